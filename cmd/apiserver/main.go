@@ -8,11 +8,13 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"world-of-wisdom/internal/apiserver"
 	"world-of-wisdom/pkg/config"
+	"world-of-wisdom/pkg/pow"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -53,8 +55,52 @@ func main() {
 	}
 	log.Println("✅ Connected to PostgreSQL database")
 
+	// Challenges may come from TCP servers whose clocks differ from ours
+	pow.SetClockSkew(cfg.ClockSkew)
+
+	// The test profile makes Argon2 cheap to forge, never in production
+	if cfg.Argon2Preset == pow.Argon2PresetTest && cfg.Environment == "production" {
+		log.Fatalf("❌ ARGON2_PRESET=test is not allowed with ENV=production")
+	}
+	if err := pow.SetArgon2Preset(cfg.Argon2Preset); err != nil {
+		log.Fatalf("❌ Invalid ARGON2_PRESET: %v", err)
+	}
+	argon2Profile, err := pow.ParseArgon2Profile(cfg.Argon2Profile)
+	if err == nil {
+		err = pow.SetArgon2Profile(argon2Profile)
+	}
+	if err != nil {
+		log.Fatalf("❌ Invalid ARGON2_PROFILE: %v", err)
+	}
+
+	// Share the TCP server's signing keys so HTTP challenges verify on any replica
+	serverCfg := apiserver.Config{
+		QueryTimeout: cfg.QueryTimeout,
+		SolveTimeSLA: cfg.SolveTimeSLA,
+		Algorithm:    cfg.Algorithm,
+		Difficulty:   cfg.Difficulty,
+		EnabledRoutes:  strings.Split(getEnv("API_ENABLED_ROUTES", ""), ","),
+		DisabledRoutes: strings.Split(getEnv("API_DISABLED_ROUTES", ""), ","),
+		AdminToken:     os.Getenv("API_ADMIN_TOKEN"),
+		VerifyAPIKey:   os.Getenv("VERIFY_API_KEY"),
+		RateLimitStateFile: os.Getenv("RATE_LIMIT_STATE_FILE"),
+		Features:       cfg.Features,
+	}
+	if masterSecret := os.Getenv("WOW_MASTER_SECRET"); masterSecret != "" {
+		keyManager, err := pow.NewDBKeyManager(dbpool, masterSecret, cfg.QueryTimeout)
+		if err != nil {
+			log.Printf("⚠️ Failed to initialize key manager, PoW endpoints disabled: %v", err)
+		} else {
+			serverCfg.KeyManager = keyManager
+			// The TCP server rotates on schedule, this only follows its rotations
+			defer close(keyManager.StartRotationScheduler(0))
+		}
+	} else {
+		log.Printf("⚠️ WOW_MASTER_SECRET not set, PoW endpoints disabled")
+	}
+
 	// Create API server with handlers
-	apiServer := apiserver.NewServer(dbpool)
+	apiServer := apiserver.NewServer(dbpool, serverCfg)
 
 	// Setup Echo routes
 	e := apiServer.SetupRoutes()
@@ -83,6 +129,7 @@ func main() {
 	if err := e.Shutdown(shutdownCtx); err != nil {
 		log.Printf("API server shutdown error: %v", err)
 	}
+	apiServer.Shutdown()
 	
 	log.Printf("✅ API server gracefully stopped")
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"log"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"world-of-wisdom/internal/client"
+	"world-of-wisdom/pkg/pow"
 )
 
 // ClientConfig holds configuration for different client types
@@ -28,6 +30,9 @@ func main() {
 		server   = flag.String("server", getEnv("SERVER_HOST", "server")+":"+getEnv("SERVER_PORT", "8080"), "Server address")
 		attempts = flag.Int("attempts", 1, "Number of quote requests")
 		timeout  = flag.Duration("timeout", 30*time.Second, "Request timeout")
+		hint     = flag.Int("difficulty-hint", getEnvInt("DIFFICULTY_HINT", 0), "Ask for challenges of at least this difficulty (0 = what the server requires)")
+		maxDiff  = flag.Int("max-difficulty", getEnvInt("MAX_ACCEPTABLE_DIFFICULTY", 0), "Decline challenges above this difficulty instead of solving them (0 = accept any)")
+		quoteKey = flag.String("quote-key", getEnv("QUOTE_KEY", ""), "Base64 HMAC key of a server running with SIGN_QUOTES; requires and verifies quote signatures (empty = don't verify)")
 	)
 	flag.Parse()
 
@@ -49,6 +54,16 @@ func main() {
 		config.SolveDelayMS, config.MaxAttempts, config.ConnectionDelayMS, config.AttackMode)
 
 	c := client.NewClient(*server, *timeout)
+	c.SetDifficultyHint(*hint)
+	c.SetMaxAcceptableDifficulty(*maxDiff)
+	if *quoteKey != "" {
+		key, err := base64.StdEncoding.DecodeString(*quoteKey)
+		if err != nil {
+			log.Fatalf("❌ Invalid quote key: %v", err)
+		}
+		c.SetQuoteVerification(pow.NewStaticKeyManager(key))
+		log.Printf("🔏 Verifying quote signatures")
+	}
 
 	// Configure retry behavior based on client type
 	switch config.ClientType {
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"world-of-wisdom/pkg/pow"
+
+	"github.com/google/uuid"
+)
+
+// printFormatStats writes the JSON and binary size of a sample challenge for every
+// algorithm and difficulty, to help choose a CHALLENGE_FORMAT
+func printFormatStats(out io.Writer) error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	keyManager := pow.NewStaticKeyManager(key)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "ALGORITHM\tDIFFICULTY\tJSON BYTES\tBINARY BYTES\tSAVED\t")
+	for _, algorithm := range []string{"sha256", "argon2"} {
+		for difficulty := 1; difficulty <= 6; difficulty++ {
+			// Client IDs are UUIDs, as issued by the server
+			challenge, err := pow.GenerateSecureChallengeWithKeyManager(difficulty, algorithm, uuid.New().String(), keyManager)
+			if err != nil {
+				return fmt.Errorf("failed to generate %s challenge: %w", algorithm, err)
+			}
+			stats, err := pow.GetFormatStats(challenge)
+			if err != nil {
+				return fmt.Errorf("failed to compute format stats: %w", err)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.1f%%\t\n", algorithm, difficulty,
+				stats["json_size"], stats["binary_size"], stats["space_saved_percent"])
+		}
+	}
+	return w.Flush()
+}
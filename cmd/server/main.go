@@ -7,26 +7,67 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"world-of-wisdom/internal/server"
 	"world-of-wisdom/pkg/config"
+	"world-of-wisdom/pkg/pow"
 )
 
 func main() {
+	// Optional KEY=VALUE file, re-read on SIGHUP for hot-reloadable settings
+	configFile := os.Getenv("CONFIG_FILE")
+	if configFile != "" {
+		if err := config.LoadEnvFile(configFile); err != nil {
+			log.Fatalf("Failed to load config file: %v", err)
+		}
+	}
+
 	var (
 		port        = flag.String("port", normalizePort(getEnv("SERVER_PORT", "8080")), "TCP port to listen on")
 		difficulty  = flag.Int("difficulty", getEnvInt("DIFFICULTY", 2), "Initial difficulty (1-6)")
-		timeout     = flag.Duration("timeout", 30*time.Second, "Client timeout")
+		timeout     = flag.Duration("timeout", 30*time.Second, "Client idle/read timeout")
 		adaptive    = flag.Bool("adaptive", getEnvBool("ADAPTIVE_MODE", true), "Enable adaptive difficulty")
 		metricsPort = flag.String("metrics-port", normalizePort(getEnv("METRICS_PORT", "2112")), "Prometheus metrics port")
 		algorithm   = flag.String("algorithm", getEnv("ALGORITHM", "argon2"), "PoW algorithm: sha256 or argon2")
+		algPolicy   = flag.String("algorithm-policy", getEnv("ALGORITHM_POLICY", ""), "Algorithm per difficulty range, e.g. 1-3:sha256,4-6:argon2 (empty = -algorithm everywhere)")
 		dbURL       = flag.String("db-url", "", "PostgreSQL connection URL (optional)")
 		format      = flag.String("format", getEnv("CHALLENGE_FORMAT", "binary"), "Challenge format: json or binary")
+		webhookURL  = flag.String("webhook-url", getEnv("WEBHOOK_URL", ""), "Optional URL notified on every solved challenge")
+		webhookKey  = flag.String("webhook-secret", getEnv("WEBHOOK_SECRET", ""), "Secret used to HMAC-sign webhook payloads")
+		maxConnsIP  = flag.Int("max-conns-per-ip", getEnvInt("MAX_CONNS_PER_IP", 0), "Concurrent connections allowed per IP (0 = unlimited)")
+		connRate    = flag.Int("max-conns-per-minute", getEnvInt("MAX_CONNECTIONS_PER_MINUTE", 0), "New connections accepted per IP per minute (0 = unlimited)")
+		issueRate   = flag.Int("challenge-issue-rate", getEnvInt("CHALLENGE_ISSUE_RATE", 0), "Challenges issued per IP per minute (0 = unlimited)")
+		allowlist   = flag.String("allowlist", getEnv("ALLOWLIST", ""), "Comma-separated IPs/CIDRs exempt from per-IP limits")
+		controller  = flag.String("difficulty-controller", getEnv("DIFFICULTY_CONTROLLER", "threshold"), "Adaptive difficulty controller: threshold or sla")
+		shadow      = flag.String("shadow-controller", getEnv("SHADOW_DIFFICULTY_CONTROLLER", ""), "Controller evaluated in shadow mode next to the active one")
+		fallback    = flag.Bool("argon2-fallback", getEnvBool("ARGON2_FALLBACK", false), "Fall back to SHA-256 when Argon2 memory is unavailable")
+		proxyProto  = flag.Bool("proxy-protocol", getEnvBool("PROXY_PROTOCOL", false), "Read PROXY protocol headers from trusted proxies")
+		proxies     = flag.String("trusted-proxies", getEnv("TRUSTED_PROXIES", ""), "Comma-separated IPs/CIDRs allowed to send PROXY headers")
+		failures    = flag.String("failure-responses", getEnv("FAILURE_RESPONSES", "terse"), "Rejected solution responses: terse or verbose")
+		surge       = flag.Int("surge-threshold", getEnvInt("SURGE_THRESHOLD", 0), "New clients per minute that raise first-time client difficulty (needs the surge_detector feature)")
+		formatStats = flag.Bool("print-format-stats", false, "Print JSON vs binary challenge sizes per algorithm and difficulty, then exit")
+		unknownDiff = flag.Int("initial-unknown-difficulty", getEnvInt("INITIAL_UNKNOWN_CLIENT_DIFFICULTY", 0), "Difficulty clients without history start at (0 = default 2)")
+		minDiff     = flag.Int("min-difficulty", getEnvInt("MIN_DIFFICULTY", 0), "Floor adaptive and per-client difficulty never drop below (0 = 1)")
+		backlog     = flag.Int("listen-backlog", getEnvInt("LISTEN_BACKLOG", 0), "TCP accept queue length (0 = OS default, Linux only)")
+		reusePort   = flag.Bool("reuse-port", getEnvBool("REUSE_PORT", false), "Set SO_REUSEPORT so several processes can share the port (Linux only)")
+		acceptors   = flag.Int("accept-listeners", getEnvInt("ACCEPT_LISTENERS", 1), "SO_REUSEPORT listeners in this process, each with its own accept loop")
+		signQuotes  = flag.Bool("sign-quotes", getEnvBool("SIGN_QUOTES", false), "Follow each quote with an HMAC signature line for trusted clients")
+		workers     = flag.Int("workers", getEnvInt("WORKERS", 0), "Worker pool size (0 = 32 per CPU)")
+		workerQueue = flag.Int("worker-queue", getEnvInt("WORKER_QUEUE", 0), "Connections waiting for a worker before new ones are shed (0 = pool size)")
+		warmup      = flag.Int("warmup-challenges", getEnvInt("WARMUP_CHALLENGES", 4), "Challenges generated at startup before accepting connections (0 = skip warm-up)")
 	)
 	flag.Parse()
 
+	if *formatStats {
+		if err := printFormatStats(os.Stdout); err != nil {
+			log.Fatalf("Failed to print format stats: %v", err)
+		}
+		return
+	}
+
 	// Load configuration for database settings
 	appConfig := config.LoadConfig()
 
@@ -37,6 +78,24 @@ func main() {
 			appConfig.PostgresPort, appConfig.PostgresDB, appConfig.PostgresSSLMode)
 	}
 
+	// Expiry checks allow for the clocks of other replicas and API servers
+	pow.SetClockSkew(appConfig.ClockSkew)
+
+	// The test profile makes Argon2 cheap to forge, never in production
+	if appConfig.Argon2Preset == pow.Argon2PresetTest && appConfig.Environment == "production" {
+		log.Fatalf("ARGON2_PRESET=test is not allowed with ENV=production")
+	}
+	if err := pow.SetArgon2Preset(appConfig.Argon2Preset); err != nil {
+		log.Fatalf("Invalid ARGON2_PRESET: %v", err)
+	}
+	argon2Profile, err := pow.ParseArgon2Profile(appConfig.Argon2Profile)
+	if err == nil {
+		err = pow.SetArgon2Profile(argon2Profile)
+	}
+	if err != nil {
+		log.Fatalf("Invalid ARGON2_PROFILE: %v", err)
+	}
+
 	cfg := server.Config{
 		Port:            *port,
 		Difficulty:      *difficulty,
@@ -45,7 +104,52 @@ func main() {
 		MetricsPort:     *metricsPort,
 		Algorithm:       *algorithm,
 		DatabaseURL:     *dbURL,
+		QueryTimeout:    appConfig.QueryTimeout,
+		SolveTimeSLA:    appConfig.SolveTimeSLA,
+		MaxSolveWait:    appConfig.MaxSolveWait,
+		MaxConnsPerIP:   *maxConnsIP,
+		MaxConnectionsPerMinute: *connRate,
+		ChallengeIssueRate: *issueRate,
+		Allowlist:       strings.Split(*allowlist, ","),
+		Argon2Fallback:  *fallback,
+		BehaviorMetricsInterval: appConfig.BehaviorMetricsInterval,
+		DifficultyController:    *controller,
+		ShadowController:        *shadow,
 		ChallengeFormat: *format,
+		WebhookURL:      *webhookURL,
+		WebhookSecret:   *webhookKey,
+		LogLevel:        appConfig.LogLevel,
+		QuotesFile:      getEnv("QUOTES_FILE", ""),
+		AdminToken:      os.Getenv("ADMIN_TOKEN"),
+		ProxyProtocol:   *proxyProto,
+		TrustedProxies:  strings.Split(*proxies, ","),
+		FailureResponses: *failures,
+		SurgeThreshold:   *surge,
+		SolveTokenTTL:    appConfig.SolveTokenTTL,
+		InitialUnknownClientDifficulty: *unknownDiff,
+		MinDifficulty:                  *minDiff,
+		HelloWait:                      appConfig.HelloWait,
+		HandshakeTimeout:               appConfig.HandshakeTimeout,
+		RespondTimeout:                 appConfig.RespondTimeout,
+		ListenBacklog:                  *backlog,
+		ReusePort:                      *reusePort,
+		AcceptListeners:                *acceptors,
+		SignQuotes:                     *signQuotes,
+		Features:                       appConfig.Features,
+		Workers:                        *workers,
+		WorkerQueue:                    *workerQueue,
+		BusyRetryAfter:                 appConfig.BusyRetryAfter,
+		WarmupChallenges:               *warmup,
+		AlgorithmPolicy:                *algPolicy,
+		ConnectionWindow:               appConfig.ConnectionWindow,
+		KeyRotationInterval:            appConfig.KeyRotationInterval,
+		Adaptive: server.AdaptiveConfig{
+			TargetSolveTime:    appConfig.AdaptiveTargetSolveTime,
+			MaxSolveTime:       appConfig.AdaptiveMaxSolveTime,
+			HighConnectionRate: appConfig.AdaptiveHighConnectionRate,
+			LowConnectionRate:  appConfig.AdaptiveLowConnectionRate,
+			AdjustEvery:        appConfig.AdaptiveAdjustEvery,
+		},
 	}
 
 	srv, err := server.NewServer(cfg)
@@ -60,14 +164,54 @@ func main() {
 	}()
 
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		reload(srv, configFile, cfg)
+	}
 
 	if err := srv.Shutdown(); err != nil {
 		log.Printf("Error during shutdown: %v", err)
 	}
 }
 
+// reload re-reads the config file and applies the settings that can change at runtime.
+// Values that need a restart are left as they are.
+func reload(srv *server.Server, configFile string, cfg server.Config) {
+	log.Println("Received SIGHUP, reloading config")
+
+	if configFile != "" {
+		if err := config.LoadEnvFile(configFile); err != nil {
+			log.Printf("Reload aborted: %v", err)
+			return
+		}
+	}
+
+	if port := normalizePort(getEnv("SERVER_PORT", cfg.Port)); port != cfg.Port {
+		log.Printf("⚠️ SERVER_PORT changed to %s, restart to apply (still listening on %s)", port, cfg.Port)
+	}
+	if algorithm := getEnv("ALGORITHM", cfg.Algorithm); algorithm != cfg.Algorithm {
+		log.Printf("⚠️ ALGORITHM changed to %s, restart to apply (still using %s)", algorithm, cfg.Algorithm)
+	}
+	if policy := getEnv("ALGORITHM_POLICY", cfg.AlgorithmPolicy); policy != cfg.AlgorithmPolicy {
+		log.Printf("⚠️ ALGORITHM_POLICY changed to %s, restart to apply (still using %q)", policy, cfg.AlgorithmPolicy)
+	}
+
+	// Unset keys fall back to the startup values, which may have come from flags
+	err := srv.Reload(server.ReloadConfig{
+		MaxConnsPerIP:           getEnvInt("MAX_CONNS_PER_IP", cfg.MaxConnsPerIP),
+		MaxConnectionsPerMinute: getEnvInt("MAX_CONNECTIONS_PER_MINUTE", cfg.MaxConnectionsPerMinute),
+		ChallengeIssueRate:      getEnvInt("CHALLENGE_ISSUE_RATE", cfg.ChallengeIssueRate),
+		Allowlist:               strings.Split(getEnv("ALLOWLIST", strings.Join(cfg.Allowlist, ",")), ","),
+		LogLevel:                getEnv("LOG_LEVEL", cfg.LogLevel),
+	})
+	if err != nil {
+		log.Printf("Reload aborted, keeping current config: %v", err)
+	}
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,125 @@
+package apiserver
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"world-of-wisdom/internal/behavior"
+	generated "world-of-wisdom/internal/database/generated"
+)
+
+const (
+	defaultAttackerSuspicious = 50.0
+	defaultAttackerLimit      = 50
+	maxAttackerLimit          = 500
+)
+
+// attackerSorts are the sort orders the GetAttackers query understands
+var attackerSorts = map[string]bool{
+	"suspicious_score": true,
+	"failure_rate":     true,
+	"connections":      true,
+	"difficulty":       true,
+}
+
+// AttackerInfo is a client that met at least one attacker threshold
+type AttackerInfo struct {
+	IP                   string  `json:"ip"`
+	Difficulty           int     `json:"difficulty"`
+	ConnectionCount      int     `json:"connectionCount"`
+	FailureRate          float64 `json:"failureRate"`
+	AvgSolveTime         int64   `json:"avgSolveTime"`
+	ReconnectRate        float64 `json:"reconnectRate"`
+	Reputation           float64 `json:"reputation"`
+	Suspicious           float64 `json:"suspicious"`
+	LastConnection       string  `json:"lastConnection"`
+	SuccessfulChallenges int     `json:"successfulChallenges"`
+	FailedChallenges     int     `json:"failedChallenges"`
+	TotalChallenges      int     `json:"totalChallenges"`
+}
+
+// GetAttackers lists clients at or above min_difficulty or min_suspicious, filtered and
+// sorted in the database
+func (s *Server) GetAttackers(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	minDifficulty := behavior.AttackerDifficulty
+	if v := c.QueryParam("min_difficulty"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > 6 {
+			return echo.NewHTTPError(http.StatusBadRequest, "min_difficulty must be between 1 and 6")
+		}
+		minDifficulty = parsed
+	}
+
+	minSuspicious := defaultAttackerSuspicious
+	if v := c.QueryParam("min_suspicious"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || parsed < 0 || parsed > 100 {
+			return echo.NewHTTPError(http.StatusBadRequest, "min_suspicious must be between 0 and 100")
+		}
+		minSuspicious = parsed
+	}
+
+	sortBy := "suspicious_score"
+	if v := c.QueryParam("sort"); v != "" {
+		if !attackerSorts[v] {
+			return echo.NewHTTPError(http.StatusBadRequest, "sort must be one of suspicious_score, failure_rate, connections, difficulty")
+		}
+		sortBy = v
+	}
+
+	limit := defaultAttackerLimit
+	if v := c.QueryParam("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxAttackerLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be between 1 and 500")
+		}
+		limit = parsed
+	}
+
+	rows, err := s.behaviorTracker.GetAttackers(ctx, generated.GetAttackersParams{
+		MinDifficulty: int32(minDifficulty),
+		MinSuspicious: minSuspicious,
+		SortBy:        sortBy,
+		MaxResults:    int32(limit),
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get attackers")
+	}
+
+	attackers := make([]AttackerInfo, len(rows))
+	for i, row := range rows {
+		attackers[i] = AttackerInfo{
+			IP:                   row.IpAddress.String(),
+			Difficulty:           int(row.Difficulty.Int32),
+			ConnectionCount:      int(row.ConnectionCount.Int32),
+			FailureRate:          row.FailureRate.Float64,
+			AvgSolveTime:         row.AvgSolveTimeMs.Int64,
+			ReconnectRate:        row.ReconnectRate.Float64,
+			Reputation:           row.ReputationScore.Float64,
+			Suspicious:           row.SuspiciousActivityScore.Float64,
+			LastConnection:       row.LastConnection.Time.Format(time.RFC3339),
+			SuccessfulChallenges: int(row.SuccessfulChallenges.Int32),
+			FailedChallenges:     int(row.FailedChallenges.Int32),
+			TotalChallenges:      int(row.TotalChallenges.Int32),
+		}
+	}
+
+	response := map[string]interface{}{
+		"data": map[string]interface{}{
+			"attackers": attackers,
+			"total":     len(attackers),
+			"thresholds": map[string]interface{}{
+				"min_difficulty": minDifficulty,
+				"min_suspicious": minSuspicious,
+			},
+			"sort": sortBy,
+		},
+		"status": "success",
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
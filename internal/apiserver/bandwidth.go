@@ -0,0 +1,75 @@
+package apiserver
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultBandwidthLimit = 20
+	maxBandwidthLimit     = 500
+)
+
+// BandwidthByIP is the traffic exchanged with one address in the last 24 hours
+type BandwidthByIP struct {
+	IP               string `json:"ip"`
+	Connections      int64  `json:"connections"`
+	BytesSent        int64  `json:"bytesSent"`
+	BytesReceived    int64  `json:"bytesReceived"`
+	MaxBytesReceived int64  `json:"maxBytesReceived"`
+}
+
+// GetBandwidth reports bytes exchanged with clients in the last 24 hours, overall and for
+// the chattiest IPs. A large received volume from one address points at oversized solution
+// payloads rather than a legitimate solver.
+func (s *Server) GetBandwidth(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	limit := defaultBandwidthLimit
+	if v := c.QueryParam("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxBandwidthLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be between 1 and 500")
+		}
+		limit = parsed
+	}
+
+	stats, err := s.repo.Connections().GetBandwidthStats(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get bandwidth stats")
+	}
+
+	rows, err := s.repo.Connections().GetBandwidthByIP(ctx, int32(limit))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get bandwidth by IP")
+	}
+
+	byIP := make([]BandwidthByIP, len(rows))
+	for i, row := range rows {
+		byIP[i] = BandwidthByIP{
+			IP:               row.RemoteAddr.String(),
+			Connections:      row.Connections,
+			BytesSent:        row.BytesSent,
+			BytesReceived:    row.BytesReceived,
+			MaxBytesReceived: row.MaxBytesReceived,
+		}
+	}
+
+	response := map[string]interface{}{
+		"data": map[string]interface{}{
+			"total": map[string]interface{}{
+				"connections":      stats.TotalConnections,
+				"bytesSent":        stats.TotalBytesSent,
+				"bytesReceived":    stats.TotalBytesReceived,
+				"avgBytesReceived": stats.AvgBytesReceived,
+				"maxBytesReceived": stats.MaxBytesReceived,
+			},
+			"byIp": byIP,
+		},
+		"status": "success",
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
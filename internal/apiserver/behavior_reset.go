@@ -0,0 +1,80 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"world-of-wisdom/internal/behavior"
+	"world-of-wisdom/internal/database/repository"
+	"world-of-wisdom/pkg/logger"
+)
+
+// adminAuth accepts requests carrying the configured admin token as a bearer token
+func (s *Server) adminAuth() echo.MiddlewareFunc {
+	return middleware.KeyAuth(func(token string, c echo.Context) (bool, error) {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1, nil
+	})
+}
+
+// ResetClientBehavior clears the penalties an IP has accumulated, for clients that were
+// misclassified such as a shared NAT gateway flagged as an attacker
+func (s *Server) ResetClientBehavior(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	ip, err := netip.ParseAddr(c.Param("ip"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid IP address")
+	}
+	ip = ip.Unmap()
+
+	cb, err := s.behaviorTracker.ResetClient(ctx, ip)
+	if errors.Is(err, behavior.ErrUnknownClient) {
+		return echo.NewHTTPError(http.StatusNotFound, "No behavior recorded for this IP")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to reset client behavior")
+	}
+
+	log.Printf("🧹 Behavior of %s reset by admin from %s", logger.SanitizeIP(ip.String()), c.RealIP())
+	s.audit(ctx, fmt.Sprintf("Client %s behavior reset by admin", ip.String()), map[string]interface{}{
+		"ip":         ip.String(),
+		"difficulty": cb.Difficulty,
+		"admin_ip":   c.RealIP(),
+		"event":      "behavior_reset",
+	})
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"ip":          ip.String(),
+			"difficulty":  cb.Difficulty,
+			"reputation":  cb.ReputationScore,
+			"suspicious":  cb.SuspiciousScore,
+			"failureRate": cb.FailureRate,
+		},
+		"status": "success",
+	})
+}
+
+// audit records an admin action in the activity log
+func (s *Server) audit(ctx context.Context, message string, metadata map[string]interface{}) {
+	metadataJSON, _ := json.Marshal(metadata)
+	_, err := s.repo.Logs().Create(ctx, repository.CreateLogParams{
+		Column1:  pgtype.Timestamptz{Time: time.Now(), Valid: true},
+		Level:    "warning",
+		Message:  message,
+		Metadata: metadataJSON,
+	})
+	if err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+	generated "world-of-wisdom/internal/database/generated"
+)
+
+// connectionEventsChannel is the NOTIFY channel of the connections triggers, see
+// migrations/008_connection_events.sql
+const connectionEventsChannel = "connection_events"
+
+// defaultStreamHeartbeat is how often an idle stream writes a heartbeat line, short
+// enough to keep proxies from closing it
+const defaultStreamHeartbeat = 15 * time.Second
+
+// connectionEvent is a connection row as published by notify_connection_event
+type connectionEvent struct {
+	Type                string     `json:"type"`
+	ID                  string     `json:"id"`
+	ClientID            string     `json:"clientId"`
+	RemoteAddr          string     `json:"remoteAddr"`
+	Status              string     `json:"status"`
+	Algorithm           string     `json:"algorithm"`
+	ConnectedAt         time.Time  `json:"connectedAt"`
+	DisconnectedAt      *time.Time `json:"disconnectedAt"`
+	ChallengesAttempted int        `json:"challengesAttempted"`
+	ChallengesCompleted int        `json:"challengesCompleted"`
+	BytesSent           int64      `json:"bytesSent"`
+	BytesReceived       int64      `json:"bytesReceived"`
+}
+
+// notificationSource delivers notification payloads until ctx is done or it fails
+type notificationSource func(ctx context.Context, deliver func(payload string)) error
+
+// listenNotifications takes a connection out of the pool, LISTENs on channel and delivers
+// its notifications. The connection is closed afterwards rather than returned still listening.
+func listenNotifications(pool *pgxpool.Pool, channel string) notificationSource {
+	return func(ctx context.Context, deliver func(string)) error {
+		pooled, err := pool.Acquire(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to acquire connection: %w", err)
+		}
+		conn := pooled.Hijack()
+		defer conn.Close(context.Background())
+
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", channel, err)
+		}
+		for {
+			notification, err := conn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+			deliver(notification.Payload)
+		}
+	}
+}
+
+// connectionFeed fans connection events out to the open streams. The database is only
+// listened to while at least one stream is open.
+type connectionFeed struct {
+	source notificationSource
+
+	mu   sync.Mutex
+	subs map[chan connectionEvent]struct{}
+	stop context.CancelFunc
+}
+
+func newConnectionFeed(source notificationSource) *connectionFeed {
+	return &connectionFeed{
+		source: source,
+		subs:   make(map[chan connectionEvent]struct{}),
+	}
+}
+
+// subscribe returns a channel of events and a function that unsubscribes it
+func (f *connectionFeed) subscribe() (<-chan connectionEvent, func()) {
+	ch := make(chan connectionEvent, 64)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subs[ch] = struct{}{}
+	if len(f.subs) == 1 {
+		ctx, cancel := context.WithCancel(context.Background())
+		f.stop = cancel
+		go f.run(ctx)
+	}
+
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.subs, ch)
+		if len(f.subs) == 0 && f.stop != nil {
+			f.stop()
+			f.stop = nil
+		}
+	}
+}
+
+// run listens until the last stream closes, reconnecting after failures
+func (f *connectionFeed) run(ctx context.Context) {
+	for {
+		err := f.source(ctx, f.publish)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("⚠️ Connection event listener failed, retrying: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// publish hands a notification to every stream, streams that fall behind miss it
+func (f *connectionFeed) publish(payload string) {
+	var event connectionEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		log.Printf("Failed to decode connection event: %v", err)
+		return
+	}
+	event.Type = "connection"
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// validConnectionStatus reports whether status is a connection_status value
+func validConnectionStatus(status string) bool {
+	switch generated.ConnectionStatus(status) {
+	case generated.ConnectionStatusConnected, generated.ConnectionStatusSolving,
+		generated.ConnectionStatusDisconnected, generated.ConnectionStatusFailed:
+		return true
+	}
+	return false
+}
+
+// StreamConnections writes connection lifecycle events as newline-delimited JSON as they
+// happen, with a heartbeat line while idle. ?status= only passes events entering that status.
+func (s *Server) StreamConnections(c echo.Context) error {
+	status := c.QueryParam("status")
+	if status != "" && !validConnectionStatus(status) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid status filter")
+	}
+	if s.connectionFeed == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Connection stream unavailable")
+	}
+
+	events, unsubscribe := s.connectionFeed.subscribe()
+	defer unsubscribe()
+
+	interval := s.streamHeartbeat
+	if interval <= 0 {
+		interval = defaultStreamHeartbeat
+	}
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	enc := json.NewEncoder(res)
+	for {
+		var line interface{}
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case event := <-events:
+			if status != "" && event.Status != status {
+				continue
+			}
+			line = event
+		case now := <-heartbeat.C:
+			line = map[string]interface{}{"type": "heartbeat", "time": now.UTC()}
+		}
+
+		// A failed write means the client went away
+		if err := enc.Encode(line); err != nil {
+			return nil
+		}
+		res.Flush()
+	}
+}
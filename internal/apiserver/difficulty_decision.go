@@ -0,0 +1,40 @@
+package apiserver
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+
+	"github.com/labstack/echo/v4"
+	"world-of-wisdom/internal/behavior"
+)
+
+// GetDifficultyDecision explains the difficulty of the most recent challenge issued to an
+// IP: the stored difficulty it started from and every factor that moved it
+func (s *Server) GetDifficultyDecision(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	ip, err := netip.ParseAddr(c.Param("ip"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid IP address")
+	}
+	ip = ip.Unmap()
+
+	decision, issuedAt, err := s.behaviorTracker.LatestDecision(ctx, ip)
+	if errors.Is(err, behavior.ErrNoDecision) {
+		return echo.NewHTTPError(http.StatusNotFound, "No difficulty decision recorded for this IP")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get difficulty decision")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"ip":       ip.String(),
+			"issuedAt": issuedAt,
+			"decision": decision,
+			"summary":  decision.String(),
+		},
+		"status": "success",
+	})
+}
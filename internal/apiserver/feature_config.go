@@ -0,0 +1,18 @@
+package apiserver
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetConfig reports which experimental features this deployment runs with. It is read-only,
+// features are switched with FEATURES or FEATURE_<NAME> and a restart.
+func (s *Server) GetConfig(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"features": s.features.List(),
+		},
+		"status": "success",
+	})
+}
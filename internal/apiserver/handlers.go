@@ -1,13 +1,18 @@
 package apiserver
 
 import (
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"world-of-wisdom/internal/database"
 	"world-of-wisdom/internal/database/repository"
 	"world-of-wisdom/internal/behavior"
+	"world-of-wisdom/pkg/config"
+	"world-of-wisdom/pkg/pow"
+	"world-of-wisdom/pkg/wisdom"
 	"github.com/jackc/pgx/v5/pgxpool"
 	generated "world-of-wisdom/internal/database/generated"
 )
@@ -16,14 +21,133 @@ type Server struct {
 	db              *pgxpool.Pool
 	repo            repository.Repository
 	behaviorTracker *behavior.Tracker
+	queryTimeout    time.Duration
+	solveTimeSLA    time.Duration
+
+	// HTTP proof-of-work flow, disabled when no key manager is configured
+	keyManager    pow.KeyManager
+	pipeline      *pow.ValidationPipeline
+	powAlgorithm  string
+	powDifficulty int
+	quoteProvider *wisdom.QuoteProvider
+	rateLimitFile string         // Where the pipeline's rate-limit windows are kept across restarts, empty keeps them in memory only
+	stopCleanup   chan struct{}  // Stops the pipeline's cleanup of expired rate limits and challenges
+
+	// Route names served or withheld, see routeGate
+	enabledRoutes  []string
+	disabledRoutes []string
+
+	// Bearer token for admin endpoints, which are not served without one
+	adminToken string
+
+	// Bearer token for /pow/verify, which is not served without one
+	verifyAPIKey string
+
+	// Experimental features reported by /config
+	features config.Features
+
+	// Live connection events for /connections/stream
+	connectionFeed  *connectionFeed
+	streamHeartbeat time.Duration // Idle interval between heartbeat lines (default 15s)
+}
+
+// Config configures the API server
+type Config struct {
+	QueryTimeout time.Duration // Deadline for the database work of a single request (default 5s)
+	SolveTimeSLA time.Duration // Solve-time target for low-difficulty clients (default 3s)
+
+	// HTTP challenge endpoints
+	KeyManager pow.KeyManager // Signing keys shared with the TCP server, nil disables the endpoints
+	Algorithm  string         // "sha256" or "argon2"
+	Difficulty int            // Difficulty of issued challenges (1-6)
+
+	// Optional file the solve rate limits are saved to on shutdown and restored from on
+	// startup, so a restart doesn't reset them
+	RateLimitStateFile string
+
+	// Route names below /api/v1 with dots for slashes (e.g. "experiment", "pow.solve"),
+	// a name covers every route below it
+	EnabledRoutes  []string // If set, only these routes are served
+	DisabledRoutes []string // Routes never served, applied after EnabledRoutes
+
+	AdminToken   string // Bearer token required by admin endpoints, empty disables them
+	VerifyAPIKey string // Bearer token external issuers send to /pow/verify, empty disables it
+
+	Features config.Features // Experimental features, reported read-only by /api/v1/config
 }
 
-func NewServer(database *pgxpool.Pool) *Server {
-	return &Server{
-		db:              database,
-		repo:            repository.New(database),
-		behaviorTracker: behavior.NewTracker(database),
+func NewServer(db *pgxpool.Pool, cfg Config) *Server {
+	queryTimeout := cfg.QueryTimeout
+	if queryTimeout <= 0 {
+		queryTimeout = database.DefaultQueryTimeout
 	}
+
+	solveTimeSLA := cfg.SolveTimeSLA
+	if solveTimeSLA <= 0 {
+		solveTimeSLA = 3 * time.Second
+	}
+
+	behaviorTracker := behavior.NewTracker(db)
+	behaviorTracker.SetQueryTimeout(queryTimeout)
+
+	s := &Server{
+		db:              db,
+		repo:            repository.New(db),
+		behaviorTracker: behaviorTracker,
+		queryTimeout:    queryTimeout,
+		solveTimeSLA:    solveTimeSLA,
+		keyManager:      cfg.KeyManager,
+		powAlgorithm:    cfg.Algorithm,
+		powDifficulty:   cfg.Difficulty,
+		quoteProvider:   wisdom.NewQuoteProvider(),
+		enabledRoutes:   cfg.EnabledRoutes,
+		disabledRoutes:  cfg.DisabledRoutes,
+		adminToken:      cfg.AdminToken,
+		verifyAPIKey:    cfg.VerifyAPIKey,
+		features:        cfg.Features,
+		rateLimitFile:   cfg.RateLimitStateFile,
+		connectionFeed:  newConnectionFeed(listenNotifications(db, connectionEventsChannel)),
+	}
+
+	if s.keyManager != nil {
+		s.pipeline = pow.NewValidationPipelineWithKeyManager(s.keyManager)
+
+		// Challenges already redeemed, shared with the TCP server through the database
+		if db != nil {
+			s.pipeline.SetReplayStore(pow.NewDBNonceStore(db, queryTimeout))
+		} else {
+			s.pipeline.SetReplayStore(pow.NewMemoryNonceStore())
+		}
+		s.stopCleanup = s.pipeline.StartCleanupRoutine()
+		if s.rateLimitFile != "" {
+			restored, err := s.pipeline.LoadRateLimits(s.rateLimitFile)
+			if err != nil {
+				log.Printf("⚠️ Starting with fresh rate limits: %v", err)
+			} else {
+				log.Printf("Restored %d rate limit windows from %s", restored, s.rateLimitFile)
+			}
+		}
+	}
+
+	return s
+}
+
+// Shutdown stops the pipeline's cleanup and saves the rate limits when a state file is
+// configured, call it once the HTTP server has stopped taking requests
+func (s *Server) Shutdown() {
+	if s.stopCleanup != nil {
+		close(s.stopCleanup)
+		s.stopCleanup = nil
+	}
+	if s.pipeline == nil || s.rateLimitFile == "" {
+		return
+	}
+	saved, err := s.pipeline.SaveRateLimits(s.rateLimitFile)
+	if err != nil {
+		log.Printf("⚠️ Failed to save rate limits: %v", err)
+		return
+	}
+	log.Printf("Saved %d rate limit windows to %s", saved, s.rateLimitFile)
 }
 
 func (s *Server) GetHealth(c echo.Context) error {
@@ -39,36 +163,22 @@ func (s *Server) GetHealth(c echo.Context) error {
 		status = Degraded
 	}
 	
-	// Calculate active challenges (pending + solving)
-	activeChallenges := int(challengeStats.PendingCount + challengeStats.SolvingCount)
-	liveConnections := int(connectionStats.ActiveConnections)
-	totalBlocks := int(challengeStats.CompletedCount)
-	miningActive := true
-	
 	// Get current difficulty from most recent challenge
 	difficulty := 2 // default
 	recentChallenges, err := s.repo.Challenges().GetRecent(ctx, 1)
 	if err == nil && len(recentChallenges) > 0 {
 		difficulty = int(recentChallenges[0].Difficulty)
 	}
-	algorithm := HealthDataAlgorithmArgon2
 	
-	healthData := HealthData{
+	return c.JSON(http.StatusOK, newHealthResponse(HealthData{
 		Status:           &status,
-		MiningActive:     &miningActive,
-		TotalBlocks:      &totalBlocks,
-		ActiveChallenges: &activeChallenges,
-		LiveConnections:  &liveConnections,
-		Algorithm:        &algorithm,
+		MiningActive:     ptr(true),
+		TotalBlocks:      ptr(int(challengeStats.CompletedCount)),
+		ActiveChallenges: ptr(int(challengeStats.PendingCount + challengeStats.SolvingCount)), // pending + solving
+		LiveConnections:  ptr(int(connectionStats.ActiveConnections)),
+		Algorithm:        ptr(HealthDataAlgorithmArgon2),
 		Difficulty:       &difficulty,
-	}
-	
-	response := HealthResponse{
-		Data:   &healthData,
-		Status: HealthResponseStatusSuccess,
-	}
-	
-	return c.JSON(http.StatusOK, response)
+	}))
 }
 
 func (s *Server) GetStats(c echo.Context) error {
@@ -77,12 +187,6 @@ func (s *Server) GetStats(c echo.Context) error {
 	// Get all required stats
 	challengeStats, _ := s.repo.Challenges().GetStats(ctx)
 	connectionStats, _ := s.repo.Connections().GetStats(ctx)
-	// Get solution statistics instead of blockchain stats
-	
-	// Convert types properly
-	totalChallenges := int(challengeStats.TotalCount)
-	completedChallenges := int(challengeStats.CompletedCount)
-	averageSolveTime := float32(challengeStats.AvgSolveTimeMs)
 	
 	// Get current difficulty from most recent challenge
 	currentDifficulty := 2 // default
@@ -90,48 +194,42 @@ func (s *Server) GetStats(c echo.Context) error {
 	if err == nil && len(recentChallenges) > 0 {
 		currentDifficulty = int(recentChallenges[0].Difficulty)
 	}
-	hashRate := float32(0.0)
-	
-	totalConnections := int(connectionStats.TotalConnections)
-	activeConnections := int(connectionStats.ActiveConnections)
-	
-	activeChallengesCount := int(challengeStats.PendingCount + challengeStats.SolvingCount)
 	
-	miningActive := true
-	algorithm := "argon2"
-	intensity := 2
-	activeMiners := int(connectionStats.ActiveConnections)
+	// Omitted rather than failing the stats when the behavior query does
+	var distribution *map[string]int
+	if s.behaviorTracker != nil {
+		if byDifficulty, err := s.behaviorTracker.DifficultyDistribution(ctx); err == nil {
+			counts := make(map[string]int, len(byDifficulty))
+			for difficulty, clients := range byDifficulty {
+				counts[strconv.Itoa(difficulty)] = clients
+			}
+			distribution = &counts
+		}
+	}
 	
-	// Build stats response
-	statsData := StatsData{
+	return c.JSON(http.StatusOK, newStatsResponse(StatsData{
+		DifficultyDistribution: distribution,
 		Stats: &MiningStats{
-			TotalChallenges:     &totalChallenges,
-			CompletedChallenges: &completedChallenges,
-			AverageSolveTime:    &averageSolveTime,
+			TotalChallenges:     ptr(int(challengeStats.TotalCount)),
+			CompletedChallenges: ptr(int(challengeStats.CompletedCount)),
+			AverageSolveTime:    ptr(float32(challengeStats.AvgSolveTimeMs)),
 			CurrentDifficulty:   &currentDifficulty,
-			HashRate:            &hashRate,
+			HashRate:            ptr(float32(0)),
 		},
-		MiningActive: &miningActive,
+		MiningActive: ptr(true),
 		Connections: &ConnectionStats{
-			Total:  &totalConnections,
-			Active: &activeConnections,
+			Total:  ptr(int(connectionStats.TotalConnections)),
+			Active: ptr(int(connectionStats.ActiveConnections)),
 		},
 		Challenges: &ChallengeStats{
-			Active: &activeChallengesCount,
+			Active: ptr(int(challengeStats.PendingCount + challengeStats.SolvingCount)),
 		},
 		System: &SystemStats{
-			Algorithm:     &algorithm,
-			Intensity:     &intensity,
-			ActiveMiners:  &activeMiners,
+			Algorithm:    ptr("argon2"),
+			Intensity:    ptr(2),
+			ActiveMiners: ptr(int(connectionStats.ActiveConnections)),
 		},
-	}
-	
-	response := StatsResponse{
-		Data:   &statsData,
-		Status: Success,
-	}
-	
-	return c.JSON(http.StatusOK, response)
+	}))
 }
 
 func (s *Server) GetChallenges(c echo.Context) error {
@@ -188,55 +286,24 @@ func (s *Server) GetChallenges(c echo.Context) error {
 	// Convert to API format
 	challengeDetails := make([]ChallengeDetail, len(challenges))
 	for i, ch := range challenges {
-		id := ch.ID.String()
-		difficulty := int(ch.Difficulty)
-		algorithm := ChallengeDetailAlgorithm(ch.Algorithm)
-		status := ChallengeDetailStatus(ch.Status)
-		
-		var createdAt, expiresAt *time.Time
-		if ch.CreatedAt.Valid {
-			createdAt = &ch.CreatedAt.Time
-		}
-		if ch.ExpiresAt.Valid {
-			expiresAt = &ch.ExpiresAt.Time
-		}
-		
 		challengeDetails[i] = ChallengeDetail{
-			Id:          &id,
-			Seed:        &ch.Seed,
-			Difficulty:  &difficulty,
-			Algorithm:   &algorithm,
-			ClientId:    &ch.ClientID,
-			Status:      &status,
-			CreatedAt:   createdAt,
-			ExpiresAt:   expiresAt,
-			SolvedAt:    nil,
-			SolveTimeMs: nil,
+			Id:         ptr(ch.ID.String()),
+			Seed:       &ch.Seed,
+			Difficulty: ptr(int(ch.Difficulty)),
+			Algorithm:  ptr(ChallengeDetailAlgorithm(ch.Algorithm)),
+			ClientId:   &ch.ClientID,
+			Status:     ptr(ChallengeDetailStatus(ch.Status)),
+			CreatedAt:  optionalTime(ch.CreatedAt),
+			ExpiresAt:  optionalTime(ch.ExpiresAt),
+			SolvedAt:   optionalTime(ch.SolvedAt),
 		}
 		
-		if ch.SolvedAt.Valid {
-			challengeDetails[i].SolvedAt = &ch.SolvedAt.Time
-			if ch.SolveTimeMs > 0 {
-				solveTime := int(ch.SolveTimeMs)
-				challengeDetails[i].SolveTimeMs = &solveTime
-			}
+		if ch.SolvedAt.Valid && ch.SolveTimeMs > 0 {
+			challengeDetails[i].SolveTimeMs = ptr(int(ch.SolveTimeMs))
 		}
 	}
 	
-	total := len(challenges)
-	
-	response := ChallengesResponse{
-		Data: &struct {
-			Challenges *[]ChallengeDetail `json:"challenges,omitempty"`
-			Total      *int               `json:"total,omitempty"`
-		}{
-			Challenges: &challengeDetails,
-			Total:      &total,
-		},
-		Status: ChallengesResponseStatusSuccess,
-	}
-	
-	return c.JSON(http.StatusOK, response)
+	return c.JSON(http.StatusOK, newChallengesResponse(challengeDetails))
 }
 
 func (s *Server) GetConnections(c echo.Context) error {
@@ -263,56 +330,26 @@ func (s *Server) GetConnections(c echo.Context) error {
 	// Convert to API format
 	connectionDetails := make([]ConnectionDetail, len(connections))
 	for i, conn := range connections {
-		id := conn.ID.String()
-		remoteAddr := conn.RemoteAddr.String()
-		status := ConnectionDetailStatus(conn.Status)
-		algorithm := ConnectionDetailAlgorithm(conn.Algorithm)
-		
-		var connectedAt, disconnectedAt *time.Time
-		if conn.ConnectedAt.Valid {
-			connectedAt = &conn.ConnectedAt.Time
-		}
-		if conn.DisconnectedAt.Valid {
-			disconnectedAt = &conn.DisconnectedAt.Time
-		}
-		
-		challengesAttempted := int(conn.ChallengesAttempted.Int32)
-		challengesCompleted := int(conn.ChallengesCompleted.Int32) 
-		totalSolveTimeMs := int(conn.TotalSolveTimeMs.Int64)
-		
 		connectionDetails[i] = ConnectionDetail{
-			Id:                  &id,
+			Id:                  ptr(conn.ID.String()),
 			ClientId:            &conn.ClientID,
-			RemoteAddr:          &remoteAddr,
-			Status:              &status,
-			Algorithm:           &algorithm,
-			ConnectedAt:         connectedAt,
-			DisconnectedAt:      disconnectedAt,
-			ChallengesAttempted: &challengesAttempted,
-			ChallengesCompleted: &challengesCompleted,
-			TotalSolveTimeMs:    &totalSolveTimeMs,
+			RemoteAddr:          ptr(conn.RemoteAddr.String()),
+			Status:              ptr(ConnectionDetailStatus(conn.Status)),
+			Algorithm:           ptr(ConnectionDetailAlgorithm(conn.Algorithm)),
+			ConnectedAt:         optionalTime(conn.ConnectedAt),
+			DisconnectedAt:      optionalTime(conn.DisconnectedAt),
+			ChallengesAttempted: ptr(int(conn.ChallengesAttempted.Int32)),
+			ChallengesCompleted: ptr(int(conn.ChallengesCompleted.Int32)),
+			TotalSolveTimeMs:    ptr(int(conn.TotalSolveTimeMs.Int64)),
+			BytesSent:           ptr(int(conn.BytesSent.Int64)),
+			BytesReceived:       ptr(int(conn.BytesReceived.Int64)),
 		}
 	}
 	
 	// Get stats for totals
 	stats, _ := s.repo.Connections().GetStats(ctx)
-	totalConnections := int(stats.TotalConnections)
-	activeConnections := int(stats.ActiveConnections)
-	
-	response := ConnectionsResponse{
-		Data: &struct {
-			Active      *int                `json:"active,omitempty"`
-			Connections *[]ConnectionDetail `json:"connections,omitempty"`
-			Total       *int                `json:"total,omitempty"`
-		}{
-			Connections: &connectionDetails,
-			Total:       &totalConnections,
-			Active:      &activeConnections,
-		},
-		Status: ConnectionsResponseStatusSuccess,
-	}
 	
-	return c.JSON(http.StatusOK, response)
+	return c.JSON(http.StatusOK, newConnectionsResponse(connectionDetails, int(stats.TotalConnections), int(stats.ActiveConnections)))
 }
 
 func (s *Server) GetMetrics(c echo.Context) error {
@@ -327,15 +364,10 @@ func (s *Server) GetMetrics(c echo.Context) error {
 	// Convert to API format
 	metricData := make([]MetricData, len(metrics))
 	for i, m := range metrics {
-		var timestamp *time.Time
-		if m.Time.Valid {
-			timestamp = &m.Time.Time
-		}
-		
 		value := float32(m.MetricValue)
 		
 		metricData[i] = MetricData{
-			Time:       timestamp,
+			Time:       optionalTime(m.Time),
 			MetricName: &m.MetricName,
 			Value:      &value,
 			AvgValue:   &value,  // Simplified
@@ -345,16 +377,7 @@ func (s *Server) GetMetrics(c echo.Context) error {
 		}
 	}
 	
-	response := MetricsResponse{
-		Data: &struct {
-			Metrics *[]MetricData `json:"metrics,omitempty"`
-		}{
-			Metrics: &metricData,
-		},
-		Status: MetricsResponseStatusSuccess,
-	}
-	
-	return c.JSON(http.StatusOK, response)
+	return c.JSON(http.StatusOK, newMetricsResponse(metricData))
 }
 
 func (s *Server) GetRecentSolves(c echo.Context) error {
@@ -369,36 +392,74 @@ func (s *Server) GetRecentSolves(c echo.Context) error {
 	// Convert solutions to block-like format for UI compatibility
 	blocks := make([]Block, len(solutions))
 	for i, sol := range solutions {
-		index := i
-		var timestamp *int64
-		if sol.CreatedAt.Valid {
-			ts := sol.CreatedAt.Time.Unix()
-			timestamp = &ts
-		}
-		
-		quote := "Wisdom through proof of work"
-		previousHash := "0000000000000000000000000000000000000000000000000000000000000000"
-		var hash string
-		if sol.Hash.Valid {
-			hash = sol.Hash.String
-		}
-		
 		blocks[i] = Block{
-			Index:        &index,
-			Timestamp:    timestamp,
+			Index:        ptr(i),
+			Timestamp:    optionalUnix(sol.CreatedAt),
 			Challenge:    nil, // TODO: Load challenge details
 			Solution:     nil, // TODO: Load solution details
-			Quote:        &quote,
-			PreviousHash: &previousHash,
-			Hash:         &hash,
+			Quote:        ptr("Wisdom through proof of work"),
+			PreviousHash: ptr("0000000000000000000000000000000000000000000000000000000000000000"),
+			Hash:         ptr(sol.Hash.String), // Empty when NULL
 		}
 	}
 	
-	response := RecentSolvesResponse{
-		Data:   &blocks,
-		Status: RecentSolvesResponseStatusSuccess,
+	return c.JSON(http.StatusOK, newRecentSolvesResponse(blocks))
+}
+
+// GetDifficultyDeltas reports required vs achieved difficulty for recent solutions.
+// Consistent over-solving can mean a client is probing timing; any accepted solution
+// below its required difficulty is a verification bug and is listed under violations.
+func (s *Server) GetDifficultyDeltas(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	distribution, err := s.repo.Solutions().GetAchievedDifficultyDistribution(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get difficulty distribution")
 	}
-	
+
+	violations, err := s.repo.Solutions().GetAchievedDifficultyViolations(ctx, 50)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get difficulty violations")
+	}
+
+	var accepted, exact, overSolved, underSolved int64
+	buckets := make([]map[string]interface{}, len(distribution))
+	for i, row := range distribution {
+		delta := row.AchievedDifficulty - row.RequiredDifficulty
+		buckets[i] = map[string]interface{}{
+			"required_difficulty": row.RequiredDifficulty,
+			"achieved_difficulty": row.AchievedDifficulty,
+			"delta":               delta,
+			"verified":            row.Verified,
+			"solutions":           row.Solutions,
+		}
+
+		if !row.Verified {
+			continue
+		}
+		accepted += row.Solutions
+		switch {
+		case delta > 0:
+			overSolved += row.Solutions
+		case delta < 0:
+			underSolved += row.Solutions
+		default:
+			exact += row.Solutions
+		}
+	}
+
+	response := map[string]interface{}{
+		"distribution": buckets,
+		"summary": map[string]interface{}{
+			"accepted":     accepted,
+			"exact":        exact,
+			"over_solved":  overSolved,
+			"under_solved": underSolved,
+		},
+		"violations": violations,
+		"healthy":    len(violations) == 0,
+	}
+
 	return c.JSON(http.StatusOK, response)
 }
 
@@ -422,29 +483,15 @@ func (s *Server) GetLogs(c echo.Context) error {
 	// Convert to API format
 	logMessages := make([]LogMessage, len(logs))
 	for i, log := range logs {
-		var timestamp *int64
-		if log.Timestamp.Valid {
-			ts := log.Timestamp.Time.Unix()
-			timestamp = &ts
-		}
-		
-		level := LogMessageLevel(log.Level)
-		icon := "📝"
-		
 		logMessages[i] = LogMessage{
-			Timestamp: timestamp,
-			Level:     &level,
+			Timestamp: optionalUnix(log.Timestamp),
+			Level:     ptr(LogMessageLevel(log.Level)),
 			Message:   &log.Message,
-			Icon:      &icon,
+			Icon:      ptr("📝"),
 		}
 	}
 	
-	response := LogsResponse{
-		Data:   &logMessages,
-		Status: LogsResponseStatusSuccess,
-	}
-	
-	return c.JSON(http.StatusOK, response)
+	return c.JSON(http.StatusOK, newLogsResponse(logMessages))
 }
 
 func (s *Server) GetClientBehaviors(c echo.Context) error {
@@ -565,39 +612,22 @@ func (s *Server) GetExperimentSummary(c echo.Context) error {
 		scenario = "morning-rush"
 	}
 
-	// Get current client behaviors
-	behaviors, err := s.behaviorTracker.GetActiveClients(ctx, 1000)
+	// Aggregated over every client seen in the last hour
+	summary, err := s.behaviorTracker.GetActiveClientSummary(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get client behaviors")
 	}
 
-	// Calculate distribution
 	distribution := struct {
-		Normal     int `json:"normal"`
-		PowerUser  int `json:"power_user"`
-		Suspicious int `json:"suspicious"`
-		Attacker   int `json:"attacker"`
-	}{}
-	
-	totalDifficulty := 0.0
-	for _, behavior := range behaviors {
-		diff := int(behavior.Difficulty.Int32)
-		totalDifficulty += float64(diff)
-		switch {
-		case diff <= 2:
-			distribution.Normal++
-		case diff == 3:
-			distribution.PowerUser++
-		case diff == 4:
-			distribution.Suspicious++
-		default:
-			distribution.Attacker++
-		}
-	}
-
-	avgDifficulty := 0.0
-	if len(behaviors) > 0 {
-		avgDifficulty = totalDifficulty / float64(len(behaviors))
+		Normal     int64 `json:"normal"`
+		PowerUser  int64 `json:"power_user"`
+		Suspicious int64 `json:"suspicious"`
+		Attacker   int64 `json:"attacker"`
+	}{
+		Normal:     summary.NormalClients,
+		PowerUser:  summary.PowerUsers,
+		Suspicious: summary.SuspiciousClients,
+		Attacker:   summary.Attackers,
 	}
 
 	// Get scenario info
@@ -657,11 +687,11 @@ func (s *Server) GetExperimentSummary(c echo.Context) error {
 		"icon":                info.Icon,
 		"color":               info.Color,
 		"expected_behavior":   info.ExpectedBehavior,
-		"total_clients":       len(behaviors),
+		"total_clients":       summary.TotalClients,
 		"client_distribution": distribution,
-		"avg_difficulty":      avgDifficulty,
+		"avg_difficulty":      summary.AvgDifficulty,
 		"metrics": map[string]interface{}{
-			"active_connections": len(behaviors),
+			"active_connections": summary.TotalClients,
 			"timestamp":          time.Now().Unix(),
 		},
 	}
@@ -669,37 +699,39 @@ func (s *Server) GetExperimentSummary(c echo.Context) error {
 	return c.JSON(http.StatusOK, response)
 }
 
+// slaBreachBudget is the share of low-difficulty solves allowed to exceed the SLA
+const slaBreachBudget = 0.05
+
 func (s *Server) GetSuccessCriteria(c echo.Context) error {
 	ctx := c.Request().Context()
 	
-	behaviors, err := s.behaviorTracker.GetActiveClients(ctx, 1000)
+	summary, err := s.behaviorTracker.GetActiveClientSummary(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get client behaviors")
 	}
 
-	// Calculate metrics
-	normalUsers := 0
-	attackers := 0
-	totalNormalSolveTime := float64(0)
-	falsePositives := 0
+	normalUsers := summary.NormalClients
+	attackers := summary.Attackers
+	avgNormalSolve := summary.AvgNormalSolveTimeMs
+	falsePositives := summary.FalsePositives
 
-	for _, b := range behaviors {
-		diff := int(b.Difficulty.Int32)
-		if diff <= 2 {
-			normalUsers++
-			totalNormalSolveTime += float64(b.AvgSolveTimeMs.Int64)
-		} else if diff >= 5 {
-			attackers++
-		}
-		if diff >= 4 && b.FailureRate.Float64 < 0.3 {
-			falsePositives++
-		}
+	// Solves by low-difficulty clients that exceeded the SLA, by difficulty
+	slaBreaches, err := s.repo.Solutions().GetSLABreaches(ctx, repository.GetSLABreachesParams{
+		SlaMs:         s.solveTimeSLA.Milliseconds(),
+		MaxDifficulty: config.SLAMaxDifficulty,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get SLA breaches")
 	}
 
-	avgNormalSolve := float64(0)
-	if normalUsers > 0 {
-		avgNormalSolve = totalNormalSolveTime / float64(normalUsers)
-	}
+	var totalSolves, totalBreaches int64
+	breachesByDifficulty := map[string]int64{}
+	for _, row := range slaBreaches {
+		totalSolves += row.TotalSolves
+		totalBreaches += row.Breaches
+		breachesByDifficulty[strconv.Itoa(int(row.Difficulty))] = row.Breaches
+	}
+	slaLabel := s.solveTimeSLA.String()
 
 	// Build criteria
 	categories := []map[string]interface{}{
@@ -709,17 +741,17 @@ func (s *Server) GetSuccessCriteria(c echo.Context) error {
 				{
 					"label": "Normal users maintain difficulty 1-2",
 					"pass":  normalUsers > 0,
-					"value": strconv.Itoa(normalUsers) + " normal users",
+					"value": strconv.FormatInt(normalUsers, 10) + " normal users",
 				},
 				{
 					"label": "Attackers reach difficulty 5-6",
 					"pass":  attackers > 0,
-					"value": strconv.Itoa(attackers) + " detected",
+					"value": strconv.FormatInt(attackers, 10) + " detected",
 				},
 				{
 					"label": "System responsive under load",
-					"pass":  len(behaviors) < 200,
-					"value": strconv.Itoa(len(behaviors)) + " connections",
+					"pass":  summary.TotalClients < 200,
+					"value": strconv.FormatInt(summary.TotalClients, 10) + " connections",
 				},
 			},
 		},
@@ -727,14 +759,20 @@ func (s *Server) GetSuccessCriteria(c echo.Context) error {
 			"name": "User Experience",
 			"items": []map[string]interface{}{
 				{
-					"label": "Legitimate users solve in <3s",
-					"pass":  avgNormalSolve < 3000,
+					"label": "Legitimate users solve in <" + slaLabel,
+					"pass":  avgNormalSolve < float64(s.solveTimeSLA.Milliseconds()),
 					"value": strconv.FormatFloat(avgNormalSolve/1000, 'f', 1, 64) + "s avg",
 				},
+				{
+					"label": "Solves within " + slaLabel + " SLA",
+					"pass":  float64(totalBreaches) <= slaBreachBudget*float64(totalSolves),
+					"value": strconv.FormatInt(totalBreaches, 10) + " of " + strconv.FormatInt(totalSolves, 10) + " breached",
+					"breaches_by_difficulty": breachesByDifficulty,
+				},
 				{
 					"label": "No false positives",
 					"pass":  falsePositives == 0,
-					"value": strconv.Itoa(falsePositives) + " false positives",
+					"value": strconv.FormatInt(falsePositives, 10) + " false positives",
 				},
 			},
 		},
@@ -840,37 +878,20 @@ func (s *Server) GetScenarioTimeline(c echo.Context) error {
 func (s *Server) GetPerformanceMetrics(c echo.Context) error {
 	ctx := c.Request().Context()
 	
-	behaviors, err := s.behaviorTracker.GetActiveClients(ctx, 1000)
+	// Aggregated per difficulty over every client seen in the last hour
+	perfByDiff, err := s.behaviorTracker.GetActiveClientsByDifficulty(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get client behaviors")
 	}
 
-	// Aggregate by difficulty
-	perfByDiff := make(map[int]struct {
-		Count        int
-		TotalSolve   float64
-		TotalFailure float64
-	})
-
-	for _, b := range behaviors {
-		diff := int(b.Difficulty.Int32)
-		perf := perfByDiff[diff]
-		perf.Count++
-		perf.TotalSolve += float64(b.AvgSolveTimeMs.Int64)
-		perf.TotalFailure += b.FailureRate.Float64
-		perfByDiff[diff] = perf
-	}
-
 	// Build response
-	data := []map[string]interface{}{}
-	for diff, perf := range perfByDiff {
-		if perf.Count > 0 {
-			data = append(data, map[string]interface{}{
-				"difficulty":    diff,
-				"avgSolveTime":  perf.TotalSolve / float64(perf.Count),
-				"failureRate":   (perf.TotalFailure / float64(perf.Count)) * 100,
-				"clients":       perf.Count,
-			})
+	data := make([]map[string]interface{}, len(perfByDiff))
+	for i, perf := range perfByDiff {
+		data[i] = map[string]interface{}{
+			"difficulty":   int(perf.Difficulty.Int32),
+			"avgSolveTime": perf.AvgSolveTimeMs,
+			"failureRate":  perf.AvgFailureRate * 100,
+			"clients":      perf.Clients,
 		}
 	}
 
@@ -884,40 +905,20 @@ func (s *Server) GetPerformanceMetrics(c echo.Context) error {
 func (s *Server) GetAttackMitigation(c echo.Context) error {
 	ctx := c.Request().Context()
 	
-	behaviors, err := s.behaviorTracker.GetActiveClients(ctx, 1000)
+	summary, err := s.behaviorTracker.GetActiveClientSummary(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get client behaviors")
 	}
 
-	attackers := 0
-	normalUsers := 0
-	totalNormalSolveTime := float64(0)
-	falsePositives := 0
-
-	for _, b := range behaviors {
-		diff := int(b.Difficulty.Int32)
-		if diff >= 5 {
-			attackers++
-		} else if diff <= 2 {
-			normalUsers++
-			totalNormalSolveTime += float64(b.AvgSolveTimeMs.Int64)
-		}
-		if diff >= 4 && b.FailureRate.Float64 < 0.3 {
-			falsePositives++
-		}
-	}
-
+	attackers := summary.Attackers
 	detectionRate := float64(0)
 	falsePositiveRate := float64(0)
-	normalUserImpact := float64(0)
+	normalUserImpact := summary.AvgNormalSolveTimeMs
 	effectivenessScore := float64(60)
 
-	if len(behaviors) > 0 {
-		detectionRate = float64(attackers) / float64(len(behaviors)) * 100
-		falsePositiveRate = float64(falsePositives) / float64(len(behaviors)) * 100
-	}
-	if normalUsers > 0 {
-		normalUserImpact = totalNormalSolveTime / float64(normalUsers)
+	if summary.TotalClients > 0 {
+		detectionRate = float64(attackers) / float64(summary.TotalClients) * 100
+		falsePositiveRate = float64(summary.FalsePositives) / float64(summary.TotalClients) * 100
 	}
 	if attackers > 0 && falsePositiveRate < 5 {
 		effectivenessScore = 95
@@ -1000,4 +1001,227 @@ func (s *Server) GetExperimentComparison(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusOK, response)
-}
\ No newline at end of file
+}
+
+// Benchmark limits keep the in-process solve benchmark cheap
+const (
+	maxBenchDifficulty = 2
+	maxBenchIterations = 10
+	benchBudget        = 10 * time.Second
+)
+
+func (s *Server) GetBenchmark(c echo.Context) error {
+	difficulty := 2
+	if v := c.QueryParam("difficulty"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxBenchDifficulty {
+			return echo.NewHTTPError(http.StatusBadRequest, "difficulty must be between 1 and "+strconv.Itoa(maxBenchDifficulty))
+		}
+		difficulty = parsed
+	}
+
+	iterations := 5
+	if v := c.QueryParam("iterations"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxBenchIterations {
+			return echo.NewHTTPError(http.StatusBadRequest, "iterations must be between 1 and "+strconv.Itoa(maxBenchIterations))
+		}
+		iterations = parsed
+	}
+
+	results := make([]*pow.BenchmarkResult, 0, 2)
+	for _, algorithm := range []string{"sha256", "argon2"} {
+		result, err := pow.RunBenchmark(c.Request().Context(), algorithm, difficulty, iterations, benchBudget/2)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Benchmark failed: "+err.Error())
+		}
+		results = append(results, result)
+	}
+
+	response := map[string]interface{}{
+		"difficulty": difficulty,
+		"iterations": iterations,
+		"results":    results,
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// maxBatchChallenges caps how many challenges are issued or verified per request
+const maxBatchChallenges = 20
+
+// SolutionSubmission bundles the full signed challenge with its solution so any
+// replica can verify it without server-side challenge storage. A challenge issued by
+// the batch endpoint can instead be named by its challengeId (its nonce), which only
+// resolves on the replica that issued it.
+type SolutionSubmission struct {
+	Challenge   *pow.SecureChallenge `json:"challenge,omitempty"`
+	ChallengeID string               `json:"challengeId,omitempty"`
+	Nonce       string               `json:"nonce"`
+}
+
+// BatchSolveRequest is the body of POST /api/v1/pow/solve/batch
+type BatchSolveRequest struct {
+	Solutions []SolutionSubmission `json:"solutions"`
+}
+
+// SolveResult reports the outcome for one submitted solution
+type SolveResult struct {
+	Index int    `json:"index"`
+	Valid bool   `json:"valid"`
+	Stage string `json:"stage"`
+	Error string `json:"error,omitempty"`
+	Quote string `json:"quote,omitempty"`
+}
+
+// IssueChallengeBatch issues count independent signed challenges so clients can prefetch work
+func (s *Server) IssueChallengeBatch(c echo.Context) error {
+	if s.keyManager == nil || s.pipeline == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Proof-of-work endpoints are not configured")
+	}
+
+	count := 10
+	if v := c.QueryParam("count"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxBatchChallenges {
+			return echo.NewHTTPError(http.StatusBadRequest, "count must be between 1 and "+strconv.Itoa(maxBatchChallenges))
+		}
+		count = parsed
+	}
+
+	// Each challenge gets its own seed, nonce and expiry
+	clientID := c.RealIP()
+	challenges := make([]*pow.SecureChallenge, 0, count)
+	for i := 0; i < count; i++ {
+		challenge, err := pow.GenerateSecureChallengeWithKeyManager(s.powDifficulty, s.powAlgorithm, clientID, s.keyManager)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate challenge: "+err.Error())
+		}
+		s.pipeline.RememberChallenge(challenge)
+		challenges = append(challenges, challenge)
+	}
+
+	response := map[string]interface{}{
+		"count":      len(challenges),
+		"challenges": challenges,
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// SolveChallenge verifies a single {challenge, nonce} submission statelessly: the HMAC
+// signature proves the challenge was issued by us, so no challenge lookup is needed
+func (s *Server) SolveChallenge(c echo.Context) error {
+	if s.pipeline == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Proof-of-work endpoints are not configured")
+	}
+
+	var submission SolutionSubmission
+	if err := c.Bind(&submission); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	solution := s.newSolution(submission, c.RealIP())
+	result := s.solveResult(s.pipeline.Validate(solution), solution)
+	if !result.Valid {
+		return c.JSON(http.StatusUnprocessableEntity, result)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// SolveChallengeBatch verifies a batch of solved challenges and returns a quote for each
+// valid one. The batch counts as one request per solution against the client's rate limit.
+func (s *Server) SolveChallengeBatch(c echo.Context) error {
+	if s.pipeline == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Proof-of-work endpoints are not configured")
+	}
+
+	var req BatchSolveRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if len(req.Solutions) == 0 || len(req.Solutions) > maxBatchChallenges {
+		return echo.NewHTTPError(http.StatusBadRequest, "solutions must contain between 1 and "+strconv.Itoa(maxBatchChallenges)+" items")
+	}
+
+	clientID := c.RealIP()
+	solutions := make([]*pow.Solution, len(req.Solutions))
+	for i, item := range req.Solutions {
+		solutions[i] = s.newSolution(item, clientID)
+	}
+
+	validations := s.pipeline.BatchValidate(solutions)
+
+	valid, limited := 0, 0
+	results := make([]SolveResult, len(validations))
+	for i, validation := range validations {
+		result := s.solveResult(validation, solutions[i])
+		result.Index = i
+		if result.Valid {
+			valid++
+		}
+		if result.Stage == "rate_limit" {
+			limited++
+		}
+		results[i] = result
+	}
+
+	response := map[string]interface{}{
+		"total":   len(results),
+		"valid":   valid,
+		"results": results,
+	}
+
+	// A fully valid batch also gets its quotes on their own, in submission order
+	if valid == len(results) {
+		quotes := make([]string, len(results))
+		for i, result := range results {
+			quotes[i] = result.Quote
+		}
+		response["quotes"] = quotes
+	}
+
+	if limited == len(results) {
+		return c.JSON(http.StatusTooManyRequests, response)
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// newSolution converts a submission into a pipeline solution keyed by the challenge nonce,
+// looking the challenge up when only its id was sent
+func (s *Server) newSolution(submission SolutionSubmission, clientID string) *pow.Solution {
+	solution := &pow.Solution{
+		Challenge:   submission.Challenge,
+		ChallengeID: submission.ChallengeID,
+		Nonce:       submission.Nonce,
+		ClientID:    clientID,
+		Timestamp:   time.Now().UnixMicro(),
+	}
+	if solution.Challenge == nil && submission.ChallengeID != "" {
+		solution.Challenge, _ = s.pipeline.LookupChallenge(submission.ChallengeID)
+	}
+	if solution.Challenge != nil {
+		solution.ChallengeID = solution.Challenge.Nonce
+	}
+	return solution
+}
+
+// solveResult converts a pipeline result and attaches a quote when valid. The pipeline has
+// already redeemed the challenge, once only, including within the same batch.
+func (s *Server) solveResult(validation *pow.ValidationResult, solution *pow.Solution) SolveResult {
+	result := SolveResult{Valid: validation.Valid, Stage: validation.Stage}
+	if validation.Error != nil {
+		result.Error = validation.Error.Error()
+	}
+	if validation.Stage == "format" && solution.Challenge == nil && solution.ChallengeID != "" {
+		result.Error = "unknown or expired challenge id"
+	}
+
+	if result.Valid {
+		result.Quote = s.quoteProvider.GetRandomQuote()
+	}
+	return result
+}
+
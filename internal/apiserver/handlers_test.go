@@ -0,0 +1,972 @@
+package apiserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"world-of-wisdom/internal/behavior"
+	"world-of-wisdom/internal/database/repository"
+	"world-of-wisdom/pkg/config"
+	"world-of-wisdom/pkg/pow"
+	"world-of-wisdom/pkg/wisdom"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+var (
+	fixtureTime = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	fixtureID   = pgtype.UUID{Bytes: [16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0x4d, 0xef, 0x80, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde}, Valid: true}
+)
+
+func timestamp(offset time.Duration) pgtype.Timestamptz {
+	return pgtype.Timestamptz{Time: fixtureTime.Add(offset), Valid: true}
+}
+
+// fakeRepo serves fixed rows. The embedded interfaces are nil, so a handler calling a
+// method without a fixture panics and fails its test.
+type fakeRepo struct {
+	repository.Repository
+	challenges  fakeChallenges
+	solutions   fakeSolutions
+	connections fakeConnections
+	metrics     fakeMetrics
+	logs        fakeLogs
+}
+
+func (r *fakeRepo) Challenges() repository.ChallengeRepository   { return &r.challenges }
+func (r *fakeRepo) Solutions() repository.SolutionRepository     { return &r.solutions }
+func (r *fakeRepo) Connections() repository.ConnectionRepository { return &r.connections }
+func (r *fakeRepo) Metrics() repository.MetricsRepository        { return &r.metrics }
+func (r *fakeRepo) Logs() repository.LogRepository               { return &r.logs }
+
+type fakeChallenges struct {
+	repository.ChallengeRepository
+	recent []repository.Challenge
+	stats  repository.GetChallengeStatsRow
+}
+
+func (f *fakeChallenges) GetRecent(_ context.Context, limit int32) ([]repository.Challenge, error) {
+	return f.recent[:min(int(limit), len(f.recent))], nil
+}
+
+func (f *fakeChallenges) GetStats(context.Context) (repository.GetChallengeStatsRow, error) {
+	return f.stats, nil
+}
+
+type fakeSolutions struct {
+	repository.SolutionRepository
+	recent       []repository.GetRecentSolutionsRow
+	distribution []repository.GetAchievedDifficultyDistributionRow
+	violations   []repository.GetAchievedDifficultyViolationsRow
+}
+
+func (f *fakeSolutions) GetRecent(context.Context, int32) ([]repository.GetRecentSolutionsRow, error) {
+	return f.recent, nil
+}
+
+func (f *fakeSolutions) GetAchievedDifficultyDistribution(context.Context) ([]repository.GetAchievedDifficultyDistributionRow, error) {
+	return f.distribution, nil
+}
+
+func (f *fakeSolutions) GetAchievedDifficultyViolations(context.Context, int32) ([]repository.GetAchievedDifficultyViolationsRow, error) {
+	return f.violations, nil
+}
+
+type fakeConnections struct {
+	repository.ConnectionRepository
+	active    []repository.Connection
+	stats     repository.GetConnectionStatsRow
+	bandwidth repository.GetBandwidthStatsRow
+	byIP      []repository.GetBandwidthByIPRow
+}
+
+func (f *fakeConnections) GetActive(context.Context) ([]repository.Connection, error) {
+	return f.active, nil
+}
+
+func (f *fakeConnections) GetFiltered(_ context.Context, status repository.ConnectionStatus) ([]repository.Connection, error) {
+	var filtered []repository.Connection
+	for _, conn := range f.active {
+		if conn.Status == status {
+			filtered = append(filtered, conn)
+		}
+	}
+	return filtered, nil
+}
+
+func (f *fakeConnections) GetStats(context.Context) (repository.GetConnectionStatsRow, error) {
+	return f.stats, nil
+}
+
+func (f *fakeConnections) GetBandwidthStats(context.Context) (repository.GetBandwidthStatsRow, error) {
+	return f.bandwidth, nil
+}
+
+func (f *fakeConnections) GetBandwidthByIP(context.Context, int32) ([]repository.GetBandwidthByIPRow, error) {
+	return f.byIP, nil
+}
+
+type fakeMetrics struct {
+	repository.MetricsRepository
+	system []repository.GetSystemMetricsRow
+}
+
+func (f *fakeMetrics) GetSystem(context.Context) ([]repository.GetSystemMetricsRow, error) {
+	return f.system, nil
+}
+
+type fakeLogs struct {
+	repository.LogRepository
+	recent  []repository.Log
+	created []repository.CreateLogParams
+}
+
+func (f *fakeLogs) Create(_ context.Context, params repository.CreateLogParams) (repository.Log, error) {
+	f.created = append(f.created, params)
+	return repository.Log{}, nil
+}
+
+func (f *fakeLogs) GetRecent(context.Context, int32) ([]repository.Log, error) {
+	return f.recent, nil
+}
+
+func newFixtureRepo() *fakeRepo {
+	clientIP := netip.MustParseAddr("203.0.113.7")
+	return &fakeRepo{
+		challenges: fakeChallenges{
+			recent: []repository.Challenge{
+				{
+					ID: fixtureID, Seed: "a1b2c3d4", Difficulty: 3, Algorithm: "argon2",
+					ClientID: "client-1", Status: "completed",
+					CreatedAt: timestamp(0), SolvedAt: timestamp(1500 * time.Millisecond), ExpiresAt: timestamp(5 * time.Minute),
+				},
+				{
+					ID: fixtureID, Seed: "e5f6a7b8", Difficulty: 2, Algorithm: "sha256",
+					ClientID: "client-2", Status: "pending",
+					CreatedAt: timestamp(time.Second), ExpiresAt: timestamp(5*time.Minute + time.Second),
+				},
+			},
+			stats: repository.GetChallengeStatsRow{
+				PendingCount: 1, SolvingCount: 2, CompletedCount: 40, FailedCount: 3, ExpiredCount: 4,
+				TotalCount: 50, AvgSolveTimeMs: 1250.5, Sha256Count: 10, Argon2Count: 40,
+			},
+		},
+		solutions: fakeSolutions{
+			recent: []repository.GetRecentSolutionsRow{
+				{ID: fixtureID, ChallengeID: fixtureID, Nonce: "42", Hash: pgtype.Text{String: "000abc", Valid: true}, Verified: true, CreatedAt: timestamp(0), Difficulty: 3, Algorithm: "argon2"},
+				{ID: fixtureID, ChallengeID: fixtureID, Nonce: "7", Verified: false, CreatedAt: timestamp(time.Minute), Difficulty: 2, Algorithm: "sha256"},
+			},
+			distribution: []repository.GetAchievedDifficultyDistributionRow{
+				{RequiredDifficulty: 2, AchievedDifficulty: 2, Verified: true, Solutions: 30},
+				{RequiredDifficulty: 2, AchievedDifficulty: 3, Verified: true, Solutions: 5},
+				{RequiredDifficulty: 3, AchievedDifficulty: 1, Verified: false, Solutions: 2},
+			},
+		},
+		connections: fakeConnections{
+			active: []repository.Connection{
+				{
+					ID: fixtureID, ClientID: "client-1", RemoteAddr: clientIP, Status: "connected", Algorithm: "argon2",
+					ConnectedAt:         timestamp(0),
+					ChallengesAttempted: pgtype.Int4{Int32: 2, Valid: true},
+					ChallengesCompleted: pgtype.Int4{Int32: 1, Valid: true},
+					TotalSolveTimeMs:    pgtype.Int8{Int64: 1500, Valid: true},
+					BytesSent:           pgtype.Int8{Int64: 170, Valid: true},
+					BytesReceived:       pgtype.Int8{Int64: 12, Valid: true},
+				},
+				{
+					ID: fixtureID, ClientID: "client-2", RemoteAddr: netip.MustParseAddr("2001:db8::1"), Status: "disconnected", Algorithm: "sha256",
+					ConnectedAt: timestamp(0), DisconnectedAt: timestamp(time.Minute),
+				},
+			},
+			stats:     repository.GetConnectionStatsRow{TotalConnections: 120, ActiveConnections: 2, AvgChallengesCompleted: 0.9, AvgSolveTimeMs: 1400},
+			bandwidth: repository.GetBandwidthStatsRow{TotalConnections: 120, TotalBytesSent: 20400, TotalBytesReceived: 1440, AvgBytesReceived: 12, MaxBytesReceived: 64},
+			byIP: []repository.GetBandwidthByIPRow{
+				{RemoteAddr: clientIP, Connections: 100, BytesSent: 17000, BytesReceived: 1200, MaxBytesReceived: 64},
+			},
+		},
+		metrics: fakeMetrics{
+			system: []repository.GetSystemMetricsRow{
+				{MetricName: "connections_per_second", MetricValue: 4.5, Time: timestamp(0)},
+				{MetricName: "current_difficulty", MetricValue: 3},
+			},
+		},
+		logs: fakeLogs{
+			recent: []repository.Log{
+				{ID: fixtureID, Timestamp: timestamp(0), Level: "info", Message: "New connection from 203.0.113.x"},
+				{ID: fixtureID, Timestamp: timestamp(time.Second), Level: "warning", Message: "Challenge failed"},
+			},
+		},
+	}
+}
+
+// TestHandlerResponsesMatchGolden snapshots the JSON of every repository-backed route, so
+// a change to a response shape shows up in review. Run with -update to accept changes.
+func TestHandlerResponsesMatchGolden(t *testing.T) {
+	s := &Server{
+		repo:            newFixtureRepo(),
+		behaviorTracker: behavior.NewTracker(distributionDB{clients: map[int32]int64{2: 14, 4: 3}}),
+		queryTimeout:    time.Second,
+		features:        config.Features{config.FeatureWorkerPool: true},
+	}
+	e := s.SetupRoutes()
+
+	routes := []struct {
+		name   string
+		target string
+	}{
+		{"health", "/health"},
+		{"stats", "/api/v1/stats"},
+		{"challenges", "/api/v1/challenges"},
+		{"challenges_filtered", "/api/v1/challenges?status=completed&limit=5"},
+		{"connections", "/api/v1/connections"},
+		{"connections_disconnected", "/api/v1/connections?status=disconnected"},
+		{"bandwidth", "/api/v1/connections/bandwidth"},
+		{"metrics", "/api/v1/metrics"},
+		{"recent_solves", "/api/v1/recent-solves"},
+		{"difficulty_deltas", "/api/v1/solutions/difficulty"},
+		{"logs", "/api/v1/logs"},
+		{"config", "/api/v1/config"},
+	}
+
+	for _, route := range routes {
+		t.Run(route.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, route.target, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET %s: expected 200, got %d: %s", route.target, rec.Code, rec.Body.String())
+			}
+
+			var got bytes.Buffer
+			if err := json.Indent(&got, rec.Body.Bytes(), "", "  "); err != nil {
+				t.Fatalf("GET %s returned invalid JSON: %v", route.target, err)
+			}
+			got.WriteByte('\n')
+
+			golden := filepath.Join("testdata", route.name+".golden.json")
+			if *update {
+				if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+					t.Fatalf("Failed to write %s: %v", golden, err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Failed to read %s (run with -update to create it): %v", golden, err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("GET %s response changed, run with -update if intended\n--- got\n%s\n--- want\n%s", route.target, got.String(), want)
+			}
+		})
+	}
+}
+
+func TestDisabledRoutesAreNotServed(t *testing.T) {
+	s := &Server{repo: newFixtureRepo(), queryTimeout: time.Second, disabledRoutes: []string{"connections"}}
+	e := s.SetupRoutes()
+
+	for target, want := range map[string]int{
+		"/api/v1/connections":           http.StatusNotFound,
+		"/api/v1/connections/bandwidth": http.StatusNotFound,
+		"/api/v1/logs":                  http.StatusOK,
+	} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s: expected %d, got %d", target, want, rec.Code)
+		}
+	}
+
+	// Disabled routes are never registered, not just answered with 404
+	for _, route := range e.Routes() {
+		if strings.Contains(route.Path, "connections") {
+			t.Errorf("Disabled route %s %s was registered", route.Method, route.Path)
+		}
+	}
+}
+
+// behaviorDB knows a single client, every query row for another IP finds nothing
+type behaviorDB struct {
+	known netip.Addr
+}
+
+func (d behaviorDB) Exec(context.Context, string, ...interface{}) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+
+func (d behaviorDB) Query(context.Context, string, ...interface{}) (pgx.Rows, error) {
+	return nil, pgx.ErrNoRows
+}
+
+func (d behaviorDB) QueryRow(_ context.Context, _ string, args ...interface{}) pgx.Row {
+	return behaviorRow{found: args[0] == d.known, difficulty: args[1].(pgtype.Int4)}
+}
+
+type behaviorRow struct {
+	found      bool
+	difficulty pgtype.Int4
+}
+
+func (r behaviorRow) Scan(dest ...interface{}) error {
+	if !r.found {
+		return pgx.ErrNoRows
+	}
+	*dest[7].(*pgtype.Int4) = r.difficulty
+	*dest[13].(*pgtype.Float8) = pgtype.Float8{Float64: 50, Valid: true}
+	return nil
+}
+
+func TestResetClientBehavior(t *testing.T) {
+	repo := newFixtureRepo()
+	s := &Server{
+		repo:            repo,
+		behaviorTracker: behavior.NewTracker(behaviorDB{known: netip.MustParseAddr("203.0.113.7")}),
+		queryTimeout:    time.Second,
+		adminToken:      "s3cret",
+	}
+	e := s.SetupRoutes()
+
+	for _, tc := range []struct {
+		target string
+		token  string
+		want   int
+	}{
+		{"/api/v1/behavior/203.0.113.7", "", http.StatusBadRequest},
+		{"/api/v1/behavior/203.0.113.7", "wrong", http.StatusUnauthorized},
+		{"/api/v1/behavior/not-an-ip", "s3cret", http.StatusBadRequest},
+		{"/api/v1/behavior/198.51.100.1", "s3cret", http.StatusNotFound},
+		{"/api/v1/behavior/203.0.113.7", "s3cret", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodDelete, tc.target, nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("DELETE %s with token %q: expected %d, got %d: %s", tc.target, tc.token, tc.want, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Only the successful reset is audited
+	if len(repo.logs.created) != 1 || !strings.Contains(string(repo.logs.created[0].Metadata), `"event":"behavior_reset"`) {
+		t.Fatalf("Expected one behavior_reset audit entry, got %+v", repo.logs.created)
+	}
+
+	// Without an admin token the endpoint does not exist
+	s.adminToken = ""
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/behavior/203.0.113.7", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	s.SetupRoutes().ServeHTTP(rec, req)
+	if rec.Code == http.StatusOK {
+		t.Error("Expected the reset endpoint to be unavailable without an admin token")
+	}
+}
+
+// distributionDB answers the per-difficulty aggregate with the given client counts
+type distributionDB struct {
+	behaviorDB
+	clients map[int32]int64
+}
+
+func (d distributionDB) Query(context.Context, string, ...interface{}) (pgx.Rows, error) {
+	rows := &distributionRows{}
+	for difficulty, clients := range d.clients {
+		rows.rows = append(rows.rows, [2]int64{int64(difficulty), clients})
+	}
+	return rows, nil
+}
+
+// distributionRows yields (difficulty, clients, avg_solve_time_ms, avg_failure_rate) rows
+type distributionRows struct {
+	pgx.Rows
+	rows [][2]int64
+	next int
+}
+
+func (r *distributionRows) Next() bool {
+	r.next++
+	return r.next <= len(r.rows)
+}
+
+func (r *distributionRows) Scan(dest ...interface{}) error {
+	row := r.rows[r.next-1]
+	*dest[0].(*pgtype.Int4) = pgtype.Int4{Int32: int32(row[0]), Valid: true}
+	*dest[1].(*int64) = row[1]
+	return nil
+}
+
+func (r *distributionRows) Err() error { return nil }
+func (r *distributionRows) Close()     {}
+
+// decisionDB has a stored difficulty decision for a single client IP
+type decisionDB struct {
+	behaviorDB
+	decision string
+}
+
+func (d decisionDB) QueryRow(_ context.Context, _ string, args ...interface{}) pgx.Row {
+	return decisionRow{found: args[0] == d.known, decision: d.decision}
+}
+
+type decisionRow struct {
+	found    bool
+	decision string
+}
+
+func (r decisionRow) Scan(dest ...interface{}) error {
+	if !r.found {
+		return pgx.ErrNoRows
+	}
+	*dest[0].(*[]byte) = []byte(r.decision)
+	*dest[1].(*pgtype.Timestamptz) = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	return nil
+}
+
+func TestGetDifficultyDecision(t *testing.T) {
+	s := &Server{
+		repo: newFixtureRepo(),
+		behaviorTracker: behavior.NewTracker(decisionDB{
+			behaviorDB: behaviorDB{known: netip.MustParseAddr("203.0.113.7")},
+			decision:   `{"previous":2,"factors":[{"name":"failure_rate","value":0.6,"effect":2},{"name":"surge","value":1,"effect":1}],"difficulty":5}`,
+		}),
+		queryTimeout: time.Second,
+	}
+	e := s.SetupRoutes()
+
+	for _, tc := range []struct {
+		target string
+		want   int
+	}{
+		{"/api/v1/behavior/not-an-ip/decision", http.StatusBadRequest},
+		{"/api/v1/behavior/198.51.100.1/decision", http.StatusNotFound},
+		{"/api/v1/behavior/203.0.113.7/decision", http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if rec.Code != tc.want {
+			t.Fatalf("GET %s: expected %d, got %d: %s", tc.target, tc.want, rec.Code, rec.Body.String())
+		}
+		if tc.want == http.StatusOK && !strings.Contains(rec.Body.String(), `"summary":"failure_rate=0.6 (+2), surge=1 (+1)"`) {
+			t.Errorf("Expected the decision summary in %s", rec.Body.String())
+		}
+	}
+}
+
+func TestStreamConnections(t *testing.T) {
+	stopped := make(chan struct{})
+	s := &Server{
+		repo:         newFixtureRepo(),
+		queryTimeout: time.Second,
+		connectionFeed: newConnectionFeed(func(ctx context.Context, deliver func(string)) error {
+			deliver(`{"id":"a","remoteAddr":"203.0.113.7","status":"connected","connectedAt":"2025-01-02T03:04:05.123456+00:00"}`)
+			deliver(`{"id":"a","remoteAddr":"203.0.113.7","status":"solving","connectedAt":"2025-01-02T03:04:05.123456+00:00"}`)
+			<-ctx.Done()
+			close(stopped)
+			return ctx.Err()
+		}),
+		streamHeartbeat: 20 * time.Millisecond,
+	}
+	srv := httptest.NewServer(s.SetupRoutes())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/connections/stream?status=bogus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid status filter, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/api/v1/connections/stream?status=solving")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected NDJSON, got %q", ct)
+	}
+
+	// The connected event is filtered out, the solving one is followed by heartbeats
+	lines := bufio.NewScanner(resp.Body)
+	var types []string
+	for len(types) < 2 && lines.Scan() {
+		var line struct{ Type, Status string }
+		if err := json.Unmarshal(lines.Bytes(), &line); err != nil {
+			t.Fatalf("Invalid stream line %q: %v", lines.Text(), err)
+		}
+		types = append(types, line.Type+":"+line.Status)
+	}
+	if strings.Join(types, ",") != "connection:solving,heartbeat:" {
+		t.Errorf("Expected the solving event then a heartbeat, got %v", types)
+	}
+	resp.Body.Close()
+
+	// The last stream closing stops listening
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Error("Expected the listener to stop after the stream closed")
+	}
+}
+
+func TestVerifySolutionRunsThePipelineOnce(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	keys := pow.NewStaticKeyManager(key)
+	s := &Server{
+		repo:         newFixtureRepo(),
+		queryTimeout: time.Second,
+		adminToken:   "admin-token",
+		verifyAPIKey: "s3cret",
+		keyManager:   keys,
+		pipeline:     pow.NewValidationPipeline(key),
+	}
+	s.pipeline.SetReplayStore(pow.NewMemoryNonceStore())
+	e := s.SetupRoutes()
+
+	challenge, err := pow.GenerateSecureChallengeWithKeyManager(1, "sha256", "issuer-client", keys)
+	if err != nil {
+		t.Fatalf("Failed to generate challenge: %v", err)
+	}
+	nonce, err := pow.SolveSecureChallenge(challenge, key)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+	tampered := *challenge
+	tampered.Difficulty = 2
+
+	verify := func(submission SolutionSubmission, token string) (int, VerifyResult) {
+		body, _ := json.Marshal(submission)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/pow/verify", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var result VerifyResult
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return rec.Code, result
+	}
+
+	if code, _ := verify(SolutionSubmission{Challenge: challenge, Nonce: nonce}, "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Expected an unknown issuer to get 401, got %d", code)
+	}
+	if code, _ := verify(SolutionSubmission{Challenge: challenge, Nonce: nonce}, "admin-token"); code != http.StatusUnauthorized {
+		t.Errorf("Expected the admin token not to be accepted for verification, got %d", code)
+	}
+	if code, result := verify(SolutionSubmission{Challenge: &tampered, Nonce: nonce}, "s3cret"); code != http.StatusUnprocessableEntity || result.Stage != "signature" {
+		t.Errorf("Expected a tampered challenge to fail at signature with 422, got %d at %q", code, result.Stage)
+	}
+	if code, result := verify(SolutionSubmission{Challenge: challenge, Nonce: nonce}, "s3cret"); code != http.StatusOK || !result.Valid || result.ClientID != "issuer-client" {
+		t.Errorf("Expected the solution to verify for issuer-client, got %d %+v", code, result)
+	}
+
+	// A verified solution can't be verified again
+	if code, result := verify(SolutionSubmission{Challenge: challenge, Nonce: nonce}, "s3cret"); code != http.StatusUnprocessableEntity || result.Stage != "replay" {
+		t.Errorf("Expected the second verification to fail at replay, got %d at %q", code, result.Stage)
+	}
+
+	// The verify key grants nothing on the admin endpoints
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/rotate-keys", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the verify key to be refused by key rotation, got %d", rec.Code)
+	}
+
+	// Without a verify key the endpoint isn't served, even with an admin token
+	s.verifyAPIKey = ""
+	e = s.SetupRoutes()
+	if code, _ := verify(SolutionSubmission{Challenge: challenge, Nonce: nonce}, "admin-token"); code == http.StatusOK || code == http.StatusUnprocessableEntity {
+		t.Errorf("Expected verification to be unavailable without a verify key, got %d", code)
+	}
+}
+
+func TestSolutionSignedBeforeKeyRotationStillVerifies(t *testing.T) {
+	keys := pow.NewStaticKeyManager([]byte("0123456789abcdef0123456789abcdef"))
+	s := &Server{
+		repo:         newFixtureRepo(),
+		queryTimeout: time.Second,
+		adminToken:   "s3cret",
+		verifyAPIKey: "verify-key",
+		keyManager:   keys,
+		pipeline:     pow.NewValidationPipelineWithKeyManager(keys),
+	}
+	e := s.SetupRoutes()
+
+	post := func(target string, body []byte) *httptest.ResponseRecorder {
+		token := "s3cret"
+		if target == "/api/v1/pow/verify" {
+			token = "verify-key"
+		}
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	issue := func() (*pow.SecureChallenge, string) {
+		challenge, err := pow.GenerateSecureChallengeWithKeyManager(1, "sha256", "rotation-client", keys)
+		if err != nil {
+			t.Fatalf("Failed to generate challenge: %v", err)
+		}
+		nonce, err := pow.SolveSecureChallenge(challenge, keys.GetCurrentKey())
+		if err != nil {
+			t.Fatalf("Failed to solve challenge: %v", err)
+		}
+		return challenge, nonce
+	}
+	verify := func(challenge *pow.SecureChallenge, nonce string) VerifyResult {
+		body, _ := json.Marshal(SolutionSubmission{Challenge: challenge, Nonce: nonce})
+		var result VerifyResult
+		json.Unmarshal(post("/api/v1/pow/verify", body).Body.Bytes(), &result)
+		return result
+	}
+
+	// Issued under the first key, rotated while the client is solving
+	inFlight, inFlightNonce := issue()
+	stale, staleNonce := issue()
+	if rec := post("/api/v1/admin/rotate-keys", nil); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the rotation to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if current, previous := keys.GetKeys(); previous == nil || bytes.Equal(current, previous) {
+		t.Fatal("Expected the rotation to keep the replaced key as the previous one")
+	}
+
+	if result := verify(inFlight, inFlightNonce); !result.Valid {
+		t.Errorf("Expected a challenge signed with the previous key to verify, got %+v", result)
+	}
+
+	// A second rotation retires the first key
+	if rec := post("/api/v1/admin/rotate-keys", nil); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the second rotation to succeed, got %d", rec.Code)
+	}
+	if result := verify(stale, staleNonce); result.Valid || result.Stage != "signature" {
+		t.Errorf("Expected a challenge signed two keys ago to fail at signature, got %+v", result)
+	}
+}
+
+func TestSolveChallengeBatchByChallengeID(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	keys := pow.NewStaticKeyManager(key)
+	s := &Server{
+		repo:          newFixtureRepo(),
+		queryTimeout:  time.Second,
+		keyManager:    keys,
+		pipeline:      pow.NewValidationPipelineWithKeyManager(keys),
+		powAlgorithm:  "sha256",
+		powDifficulty: 1,
+		quoteProvider: wisdom.NewQuoteProvider(),
+	}
+	s.pipeline.SetReplayStore(pow.NewMemoryNonceStore())
+	s.pipeline.SetRateLimitConfig(time.Minute, 3)
+	e := s.SetupRoutes()
+
+	post := func(target string, body any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	type batchResponse struct {
+		Total   int           `json:"total"`
+		Valid   int           `json:"valid"`
+		Results []SolveResult `json:"results"`
+		Quotes  []string      `json:"quotes"`
+	}
+	solve := func(solutions ...SolutionSubmission) (int, batchResponse) {
+		rec := post("/api/v1/pow/solve/batch", BatchSolveRequest{Solutions: solutions})
+		var response batchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode batch response %q: %v", rec.Body, err)
+		}
+		return rec.Code, response
+	}
+
+	rec := post("/api/v1/pow/challenges/batch?count=2", nil)
+	var issued struct {
+		Challenges []*pow.SecureChallenge `json:"challenges"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &issued); err != nil || len(issued.Challenges) != 2 {
+		t.Fatalf("Expected two issued challenges, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Only the challenge ids are sent back, the pipeline remembers the challenges
+	var submissions []SolutionSubmission
+	for _, challenge := range issued.Challenges {
+		nonce, err := pow.SolveSecureChallenge(challenge, key)
+		if err != nil {
+			t.Fatalf("Failed to solve challenge: %v", err)
+		}
+		submissions = append(submissions, SolutionSubmission{ChallengeID: challenge.Nonce, Nonce: nonce})
+	}
+	code, response := solve(submissions...)
+	if code != http.StatusOK || response.Valid != 2 || len(response.Quotes) != 2 {
+		t.Fatalf("Expected both solutions to be valid with two quotes, got %d %+v", code, response)
+	}
+	for i, quote := range response.Quotes {
+		if quote == "" || quote != response.Results[i].Quote {
+			t.Errorf("Expected quote %d to match its result, got %q", i, quote)
+		}
+	}
+
+	code, response = solve(SolutionSubmission{ChallengeID: "unknown", Nonce: "1"})
+	if code != http.StatusOK || response.Valid != 0 || response.Quotes != nil || response.Results[0].Error != "unknown or expired challenge id" {
+		t.Errorf("Expected an unknown challenge id to be reported without quotes, got %d %+v", code, response)
+	}
+
+	// The client has used its three requests of the window
+	code, response = solve(submissions[0])
+	if code != http.StatusTooManyRequests || response.Results[0].Stage != "rate_limit" {
+		t.Errorf("Expected a batch over the rate limit to get 429, got %d %+v", code, response)
+	}
+}
+
+func TestClassifyBucket(t *testing.T) {
+	const baseline = 10
+	for _, tc := range []struct {
+		name     string
+		bucket   repository.GetActivityTimelineRow
+		baseline float64
+		want     replayPhase
+	}{
+		{"no connections or challenges", repository.GetActivityTimelineRow{}, baseline, phaseQuiet},
+		{"aggressive alert", repository.GetActivityTimelineRow{Connections: 5, AggressiveAlerts: 1, Escalations: 2}, baseline, phaseAttack},
+		{"escalation", repository.GetActivityTimelineRow{Connections: 5, Escalations: 1}, baseline, phaseMitigation},
+		{"attacker difficulty", repository.GetActivityTimelineRow{Connections: 5, MaxDifficulty: 5}, baseline, phaseMitigation},
+		{"surge factor reached", repository.GetActivityTimelineRow{Connections: 30}, baseline, phaseSurge},
+		{"just below surge factor", repository.GetActivityTimelineRow{Connections: 29}, baseline, phaseNormal},
+		{"challenges only", repository.GetActivityTimelineRow{Challenges: 3}, baseline, phaseNormal},
+		{"no baseline", repository.GetActivityTimelineRow{Connections: 100}, 0, phaseNormal},
+	} {
+		if got := classifyBucket(tc.bucket, tc.baseline); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestBuildReplayTimeline(t *testing.T) {
+	minute := func(i int, row repository.GetActivityTimelineRow) repository.GetActivityTimelineRow {
+		row.Bucket = timestamp(time.Duration(i) * time.Minute)
+		return row
+	}
+
+	for _, tc := range []struct {
+		name    string
+		buckets []repository.GetActivityTimelineRow
+		want    []map[string]string
+	}{
+		{
+			name:    "no data",
+			buckets: nil,
+			want:    []map[string]string{},
+		},
+		{
+			name:    "only quiet minutes",
+			buckets: []repository.GetActivityTimelineRow{minute(0, repository.GetActivityTimelineRow{}), minute(1, repository.GetActivityTimelineRow{})},
+			want: []map[string]string{
+				{"time": "0-2 min", "event": "No client activity", "icon": "trending-down", "color": "gray"},
+			},
+		},
+		{
+			name: "consecutive minutes merge into phases",
+			buckets: []repository.GetActivityTimelineRow{
+				minute(0, repository.GetActivityTimelineRow{Connections: 10, UniqueClients: 3}),
+				minute(1, repository.GetActivityTimelineRow{Connections: 10, UniqueClients: 4}),
+				minute(2, repository.GetActivityTimelineRow{Connections: 40, UniqueClients: 20}),
+				minute(3, repository.GetActivityTimelineRow{Connections: 10, Challenges: 8, Failed: 6, AggressiveAlerts: 2}),
+				minute(4, repository.GetActivityTimelineRow{Connections: 5, MaxDifficulty: 6, Escalations: 3}),
+				minute(5, repository.GetActivityTimelineRow{}),
+			},
+			want: []map[string]string{
+				{"time": "0-2 min", "event": "Normal traffic: 20 connections from up to 4 clients", "icon": "users", "color": "blue"},
+				{"time": "2-3 min", "event": "Connection surge: 40/min (4.0x baseline) from up to 20 clients", "icon": "trending-up", "color": "orange"},
+				{"time": "3-4 min", "event": "Aggressive clients detected (2 alerts), 6 of 8 challenges failed", "icon": "alert-triangle", "color": "red"},
+				{"time": "4-5 min", "event": "Difficulty escalated to 6 (3 escalations)", "icon": "shield", "color": "yellow"},
+				{"time": "5-6 min", "event": "No client activity", "icon": "trending-down", "color": "gray"},
+			},
+		},
+	} {
+		got := buildReplayTimeline(tc.buckets, fixtureTime)
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(tc.want)
+		if !bytes.Equal(gotJSON, wantJSON) {
+			t.Errorf("%s: expected %s, got %s", tc.name, wantJSON, gotJSON)
+		}
+	}
+}
+
+// attackersDB records the parameters of every attacker query and answers with one attacker
+type attackersDB struct {
+	behaviorDB
+	queries *[][]interface{}
+}
+
+func (d attackersDB) Query(_ context.Context, _ string, args ...interface{}) (pgx.Rows, error) {
+	*d.queries = append(*d.queries, args)
+	return &attackerRows{}, nil
+}
+
+type attackerRows struct {
+	pgx.Rows
+	done bool
+}
+
+func (r *attackerRows) Next() bool {
+	next := !r.done
+	r.done = true
+	return next
+}
+
+func (r *attackerRows) Scan(dest ...interface{}) error {
+	*dest[0].(*netip.Addr) = netip.MustParseAddr("198.51.100.9")
+	*dest[1].(*pgtype.Int4) = pgtype.Int4{Int32: 6, Valid: true}
+	*dest[2].(*pgtype.Int4) = pgtype.Int4{Int32: 120, Valid: true}
+	*dest[3].(*pgtype.Float8) = pgtype.Float8{Float64: 0.75, Valid: true}
+	*dest[4].(*pgtype.Int8) = pgtype.Int8{Int64: 40, Valid: true}
+	*dest[5].(*pgtype.Float8) = pgtype.Float8{Float64: 0.5, Valid: true}
+	*dest[6].(*pgtype.Float8) = pgtype.Float8{Float64: 10, Valid: true}
+	*dest[7].(*pgtype.Float8) = pgtype.Float8{Float64: 90, Valid: true}
+	*dest[8].(*pgtype.Timestamptz) = timestamp(0)
+	*dest[9].(*pgtype.Int4) = pgtype.Int4{Int32: 5, Valid: true}
+	*dest[10].(*pgtype.Int4) = pgtype.Int4{Int32: 15, Valid: true}
+	*dest[11].(*pgtype.Int4) = pgtype.Int4{Int32: 20, Valid: true}
+	return nil
+}
+
+func (r *attackerRows) Err() error { return nil }
+func (r *attackerRows) Close()     {}
+
+func TestGetAttackers(t *testing.T) {
+	var queries [][]interface{}
+	s := &Server{
+		repo:            newFixtureRepo(),
+		behaviorTracker: behavior.NewTracker(attackersDB{queries: &queries}),
+		queryTimeout:    time.Second,
+	}
+	e := s.SetupRoutes()
+
+	// Invalid parameters are rejected before the database is queried
+	for _, target := range []string{
+		"/api/v1/attackers?min_difficulty=0",
+		"/api/v1/attackers?min_difficulty=7",
+		"/api/v1/attackers?min_difficulty=high",
+		"/api/v1/attackers?min_suspicious=-1",
+		"/api/v1/attackers?min_suspicious=100.5",
+		"/api/v1/attackers?min_suspicious=very",
+		"/api/v1/attackers?sort=ip",
+		"/api/v1/attackers?limit=0",
+		"/api/v1/attackers?limit=501",
+		"/api/v1/attackers?limit=all",
+	} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: expected %d, got %d", target, http.StatusBadRequest, rec.Code)
+		}
+	}
+	if len(queries) != 0 {
+		t.Fatalf("Expected no attacker query for invalid parameters, got %v", queries)
+	}
+
+	for _, tc := range []struct {
+		target string
+		want   []interface{}
+	}{
+		{"/api/v1/attackers", []interface{}{int32(behavior.AttackerDifficulty), 50.0, "suspicious_score", int32(50)}},
+		{"/api/v1/attackers?min_difficulty=3&min_suspicious=20.5&sort=failure_rate&limit=10", []interface{}{int32(3), 20.5, "failure_rate", int32(10)}},
+		{"/api/v1/attackers?sort=connections&limit=500", []interface{}{int32(behavior.AttackerDifficulty), 50.0, "connections", int32(500)}},
+		{"/api/v1/attackers?sort=difficulty&min_suspicious=0", []interface{}{int32(behavior.AttackerDifficulty), 0.0, "difficulty", int32(50)}},
+	} {
+		queries = nil
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s: expected %d, got %d: %s", tc.target, http.StatusOK, rec.Code, rec.Body.String())
+			continue
+		}
+		if len(queries) != 1 || !reflect.DeepEqual(queries[0], tc.want) {
+			t.Errorf("GET %s: expected query parameters %v, got %v", tc.target, tc.want, queries)
+		}
+
+		var body struct {
+			Data struct {
+				Attackers  []AttackerInfo `json:"attackers"`
+				Total      int            `json:"total"`
+				Sort       string         `json:"sort"`
+				Thresholds struct {
+					MinDifficulty int     `json:"min_difficulty"`
+					MinSuspicious float64 `json:"min_suspicious"`
+				} `json:"thresholds"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("GET %s: invalid response: %v", tc.target, err)
+		}
+		if body.Data.Sort != tc.want[2] || int32(body.Data.Thresholds.MinDifficulty) != tc.want[0] || body.Data.Thresholds.MinSuspicious != tc.want[1] {
+			t.Errorf("GET %s: expected the sort and thresholds echoed, got %+v", tc.target, body.Data)
+		}
+		want := AttackerInfo{
+			IP: "198.51.100.9", Difficulty: 6, ConnectionCount: 120, FailureRate: 0.75, AvgSolveTime: 40,
+			ReconnectRate: 0.5, Reputation: 10, Suspicious: 90, LastConnection: fixtureTime.Format(time.RFC3339),
+			SuccessfulChallenges: 5, FailedChallenges: 15, TotalChallenges: 20,
+		}
+		if body.Data.Total != 1 || len(body.Data.Attackers) != 1 || body.Data.Attackers[0] != want {
+			t.Errorf("GET %s: expected %+v, got %+v", tc.target, want, body.Data.Attackers)
+		}
+	}
+}
+
+func TestForwardedHeadersDoNotResetRateLimit(t *testing.T) {
+	keys := pow.NewStaticKeyManager([]byte("0123456789abcdef0123456789abcdef"))
+	s := &Server{
+		repo:          newFixtureRepo(),
+		queryTimeout:  time.Second,
+		keyManager:    keys,
+		pipeline:      pow.NewValidationPipelineWithKeyManager(keys),
+		powAlgorithm:  "sha256",
+		powDifficulty: 1,
+		quoteProvider: wisdom.NewQuoteProvider(),
+	}
+	s.pipeline.SetRateLimitConfig(time.Minute, 1)
+	e := s.SetupRoutes()
+
+	var codes []int
+	for _, spoofed := range []string{"198.51.100.1", "198.51.100.2"} {
+		data, _ := json.Marshal(BatchSolveRequest{Solutions: []SolutionSubmission{{ChallengeID: "unknown", Nonce: "1"}}})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/pow/solve/batch", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", spoofed)
+		req.Header.Set("X-Real-IP", spoofed)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+
+	// Both requests come from the same connection address, whatever the headers claim
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("Expected the second request to be rate limited despite a new forwarded address, got %v", codes)
+	}
+}
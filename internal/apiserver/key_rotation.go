@@ -0,0 +1,47 @@
+package apiserver
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// keyVersioner is implemented by key managers that number their keys, like the database one
+type keyVersioner interface {
+	Version() int
+}
+
+// RotateKeys rotates the HMAC signing keys on demand, e.g. after a suspected leak. The
+// replaced key stays valid for verification until the next rotation, so challenges
+// already issued can still be solved.
+func (s *Server) RotateKeys(c echo.Context) error {
+	if s.keyManager == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Proof-of-work endpoints are not configured")
+	}
+
+	previousAge := s.keyManager.GetRotationAge()
+	if err := s.keyManager.RotateKeys(); err != nil {
+		log.Printf("⚠️ HMAC key rotation requested by %s failed: %v", c.RealIP(), err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to rotate keys")
+	}
+
+	data := map[string]interface{}{
+		"previousKeyAgeSeconds": int64(previousAge.Seconds()),
+	}
+	if versioned, ok := s.keyManager.(keyVersioner); ok {
+		data["version"] = versioned.Version()
+	}
+
+	log.Printf("🔑 HMAC keys rotated by admin from %s", c.RealIP())
+	s.audit(c.Request().Context(), fmt.Sprintf("HMAC keys rotated by admin from %s", c.RealIP()), map[string]interface{}{
+		"admin_ip": c.RealIP(),
+		"event":    "key_rotation",
+	})
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":   data,
+		"status": "success",
+	})
+}
@@ -0,0 +1,67 @@
+package apiserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// VerifyResult reports the pipeline's verdict on a solution checked for an external issuer
+type VerifyResult struct {
+	Valid      bool    `json:"valid"`
+	Stage      string  `json:"stage"` // The failing stage, or "complete"
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"durationMs"`
+	ClientID   string  `json:"clientId"`
+}
+
+// verifierAuth accepts requests carrying the verify API key as a bearer token. Issuers get
+// their own credential so they can verify solutions without the admin endpoints.
+func (s *Server) verifierAuth() echo.MiddlewareFunc {
+	return middleware.KeyAuth(func(token string, c echo.Context) (bool, error) {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(s.verifyAPIKey)) == 1, nil
+	})
+}
+
+// VerifySolution checks a {challenge, nonce} signed with the shared key for an issuer that
+// runs its own challenge endpoint. It runs the full pipeline, whose replay stage redeems
+// the challenge so it can't be verified twice. No quote is returned, the issuer decides what a valid
+// solution grants. Rate limiting is per challenge client, not per calling issuer.
+func (s *Server) VerifySolution(c echo.Context) error {
+	if s.pipeline == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Proof-of-work endpoints are not configured")
+	}
+
+	var submission SolutionSubmission
+	if err := c.Bind(&submission); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if submission.Challenge == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "challenge is required")
+	}
+
+	clientID := submission.Challenge.ClientID
+	if clientID == "" {
+		clientID = c.RealIP()
+	}
+	solution := s.newSolution(submission, clientID)
+	validation := s.pipeline.Validate(solution)
+
+	result := VerifyResult{
+		Valid:      validation.Valid,
+		Stage:      validation.Stage,
+		DurationMs: float64(validation.Duration.Microseconds()) / 1000,
+		ClientID:   validation.ClientID,
+	}
+	if validation.Error != nil {
+		result.Error = validation.Error.Error()
+	}
+
+	if !result.Valid {
+		return c.JSON(http.StatusUnprocessableEntity, result)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
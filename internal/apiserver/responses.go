@@ -0,0 +1,86 @@
+package apiserver
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// The generated response types make every field optional, these helpers keep handlers
+// from spelling out a local variable per field and the anonymous Data structs per envelope.
+
+// ptr returns a pointer to a copy of v
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// optionalTime is nil for NULL timestamps
+func optionalTime(t pgtype.Timestamptz) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return ptr(t.Time)
+}
+
+// optionalUnix is nil for NULL timestamps, otherwise seconds since the epoch
+func optionalUnix(t pgtype.Timestamptz) *int64 {
+	if !t.Valid {
+		return nil
+	}
+	return ptr(t.Time.Unix())
+}
+
+func newHealthResponse(data HealthData) HealthResponse {
+	return HealthResponse{Data: &data, Status: HealthResponseStatusSuccess}
+}
+
+func newStatsResponse(data StatsData) StatsResponse {
+	return StatsResponse{Data: &data, Status: Success}
+}
+
+func newChallengesResponse(challenges []ChallengeDetail) ChallengesResponse {
+	return ChallengesResponse{
+		Data: &struct {
+			Challenges *[]ChallengeDetail `json:"challenges,omitempty"`
+			Total      *int               `json:"total,omitempty"`
+		}{
+			Challenges: &challenges,
+			Total:      ptr(len(challenges)),
+		},
+		Status: ChallengesResponseStatusSuccess,
+	}
+}
+
+func newConnectionsResponse(connections []ConnectionDetail, total, active int) ConnectionsResponse {
+	return ConnectionsResponse{
+		Data: &struct {
+			Active      *int                `json:"active,omitempty"`
+			Connections *[]ConnectionDetail `json:"connections,omitempty"`
+			Total       *int                `json:"total,omitempty"`
+		}{
+			Connections: &connections,
+			Total:       &total,
+			Active:      &active,
+		},
+		Status: ConnectionsResponseStatusSuccess,
+	}
+}
+
+func newMetricsResponse(metrics []MetricData) MetricsResponse {
+	return MetricsResponse{
+		Data: &struct {
+			Metrics *[]MetricData `json:"metrics,omitempty"`
+		}{
+			Metrics: &metrics,
+		},
+		Status: MetricsResponseStatusSuccess,
+	}
+}
+
+func newRecentSolvesResponse(blocks []Block) RecentSolvesResponse {
+	return RecentSolvesResponse{Data: &blocks, Status: RecentSolvesResponseStatusSuccess}
+}
+
+func newLogsResponse(logs []LogMessage) LogsResponse {
+	return LogsResponse{Data: &logs, Status: LogsResponseStatusSuccess}
+}
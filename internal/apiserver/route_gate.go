@@ -0,0 +1,101 @@
+package apiserver
+
+import (
+	"log"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// routeGate registers API routes unless configuration turns them off. Routes are named
+// by their path below /api/v1 with slashes as dots, e.g. "experiment.comparison" or
+// "pow.solve.batch", and a config entry also covers every route below it, so
+// "experiment" disables all experiment analytics. Disabled routes are never registered
+// and answer 404.
+type routeGate struct {
+	e        *echo.Echo
+	enabled  []string // Only these routes are served when set
+	disabled []string
+	matched  map[string]bool
+}
+
+func newRouteGate(e *echo.Echo, enabled, disabled []string) *routeGate {
+	return &routeGate{
+		e:        e,
+		enabled:  cleanRouteNames(enabled),
+		disabled: cleanRouteNames(disabled),
+		matched:  make(map[string]bool),
+	}
+}
+
+func cleanRouteNames(entries []string) []string {
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			names = append(names, entry)
+		}
+	}
+	return names
+}
+
+// routeName maps /api/v1/experiment/summary to experiment.summary
+func routeName(path string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(path, "/api/v1/"), "/", ".")
+}
+
+// covers reports whether a config entry names route or one of its parents
+func covers(entry, route string) bool {
+	return route == entry || strings.HasPrefix(route, entry+".")
+}
+
+func (g *routeGate) allowed(path string) bool {
+	route := routeName(path)
+
+	allowed := len(g.enabled) == 0
+	for _, entry := range g.enabled {
+		if covers(entry, route) {
+			g.matched[entry] = true
+			allowed = true
+		}
+	}
+	for _, entry := range g.disabled {
+		if covers(entry, route) {
+			g.matched[entry] = true
+			allowed = false
+		}
+	}
+
+	if !allowed {
+		log.Printf("🚫 API route %s disabled by configuration", path)
+	}
+	return allowed
+}
+
+func (g *routeGate) GET(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) {
+	if g.allowed(path) {
+		g.e.GET(path, h, m...)
+	}
+}
+
+func (g *routeGate) POST(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) {
+	if g.allowed(path) {
+		g.e.POST(path, h, m...)
+	}
+}
+
+func (g *routeGate) DELETE(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) {
+	if g.allowed(path) {
+		g.e.DELETE(path, h, m...)
+	}
+}
+
+// warnUnmatched logs config entries that named no route, most likely a typo
+func (g *routeGate) warnUnmatched() {
+	for _, entries := range [][]string{g.enabled, g.disabled} {
+		for _, entry := range entries {
+			if !g.matched[entry] {
+				log.Printf("⚠️ API route setting %q matches no route", entry)
+			}
+		}
+	}
+}
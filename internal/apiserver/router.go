@@ -1,18 +1,34 @@
 package apiserver
 
 import (
+	"time"
+
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
 )
 
 // SetupRoutes configures the HTTP routes for the API server
 func (s *Server) SetupRoutes() *echo.Echo {
 	e := echo.New()
+
+	// Rate limits, batch accounting and audit logs key on the client IP, so it comes from the
+	// connection: forwarding headers are set by the client and would reset its limits
+	e.IPExtractor = echo.ExtractIPDirect()
 	
 	// Middleware
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	
+	// Bound the database work of every request, the benchmark is CPU bound and has its own
+	// budget and the connection stream stays open until the client leaves
+	e.Use(middleware.ContextTimeoutWithConfig(middleware.ContextTimeoutConfig{
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/api/v1/bench" || c.Path() == "/api/v1/connections/stream"
+		},
+		Timeout: s.queryTimeout,
+	}))
+	
 	// Configure CORS to allow requests from the web frontend
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins:     []string{"*"}, // Allow all origins for now
@@ -24,22 +40,58 @@ func (s *Server) SetupRoutes() *echo.Echo {
 	// Health check
 	e.GET("/health", s.GetHealth)
 	
-	// API v1 endpoints
-	e.GET("/api/v1/stats", s.GetStats)
-	e.GET("/api/v1/challenges", s.GetChallenges)
-	e.GET("/api/v1/connections", s.GetConnections)
-	e.GET("/api/v1/metrics", s.GetMetrics)
-	e.GET("/api/v1/recent-solves", s.GetRecentSolves)
-	e.GET("/api/v1/logs", s.GetLogs)
-	e.GET("/api/v1/client-behaviors", s.GetClientBehaviors)
+	// API v1 endpoints, individually disabled by EnabledRoutes/DisabledRoutes
+	r := newRouteGate(e, s.enabledRoutes, s.disabledRoutes)
+	r.GET("/api/v1/stats", s.GetStats)
+	r.GET("/api/v1/challenges", s.GetChallenges)
+	r.GET("/api/v1/connections", s.GetConnections)
+	r.GET("/api/v1/connections/bandwidth", s.GetBandwidth)
+	r.GET("/api/v1/connections/stream", s.StreamConnections)
+	r.GET("/api/v1/metrics", s.GetMetrics)
+	r.GET("/api/v1/recent-solves", s.GetRecentSolves)
+	r.GET("/api/v1/solutions/difficulty", s.GetDifficultyDeltas)
+	r.GET("/api/v1/validation/metrics", s.GetValidationMetrics)
+	r.GET("/api/v1/logs", s.GetLogs)
+	r.GET("/api/v1/client-behaviors", s.GetClientBehaviors)
+	r.GET("/api/v1/behavior/:ip/decision", s.GetDifficultyDecision)
+	r.GET("/api/v1/attackers", s.GetAttackers)
+	r.GET("/api/v1/config", s.GetConfig)
 	
 	// Experiment Analytics endpoints
-	e.GET("/api/v1/experiment/summary", s.GetExperimentSummary)
-	e.GET("/api/v1/experiment/success-criteria", s.GetSuccessCriteria)
-	e.GET("/api/v1/experiment/timeline", s.GetScenarioTimeline)
-	e.GET("/api/v1/experiment/performance", s.GetPerformanceMetrics)
-	e.GET("/api/v1/experiment/mitigation", s.GetAttackMitigation)
-	e.GET("/api/v1/experiment/comparison", s.GetExperimentComparison)
+	r.GET("/api/v1/experiment/summary", s.GetExperimentSummary)
+	r.GET("/api/v1/experiment/success-criteria", s.GetSuccessCriteria)
+	r.GET("/api/v1/experiment/timeline", s.GetScenarioTimeline)
+	r.GET("/api/v1/experiment/replay", s.GetReplayTimeline)
+	r.GET("/api/v1/experiment/performance", s.GetPerformanceMetrics)
+	r.GET("/api/v1/experiment/mitigation", s.GetAttackMitigation)
+	r.GET("/api/v1/experiment/comparison", s.GetExperimentComparison)
+	
+	// CPU-intensive benchmark, rate limited per client IP
+	benchLimiter := middleware.RateLimiter(middleware.NewRateLimiterMemoryStoreWithConfig(
+		middleware.RateLimiterMemoryStoreConfig{Rate: rate.Every(30 * time.Second), Burst: 2, ExpiresIn: 5 * time.Minute},
+	))
+	r.GET("/api/v1/bench", s.GetBenchmark, benchLimiter)
+	
+	// HTTP proof-of-work flow, rate limited per client IP
+	powLimiter := middleware.RateLimiter(middleware.NewRateLimiterMemoryStoreWithConfig(
+		middleware.RateLimiterMemoryStoreConfig{Rate: rate.Every(time.Second), Burst: 5, ExpiresIn: 5 * time.Minute},
+	))
+	r.POST("/api/v1/pow/challenges/batch", s.IssueChallengeBatch, powLimiter)
+	r.POST("/api/v1/pow/solve", s.SolveChallenge, powLimiter)
+	r.POST("/api/v1/pow/solve/batch", s.SolveChallengeBatch, powLimiter)
+
+	// Verification for external issuers, only served with a verify API key configured
+	if s.verifyAPIKey != "" {
+		r.POST("/api/v1/pow/verify", s.VerifySolution, s.verifierAuth())
+	}
+
+	// Admin endpoints, only served with an admin token configured
+	if s.adminToken != "" {
+		r.DELETE("/api/v1/behavior/:ip", s.ResetClientBehavior, s.adminAuth())
+		r.POST("/api/v1/admin/rotate-keys", s.RotateKeys, s.adminAuth())
+	}
+
+	r.warnUnmatched()
 	
 	return e
 }
\ No newline at end of file
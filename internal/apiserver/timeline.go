@@ -0,0 +1,178 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+	"world-of-wisdom/internal/database/repository"
+)
+
+const (
+	defaultReplayWindow = 30 * time.Minute
+	maxReplayWindow     = 24 * time.Hour
+
+	// A minute with this many times the median connection count is a surge
+	surgeFactor = 3.0
+)
+
+type replayPhase string
+
+const (
+	phaseQuiet      replayPhase = "quiet"
+	phaseNormal     replayPhase = "normal"
+	phaseSurge      replayPhase = "surge"
+	phaseAttack     replayPhase = "attack"
+	phaseMitigation replayPhase = "mitigation"
+)
+
+// GetReplayTimeline reconstructs what actually happened in a time range from stored
+// connections, challenges and logs, in the same shape as GetScenarioTimeline
+func (s *Server) GetReplayTimeline(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	end := time.Now()
+	if v := c.QueryParam("to"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "to must be an RFC3339 timestamp")
+		}
+		end = parsed
+	}
+
+	start := end.Add(-defaultReplayWindow)
+	if v := c.QueryParam("from"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "from must be an RFC3339 timestamp")
+		}
+		start = parsed
+	}
+
+	if !start.Before(end) {
+		return echo.NewHTTPError(http.StatusBadRequest, "from must be before to")
+	}
+	if end.Sub(start) > maxReplayWindow {
+		return echo.NewHTTPError(http.StatusBadRequest, "time range must not exceed 24h")
+	}
+
+	buckets, err := s.repo.Metrics().GetActivityTimeline(ctx, repository.GetActivityTimelineParams{
+		StartTime: pgtype.Timestamptz{Time: start, Valid: true},
+		EndTime:   pgtype.Timestamptz{Time: end, Valid: true},
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to load activity timeline")
+	}
+
+	response := map[string]interface{}{
+		"events": buildReplayTimeline(buckets, start),
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// buildReplayTimeline classifies every minute and merges consecutive minutes of the same kind into phases
+func buildReplayTimeline(buckets []repository.GetActivityTimelineRow, start time.Time) []map[string]string {
+	baseline := medianConnections(buckets)
+
+	events := []map[string]string{}
+	for i := 0; i < len(buckets); {
+		phase := classifyBucket(buckets[i], baseline)
+
+		j := i
+		for j+1 < len(buckets) && classifyBucket(buckets[j+1], baseline) == phase {
+			j++
+		}
+
+		events = append(events, describePhase(phase, buckets[i:j+1], baseline, start))
+		i = j + 1
+	}
+
+	return events
+}
+
+func classifyBucket(b repository.GetActivityTimelineRow, baseline float64) replayPhase {
+	switch {
+	case b.Connections == 0 && b.Challenges == 0:
+		return phaseQuiet
+	case b.AggressiveAlerts > 0:
+		return phaseAttack
+	case b.Escalations > 0 || b.MaxDifficulty >= 5:
+		return phaseMitigation
+	case baseline > 0 && float64(b.Connections) >= surgeFactor*baseline:
+		return phaseSurge
+	default:
+		return phaseNormal
+	}
+}
+
+func describePhase(phase replayPhase, buckets []repository.GetActivityTimelineRow, baseline float64, start time.Time) map[string]string {
+	var connections, challenges, failed, alerts, escalations int64
+	var peakClients int64
+	var maxDifficulty int32
+	for _, b := range buckets {
+		connections += b.Connections
+		challenges += b.Challenges
+		failed += b.Failed
+		alerts += b.AggressiveAlerts
+		escalations += b.Escalations
+		if b.UniqueClients > peakClients {
+			peakClients = b.UniqueClients
+		}
+		if b.MaxDifficulty > maxDifficulty {
+			maxDifficulty = b.MaxDifficulty
+		}
+	}
+
+	from := int(buckets[0].Bucket.Time.Sub(start).Minutes())
+	if from < 0 {
+		from = 0
+	}
+	to := from + len(buckets)
+
+	event := map[string]string{"time": fmt.Sprintf("%d-%d min", from, to)}
+
+	switch phase {
+	case phaseQuiet:
+		event["event"] = "No client activity"
+		event["icon"], event["color"] = "trending-down", "gray"
+	case phaseNormal:
+		event["event"] = fmt.Sprintf("Normal traffic: %d connections from up to %d clients", connections, peakClients)
+		event["icon"], event["color"] = "users", "blue"
+	case phaseSurge:
+		rate := float64(connections) / float64(len(buckets))
+		event["event"] = fmt.Sprintf("Connection surge: %.0f/min (%.1fx baseline) from up to %d clients", rate, rate/baseline, peakClients)
+		event["icon"], event["color"] = "trending-up", "orange"
+	case phaseAttack:
+		event["event"] = fmt.Sprintf("Aggressive clients detected (%d alerts), %d of %d challenges failed", alerts, failed, challenges)
+		event["icon"], event["color"] = "alert-triangle", "red"
+	case phaseMitigation:
+		event["event"] = fmt.Sprintf("Difficulty escalated to %d (%d escalations)", maxDifficulty, escalations)
+		event["icon"], event["color"] = "shield", "yellow"
+	}
+
+	return event
+}
+
+// medianConnections is the typical per-minute connection count over the active minutes
+func medianConnections(buckets []repository.GetActivityTimelineRow) float64 {
+	counts := make([]int64, 0, len(buckets))
+	for _, b := range buckets {
+		if b.Connections > 0 {
+			counts = append(counts, b.Connections)
+		}
+	}
+	if len(counts) == 0 {
+		return 0
+	}
+
+	sort.Slice(counts, func(i, j int) bool { return counts[i] < counts[j] })
+	mid := len(counts) / 2
+	if len(counts)%2 == 0 {
+		return float64(counts[mid-1]+counts[mid]) / 2
+	}
+	return float64(counts[mid])
+}
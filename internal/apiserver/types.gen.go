@@ -218,6 +218,8 @@ type ChallengesResponseStatus string
 // ConnectionDetail defines model for ConnectionDetail.
 type ConnectionDetail struct {
 	Algorithm           *ConnectionDetailAlgorithm `json:"algorithm,omitempty"`
+	BytesReceived       *int                       `json:"bytesReceived,omitempty"`
+	BytesSent           *int                       `json:"bytesSent,omitempty"`
 	ChallengesAttempted *int                       `json:"challengesAttempted,omitempty"`
 	ChallengesCompleted *int                       `json:"challengesCompleted,omitempty"`
 	ClientId            *string                    `json:"clientId,omitempty"`
@@ -357,11 +359,14 @@ type Solution struct {
 
 // StatsData defines model for StatsData.
 type StatsData struct {
-	Challenges   *ChallengeStats  `json:"challenges,omitempty"`
-	Connections  *ConnectionStats `json:"connections,omitempty"`
-	MiningActive *bool            `json:"miningActive,omitempty"`
-	Stats        *MiningStats     `json:"stats,omitempty"`
-	System       *SystemStats     `json:"system,omitempty"`
+	Challenges  *ChallengeStats  `json:"challenges,omitempty"`
+	Connections *ConnectionStats `json:"connections,omitempty"`
+
+	// DifficultyDistribution Clients seen in the last hour per assigned difficulty
+	DifficultyDistribution *map[string]int `json:"difficultyDistribution,omitempty"`
+	MiningActive           *bool           `json:"miningActive,omitempty"`
+	Stats                  *MiningStats    `json:"stats,omitempty"`
+	System                 *SystemStats    `json:"system,omitempty"`
 }
 
 // StatsResponse defines model for StatsResponse.
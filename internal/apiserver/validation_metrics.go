@@ -0,0 +1,20 @@
+package apiserver
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetValidationMetrics reports the HTTP validation pipeline's counters since startup: how
+// many solutions passed or failed, at which stage, and how often signatures hit the cache
+func (s *Server) GetValidationMetrics(c echo.Context) error {
+	if s.pipeline == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Proof-of-work endpoints are not configured")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":   s.pipeline.GetMetrics(),
+		"status": "success",
+	})
+}
@@ -0,0 +1,126 @@
+package behavior
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DifficultyFactor is one input to a client's difficulty and the levels it added or removed
+type DifficultyFactor struct {
+	Name   string  `json:"name"`
+	Value  float64 `json:"value"`
+	Effect int     `json:"effect"`
+}
+
+// DifficultyDecision explains a client's difficulty: the stored difficulty it started from
+// and every factor that moved it. Previous plus the factor effects is always Difficulty.
+type DifficultyDecision struct {
+	Previous   int                `json:"previous"`
+	Factors    []DifficultyFactor `json:"factors,omitempty"`
+	Difficulty int                `json:"difficulty"`
+	Fallback   bool               `json:"fallback,omitempty"` // Database unavailable, nothing about the client was considered
+}
+
+// difficultyInputs are the client_behaviors columns calculate_adaptive_difficulty reads
+type difficultyInputs struct {
+	failureRate     float64
+	avgSolveTimeMs  int64
+	reconnectRate   float64
+	connectionCount int
+	reputation      float64
+}
+
+// explainAdaptiveDifficulty mirrors calculate_adaptive_difficulty from
+// migrations/002_client_behavior.sql rule by rule, the two must be changed together.
+// The database stays the source of the difficulty itself, whatever the rules here do
+// not account for is attributed to the final clamp to 1-6.
+func explainAdaptiveDifficulty(previous, difficulty int, in difficultyInputs) DifficultyDecision {
+	d := DifficultyDecision{Previous: previous, Difficulty: previous}
+	add := func(name string, value float64, effect int) {
+		if effect != 0 {
+			d.Factors = append(d.Factors, DifficultyFactor{Name: name, Value: value, Effect: effect})
+			d.Difficulty += effect
+		}
+	}
+	solveMs := float64(in.avgSolveTimeMs)
+	count := float64(in.connectionCount)
+
+	switch {
+	case in.failureRate > 0.5:
+		add("failure_rate", in.failureRate, 2)
+	case in.failureRate > 0.3:
+		add("failure_rate", in.failureRate, 1)
+	}
+
+	// Slow solvers get help, solve times should stay in the 10-30s range
+	switch {
+	case in.avgSolveTimeMs > 30000:
+		add("slow_solves", solveMs, -3)
+	case in.avgSolveTimeMs > 20000:
+		add("slow_solves", solveMs, -2)
+	case in.avgSolveTimeMs > 15000:
+		add("slow_solves", solveMs, -1)
+	}
+
+	switch {
+	case in.connectionCount >= 10 && in.failureRate <= 0.1 && in.avgSolveTimeMs < 10000:
+		add("sustained_activity", count, 1)
+	case in.connectionCount >= 20 && in.failureRate <= 0.2:
+		add("sustained_activity", count, 1)
+	}
+
+	switch {
+	case in.avgSolveTimeMs > 0 && in.avgSolveTimeMs < 100:
+		add("bot_solve_speed", solveMs, 3)
+	case in.avgSolveTimeMs < 1000 && in.connectionCount > 50:
+		add("bot_solve_speed", solveMs, 2)
+	}
+
+	switch {
+	case in.connectionCount > 100:
+		add("connection_volume", count, 2)
+	case in.reconnectRate > 0.8:
+		add("reconnect_rate", in.reconnectRate, 2)
+	}
+
+	if in.connectionCount >= 3 && in.avgSolveTimeMs >= 10000 && in.avgSolveTimeMs <= 30000 {
+		add("target_solve_time", solveMs, -1)
+	}
+
+	switch {
+	case in.reputation < 10:
+		add("reputation", in.reputation, 1)
+	case in.reputation > 80:
+		add("reputation", in.reputation, -1)
+	}
+
+	return d.Adjust("range_clamp", float64(d.Difficulty), difficulty)
+}
+
+// Adjust returns the decision moved to difficulty by the named factor, or unchanged when
+// it is already there. The factors are copied, so decisions can be adjusted per connection.
+func (d DifficultyDecision) Adjust(name string, value float64, difficulty int) DifficultyDecision {
+	if difficulty == d.Difficulty {
+		return d
+	}
+	factors := make([]DifficultyFactor, len(d.Factors), len(d.Factors)+1)
+	copy(factors, d.Factors)
+	d.Factors = append(factors, DifficultyFactor{Name: name, Value: value, Effect: difficulty - d.Difficulty})
+	d.Difficulty = difficulty
+	return d
+}
+
+// String lists the factors with their effects, e.g. "failure_rate=0.6 (+2), reputation=85 (-1)"
+func (d DifficultyDecision) String() string {
+	var parts []string
+	if d.Fallback {
+		parts = append(parts, "database unavailable")
+	}
+	for _, f := range d.Factors {
+		parts = append(parts, fmt.Sprintf("%s=%g (%+d)", f.Name, f.Value, f.Effect))
+	}
+	if len(parts) == 0 {
+		return "no adjustment"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,149 @@
+//go:build integration
+
+package behavior
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The escalation tests run the tracker against a real database, since the scoring itself
+// lives in the SQL functions of migrations/002_client_behavior.sql. Point
+// WOW_TEST_DATABASE_URL at a migrated database, `make test-integration` starts one.
+
+// escalationHarness drives one simulated client through the tracker
+type escalationHarness struct {
+	t       *testing.T
+	pool    *pgxpool.Pool
+	tracker *Tracker
+	ip      netip.Addr
+}
+
+func newEscalationHarness(t *testing.T, ip string) *escalationHarness {
+	url := os.Getenv("WOW_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("WOW_TEST_DATABASE_URL not set")
+	}
+	pool, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	h := &escalationHarness{t: t, pool: pool, tracker: NewTracker(pool), ip: netip.MustParseAddr(ip)}
+	h.forget()
+	t.Cleanup(h.forget)
+	return h
+}
+
+// forget removes everything recorded about the client, connection timestamps cascade
+func (h *escalationHarness) forget() {
+	if _, err := h.pool.Exec(context.Background(), "DELETE FROM client_behaviors WHERE ip_address = $1", h.ip); err != nil {
+		h.t.Fatalf("Failed to clear client %s: %v", h.ip, err)
+	}
+}
+
+// connect runs one connection: the challenge result is recorded and the client
+// disconnects. It returns the difficulty the connection was issued.
+func (h *escalationHarness) connect(success bool, solveTime time.Duration) int {
+	ctx := context.Background()
+	cb, err := h.tracker.RecordConnection(ctx, h.ip)
+	if err != nil {
+		h.t.Fatalf("Failed to record connection: %v", err)
+	}
+	if err := h.tracker.RecordChallengeResult(ctx, h.ip, success, solveTime); err != nil {
+		h.t.Fatalf("Failed to record challenge result: %v", err)
+	}
+	if err := h.tracker.RecordDisconnection(ctx, cb.ConnectionTimestampID, success); err != nil {
+		h.t.Fatalf("Failed to record disconnection: %v", err)
+	}
+	return cb.Difficulty
+}
+
+// elapse moves the client's history d into the past, so the test doesn't have to wait
+// out the gaps between a well-behaved client's connections
+func (h *escalationHarness) elapse(d time.Duration) {
+	interval := fmt.Sprintf("%d milliseconds", d.Milliseconds())
+	_, err := h.pool.Exec(context.Background(), `
+		UPDATE connection_timestamps
+		SET connected_at = connected_at - $2::interval,
+		    disconnected_at = disconnected_at - $2::interval
+		WHERE client_behavior_id = (SELECT id FROM client_behaviors WHERE ip_address = $1)`,
+		h.ip, interval)
+	if err != nil {
+		h.t.Fatalf("Failed to shift connection history: %v", err)
+	}
+}
+
+func TestAggressiveClientReachesAttackerTier(t *testing.T) {
+	h := newEscalationHarness(t, "198.51.100.66")
+
+	// Reconnects the moment it is rejected and fails every challenge, fast
+	const maxConnections = 10
+	difficulty := 0
+	for i := 1; i <= maxConnections; i++ {
+		difficulty = h.connect(false, 50*time.Millisecond)
+		if difficulty >= 5 {
+			t.Logf("Aggressive client reached difficulty %d on connection %d", difficulty, i)
+			return
+		}
+	}
+	t.Fatalf("Aggressive client was still at difficulty %d after %d connections, expected 5 or more", difficulty, maxConnections)
+}
+
+func TestWellBehavedClientStaysLow(t *testing.T) {
+	h := newEscalationHarness(t, "198.51.100.67")
+
+	// Solves every challenge in the 10-30s target range and comes back half a minute later
+	for i := 1; i <= 15; i++ {
+		if difficulty := h.connect(true, 12*time.Second); difficulty > DefaultInitialDifficulty {
+			t.Fatalf("Well-behaved client was issued difficulty %d on connection %d, expected at most %d", difficulty, i, DefaultInitialDifficulty)
+		}
+		h.elapse(30 * time.Second)
+	}
+}
+
+// activity reads the connection count and reconnect rate recorded for the client
+func (h *escalationHarness) activity() (int, float64) {
+	var count int32
+	var rate float64
+	err := h.pool.QueryRow(context.Background(),
+		"SELECT connection_count, reconnect_rate FROM client_behaviors WHERE ip_address = $1", h.ip).Scan(&count, &rate)
+	if err != nil {
+		h.t.Fatalf("Failed to read client activity: %v", err)
+	}
+	return int(count), rate
+}
+
+func TestConnectionWindowForgetsOldConnections(t *testing.T) {
+	slow := newEscalationHarness(t, "198.51.100.68")
+	rapid := newEscalationHarness(t, "198.51.100.69")
+	slow.tracker.SetConnectionWindow(time.Hour)
+	rapid.tracker.SetConnectionWindow(time.Hour)
+
+	// One connection every two hours against twenty back to back
+	for i := 0; i < 20; i++ {
+		slow.connect(true, 12*time.Second)
+		slow.elapse(2 * time.Hour)
+		rapid.connect(false, 50*time.Millisecond)
+	}
+	slow.connect(true, 12*time.Second)
+
+	slowCount, slowRate := slow.activity()
+	rapidCount, rapidRate := rapid.activity()
+	if slowCount != 1 || slowRate != 0 {
+		t.Errorf("Expected the slow client to count only its last connection, got %d at reconnect rate %.2f", slowCount, slowRate)
+	}
+	if rapidCount != 20 {
+		t.Errorf("Expected the rapid client to count all 20 connections, got %d", rapidCount)
+	}
+	if rapidRate <= slowRate {
+		t.Errorf("Expected the rapid client's reconnect rate %.2f above the slow client's %.2f", rapidRate, slowRate)
+	}
+}
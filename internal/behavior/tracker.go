@@ -2,18 +2,33 @@ package behavior
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/netip"
 	"sync"
 	"time"
 
+	"world-of-wisdom/internal/database"
 	generated "world-of-wisdom/internal/database/generated"
+	"world-of-wisdom/pkg/metrics"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// DefaultInitialDifficulty is the difficulty a client without history starts at
+const DefaultInitialDifficulty = 2
+
+// NeutralReputation is the reputation of clients without history, and of every client
+// while the database is unavailable
+const NeutralReputation = 50.0
+
+// VoluntaryDifficultyBonus is the reputation earned per level a client solved above the
+// difficulty it was required to, at its own request
+const VoluntaryDifficultyBonus = 2.0
+
 type ClientBehavior struct {
 	IP                    netip.Addr
 	ConnectionCount       int
@@ -25,23 +40,80 @@ type ClientBehavior struct {
 	ReputationScore       float64
 	SuspiciousScore       float64
 	ConnectionTimestampID pgtype.UUID
+	Fallback              bool               // Database unavailable, nothing about the client is known or recorded
+	Decision              DifficultyDecision // How Difficulty was reached, only set by RecordConnection
 }
 
 type Tracker struct {
-	dbpool  *pgxpool.Pool
-	queries *generated.Queries
-	cache   map[string]*ClientBehavior
-	mu      sync.RWMutex
+	db                 generated.DBTX
+	queries            *generated.Queries
+	cache              map[string]*ClientBehavior
+	mu                 sync.RWMutex
+	queryTimeout       time.Duration
+	unknownDifficulty  int           // Difficulty new clients are created with
+	fallbackDifficulty func() int    // Difficulty served while the database is unavailable
+	connectionWindow   time.Duration // Connection count and reconnect rate cover this much recent history, 0 is the whole lifetime
 }
 
-func NewTracker(dbpool *pgxpool.Pool) *Tracker {
+func NewTracker(db generated.DBTX) *Tracker {
 	return &Tracker{
-		dbpool:  dbpool,
-		queries: generated.New(),
-		cache:   make(map[string]*ClientBehavior),
+		db:                 db,
+		queries:            generated.New(),
+		cache:              make(map[string]*ClientBehavior),
+		queryTimeout:       database.DefaultQueryTimeout,
+		unknownDifficulty:  DefaultInitialDifficulty,
+		fallbackDifficulty: func() int { return DefaultInitialDifficulty },
+	}
+}
+
+// SetQueryTimeout bounds the database work done by each tracker call
+func (t *Tracker) SetQueryTimeout(timeout time.Duration) {
+	t.queryTimeout = timeout
+}
+
+// SetInitialUnknownDifficulty sets the difficulty clients without history start at.
+// Adaptive adjustment takes over from there once they have connected.
+func (t *Tracker) SetInitialUnknownDifficulty(difficulty int) {
+	t.unknownDifficulty = difficulty
+}
+
+// SetFallbackDifficulty sets where the difficulty of fallback behaviors comes from,
+// usually the server's global difficulty
+func (t *Tracker) SetFallbackDifficulty(difficulty func() int) {
+	t.fallbackDifficulty = difficulty
+}
+
+// SetConnectionWindow makes the connection count and reconnect rate, and so the difficulty
+// they feed, cover only connections in the last window instead of the client's lifetime
+func (t *Tracker) SetConnectionWindow(window time.Duration) {
+	t.connectionWindow = window
+}
+
+// fallback is the behavior served while the database is unavailable: the global
+// difficulty and a neutral reputation. It is never cached.
+func (t *Tracker) fallback(ip netip.Addr, operation string) *ClientBehavior {
+	metrics.RecordBehaviorFallback(operation)
+	difficulty := t.fallbackDifficulty()
+	return &ClientBehavior{
+		IP:              ip,
+		Difficulty:      difficulty,
+		ReputationScore: NeutralReputation,
+		Fallback:        true,
+		Decision:        DifficultyDecision{Previous: difficulty, Difficulty: difficulty, Fallback: true},
 	}
 }
 
+// createClient records a client seen for the first time
+func (t *Tracker) createClient(ctx context.Context, ip netip.Addr) (generated.ClientBehavior, error) {
+	return t.queries.CreateClientBehavior(ctx, t.db, generated.CreateClientBehaviorParams{
+		IpAddress:  ip,
+		Difficulty: pgtype.Int4{Int32: int32(t.unknownDifficulty), Valid: true},
+	})
+}
+
+// GetClientBehavior returns the tracked behavior of ip, creating it for new clients.
+// If the database is unavailable it returns a fallback behavior along with the error,
+// so the result is always safe to use.
 func (t *Tracker) GetClientBehavior(ctx context.Context, ip netip.Addr) (*ClientBehavior, error) {
 	ipStr := ip.String()
 	
@@ -53,13 +125,16 @@ func (t *Tracker) GetClientBehavior(ctx context.Context, ip netip.Addr) (*Client
 	}
 	t.mu.RUnlock()
 
+	ctx, cancel := database.WithQueryTimeout(ctx, t.queryTimeout)
+	defer cancel()
+
 	// Query from database
-	behavior, err := t.queries.GetClientBehaviorByIP(ctx, t.dbpool, ip)
+	behavior, err := t.queries.GetClientBehaviorByIP(ctx, t.db, ip)
 	if err != nil {
 		// Create new client behavior if not found
-		newBehavior, err := t.queries.CreateClientBehavior(ctx, t.dbpool, ip)
+		newBehavior, err := t.createClient(ctx, ip)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create client behavior: %w", err)
+			return t.fallback(ip, "lookup"), fmt.Errorf("failed to create client behavior: %w", err)
 		}
 		behavior = newBehavior
 	}
@@ -85,44 +160,69 @@ func (t *Tracker) GetClientBehavior(ctx context.Context, ip netip.Addr) (*Client
 	return cb, nil
 }
 
+// RecordConnection counts a new connection from ip and returns its updated behavior.
+// Like GetClientBehavior it returns a fallback behavior along with any database error.
 func (t *Tracker) RecordConnection(ctx context.Context, ip netip.Addr) (*ClientBehavior, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, t.queryTimeout)
+	defer cancel()
+
 	// Update or create client behavior
-	behavior, err := t.queries.UpdateClientBehavior(ctx, t.dbpool, ip)
+	behavior, err := t.queries.UpdateClientBehavior(ctx, t.db, ip)
 	if err != nil {
 		// Try to create if doesn't exist
-		behavior, err = t.queries.CreateClientBehavior(ctx, t.dbpool, ip)
+		behavior, err = t.createClient(ctx, ip)
 		if err != nil {
-			return nil, fmt.Errorf("failed to record connection: %w", err)
+			return t.fallback(ip, "record_connection"), fmt.Errorf("failed to record connection: %w", err)
 		}
 	}
 
 	// Create connection timestamp
-	connTimestamp, err := t.queries.CreateConnectionTimestamp(ctx, t.dbpool, ip)
+	connTimestamp, err := t.queries.CreateConnectionTimestamp(ctx, t.db, ip)
 	if err != nil {
 		log.Printf("Failed to create connection timestamp: %v", err)
 	}
 
-	// Update reconnect rate
-	err = t.queries.UpdateClientReconnectRate(ctx, t.dbpool, ip)
-	if err != nil {
+	// Update reconnect rate, and with a window the connection count too
+	if t.connectionWindow > 0 {
+		windowed, err := t.queries.UpdateClientWindowedActivity(ctx, t.db, generated.UpdateClientWindowedActivityParams{
+			ConnectionWindow: pgtype.Interval{Microseconds: t.connectionWindow.Microseconds(), Valid: true},
+			IpAddress:        ip,
+		})
+		if err != nil {
+			log.Printf("Failed to update windowed connection activity: %v", err)
+		} else {
+			behavior.ConnectionCount = windowed.ConnectionCount
+			behavior.ReconnectRate = windowed.ReconnectRate
+		}
+	} else if err := t.queries.UpdateClientReconnectRate(ctx, t.db, ip); err != nil {
 		log.Printf("Failed to update reconnect rate: %v", err)
 	}
 
 	// Calculate and update difficulty
 	oldDifficulty := behavior.Difficulty.Int32
-	newDifficulty, err := t.queries.CalculateAndUpdateClientDifficulty(ctx, t.dbpool, ip)
+	newDifficulty := behavior.Difficulty
+	decision := DifficultyDecision{Previous: int(oldDifficulty), Difficulty: int(oldDifficulty)}
+	adaptive, err := t.queries.CalculateAndUpdateClientDifficulty(ctx, t.db, ip)
 	if err != nil {
 		log.Printf("Failed to calculate adaptive difficulty: %v", err)
-		newDifficulty = behavior.Difficulty
+	} else {
+		newDifficulty = adaptive.Difficulty
+		decision = explainAdaptiveDifficulty(int(oldDifficulty), int(adaptive.Difficulty.Int32), difficultyInputs{
+			failureRate:     adaptive.FailureRate.Float64,
+			avgSolveTimeMs:  adaptive.AvgSolveTimeMs.Int64,
+			reconnectRate:   adaptive.ReconnectRate.Float64,
+			connectionCount: int(adaptive.ConnectionCount.Int32),
+			reputation:      adaptive.ReputationScore.Float64,
+		})
 	}
 	
 	// Log difficulty change if it occurred
 	if oldDifficulty != newDifficulty.Int32 {
-		log.Printf("Client %s difficulty changed from %d to %d", ip.String(), oldDifficulty, newDifficulty.Int32)
+		log.Printf("Client %s difficulty changed from %d to %d: %s", ip.String(), oldDifficulty, newDifficulty.Int32, decision)
 	}
 
 	// Update suspicious activity score
-	err = t.queries.UpdateSuspiciousActivityScore(ctx, t.dbpool, ip)
+	err = t.queries.UpdateSuspiciousActivityScore(ctx, t.db, ip)
 	if err != nil {
 		log.Printf("Failed to update suspicious activity score: %v", err)
 	}
@@ -139,6 +239,7 @@ func (t *Tracker) RecordConnection(ctx context.Context, ip netip.Addr) (*ClientB
 		ReputationScore:       behavior.ReputationScore.Float64,
 		SuspiciousScore:       behavior.SuspiciousActivityScore.Float64,
 		ConnectionTimestampID: connTimestamp.ID,
+		Decision:              decision,
 	}
 
 	// Update cache
@@ -150,8 +251,11 @@ func (t *Tracker) RecordConnection(ctx context.Context, ip netip.Addr) (*ClientB
 }
 
 func (t *Tracker) RecordChallengeResult(ctx context.Context, ip netip.Addr, success bool, solveTime time.Duration) error {
+	ctx, cancel := database.WithQueryTimeout(ctx, t.queryTimeout)
+	defer cancel()
+
 	// Update challenge statistics
-	err := t.queries.UpdateClientChallengeStats(ctx, t.dbpool, generated.UpdateClientChallengeStatsParams{
+	err := t.queries.UpdateClientChallengeStats(ctx, t.db, generated.UpdateClientChallengeStatsParams{
 		IpAddress:    ip,
 		IsSuccessful: success,
 		SolveTimeMs:  solveTime.Milliseconds(),
@@ -161,7 +265,7 @@ func (t *Tracker) RecordChallengeResult(ctx context.Context, ip netip.Addr, succ
 	}
 
 	// Update reputation based on result
-	err = t.queries.UpdateClientReputation(ctx, t.dbpool, generated.UpdateClientReputationParams{
+	err = t.queries.UpdateClientReputation(ctx, t.db, generated.UpdateClientReputationParams{
 		IpAddress:        ip,
 		ChallengeSuccess: success,
 	})
@@ -170,13 +274,13 @@ func (t *Tracker) RecordChallengeResult(ctx context.Context, ip netip.Addr, succ
 	}
 
 	// Recalculate difficulty
-	_, err = t.queries.CalculateAndUpdateClientDifficulty(ctx, t.dbpool, ip)
+	_, err = t.queries.CalculateAndUpdateClientDifficulty(ctx, t.db, ip)
 	if err != nil {
 		log.Printf("Failed to recalculate difficulty: %v", err)
 	}
 
 	// Update suspicious activity score
-	err = t.queries.UpdateSuspiciousActivityScore(ctx, t.dbpool, ip)
+	err = t.queries.UpdateSuspiciousActivityScore(ctx, t.db, ip)
 	if err != nil {
 		log.Printf("Failed to update suspicious activity score: %v", err)
 	}
@@ -189,12 +293,36 @@ func (t *Tracker) RecordChallengeResult(ctx context.Context, ip netip.Addr, succ
 	return nil
 }
 
+// RecordVoluntaryDifficulty rewards a client that solved levels above its required
+// difficulty by choice, on top of the reputation of the challenge result itself
+func (t *Tracker) RecordVoluntaryDifficulty(ctx context.Context, ip netip.Addr, levels int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx, t.queryTimeout)
+	defer cancel()
+
+	err := t.queries.AddClientReputation(ctx, t.db, generated.AddClientReputationParams{
+		Bonus:     VoluntaryDifficultyBonus * float64(levels),
+		IpAddress: ip,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add reputation: %w", err)
+	}
+
+	t.mu.Lock()
+	delete(t.cache, ip.String())
+	t.mu.Unlock()
+
+	return nil
+}
+
 func (t *Tracker) RecordDisconnection(ctx context.Context, connectionTimestampID pgtype.UUID, challengeCompleted bool) error {
 	if connectionTimestampID == (pgtype.UUID{}) {
 		return nil // Skip if no valid ID
 	}
 
-	err := t.queries.UpdateConnectionTimestamp(ctx, t.dbpool, generated.UpdateConnectionTimestampParams{
+	ctx, cancel := database.WithQueryTimeout(ctx, t.queryTimeout)
+	defer cancel()
+
+	err := t.queries.UpdateConnectionTimestamp(ctx, t.db, generated.UpdateConnectionTimestampParams{
 		ID:                 connectionTimestampID,
 		ChallengeCompleted: challengeCompleted,
 	})
@@ -206,15 +334,164 @@ func (t *Tracker) RecordDisconnection(ctx context.Context, connectionTimestampID
 }
 
 func (t *Tracker) GetActiveClients(ctx context.Context, limit int) ([]generated.GetActiveClientsRow, error) {
-	return t.queries.GetActiveClients(ctx, t.dbpool, int32(limit))
+	ctx, cancel := database.WithQueryTimeout(ctx, t.queryTimeout)
+	defer cancel()
+
+	return t.queries.GetActiveClients(ctx, t.db, int32(limit))
+}
+
+// GetActiveClientSummary aggregates every client seen in the last hour in the database
+func (t *Tracker) GetActiveClientSummary(ctx context.Context) (generated.GetActiveClientSummaryRow, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, t.queryTimeout)
+	defer cancel()
+
+	return t.queries.GetActiveClientSummary(ctx, t.db)
+}
+
+// GetActiveClientsByDifficulty aggregates every client seen in the last hour per difficulty
+func (t *Tracker) GetActiveClientsByDifficulty(ctx context.Context) ([]generated.GetActiveClientsByDifficultyRow, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, t.queryTimeout)
+	defer cancel()
+
+	return t.queries.GetActiveClientsByDifficulty(ctx, t.db)
 }
 
 func (t *Tracker) GetClientStats(ctx context.Context, limit int) ([]generated.GetClientBehaviorStatsRow, error) {
-	return t.queries.GetClientBehaviorStats(ctx, t.dbpool, int32(limit))
+	ctx, cancel := database.WithQueryTimeout(ctx, t.queryTimeout)
+	defer cancel()
+
+	return t.queries.GetClientBehaviorStats(ctx, t.db, int32(limit))
 }
 
 func (t *Tracker) GetAggressiveClients(ctx context.Context, limit int) ([]generated.GetTopAggressiveClientsRow, error) {
-	return t.queries.GetTopAggressiveClients(ctx, t.dbpool, int32(limit))
+	ctx, cancel := database.WithQueryTimeout(ctx, t.queryTimeout)
+	defer cancel()
+
+	return t.queries.GetTopAggressiveClients(ctx, t.db, int32(limit))
+}
+
+func (t *Tracker) GetAttackers(ctx context.Context, params generated.GetAttackersParams) ([]generated.GetAttackersRow, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, t.queryTimeout)
+	defer cancel()
+
+	return t.queries.GetAttackers(ctx, t.db, params)
+}
+
+// AttackerDifficulty is the difficulty at which a client is considered a flagged attacker
+const AttackerDifficulty = 5
+
+// Aggregates summarizes the clients seen in the last hour
+type Aggregates struct {
+	ClientsByDifficulty map[int]int
+	FlaggedAttackers    int
+	AvgReputation       float64
+	AvgSuspiciousScore  float64
+	NewClientsPerMinute int
+}
+
+// DifficultyDistribution counts the clients seen in the last hour per difficulty, from
+// the same aggregate query as ComputeAggregates rather than a scan of every client
+func (t *Tracker) DifficultyDistribution(ctx context.Context) (map[int]int, error) {
+	rows, err := t.GetActiveClientsByDifficulty(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get difficulty distribution: %w", err)
+	}
+
+	distribution := make(map[int]int, len(rows))
+	for _, row := range rows {
+		distribution[int(row.Difficulty.Int32)] += int(row.Clients)
+	}
+	return distribution, nil
+}
+
+// ComputeAggregates summarizes every client seen in the last hour, aggregated in the database
+func (t *Tracker) ComputeAggregates(ctx context.Context) (*Aggregates, error) {
+	summary, err := t.GetActiveClientSummary(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client summary: %w", err)
+	}
+
+	byDifficulty, err := t.GetActiveClientsByDifficulty(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get clients by difficulty: %w", err)
+	}
+
+	agg := &Aggregates{
+		ClientsByDifficulty: make(map[int]int),
+		AvgReputation:       summary.AvgReputation,
+		AvgSuspiciousScore:  summary.AvgSuspiciousScore,
+		NewClientsPerMinute: int(summary.NewClientsLastMinute),
+	}
+	for _, row := range byDifficulty {
+		difficulty := int(row.Difficulty.Int32)
+		agg.ClientsByDifficulty[difficulty] += int(row.Clients)
+		if difficulty >= AttackerDifficulty {
+			agg.FlaggedAttackers += int(row.Clients)
+		}
+	}
+
+	return agg, nil
+}
+
+// ErrUnknownClient is returned by ResetClient for an IP without a behavior record
+var ErrUnknownClient = errors.New("no behavior recorded for client")
+
+// ResetClient clears the reputation, suspicious score, failure rate and difficulty ip has
+// accumulated and drops its cache entry, for clients that were misclassified
+func (t *Tracker) ResetClient(ctx context.Context, ip netip.Addr) (*ClientBehavior, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, t.queryTimeout)
+	defer cancel()
+
+	behavior, err := t.queries.ResetClientBehavior(ctx, t.db, generated.ResetClientBehaviorParams{
+		IpAddress:  ip,
+		Difficulty: pgtype.Int4{Int32: int32(t.unknownDifficulty), Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUnknownClient
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reset client behavior: %w", err)
+	}
+
+	t.mu.Lock()
+	delete(t.cache, ip.String())
+	t.mu.Unlock()
+
+	return &ClientBehavior{
+		IP:              ip,
+		ConnectionCount: int(behavior.ConnectionCount.Int32),
+		FailureRate:     behavior.FailureRate.Float64,
+		AvgSolveTime:    time.Duration(behavior.AvgSolveTimeMs.Int64) * time.Millisecond,
+		LastConnection:  behavior.LastConnection.Time,
+		ReconnectRate:   behavior.ReconnectRate.Float64,
+		Difficulty:      int(behavior.Difficulty.Int32),
+		ReputationScore: behavior.ReputationScore.Float64,
+		SuspiciousScore: behavior.SuspiciousActivityScore.Float64,
+	}, nil
+}
+
+// ErrNoDecision is returned by LatestDecision for an IP without a recorded difficulty decision
+var ErrNoDecision = errors.New("no difficulty decision recorded for client")
+
+// LatestDecision returns the difficulty decision stored with the most recent challenge
+// issued to ip, and when that challenge was issued
+func (t *Tracker) LatestDecision(ctx context.Context, ip netip.Addr) (*DifficultyDecision, time.Time, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, t.queryTimeout)
+	defer cancel()
+
+	row, err := t.queries.GetLatestDifficultyDecision(ctx, t.db, ip)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, time.Time{}, ErrNoDecision
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to get difficulty decision: %w", err)
+	}
+
+	var decision DifficultyDecision
+	if err := json.Unmarshal(row.DifficultyDecision, &decision); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to decode difficulty decision: %w", err)
+	}
+	return &decision, row.CreatedAt.Time, nil
 }
 
 func (t *Tracker) ClearCache() {
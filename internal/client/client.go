@@ -2,22 +2,81 @@ package client
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"world-of-wisdom/pkg/logger"
 	"world-of-wisdom/pkg/pow"
 )
 
+// retryPrefix replaces the solution when collecting a quote earned on a lost connection
+const retryPrefix = "RETRY "
+
+// framedHello tells the server this client reads length-prefixed challenge frames
+const framedHello = "FRAMED\n"
+
+// busyPrefix starts the line an overloaded server sends instead of a challenge
+const busyPrefix = "BUSY retry-after="
+
+// busyError is a connection the server shed, asking to be retried no sooner than retryAfter
+type busyError struct {
+	retryAfter time.Duration
+}
+
+func (e *busyError) Error() string {
+	return fmt.Sprintf("server busy, retry after %v", e.retryAfter)
+}
+
+// parseBusy recognizes the busy line, "BUSY retry-after=<seconds>"
+func parseBusy(line []byte) (*busyError, bool) {
+	seconds, ok := bytes.CutPrefix(line, []byte(busyPrefix))
+	if !ok {
+		return nil, false
+	}
+	n, err := strconv.Atoi(string(seconds))
+	if err != nil || n < 0 {
+		n = 0
+	}
+	return &busyError{retryAfter: time.Duration(n) * time.Second}, true
+}
+
+// hintRejectedPrefix starts the line a server sends ahead of the challenge when it doesn't
+// grant the difficulty hint, followed by the difficulty it enforces instead
+const hintRejectedPrefix = "HINT rejected difficulty="
+
+// quoteSignatureMaxAge bounds how old a quote signature may be, allowing for clock skew
+const quoteSignatureMaxAge = 5 * time.Minute
+
 type Client struct {
 	serverAddr string
 	timeout    time.Duration
 	maxRetries int
 	retryDelay time.Duration
 	encoder    *pow.ChallengeEncoder
+	quoteKeys  pow.KeyManager // Set to require and verify quote signatures
+	difficulty int            // Difficulty asked for in the hello, 0 takes what the server requires
+
+	maxDifficulty  int                         // Challenges above it are declined, 0 accepts any
+	previewHandler func(ChallengePreview) bool // Decides whether a previewed challenge is solved
+	hashRates      hashRates                   // Measured solve speed per algorithm, for previews
+	stats          requestStats
+}
+
+// requestStats counts quote requests by how they ended. Declined requests are the client's
+// own choice and are not counted as failed.
+type requestStats struct {
+	total, successful, failed, declined atomic.Int64
+	solves, solveTime                   atomic.Int64 // Challenges solved and their total time in nanoseconds
 }
 
 func NewClient(serverAddr string, timeout time.Duration) *Client {
@@ -38,61 +97,138 @@ func (c *Client) RequestQuote() (string, error) {
 	return c.requestQuoteWithRetry(c.maxRetries)
 }
 
+// requestQuoteWithRetry sends a solve token with every solution. When a solution was sent
+// but the response got lost, the next attempt asks the server for the quote earned with
+// that token instead of solving a new challenge. A busy server's retry-after stretches
+// the delay before the next attempt.
 func (c *Client) requestQuoteWithRetry(retriesLeft int) (string, error) {
-	quote, err := c.attemptRequestQuote()
+	c.stats.total.Add(1)
+	token, err := newSolveToken()
 	if err != nil {
-		if retriesLeft > 0 {
-			log.Printf("Request failed: %v. Retrying in %v... (%d retries left)", err, c.retryDelay, retriesLeft)
-			time.Sleep(c.retryDelay)
-			return c.requestQuoteWithRetry(retriesLeft - 1)
+		c.stats.failed.Add(1)
+		return "", err
+	}
+	redeem := false
+	for {
+		quote, solved, err := c.attemptRequestQuote(token, redeem)
+		if err == nil {
+			c.stats.successful.Add(1)
+			return quote, nil
+		}
+		// Declining is a decision to back off, retrying would just be offered the same
+		if errors.Is(err, ErrChallengeDeclined) {
+			c.stats.declined.Add(1)
+			return "", err
 		}
-		return "", fmt.Errorf("failed after %d retries: %w", c.maxRetries, err)
+		if errors.Is(err, ErrUnsupportedAlgorithm) {
+			c.stats.failed.Add(1)
+			return "", err
+		}
+		if retriesLeft == 0 {
+			c.stats.failed.Add(1)
+			return "", fmt.Errorf("failed after %d retries: %w", c.maxRetries, err)
+		}
+		delay := c.retryDelay
+		var busy *busyError
+		if errors.As(err, &busy) {
+			// Nothing was exchanged, a pending redeem is still pending
+			delay = max(delay, busy.retryAfter)
+		} else {
+			redeem = solved && !redeem
+		}
+		log.Printf("Request failed: %v. Retrying in %v... (%d retries left)", err, delay, retriesLeft)
+		time.Sleep(delay)
+		retriesLeft--
+	}
+}
+
+// decodeError explains a challenge that failed to decode, telling an outdated client to
+// upgrade rather than reporting a raw decode failure
+func decodeError(format pow.ChallengeFormat, err error) error {
+	var unknown *pow.UnknownAlgorithmError
+	if errors.As(err, &unknown) {
+		return fmt.Errorf("%w (%v)", ErrUnsupportedAlgorithm, unknown)
+	}
+	return fmt.Errorf("failed to decode %s challenge: %w", format, err)
+}
+
+// newSolveToken returns a random token identifying one quote request across retries
+func newSolveToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate solve token: %w", err)
 	}
-	return quote, nil
+	return hex.EncodeToString(b), nil
 }
 
-func (c *Client) attemptRequestQuote() (string, error) {
+// attemptRequestQuote runs one connection. With redeem set it asks for the quote already
+// earned with token, otherwise it solves the challenge. solved reports whether a solution
+// was sent without a rejection coming back, so the quote may have been earned.
+func (c *Client) attemptRequestQuote(token string, redeem bool) (quote string, solved bool, err error) {
 	conn, err := net.DialTimeout("tcp", c.serverAddr, c.timeout)
 	if err != nil {
-		return "", fmt.Errorf("failed to connect to server: %w", err)
+		return "", false, fmt.Errorf("failed to connect to server: %w", err)
 	}
 	defer conn.Close()
 
-	conn.SetDeadline(time.Now().Add(c.timeout))
+	// Solving stops with the connection's deadline, a late solution would never be read
+	deadline := time.Now().Add(c.timeout)
+	conn.SetDeadline(deadline)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
 
-	scanner := bufio.NewScanner(conn)
-	if !scanner.Scan() {
-		return "", fmt.Errorf("failed to receive challenge from server")
+	challengeData, reader, err := c.receiveChallenge(conn)
+	if err != nil {
+		return "", false, err
 	}
-
-	challengeData := scanner.Bytes()
+	scanner := bufio.NewScanner(reader)
 	log.Printf("Received challenge data: %d bytes", len(challengeData))
 
-	// Auto-detect format and decode challenge
+	// Auto-detect format and decode challenge, a redeemed quote is signed with it too
 	format := c.encoder.AutoDetectFormat(challengeData)
 	log.Printf("Detected challenge format: %s", format)
 	
 	secureChallenge, err := c.encoder.Decode(challengeData, format, "")
 	if err != nil {
-		return "", fmt.Errorf("failed to decode %s challenge: %w", format, err)
+		return "", false, decodeError(format, err)
+	}
+
+	if redeem {
+		log.Printf("Requesting the quote earned with solve token %s", logger.MaskSensitive(token))
+		return c.exchange(conn, scanner, retryPrefix+token, false, secureChallenge.Seed)
 	}
 
 	log.Printf("Decoded secure challenge: Algorithm=%s, Difficulty=%d, ExpiresAt=%d", 
 		secureChallenge.Algorithm, secureChallenge.Difficulty, secureChallenge.ExpiresAt)
 
+	// Look before spending any work on it
+	if err := c.reviewChallenge(secureChallenge); err != nil {
+		return "", false, err
+	}
+
 	// Solve the challenge
 	var solution string
 	start := time.Now()
 
-	if secureChallenge.Algorithm == "sha256" {
+	if secureChallenge.Algorithm == "sha256" && secureChallenge.Target != "" {
+		// Solve SHA-256 challenge below a target
+		target, err := secureChallenge.TargetValue()
+		if err != nil {
+			return "", false, err
+		}
+		solution, err = pow.SolveTargetChallengeCtx(ctx, secureChallenge.Seed, target)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to solve SHA-256 target challenge: %w", err)
+		}
+	} else if secureChallenge.Algorithm == "sha256" {
 		// Solve SHA-256 challenge
 		challenge := &pow.Challenge{
 			Seed:       secureChallenge.Seed,
 			Difficulty: secureChallenge.Difficulty,
 		}
-		solution, err = pow.SolveChallenge(challenge)
+		solution, err = pow.SolveChallengeCtx(ctx, challenge)
 		if err != nil {
-			return "", fmt.Errorf("failed to solve SHA-256 challenge: %w", err)
+			return "", false, fmt.Errorf("failed to solve SHA-256 challenge: %w", err)
 		}
 	} else if secureChallenge.Algorithm == "argon2" {
 		// Solve Argon2 challenge
@@ -106,33 +242,115 @@ func (c *Client) attemptRequestQuote() (string, error) {
 			challenge.Threads = secureChallenge.Argon2Params.Threads
 			challenge.KeyLen = secureChallenge.Argon2Params.KeyLength
 		}
-		solution, err = pow.SolveArgon2Challenge(challenge)
+		solution, err = pow.SolveArgon2ChallengeCtx(ctx, challenge)
 		if err != nil {
-			return "", fmt.Errorf("failed to solve Argon2 challenge: %w", err)
+			return "", false, fmt.Errorf("failed to solve Argon2 challenge: %w", err)
 		}
 	} else {
-		return "", fmt.Errorf("unsupported algorithm: %s", secureChallenge.Algorithm)
+		return "", false, fmt.Errorf("unsupported algorithm: %s", secureChallenge.Algorithm)
 	}
 	elapsed := time.Since(start)
 
 	log.Printf("Solved challenge in %v, sending solution: %s", elapsed, logger.MaskSensitive(solution))
 
-	_, err = conn.Write([]byte(solution + "\n"))
-	if err != nil {
-		return "", fmt.Errorf("failed to send solution: %w", err)
+	// The solvers count nonces up from zero, so the winning nonce tells the attempts.
+	// The server stores this report for analytics only.
+	line := solution + " " + token
+	if nonce, err := strconv.Atoi(solution); err == nil {
+		line += fmt.Sprintf(" attempts=%d ms=%d", nonce+1, elapsed.Milliseconds())
+		c.hashRates.observe(secureChallenge.Algorithm, nonce+1, elapsed)
+	}
+	c.stats.solves.Add(1)
+	c.stats.solveTime.Add(int64(elapsed))
+
+	return c.exchange(conn, scanner, line, true, secureChallenge.Seed)
+}
+
+// exchange sends line and reads the server's answer. sent is passed through as solved
+// unless the server rejected the line. With quote keys set the quote must be followed by
+// a valid signature over it and the seed of the challenge received on this connection.
+func (c *Client) exchange(conn net.Conn, scanner *bufio.Scanner, line string, sent bool, seed string) (string, bool, error) {
+	if _, err := conn.Write([]byte(line + "\n")); err != nil {
+		return "", false, fmt.Errorf("failed to send solution: %w", err)
 	}
 
 	if !scanner.Scan() {
-		return "", fmt.Errorf("failed to receive response from server")
+		return "", sent, fmt.Errorf("failed to receive response from server")
 	}
 
 	response := scanner.Text()
 
 	if strings.HasPrefix(response, "Error:") {
-		return "", fmt.Errorf("server error: %s", response)
+		return "", false, fmt.Errorf("server error: %s", response)
+	}
+
+	if c.quoteKeys != nil {
+		if !scanner.Scan() {
+			return "", sent, fmt.Errorf("quote arrived without a signature")
+		}
+		if err := pow.VerifyQuote(c.quoteKeys, response, seed, scanner.Text(), quoteSignatureMaxAge); err != nil {
+			return "", sent, fmt.Errorf("rejected quote: %w", err)
+		}
 	}
 
-	return response, nil
+	return response, sent, nil
+}
+
+// receiveChallenge announces that the client reads framed challenges and returns the
+// challenge data, along with the reader the rest of the exchange continues on. Servers
+// that don't negotiate framing send a newline-delimited challenge instead.
+func (c *Client) receiveChallenge(conn net.Conn) ([]byte, *bufio.Reader, error) {
+	hello := framedHello
+	if c.difficulty > 0 {
+		hello = fmt.Sprintf("FRAMED difficulty=%d\n", c.difficulty)
+	}
+	if _, err := conn.Write([]byte(hello)); err != nil {
+		return nil, nil, fmt.Errorf("failed to send hello: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to receive challenge from server")
+		}
+
+		if pow.IsFrameStart(first[0]) {
+			data, _, err := pow.ReadFrame(reader)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to receive challenge from server: %w", err)
+			}
+			return data, reader, nil
+		}
+
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to receive challenge from server")
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if busy, ok := parseBusy(line); ok {
+			return nil, nil, busy
+		}
+		// The challenge follows at the difficulty the server enforces
+		if enforced, ok := bytes.CutPrefix(line, []byte(hintRejectedPrefix)); ok {
+			log.Printf("Server rejected difficulty hint %d, enforcing %s", c.difficulty, enforced)
+			continue
+		}
+		return line, reader, nil
+	}
+}
+
+// SetDifficultyHint asks the server for challenges of at least difficulty, e.g. to build
+// reputation by solving harder ones than required. Servers only grant hints between the
+// difficulty they require and their maximum, 0 removes the hint.
+func (c *Client) SetDifficultyHint(difficulty int) {
+	c.difficulty = difficulty
+}
+
+// SetQuoteVerification makes the client require signed quotes and verify them with the
+// server's signing keys, for trusted clients on servers running with SIGN_QUOTES
+func (c *Client) SetQuoteVerification(keyManager pow.KeyManager) {
+	c.quoteKeys = keyManager
 }
 
 // SetRetryConfig allows customizing retry behavior
@@ -141,6 +359,20 @@ func (c *Client) SetRetryConfig(maxRetries int, retryDelay time.Duration) {
 	c.retryDelay = retryDelay
 }
 
+// GetStats returns how the client's quote requests ended so far
+func (c *Client) GetStats() ClientStats {
+	stats := ClientStats{
+		TotalRequests:      int(c.stats.total.Load()),
+		SuccessfulRequests: int(c.stats.successful.Load()),
+		FailedRequests:     int(c.stats.failed.Load()),
+		DeclinedRequests:   int(c.stats.declined.Load()),
+	}
+	if solves := c.stats.solves.Load(); solves > 0 {
+		stats.AverageSolveTime = time.Duration(c.stats.solveTime.Load() / solves)
+	}
+	return stats
+}
+
 // Legacy parsing functions removed - only JSON format supported
 
 func (c *Client) RequestMultipleQuotes(count int) []string {
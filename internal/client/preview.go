@@ -0,0 +1,117 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"world-of-wisdom/pkg/pow"
+)
+
+// ErrChallengeDeclined is wrapped by the error of a request the client gave up on after
+// previewing the challenge, rather than one that failed
+var ErrChallengeDeclined = errors.New("challenge declined")
+
+// ErrUnsupportedAlgorithm is wrapped by the error of a request whose challenge uses an
+// algorithm added to the server after this client was built. Retrying can't help.
+var ErrUnsupportedAlgorithm = errors.New("server uses an algorithm this client doesn't support, upgrade the client")
+
+// ChallengePreview describes a received challenge before any work is spent on it
+type ChallengePreview struct {
+	Algorithm  string
+	Difficulty int
+	ExpiresAt  time.Time
+
+	// EstimatedSolveTime is the expected solve time at the hash rate of this client's
+	// previous solves of the algorithm, or a slow reference client's before any
+	EstimatedSolveTime time.Duration
+}
+
+// hashRates remembers how fast this client solved each algorithm, in hashes per second
+type hashRates struct {
+	mu    sync.Mutex
+	rates map[string]float64
+}
+
+// observe folds a solve into the algorithm's rate, averaging it with the previous one
+func (h *hashRates) observe(algorithm string, attempts int, elapsed time.Duration) {
+	if attempts <= 0 || elapsed <= 0 {
+		return
+	}
+	rate := float64(attempts) / elapsed.Seconds()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rates == nil {
+		h.rates = make(map[string]float64)
+	}
+	if previous, ok := h.rates[algorithm]; ok {
+		rate = (previous + rate) / 2
+	}
+	h.rates[algorithm] = rate
+}
+
+func (h *hashRates) rate(algorithm string) float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.rates[algorithm]
+}
+
+// PreviewChallenge describes challenge without solving it
+func (c *Client) PreviewChallenge(challenge *pow.SecureChallenge) ChallengePreview {
+	preview := ChallengePreview{
+		Algorithm:  challenge.Algorithm,
+		Difficulty: challenge.Difficulty,
+		ExpiresAt:  time.UnixMicro(challenge.ExpiresAt),
+	}
+
+	rate := c.hashRates.rate(challenge.Algorithm)
+	if rate <= 0 {
+		preview.EstimatedSolveTime = pow.ExpectedSolveTime(challenge.Algorithm, challenge.Difficulty)
+		return preview
+	}
+
+	// A hex leading-zero difficulty takes 16^d hashes on average, a target the same at its
+	// fractional difficulty
+	hashes := math.Pow(16, float64(challenge.Difficulty))
+	if target, err := challenge.TargetValue(); err == nil && target != nil {
+		hashes = math.Pow(16, pow.TargetToDifficulty(target))
+	}
+	seconds := hashes / rate
+	if seconds >= math.MaxInt64/float64(time.Second) {
+		preview.EstimatedSolveTime = time.Duration(math.MaxInt64)
+	} else {
+		preview.EstimatedSolveTime = time.Duration(seconds * float64(time.Second))
+	}
+	return preview
+}
+
+// SetMaxAcceptableDifficulty makes the client decline challenges harder than difficulty
+// instead of solving them, e.g. to back off once the server escalates it to attacker
+// levels. 0 accepts any difficulty.
+func (c *Client) SetMaxAcceptableDifficulty(difficulty int) {
+	c.maxDifficulty = difficulty
+}
+
+// SetPreviewHandler lets accept decide from the preview whether each challenge is solved,
+// after the maximum acceptable difficulty has been checked. nil solves every challenge.
+func (c *Client) SetPreviewHandler(accept func(ChallengePreview) bool) {
+	c.previewHandler = accept
+}
+
+// reviewChallenge returns an error wrapping ErrChallengeDeclined when the client won't
+// spend the work challenge asks for
+func (c *Client) reviewChallenge(challenge *pow.SecureChallenge) error {
+	preview := c.PreviewChallenge(challenge)
+	if c.maxDifficulty > 0 && preview.Difficulty > c.maxDifficulty {
+		return fmt.Errorf("%w: difficulty %d exceeds the maximum acceptable %d (estimated %v)",
+			ErrChallengeDeclined, preview.Difficulty, c.maxDifficulty, preview.EstimatedSolveTime)
+	}
+	if c.previewHandler != nil && !c.previewHandler(preview) {
+		return fmt.Errorf("%w: %s difficulty %d (estimated %v)",
+			ErrChallengeDeclined, preview.Algorithm, preview.Difficulty, preview.EstimatedSolveTime)
+	}
+	return nil
+}
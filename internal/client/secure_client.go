@@ -44,12 +44,13 @@ func (sc *SecureClient) attemptRequestQuote() (string, error) {
 
 	conn.SetDeadline(time.Now().Add(sc.timeout))
 
-	scanner := bufio.NewScanner(conn)
-	if !scanner.Scan() {
-		return "", fmt.Errorf("failed to receive challenge from server")
+	// Binary challenges may contain newlines, so they are read as a length-prefixed frame.
+	// Only the response after the solution is line-based.
+	challengeData, reader, err := sc.receiveChallenge(conn)
+	if err != nil {
+		return "", err
 	}
-
-	challengeData := scanner.Bytes()
+	scanner := bufio.NewScanner(reader)
 	log.Printf("Received challenge data: %d bytes", len(challengeData))
 
 	// Auto-detect format and handle accordingly
@@ -64,7 +65,7 @@ func (sc *SecureClient) handleSecureChallenge(conn net.Conn, challengeData []byt
 	// Decode challenge using detected format
 	challenge, err := sc.encoder.Decode(challengeData, format, sc.clientID)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode %s challenge: %w", format, err)
+		return "", decodeError(format, err)
 	}
 
 	// Client ID is already set by decoder if needed
@@ -195,20 +196,8 @@ type ClientStats struct {
 	TotalRequests     int           `json:"total_requests"`
 	SuccessfulRequests int           `json:"successful_requests"`
 	FailedRequests    int           `json:"failed_requests"`
+	DeclinedRequests  int           `json:"declined_requests"` // Challenges refused after preview, not failures
 	AverageSolveTime  time.Duration `json:"average_solve_time"`
 	SecureChallenges  int           `json:"secure_challenges"`
 	LegacyChallenges  int           `json:"legacy_challenges"`
 }
-
-// GetStats returns client performance statistics
-func (sc *SecureClient) GetStats() ClientStats {
-	// This would be implemented with proper statistics collection
-	return ClientStats{
-		TotalRequests:     0,
-		SuccessfulRequests: 0,
-		FailedRequests:    0,
-		AverageSolveTime:  0,
-		SecureChallenges:  0,
-		LegacyChallenges:  0,
-	}
-}
\ No newline at end of file
@@ -3,10 +3,22 @@ package database
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// DefaultQueryTimeout bounds a single database call when no timeout is configured
+const DefaultQueryTimeout = 5 * time.Second
+
+// WithQueryTimeout derives a context for one database call so a hung query can't pile up goroutines
+func WithQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = DefaultQueryTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
 // Database represents the database connection and configuration
 type Database struct {
 	pool *pgxpool.Pool
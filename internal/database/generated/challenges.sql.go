@@ -7,6 +7,7 @@ package db
 
 import (
 	"context"
+	"net/netip"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
@@ -14,22 +15,24 @@ import (
 const createChallenge = `-- name: CreateChallenge :one
 INSERT INTO challenges (
     seed, difficulty, algorithm, client_id, status,
-    argon2_time, argon2_memory, argon2_threads, argon2_keylen
+    argon2_time, argon2_memory, argon2_threads, argon2_keylen,
+    difficulty_decision
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7, $8, $9
-) RETURNING id, seed, difficulty, algorithm, client_id, status, created_at, solved_at, expires_at, argon2_time, argon2_memory, argon2_threads, argon2_keylen
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+) RETURNING id, seed, difficulty, algorithm, client_id, status, created_at, solved_at, expires_at, argon2_time, argon2_memory, argon2_threads, argon2_keylen, difficulty_decision
 `
 
 type CreateChallengeParams struct {
-	Seed          string          `json:"seed"`
-	Difficulty    int32           `json:"difficulty"`
-	Algorithm     PowAlgorithm    `json:"algorithm"`
-	ClientID      string          `json:"client_id"`
-	Status        ChallengeStatus `json:"status"`
-	Argon2Time    pgtype.Int4     `json:"argon2_time"`
-	Argon2Memory  pgtype.Int4     `json:"argon2_memory"`
-	Argon2Threads pgtype.Int2     `json:"argon2_threads"`
-	Argon2Keylen  pgtype.Int4     `json:"argon2_keylen"`
+	Seed               string          `json:"seed"`
+	Difficulty         int32           `json:"difficulty"`
+	Algorithm          PowAlgorithm    `json:"algorithm"`
+	ClientID           string          `json:"client_id"`
+	Status             ChallengeStatus `json:"status"`
+	Argon2Time         pgtype.Int4     `json:"argon2_time"`
+	Argon2Memory       pgtype.Int4     `json:"argon2_memory"`
+	Argon2Threads      pgtype.Int2     `json:"argon2_threads"`
+	Argon2Keylen       pgtype.Int4     `json:"argon2_keylen"`
+	DifficultyDecision []byte          `json:"difficulty_decision"`
 }
 
 func (q *Queries) CreateChallenge(ctx context.Context, db DBTX, arg CreateChallengeParams) (Challenge, error) {
@@ -43,6 +46,7 @@ func (q *Queries) CreateChallenge(ctx context.Context, db DBTX, arg CreateChalle
 		arg.Argon2Memory,
 		arg.Argon2Threads,
 		arg.Argon2Keylen,
+		arg.DifficultyDecision,
 	)
 	var i Challenge
 	err := row.Scan(
@@ -59,12 +63,13 @@ func (q *Queries) CreateChallenge(ctx context.Context, db DBTX, arg CreateChalle
 		&i.Argon2Memory,
 		&i.Argon2Threads,
 		&i.Argon2Keylen,
+		&i.DifficultyDecision,
 	)
 	return i, err
 }
 
 const getChallenge = `-- name: GetChallenge :one
-SELECT id, seed, difficulty, algorithm, client_id, status, created_at, solved_at, expires_at, argon2_time, argon2_memory, argon2_threads, argon2_keylen FROM challenges WHERE id = $1
+SELECT id, seed, difficulty, algorithm, client_id, status, created_at, solved_at, expires_at, argon2_time, argon2_memory, argon2_threads, argon2_keylen, difficulty_decision FROM challenges WHERE id = $1
 `
 
 func (q *Queries) GetChallenge(ctx context.Context, db DBTX, id pgtype.UUID) (Challenge, error) {
@@ -84,12 +89,13 @@ func (q *Queries) GetChallenge(ctx context.Context, db DBTX, id pgtype.UUID) (Ch
 		&i.Argon2Memory,
 		&i.Argon2Threads,
 		&i.Argon2Keylen,
+		&i.DifficultyDecision,
 	)
 	return i, err
 }
 
 const getChallengeByClientID = `-- name: GetChallengeByClientID :one
-SELECT id, seed, difficulty, algorithm, client_id, status, created_at, solved_at, expires_at, argon2_time, argon2_memory, argon2_threads, argon2_keylen FROM challenges 
+SELECT id, seed, difficulty, algorithm, client_id, status, created_at, solved_at, expires_at, argon2_time, argon2_memory, argon2_threads, argon2_keylen, difficulty_decision FROM challenges 
 WHERE client_id = $1 AND status = 'pending'
 ORDER BY created_at DESC 
 LIMIT 1
@@ -112,12 +118,13 @@ func (q *Queries) GetChallengeByClientID(ctx context.Context, db DBTX, clientID
 		&i.Argon2Memory,
 		&i.Argon2Threads,
 		&i.Argon2Keylen,
+		&i.DifficultyDecision,
 	)
 	return i, err
 }
 
 const getChallengesByAlgorithm = `-- name: GetChallengesByAlgorithm :many
-SELECT id, seed, difficulty, algorithm, client_id, status, created_at, solved_at, expires_at, argon2_time, argon2_memory, argon2_threads, argon2_keylen FROM challenges 
+SELECT id, seed, difficulty, algorithm, client_id, status, created_at, solved_at, expires_at, argon2_time, argon2_memory, argon2_threads, argon2_keylen, difficulty_decision FROM challenges 
 WHERE algorithm = $1 AND created_at >= NOW() - INTERVAL '24 hours'
 ORDER BY created_at DESC
 `
@@ -145,6 +152,8 @@ func (q *Queries) GetChallengesByAlgorithm(ctx context.Context, db DBTX, algorit
 			&i.Argon2Memory,
 			&i.Argon2Threads,
 			&i.Argon2Keylen,
+			&i.DifficultyDecision,
+			&i.DifficultyDecision,
 		); err != nil {
 			return nil, err
 		}
@@ -157,7 +166,7 @@ func (q *Queries) GetChallengesByAlgorithm(ctx context.Context, db DBTX, algorit
 }
 
 const getChallengesByDifficulty = `-- name: GetChallengesByDifficulty :many
-SELECT id, seed, difficulty, algorithm, client_id, status, created_at, solved_at, expires_at, argon2_time, argon2_memory, argon2_threads, argon2_keylen FROM challenges 
+SELECT id, seed, difficulty, algorithm, client_id, status, created_at, solved_at, expires_at, argon2_time, argon2_memory, argon2_threads, argon2_keylen, difficulty_decision FROM challenges 
 WHERE difficulty = $1 AND created_at >= NOW() - INTERVAL '24 hours'
 ORDER BY created_at DESC
 `
@@ -185,6 +194,8 @@ func (q *Queries) GetChallengesByDifficulty(ctx context.Context, db DBTX, diffic
 			&i.Argon2Memory,
 			&i.Argon2Threads,
 			&i.Argon2Keylen,
+			&i.DifficultyDecision,
+			&i.DifficultyDecision,
 		); err != nil {
 			return nil, err
 		}
@@ -272,8 +283,30 @@ func (q *Queries) GetChallengesFiltered(ctx context.Context, db DBTX, arg GetCha
 	return items, nil
 }
 
+const getLatestDifficultyDecision = `-- name: GetLatestDifficultyDecision :one
+SELECT ch.difficulty_decision, ch.created_at
+FROM challenges ch
+JOIN connections c ON c.client_id = ch.client_id
+WHERE c.remote_addr = $1 AND ch.difficulty_decision IS NOT NULL
+ORDER BY ch.created_at DESC
+LIMIT 1
+`
+
+type GetLatestDifficultyDecisionRow struct {
+	DifficultyDecision []byte             `json:"difficulty_decision"`
+	CreatedAt          pgtype.Timestamptz `json:"created_at"`
+}
+
+// Decision behind the most recent challenge issued to a client IP
+func (q *Queries) GetLatestDifficultyDecision(ctx context.Context, db DBTX, remoteAddr netip.Addr) (GetLatestDifficultyDecisionRow, error) {
+	row := db.QueryRow(ctx, getLatestDifficultyDecision, remoteAddr)
+	var i GetLatestDifficultyDecisionRow
+	err := row.Scan(&i.DifficultyDecision, &i.CreatedAt)
+	return i, err
+}
+
 const getRecentChallenges = `-- name: GetRecentChallenges :many
-SELECT id, seed, difficulty, algorithm, client_id, status, created_at, solved_at, expires_at, argon2_time, argon2_memory, argon2_threads, argon2_keylen FROM challenges 
+SELECT id, seed, difficulty, algorithm, client_id, status, created_at, solved_at, expires_at, argon2_time, argon2_memory, argon2_threads, argon2_keylen, difficulty_decision FROM challenges 
 WHERE created_at >= NOW() - INTERVAL '1 hour'
 ORDER BY created_at DESC
 LIMIT $1
@@ -302,6 +335,8 @@ func (q *Queries) GetRecentChallenges(ctx context.Context, db DBTX, limit int32)
 			&i.Argon2Memory,
 			&i.Argon2Threads,
 			&i.Argon2Keylen,
+			&i.DifficultyDecision,
+			&i.DifficultyDecision,
 		); err != nil {
 			return nil, err
 		}
@@ -317,7 +352,7 @@ const updateChallengeStatus = `-- name: UpdateChallengeStatus :one
 UPDATE challenges 
 SET status = $1::challenge_status, solved_at = CASE WHEN $1::challenge_status = 'completed' THEN NOW() ELSE solved_at END
 WHERE id = $2 
-RETURNING id, seed, difficulty, algorithm, client_id, status, created_at, solved_at, expires_at, argon2_time, argon2_memory, argon2_threads, argon2_keylen
+RETURNING id, seed, difficulty, algorithm, client_id, status, created_at, solved_at, expires_at, argon2_time, argon2_memory, argon2_threads, argon2_keylen, difficulty_decision
 `
 
 type UpdateChallengeStatusParams struct {
@@ -342,6 +377,7 @@ func (q *Queries) UpdateChallengeStatus(ctx context.Context, db DBTX, arg Update
 		&i.Argon2Memory,
 		&i.Argon2Threads,
 		&i.Argon2Keylen,
+		&i.DifficultyDecision,
 	)
 	return i, err
 }
@@ -12,6 +12,24 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const addClientReputation = `-- name: AddClientReputation :exec
+UPDATE client_behaviors
+SET reputation_score = LEAST(100, reputation_score + $1::float),
+    updated_at = CURRENT_TIMESTAMP
+WHERE ip_address = $2
+`
+
+type AddClientReputationParams struct {
+	Bonus     float64    `json:"bonus"`
+	IpAddress netip.Addr `json:"ip_address"`
+}
+
+// Reputation earned outside a challenge result, capped at 100
+func (q *Queries) AddClientReputation(ctx context.Context, db DBTX, arg AddClientReputationParams) error {
+	_, err := db.Exec(ctx, addClientReputation, arg.Bonus, arg.IpAddress)
+	return err
+}
+
 const calculateAndUpdateClientDifficulty = `-- name: CalculateAndUpdateClientDifficulty :one
 UPDATE client_behaviors
 SET 
@@ -25,14 +43,31 @@ SET
     ),
     updated_at = CURRENT_TIMESTAMP
 WHERE ip_address = $1
-RETURNING difficulty
+RETURNING difficulty, failure_rate, avg_solve_time_ms, reconnect_rate, connection_count, reputation_score
 `
 
-func (q *Queries) CalculateAndUpdateClientDifficulty(ctx context.Context, db DBTX, ipAddress netip.Addr) (pgtype.Int4, error) {
+type CalculateAndUpdateClientDifficultyRow struct {
+	Difficulty      pgtype.Int4   `json:"difficulty"`
+	FailureRate     pgtype.Float8 `json:"failure_rate"`
+	AvgSolveTimeMs  pgtype.Int8   `json:"avg_solve_time_ms"`
+	ReconnectRate   pgtype.Float8 `json:"reconnect_rate"`
+	ConnectionCount pgtype.Int4   `json:"connection_count"`
+	ReputationScore pgtype.Float8 `json:"reputation_score"`
+}
+
+// Returns the new difficulty with the inputs it was calculated from
+func (q *Queries) CalculateAndUpdateClientDifficulty(ctx context.Context, db DBTX, ipAddress netip.Addr) (CalculateAndUpdateClientDifficultyRow, error) {
 	row := db.QueryRow(ctx, calculateAndUpdateClientDifficulty, ipAddress)
-	var difficulty pgtype.Int4
-	err := row.Scan(&difficulty)
-	return difficulty, err
+	var i CalculateAndUpdateClientDifficultyRow
+	err := row.Scan(
+		&i.Difficulty,
+		&i.FailureRate,
+		&i.AvgSolveTimeMs,
+		&i.ReconnectRate,
+		&i.ConnectionCount,
+		&i.ReputationScore,
+	)
+	return i, err
 }
 
 const createClientBehavior = `-- name: CreateClientBehavior :one
@@ -42,12 +77,17 @@ INSERT INTO client_behaviors (
     difficulty,
     last_connection
 ) VALUES (
-    $1, 1, 2, CURRENT_TIMESTAMP
+    $1, 1, $2, CURRENT_TIMESTAMP
 ) RETURNING id, ip_address, connection_count, failure_rate, avg_solve_time_ms, last_connection, reconnect_rate, difficulty, total_challenges, successful_challenges, failed_challenges, total_solve_time_ms, suspicious_activity_score, reputation_score, last_reputation_update, created_at, updated_at
 `
 
-func (q *Queries) CreateClientBehavior(ctx context.Context, db DBTX, ipAddress netip.Addr) (ClientBehavior, error) {
-	row := db.QueryRow(ctx, createClientBehavior, ipAddress)
+type CreateClientBehaviorParams struct {
+	IpAddress  netip.Addr  `json:"ip_address"`
+	Difficulty pgtype.Int4 `json:"difficulty"`
+}
+
+func (q *Queries) CreateClientBehavior(ctx context.Context, db DBTX, arg CreateClientBehaviorParams) (ClientBehavior, error) {
+	row := db.QueryRow(ctx, createClientBehavior, arg.IpAddress, arg.Difficulty)
 	var i ClientBehavior
 	err := row.Scan(
 		&i.ID,
@@ -94,6 +134,57 @@ func (q *Queries) CreateConnectionTimestamp(ctx context.Context, db DBTX, ipAddr
 	return i, err
 }
 
+const getActiveClientSummary = `-- name: GetActiveClientSummary :one
+SELECT
+    COUNT(*) as total_clients,
+    COUNT(*) FILTER (WHERE difficulty <= 2) as normal_clients,
+    COUNT(*) FILTER (WHERE difficulty = 3) as power_users,
+    COUNT(*) FILTER (WHERE difficulty = 4) as suspicious_clients,
+    COUNT(*) FILTER (WHERE difficulty >= 5) as attackers,
+    COUNT(*) FILTER (WHERE difficulty >= 4 AND failure_rate < 0.3) as false_positives,
+    COUNT(*) FILTER (WHERE created_at > NOW() - INTERVAL '1 minute') as new_clients_last_minute,
+    COALESCE(AVG(difficulty), 0)::float8 as avg_difficulty,
+    COALESCE(AVG(avg_solve_time_ms) FILTER (WHERE difficulty <= 2), 0)::float8 as avg_normal_solve_time_ms,
+    COALESCE(AVG(reputation_score), 0)::float8 as avg_reputation,
+    COALESCE(AVG(suspicious_activity_score), 0)::float8 as avg_suspicious_score
+FROM client_behaviors
+WHERE last_connection > NOW() - INTERVAL '1 hour'
+`
+
+type GetActiveClientSummaryRow struct {
+	TotalClients         int64   `json:"total_clients"`
+	NormalClients        int64   `json:"normal_clients"`
+	PowerUsers           int64   `json:"power_users"`
+	SuspiciousClients    int64   `json:"suspicious_clients"`
+	Attackers            int64   `json:"attackers"`
+	FalsePositives       int64   `json:"false_positives"`
+	NewClientsLastMinute int64   `json:"new_clients_last_minute"`
+	AvgDifficulty        float64 `json:"avg_difficulty"`
+	AvgNormalSolveTimeMs float64 `json:"avg_normal_solve_time_ms"`
+	AvgReputation        float64 `json:"avg_reputation"`
+	AvgSuspiciousScore   float64 `json:"avg_suspicious_score"`
+}
+
+// Class counts and averages over every client seen in the last hour
+func (q *Queries) GetActiveClientSummary(ctx context.Context, db DBTX) (GetActiveClientSummaryRow, error) {
+	row := db.QueryRow(ctx, getActiveClientSummary)
+	var i GetActiveClientSummaryRow
+	err := row.Scan(
+		&i.TotalClients,
+		&i.NormalClients,
+		&i.PowerUsers,
+		&i.SuspiciousClients,
+		&i.Attackers,
+		&i.FalsePositives,
+		&i.NewClientsLastMinute,
+		&i.AvgDifficulty,
+		&i.AvgNormalSolveTimeMs,
+		&i.AvgReputation,
+		&i.AvgSuspiciousScore,
+	)
+	return i, err
+}
+
 const getActiveClients = `-- name: GetActiveClients :many
 SELECT 
     cb.id, cb.ip_address, cb.connection_count, cb.failure_rate, cb.avg_solve_time_ms, cb.last_connection, cb.reconnect_rate, cb.difficulty, cb.total_challenges, cb.successful_challenges, cb.failed_challenges, cb.total_solve_time_ms, cb.suspicious_activity_score, cb.reputation_score, cb.last_reputation_update, cb.created_at, cb.updated_at,
@@ -166,6 +257,138 @@ func (q *Queries) GetActiveClients(ctx context.Context, db DBTX, limit int32) ([
 	return items, nil
 }
 
+const getActiveClientsByDifficulty = `-- name: GetActiveClientsByDifficulty :many
+SELECT
+    difficulty,
+    COUNT(*) as clients,
+    COALESCE(AVG(avg_solve_time_ms), 0)::float8 as avg_solve_time_ms,
+    COALESCE(AVG(failure_rate), 0)::float8 as avg_failure_rate
+FROM client_behaviors
+WHERE last_connection > NOW() - INTERVAL '1 hour'
+GROUP BY difficulty
+ORDER BY difficulty
+`
+
+type GetActiveClientsByDifficultyRow struct {
+	Difficulty     pgtype.Int4 `json:"difficulty"`
+	Clients        int64       `json:"clients"`
+	AvgSolveTimeMs float64     `json:"avg_solve_time_ms"`
+	AvgFailureRate float64     `json:"avg_failure_rate"`
+}
+
+// Client count, solve time and failure rate per difficulty over every client seen in the last hour
+func (q *Queries) GetActiveClientsByDifficulty(ctx context.Context, db DBTX) ([]GetActiveClientsByDifficultyRow, error) {
+	rows, err := db.Query(ctx, getActiveClientsByDifficulty)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetActiveClientsByDifficultyRow{}
+	for rows.Next() {
+		var i GetActiveClientsByDifficultyRow
+		if err := rows.Scan(
+			&i.Difficulty,
+			&i.Clients,
+			&i.AvgSolveTimeMs,
+			&i.AvgFailureRate,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAttackers = `-- name: GetAttackers :many
+SELECT 
+    ip_address,
+    difficulty,
+    connection_count,
+    failure_rate,
+    avg_solve_time_ms,
+    reconnect_rate,
+    reputation_score,
+    suspicious_activity_score,
+    last_connection,
+    successful_challenges,
+    failed_challenges,
+    total_challenges
+FROM client_behaviors
+WHERE difficulty >= $1::integer
+   OR suspicious_activity_score >= $2::float8
+ORDER BY
+    CASE WHEN $3::text = 'failure_rate' THEN failure_rate END DESC NULLS LAST,
+    CASE WHEN $3::text = 'connections' THEN connection_count END DESC NULLS LAST,
+    CASE WHEN $3::text = 'difficulty' THEN difficulty END DESC NULLS LAST,
+    suspicious_activity_score DESC NULLS LAST,
+    ip_address
+LIMIT $4::integer
+`
+
+type GetAttackersParams struct {
+	MinDifficulty int32   `json:"min_difficulty"`
+	MinSuspicious float64 `json:"min_suspicious"`
+	SortBy        string  `json:"sort_by"`
+	MaxResults    int32   `json:"max_results"`
+}
+
+type GetAttackersRow struct {
+	IpAddress               netip.Addr         `json:"ip_address"`
+	Difficulty              pgtype.Int4        `json:"difficulty"`
+	ConnectionCount         pgtype.Int4        `json:"connection_count"`
+	FailureRate             pgtype.Float8      `json:"failure_rate"`
+	AvgSolveTimeMs          pgtype.Int8        `json:"avg_solve_time_ms"`
+	ReconnectRate           pgtype.Float8      `json:"reconnect_rate"`
+	ReputationScore         pgtype.Float8      `json:"reputation_score"`
+	SuspiciousActivityScore pgtype.Float8      `json:"suspicious_activity_score"`
+	LastConnection          pgtype.Timestamptz `json:"last_connection"`
+	SuccessfulChallenges    pgtype.Int4        `json:"successful_challenges"`
+	FailedChallenges        pgtype.Int4        `json:"failed_challenges"`
+	TotalChallenges         pgtype.Int4        `json:"total_challenges"`
+}
+
+// Clients at or above either attacker threshold, sorted by suspicious_score, failure_rate, connections or difficulty
+func (q *Queries) GetAttackers(ctx context.Context, db DBTX, arg GetAttackersParams) ([]GetAttackersRow, error) {
+	rows, err := db.Query(ctx, getAttackers,
+		arg.MinDifficulty,
+		arg.MinSuspicious,
+		arg.SortBy,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetAttackersRow{}
+	for rows.Next() {
+		var i GetAttackersRow
+		if err := rows.Scan(
+			&i.IpAddress,
+			&i.Difficulty,
+			&i.ConnectionCount,
+			&i.FailureRate,
+			&i.AvgSolveTimeMs,
+			&i.ReconnectRate,
+			&i.ReputationScore,
+			&i.SuspiciousActivityScore,
+			&i.LastConnection,
+			&i.SuccessfulChallenges,
+			&i.FailedChallenges,
+			&i.TotalChallenges,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getClientBehaviorByIP = `-- name: GetClientBehaviorByIP :one
 SELECT id, ip_address, connection_count, failure_rate, avg_solve_time_ms, last_connection, reconnect_rate, difficulty, total_challenges, successful_challenges, failed_challenges, total_solve_time_ms, suspicious_activity_score, reputation_score, last_reputation_update, created_at, updated_at FROM client_behaviors
 WHERE ip_address = $1
@@ -343,6 +566,52 @@ func (q *Queries) GetTopAggressiveClients(ctx context.Context, db DBTX, limit in
 	return items, nil
 }
 
+const resetClientBehavior = `-- name: ResetClientBehavior :one
+UPDATE client_behaviors
+SET
+    reputation_score = 50.0,
+    suspicious_activity_score = 0.0,
+    failure_rate = 0.0,
+    failed_challenges = 0,
+    total_challenges = successful_challenges,
+    difficulty = $2,
+    last_reputation_update = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+WHERE ip_address = $1
+RETURNING id, ip_address, connection_count, failure_rate, avg_solve_time_ms, last_connection, reconnect_rate, difficulty, total_challenges, successful_challenges, failed_challenges, total_solve_time_ms, suspicious_activity_score, reputation_score, last_reputation_update, created_at, updated_at
+`
+
+type ResetClientBehaviorParams struct {
+	IpAddress  netip.Addr  `json:"ip_address"`
+	Difficulty pgtype.Int4 `json:"difficulty"`
+}
+
+// Clears the accumulated penalties of a client, keeping its successful challenge history
+func (q *Queries) ResetClientBehavior(ctx context.Context, db DBTX, arg ResetClientBehaviorParams) (ClientBehavior, error) {
+	row := db.QueryRow(ctx, resetClientBehavior, arg.IpAddress, arg.Difficulty)
+	var i ClientBehavior
+	err := row.Scan(
+		&i.ID,
+		&i.IpAddress,
+		&i.ConnectionCount,
+		&i.FailureRate,
+		&i.AvgSolveTimeMs,
+		&i.LastConnection,
+		&i.ReconnectRate,
+		&i.Difficulty,
+		&i.TotalChallenges,
+		&i.SuccessfulChallenges,
+		&i.FailedChallenges,
+		&i.TotalSolveTimeMs,
+		&i.SuspiciousActivityScore,
+		&i.ReputationScore,
+		&i.LastReputationUpdate,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const updateClientBehavior = `-- name: UpdateClientBehavior :one
 UPDATE client_behaviors
 SET 
@@ -450,6 +719,34 @@ func (q *Queries) UpdateClientReputation(ctx context.Context, db DBTX, arg Updat
 	return err
 }
 
+const updateClientWindowedActivity = `-- name: UpdateClientWindowedActivity :one
+UPDATE client_behaviors
+SET 
+    connection_count = count_recent_connections(id, $1::interval),
+    reconnect_rate = calculate_windowed_reconnect_rate(id, $1::interval),
+    updated_at = CURRENT_TIMESTAMP
+WHERE ip_address = $2
+RETURNING connection_count, reconnect_rate
+`
+
+type UpdateClientWindowedActivityParams struct {
+	ConnectionWindow pgtype.Interval `json:"connection_window"`
+	IpAddress        netip.Addr      `json:"ip_address"`
+}
+
+type UpdateClientWindowedActivityRow struct {
+	ConnectionCount pgtype.Int4   `json:"connection_count"`
+	ReconnectRate   pgtype.Float8 `json:"reconnect_rate"`
+}
+
+// Replaces the lifetime connection count and reconnect rate with their values over the window
+func (q *Queries) UpdateClientWindowedActivity(ctx context.Context, db DBTX, arg UpdateClientWindowedActivityParams) (UpdateClientWindowedActivityRow, error) {
+	row := db.QueryRow(ctx, updateClientWindowedActivity, arg.ConnectionWindow, arg.IpAddress)
+	var i UpdateClientWindowedActivityRow
+	err := row.Scan(&i.ConnectionCount, &i.ReconnectRate)
+	return i, err
+}
+
 const updateConnectionTimestamp = `-- name: UpdateConnectionTimestamp :exec
 UPDATE connection_timestamps
 SET 
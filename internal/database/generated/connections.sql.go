@@ -17,7 +17,7 @@ INSERT INTO connections (
     client_id, remote_addr, status, algorithm
 ) VALUES (
     $1, $2, $3, $4
-) RETURNING id, client_id, remote_addr, status, algorithm, connected_at, disconnected_at, challenges_attempted, challenges_completed, total_solve_time_ms
+) RETURNING id, client_id, remote_addr, status, algorithm, connected_at, disconnected_at, challenges_attempted, challenges_completed, total_solve_time_ms, bytes_sent, bytes_received
 `
 
 type CreateConnectionParams struct {
@@ -46,12 +46,14 @@ func (q *Queries) CreateConnection(ctx context.Context, db DBTX, arg CreateConne
 		&i.ChallengesAttempted,
 		&i.ChallengesCompleted,
 		&i.TotalSolveTimeMs,
+		&i.BytesSent,
+		&i.BytesReceived,
 	)
 	return i, err
 }
 
 const getActiveConnections = `-- name: GetActiveConnections :many
-SELECT id, client_id, remote_addr, status, algorithm, connected_at, disconnected_at, challenges_attempted, challenges_completed, total_solve_time_ms FROM connections 
+SELECT id, client_id, remote_addr, status, algorithm, connected_at, disconnected_at, challenges_attempted, challenges_completed, total_solve_time_ms, bytes_sent, bytes_received FROM connections 
 WHERE status IN ('connected', 'solving')
 ORDER BY connected_at DESC
 `
@@ -76,6 +78,8 @@ func (q *Queries) GetActiveConnections(ctx context.Context, db DBTX) ([]Connecti
 			&i.ChallengesAttempted,
 			&i.ChallengesCompleted,
 			&i.TotalSolveTimeMs,
+			&i.BytesSent,
+			&i.BytesReceived,
 		); err != nil {
 			return nil, err
 		}
@@ -87,8 +91,90 @@ func (q *Queries) GetActiveConnections(ctx context.Context, db DBTX) ([]Connecti
 	return items, nil
 }
 
+const getBandwidthByIP = `-- name: GetBandwidthByIP :many
+SELECT
+    remote_addr,
+    COUNT(*) as connections,
+    COALESCE(SUM(bytes_sent), 0)::bigint as bytes_sent,
+    COALESCE(SUM(bytes_received), 0)::bigint as bytes_received,
+    COALESCE(MAX(bytes_received), 0)::bigint as max_bytes_received
+FROM connections
+WHERE connected_at >= NOW() - INTERVAL '24 hours'
+GROUP BY remote_addr
+ORDER BY bytes_received DESC, bytes_sent DESC
+LIMIT $1
+`
+
+type GetBandwidthByIPRow struct {
+	RemoteAddr       netip.Addr `json:"remote_addr"`
+	Connections      int64      `json:"connections"`
+	BytesSent        int64      `json:"bytes_sent"`
+	BytesReceived    int64      `json:"bytes_received"`
+	MaxBytesReceived int64      `json:"max_bytes_received"`
+}
+
+// Per-IP bytes exchanged in the last 24 hours, chattiest first
+func (q *Queries) GetBandwidthByIP(ctx context.Context, db DBTX, limit int32) ([]GetBandwidthByIPRow, error) {
+	rows, err := db.Query(ctx, getBandwidthByIP, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetBandwidthByIPRow{}
+	for rows.Next() {
+		var i GetBandwidthByIPRow
+		if err := rows.Scan(
+			&i.RemoteAddr,
+			&i.Connections,
+			&i.BytesSent,
+			&i.BytesReceived,
+			&i.MaxBytesReceived,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getBandwidthStats = `-- name: GetBandwidthStats :one
+SELECT
+    COUNT(*) as total_connections,
+    COALESCE(SUM(bytes_sent), 0)::bigint as total_bytes_sent,
+    COALESCE(SUM(bytes_received), 0)::bigint as total_bytes_received,
+    COALESCE(AVG(bytes_received), 0)::float8 as avg_bytes_received,
+    COALESCE(MAX(bytes_received), 0)::bigint as max_bytes_received
+FROM connections
+WHERE connected_at >= NOW() - INTERVAL '24 hours'
+`
+
+type GetBandwidthStatsRow struct {
+	TotalConnections   int64   `json:"total_connections"`
+	TotalBytesSent     int64   `json:"total_bytes_sent"`
+	TotalBytesReceived int64   `json:"total_bytes_received"`
+	AvgBytesReceived   float64 `json:"avg_bytes_received"`
+	MaxBytesReceived   int64   `json:"max_bytes_received"`
+}
+
+// Bytes exchanged across all connections in the last 24 hours
+func (q *Queries) GetBandwidthStats(ctx context.Context, db DBTX) (GetBandwidthStatsRow, error) {
+	row := db.QueryRow(ctx, getBandwidthStats)
+	var i GetBandwidthStatsRow
+	err := row.Scan(
+		&i.TotalConnections,
+		&i.TotalBytesSent,
+		&i.TotalBytesReceived,
+		&i.AvgBytesReceived,
+		&i.MaxBytesReceived,
+	)
+	return i, err
+}
+
 const getConnection = `-- name: GetConnection :one
-SELECT id, client_id, remote_addr, status, algorithm, connected_at, disconnected_at, challenges_attempted, challenges_completed, total_solve_time_ms FROM connections WHERE id = $1
+SELECT id, client_id, remote_addr, status, algorithm, connected_at, disconnected_at, challenges_attempted, challenges_completed, total_solve_time_ms, bytes_sent, bytes_received FROM connections WHERE id = $1
 `
 
 func (q *Queries) GetConnection(ctx context.Context, db DBTX, id pgtype.UUID) (Connection, error) {
@@ -105,12 +191,14 @@ func (q *Queries) GetConnection(ctx context.Context, db DBTX, id pgtype.UUID) (C
 		&i.ChallengesAttempted,
 		&i.ChallengesCompleted,
 		&i.TotalSolveTimeMs,
+		&i.BytesSent,
+		&i.BytesReceived,
 	)
 	return i, err
 }
 
 const getConnectionByClientID = `-- name: GetConnectionByClientID :one
-SELECT id, client_id, remote_addr, status, algorithm, connected_at, disconnected_at, challenges_attempted, challenges_completed, total_solve_time_ms FROM connections 
+SELECT id, client_id, remote_addr, status, algorithm, connected_at, disconnected_at, challenges_attempted, challenges_completed, total_solve_time_ms, bytes_sent, bytes_received FROM connections 
 WHERE client_id = $1 AND status IN ('connected', 'solving')
 ORDER BY connected_at DESC 
 LIMIT 1
@@ -130,6 +218,8 @@ func (q *Queries) GetConnectionByClientID(ctx context.Context, db DBTX, clientID
 		&i.ChallengesAttempted,
 		&i.ChallengesCompleted,
 		&i.TotalSolveTimeMs,
+		&i.BytesSent,
+		&i.BytesReceived,
 	)
 	return i, err
 }
@@ -174,7 +264,9 @@ SELECT
     disconnected_at,
     challenges_attempted,
     challenges_completed,
-    total_solve_time_ms
+    total_solve_time_ms,
+    bytes_sent,
+    bytes_received
 FROM connections
 WHERE 
     ($1::connection_status IS NULL OR status = $1)
@@ -204,6 +296,8 @@ func (q *Queries) GetConnectionsFiltered(ctx context.Context, db DBTX, status Co
 			&i.ChallengesAttempted,
 			&i.ChallengesCompleted,
 			&i.TotalSolveTimeMs,
+			&i.BytesSent,
+			&i.BytesReceived,
 		); err != nil {
 			return nil, err
 		}
@@ -216,7 +310,7 @@ func (q *Queries) GetConnectionsFiltered(ctx context.Context, db DBTX, status Co
 }
 
 const getRecentConnections = `-- name: GetRecentConnections :many
-SELECT id, client_id, remote_addr, status, algorithm, connected_at, disconnected_at, challenges_attempted, challenges_completed, total_solve_time_ms FROM connections 
+SELECT id, client_id, remote_addr, status, algorithm, connected_at, disconnected_at, challenges_attempted, challenges_completed, total_solve_time_ms, bytes_sent, bytes_received FROM connections 
 WHERE connected_at >= NOW() - INTERVAL '1 hour'
 ORDER BY connected_at DESC
 LIMIT $1
@@ -242,6 +336,8 @@ func (q *Queries) GetRecentConnections(ctx context.Context, db DBTX, limit int32
 			&i.ChallengesAttempted,
 			&i.ChallengesCompleted,
 			&i.TotalSolveTimeMs,
+			&i.BytesSent,
+			&i.BytesReceived,
 		); err != nil {
 			return nil, err
 		}
@@ -253,13 +349,31 @@ func (q *Queries) GetRecentConnections(ctx context.Context, db DBTX, limit int32
 	return items, nil
 }
 
+const updateConnectionBandwidth = `-- name: UpdateConnectionBandwidth :exec
+UPDATE connections
+SET bytes_sent = $1,
+    bytes_received = $2
+WHERE id = $3
+`
+
+type UpdateConnectionBandwidthParams struct {
+	BytesSent     pgtype.Int8 `json:"bytes_sent"`
+	BytesReceived pgtype.Int8 `json:"bytes_received"`
+	ID            pgtype.UUID `json:"id"`
+}
+
+func (q *Queries) UpdateConnectionBandwidth(ctx context.Context, db DBTX, arg UpdateConnectionBandwidthParams) error {
+	_, err := db.Exec(ctx, updateConnectionBandwidth, arg.BytesSent, arg.BytesReceived, arg.ID)
+	return err
+}
+
 const updateConnectionStats = `-- name: UpdateConnectionStats :one
 UPDATE connections 
 SET challenges_attempted = challenges_attempted + $2,
     challenges_completed = challenges_completed + $3,
     total_solve_time_ms = total_solve_time_ms + $4
 WHERE id = $1 
-RETURNING id, client_id, remote_addr, status, algorithm, connected_at, disconnected_at, challenges_attempted, challenges_completed, total_solve_time_ms
+RETURNING id, client_id, remote_addr, status, algorithm, connected_at, disconnected_at, challenges_attempted, challenges_completed, total_solve_time_ms, bytes_sent, bytes_received
 `
 
 type UpdateConnectionStatsParams struct {
@@ -288,6 +402,8 @@ func (q *Queries) UpdateConnectionStats(ctx context.Context, db DBTX, arg Update
 		&i.ChallengesAttempted,
 		&i.ChallengesCompleted,
 		&i.TotalSolveTimeMs,
+		&i.BytesSent,
+		&i.BytesReceived,
 	)
 	return i, err
 }
@@ -297,7 +413,7 @@ UPDATE connections
 SET status = $1::connection_status, 
     disconnected_at = CASE WHEN $1::connection_status = 'disconnected' THEN NOW() ELSE disconnected_at END
 WHERE id = $2 
-RETURNING id, client_id, remote_addr, status, algorithm, connected_at, disconnected_at, challenges_attempted, challenges_completed, total_solve_time_ms
+RETURNING id, client_id, remote_addr, status, algorithm, connected_at, disconnected_at, challenges_attempted, challenges_completed, total_solve_time_ms, bytes_sent, bytes_received
 `
 
 type UpdateConnectionStatusParams struct {
@@ -319,6 +435,8 @@ func (q *Queries) UpdateConnectionStatus(ctx context.Context, db DBTX, arg Updat
 		&i.ChallengesAttempted,
 		&i.ChallengesCompleted,
 		&i.TotalSolveTimeMs,
+		&i.BytesSent,
+		&i.BytesReceived,
 	)
 	return i, err
 }
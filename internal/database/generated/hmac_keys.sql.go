@@ -83,6 +83,30 @@ func (q *Queries) GetActiveHMACKey(ctx context.Context, db DBTX) (HmacKey, error
 	return i, err
 }
 
+const getActiveHMACKeyForUpdate = `-- name: GetActiveHMACKeyForUpdate :one
+SELECT id, key_version, encrypted_key, previous_encrypted_key, created_at, rotated_at, is_active, metadata FROM hmac_keys
+WHERE is_active = true
+LIMIT 1
+FOR UPDATE
+`
+
+// Locks the active key so concurrent rotations derive from the same row one at a time
+func (q *Queries) GetActiveHMACKeyForUpdate(ctx context.Context, db DBTX) (HmacKey, error) {
+	row := db.QueryRow(ctx, getActiveHMACKeyForUpdate)
+	var i HmacKey
+	err := row.Scan(
+		&i.ID,
+		&i.KeyVersion,
+		&i.EncryptedKey,
+		&i.PreviousEncryptedKey,
+		&i.CreatedAt,
+		&i.RotatedAt,
+		&i.IsActive,
+		&i.Metadata,
+	)
+	return i, err
+}
+
 const getHMACKeyByVersion = `-- name: GetHMACKeyByVersion :one
 SELECT id, key_version, encrypted_key, previous_encrypted_key, created_at, rotated_at, is_active, metadata FROM hmac_keys
 WHERE key_version = $1
@@ -144,19 +144,20 @@ func (ns NullPowAlgorithm) Value() (driver.Value, error) {
 }
 
 type Challenge struct {
-	ID            pgtype.UUID        `json:"id"`
-	Seed          string             `json:"seed"`
-	Difficulty    int32              `json:"difficulty"`
-	Algorithm     PowAlgorithm       `json:"algorithm"`
-	ClientID      string             `json:"client_id"`
-	Status        ChallengeStatus    `json:"status"`
-	CreatedAt     pgtype.Timestamptz `json:"created_at"`
-	SolvedAt      pgtype.Timestamptz `json:"solved_at"`
-	ExpiresAt     pgtype.Timestamptz `json:"expires_at"`
-	Argon2Time    pgtype.Int4        `json:"argon2_time"`
-	Argon2Memory  pgtype.Int4        `json:"argon2_memory"`
-	Argon2Threads pgtype.Int2        `json:"argon2_threads"`
-	Argon2Keylen  pgtype.Int4        `json:"argon2_keylen"`
+	ID                 pgtype.UUID        `json:"id"`
+	Seed               string             `json:"seed"`
+	Difficulty         int32              `json:"difficulty"`
+	Algorithm          PowAlgorithm       `json:"algorithm"`
+	ClientID           string             `json:"client_id"`
+	Status             ChallengeStatus    `json:"status"`
+	CreatedAt          pgtype.Timestamptz `json:"created_at"`
+	SolvedAt           pgtype.Timestamptz `json:"solved_at"`
+	ExpiresAt          pgtype.Timestamptz `json:"expires_at"`
+	Argon2Time         pgtype.Int4        `json:"argon2_time"`
+	Argon2Memory       pgtype.Int4        `json:"argon2_memory"`
+	Argon2Threads      pgtype.Int2        `json:"argon2_threads"`
+	Argon2Keylen       pgtype.Int4        `json:"argon2_keylen"`
+	DifficultyDecision []byte             `json:"difficulty_decision"`
 }
 
 type ClientBehavior struct {
@@ -190,6 +191,8 @@ type Connection struct {
 	ChallengesAttempted pgtype.Int4        `json:"challenges_attempted"`
 	ChallengesCompleted pgtype.Int4        `json:"challenges_completed"`
 	TotalSolveTimeMs    pgtype.Int8        `json:"total_solve_time_ms"`
+	BytesSent           pgtype.Int8        `json:"bytes_sent"`
+	BytesReceived       pgtype.Int8        `json:"bytes_received"`
 }
 
 type ConnectionTimestamp struct {
@@ -227,13 +230,21 @@ type Metric struct {
 	ServerInstance pgtype.Text        `json:"server_instance"`
 }
 
+type RedeemedChallenge struct {
+	Nonce      string             `json:"nonce"`
+	ExpiresAt  pgtype.Timestamptz `json:"expires_at"`
+	RedeemedAt pgtype.Timestamptz `json:"redeemed_at"`
+}
+
 type Solution struct {
-	ID          pgtype.UUID        `json:"id"`
-	ChallengeID pgtype.UUID        `json:"challenge_id"`
-	Nonce       string             `json:"nonce"`
-	Hash        pgtype.Text        `json:"hash"`
-	Attempts    pgtype.Int4        `json:"attempts"`
-	SolveTimeMs int64              `json:"solve_time_ms"`
-	Verified    bool               `json:"verified"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	ID                 pgtype.UUID        `json:"id"`
+	ChallengeID        pgtype.UUID        `json:"challenge_id"`
+	Nonce              string             `json:"nonce"`
+	Hash               pgtype.Text        `json:"hash"`
+	Attempts           pgtype.Int4        `json:"attempts"`
+	SolveTimeMs        int64              `json:"solve_time_ms"`
+	Verified           bool               `json:"verified"`
+	CreatedAt          pgtype.Timestamptz `json:"created_at"`
+	AchievedDifficulty pgtype.Int4        `json:"achieved_difficulty"`
+	ClientSolveTimeMs  pgtype.Int8        `json:"client_solve_time_ms"`
 }
@@ -12,23 +12,46 @@ import (
 )
 
 type Querier interface {
-	CalculateAndUpdateClientDifficulty(ctx context.Context, db DBTX, ipAddress netip.Addr) (pgtype.Int4, error)
+	// Reputation earned outside a challenge result, capped at 100
+	AddClientReputation(ctx context.Context, db DBTX, arg AddClientReputationParams) error
+	// Returns the new difficulty with the inputs it was calculated from
+	CalculateAndUpdateClientDifficulty(ctx context.Context, db DBTX, ipAddress netip.Addr) (CalculateAndUpdateClientDifficultyRow, error)
 	CountDifficultyAdjustments(ctx context.Context, db DBTX) (int64, error)
 	CountLogsByLevel(ctx context.Context, db DBTX) ([]CountLogsByLevelRow, error)
 	CreateChallenge(ctx context.Context, db DBTX, arg CreateChallengeParams) (Challenge, error)
-	CreateClientBehavior(ctx context.Context, db DBTX, ipAddress netip.Addr) (ClientBehavior, error)
+	CreateClientBehavior(ctx context.Context, db DBTX, arg CreateClientBehaviorParams) (ClientBehavior, error)
 	CreateConnection(ctx context.Context, db DBTX, arg CreateConnectionParams) (Connection, error)
 	CreateConnectionTimestamp(ctx context.Context, db DBTX, ipAddress netip.Addr) (ConnectionTimestamp, error)
 	CreateHMACKey(ctx context.Context, db DBTX, arg CreateHMACKeyParams) (HmacKey, error)
 	CreateLog(ctx context.Context, db DBTX, arg CreateLogParams) (Log, error)
 	CreateSolution(ctx context.Context, db DBTX, arg CreateSolutionParams) (Solution, error)
 	DeactivateHMACKeys(ctx context.Context, db DBTX) error
+	// Deletes redemptions of challenges that expired before the cutoff
+	DeleteExpiredRedemptions(ctx context.Context, db DBTX, expiresAt pgtype.Timestamptz) error
 	DeleteOldLogs(ctx context.Context, db DBTX) error
+	// Required vs achieved difficulty of solutions in the last 24 hours
+	GetAchievedDifficultyDistribution(ctx context.Context, db DBTX) ([]GetAchievedDifficultyDistributionRow, error)
+	// Accepted solutions whose hash does not meet the required difficulty, which should never happen
+	GetAchievedDifficultyViolations(ctx context.Context, db DBTX, limit int32) ([]GetAchievedDifficultyViolationsRow, error)
+	// Class counts and averages over every client seen in the last hour
+	GetActiveClientSummary(ctx context.Context, db DBTX) (GetActiveClientSummaryRow, error)
 	GetActiveClients(ctx context.Context, db DBTX, limit int32) ([]GetActiveClientsRow, error)
+	// Client count, solve time and failure rate per difficulty over every client seen in the last hour
+	GetActiveClientsByDifficulty(ctx context.Context, db DBTX) ([]GetActiveClientsByDifficultyRow, error)
+	// Per-minute activity between two timestamps, used to reconstruct experiment timelines
+	GetActivityTimeline(ctx context.Context, db DBTX, arg GetActivityTimelineParams) ([]GetActivityTimelineRow, error)
 	GetActiveConnections(ctx context.Context, db DBTX) ([]Connection, error)
 	GetActiveHMACKey(ctx context.Context, db DBTX) (HmacKey, error)
+	// Locks the active key so concurrent rotations derive from the same row one at a time
+	GetActiveHMACKeyForUpdate(ctx context.Context, db DBTX) (HmacKey, error)
 	// Get aggregated metrics with configurable time bucket
 	GetAggregatedMetrics(ctx context.Context, db DBTX, arg GetAggregatedMetricsParams) ([]GetAggregatedMetricsRow, error)
+	// Clients at or above either attacker threshold, sorted by suspicious_score, failure_rate, connections or difficulty
+	GetAttackers(ctx context.Context, db DBTX, arg GetAttackersParams) ([]GetAttackersRow, error)
+	// Per-IP bytes exchanged in the last 24 hours, chattiest first
+	GetBandwidthByIP(ctx context.Context, db DBTX, limit int32) ([]GetBandwidthByIPRow, error)
+	// Bytes exchanged across all connections in the last 24 hours
+	GetBandwidthStats(ctx context.Context, db DBTX) (GetBandwidthStatsRow, error)
 	GetChallenge(ctx context.Context, db DBTX, id pgtype.UUID) (Challenge, error)
 	GetChallengeByClientID(ctx context.Context, db DBTX, clientID string) (Challenge, error)
 	// Get distribution of challenges by difficulty and algorithm
@@ -51,6 +74,8 @@ type Querier interface {
 	GetHMACKeyByVersion(ctx context.Context, db DBTX, keyVersion int32) (HmacKey, error)
 	// Get historical hash rate data for charts (using solutions table)
 	GetHashRateHistory(ctx context.Context, db DBTX) ([]GetHashRateHistoryRow, error)
+	// Decision behind the most recent challenge issued to a client IP
+	GetLatestDifficultyDecision(ctx context.Context, db DBTX, remoteAddr netip.Addr) (GetLatestDifficultyDecisionRow, error)
 	GetLatestHMACKeys(ctx context.Context, db DBTX, limit int32) ([]HmacKey, error)
 	GetLogsByLevel(ctx context.Context, db DBTX, arg GetLogsByLevelParams) ([]Log, error)
 	GetLogsInTimeRange(ctx context.Context, db DBTX, arg GetLogsInTimeRangeParams) ([]Log, error)
@@ -66,18 +91,27 @@ type Querier interface {
 	GetRecentLogs(ctx context.Context, db DBTX, limit int32) ([]Log, error)
 	GetRecentMetrics(ctx context.Context, db DBTX) ([]GetRecentMetricsRow, error)
 	GetRecentSolutions(ctx context.Context, db DBTX, limit int32) ([]GetRecentSolutionsRow, error)
+	// Verified solves by low-difficulty clients in the last 24 hours and how many exceeded the SLA
+	GetSLABreaches(ctx context.Context, db DBTX, arg GetSLABreachesParams) ([]GetSLABreachesRow, error)
 	GetSolution(ctx context.Context, db DBTX, id pgtype.UUID) (Solution, error)
 	GetSolutionStats(ctx context.Context, db DBTX) (GetSolutionStatsRow, error)
 	GetSolutionsByChallenge(ctx context.Context, db DBTX, challengeID pgtype.UUID) ([]Solution, error)
 	GetSystemMetrics(ctx context.Context, db DBTX) ([]GetSystemMetricsRow, error)
 	GetTopAggressiveClients(ctx context.Context, db DBTX, limit int32) ([]GetTopAggressiveClientsRow, error)
 	RecordMetric(ctx context.Context, db DBTX, arg RecordMetricParams) error
+	// Claims a challenge nonce, no row is affected when it was already redeemed
+	RedeemChallenge(ctx context.Context, db DBTX, arg RedeemChallengeParams) (int64, error)
+	// Clears the accumulated penalties of a client, keeping its successful challenge history
+	ResetClientBehavior(ctx context.Context, db DBTX, arg ResetClientBehaviorParams) (ClientBehavior, error)
 	UpdateChallengeStatus(ctx context.Context, db DBTX, arg UpdateChallengeStatusParams) (Challenge, error)
 	UpdateClientBehavior(ctx context.Context, db DBTX, ipAddress netip.Addr) (ClientBehavior, error)
 	UpdateClientChallengeStats(ctx context.Context, db DBTX, arg UpdateClientChallengeStatsParams) error
 	UpdateClientDifficulty(ctx context.Context, db DBTX, arg UpdateClientDifficultyParams) error
 	UpdateClientReconnectRate(ctx context.Context, db DBTX, ipAddress netip.Addr) error
 	UpdateClientReputation(ctx context.Context, db DBTX, arg UpdateClientReputationParams) error
+	// Replaces the lifetime connection count and reconnect rate with their values over the window
+	UpdateClientWindowedActivity(ctx context.Context, db DBTX, arg UpdateClientWindowedActivityParams) (UpdateClientWindowedActivityRow, error)
+	UpdateConnectionBandwidth(ctx context.Context, db DBTX, arg UpdateConnectionBandwidthParams) error
 	UpdateConnectionStats(ctx context.Context, db DBTX, arg UpdateConnectionStatsParams) (Connection, error)
 	UpdateConnectionStatus(ctx context.Context, db DBTX, arg UpdateConnectionStatusParams) (Connection, error)
 	UpdateConnectionTimestamp(ctx context.Context, db DBTX, arg UpdateConnectionTimestampParams) error
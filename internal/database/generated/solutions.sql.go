@@ -13,19 +13,21 @@ import (
 
 const createSolution = `-- name: CreateSolution :one
 INSERT INTO solutions (
-    challenge_id, nonce, hash, attempts, solve_time_ms, verified
+    challenge_id, nonce, hash, attempts, solve_time_ms, verified, achieved_difficulty, client_solve_time_ms
 ) VALUES (
-    $1, $2, $3, $4, $5, $6
-) RETURNING id, challenge_id, nonce, hash, attempts, solve_time_ms, verified, created_at
+    $1, $2, $3, $4, $5, $6, $7, $8
+) RETURNING id, challenge_id, nonce, hash, attempts, solve_time_ms, verified, created_at, achieved_difficulty, client_solve_time_ms
 `
 
 type CreateSolutionParams struct {
-	ChallengeID pgtype.UUID `json:"challenge_id"`
-	Nonce       string      `json:"nonce"`
-	Hash        pgtype.Text `json:"hash"`
-	Attempts    pgtype.Int4 `json:"attempts"`
-	SolveTimeMs int64       `json:"solve_time_ms"`
-	Verified    bool        `json:"verified"`
+	ChallengeID        pgtype.UUID `json:"challenge_id"`
+	Nonce              string      `json:"nonce"`
+	Hash               pgtype.Text `json:"hash"`
+	Attempts           pgtype.Int4 `json:"attempts"`
+	SolveTimeMs        int64       `json:"solve_time_ms"`
+	Verified           bool        `json:"verified"`
+	AchievedDifficulty pgtype.Int4 `json:"achieved_difficulty"`
+	ClientSolveTimeMs  pgtype.Int8 `json:"client_solve_time_ms"`
 }
 
 func (q *Queries) CreateSolution(ctx context.Context, db DBTX, arg CreateSolutionParams) (Solution, error) {
@@ -36,6 +38,8 @@ func (q *Queries) CreateSolution(ctx context.Context, db DBTX, arg CreateSolutio
 		arg.Attempts,
 		arg.SolveTimeMs,
 		arg.Verified,
+		arg.AchievedDifficulty,
+		arg.ClientSolveTimeMs,
 	)
 	var i Solution
 	err := row.Scan(
@@ -47,12 +51,118 @@ func (q *Queries) CreateSolution(ctx context.Context, db DBTX, arg CreateSolutio
 		&i.SolveTimeMs,
 		&i.Verified,
 		&i.CreatedAt,
+		&i.AchievedDifficulty,
+		&i.ClientSolveTimeMs,
 	)
 	return i, err
 }
 
+const getAchievedDifficultyDistribution = `-- name: GetAchievedDifficultyDistribution :many
+SELECT 
+    c.difficulty as required_difficulty,
+    s.achieved_difficulty::integer as achieved_difficulty,
+    s.verified,
+    COUNT(*) as solutions
+FROM solutions s
+JOIN challenges c ON s.challenge_id = c.id
+WHERE s.achieved_difficulty IS NOT NULL
+    AND s.created_at >= NOW() - INTERVAL '24 hours'
+GROUP BY c.difficulty, s.achieved_difficulty, s.verified
+ORDER BY c.difficulty, s.achieved_difficulty, s.verified
+`
+
+type GetAchievedDifficultyDistributionRow struct {
+	RequiredDifficulty int32 `json:"required_difficulty"`
+	AchievedDifficulty int32 `json:"achieved_difficulty"`
+	Verified           bool  `json:"verified"`
+	Solutions          int64 `json:"solutions"`
+}
+
+// Required vs achieved difficulty of solutions in the last 24 hours
+func (q *Queries) GetAchievedDifficultyDistribution(ctx context.Context, db DBTX) ([]GetAchievedDifficultyDistributionRow, error) {
+	rows, err := db.Query(ctx, getAchievedDifficultyDistribution)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetAchievedDifficultyDistributionRow{}
+	for rows.Next() {
+		var i GetAchievedDifficultyDistributionRow
+		if err := rows.Scan(
+			&i.RequiredDifficulty,
+			&i.AchievedDifficulty,
+			&i.Verified,
+			&i.Solutions,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAchievedDifficultyViolations = `-- name: GetAchievedDifficultyViolations :many
+SELECT 
+    s.id,
+    s.challenge_id,
+    c.client_id,
+    c.algorithm,
+    c.difficulty as required_difficulty,
+    s.achieved_difficulty::integer as achieved_difficulty,
+    s.created_at
+FROM solutions s
+JOIN challenges c ON s.challenge_id = c.id
+WHERE s.verified = true
+    AND s.achieved_difficulty < c.difficulty
+    AND s.created_at >= NOW() - INTERVAL '24 hours'
+ORDER BY s.created_at DESC
+LIMIT $1
+`
+
+type GetAchievedDifficultyViolationsRow struct {
+	ID                 pgtype.UUID        `json:"id"`
+	ChallengeID        pgtype.UUID        `json:"challenge_id"`
+	ClientID           string             `json:"client_id"`
+	Algorithm          PowAlgorithm       `json:"algorithm"`
+	RequiredDifficulty int32              `json:"required_difficulty"`
+	AchievedDifficulty int32              `json:"achieved_difficulty"`
+	CreatedAt          pgtype.Timestamptz `json:"created_at"`
+}
+
+// Accepted solutions whose hash does not meet the required difficulty, which should never happen
+func (q *Queries) GetAchievedDifficultyViolations(ctx context.Context, db DBTX, limit int32) ([]GetAchievedDifficultyViolationsRow, error) {
+	rows, err := db.Query(ctx, getAchievedDifficultyViolations, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetAchievedDifficultyViolationsRow{}
+	for rows.Next() {
+		var i GetAchievedDifficultyViolationsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.ChallengeID,
+			&i.ClientID,
+			&i.Algorithm,
+			&i.RequiredDifficulty,
+			&i.AchievedDifficulty,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getRecentSolutions = `-- name: GetRecentSolutions :many
-SELECT s.id, s.challenge_id, s.nonce, s.hash, s.attempts, s.solve_time_ms, s.verified, s.created_at, c.difficulty, c.algorithm 
+SELECT s.id, s.challenge_id, s.nonce, s.hash, s.attempts, s.solve_time_ms, s.verified, s.created_at, s.achieved_difficulty, s.client_solve_time_ms, c.difficulty, c.algorithm 
 FROM solutions s
 JOIN challenges c ON s.challenge_id = c.id
 WHERE s.created_at >= NOW() - INTERVAL '1 hour'
@@ -61,16 +171,18 @@ LIMIT $1
 `
 
 type GetRecentSolutionsRow struct {
-	ID          pgtype.UUID        `json:"id"`
-	ChallengeID pgtype.UUID        `json:"challenge_id"`
-	Nonce       string             `json:"nonce"`
-	Hash        pgtype.Text        `json:"hash"`
-	Attempts    pgtype.Int4        `json:"attempts"`
-	SolveTimeMs int64              `json:"solve_time_ms"`
-	Verified    bool               `json:"verified"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	Difficulty  int32              `json:"difficulty"`
-	Algorithm   PowAlgorithm       `json:"algorithm"`
+	ID                 pgtype.UUID        `json:"id"`
+	ChallengeID        pgtype.UUID        `json:"challenge_id"`
+	Nonce              string             `json:"nonce"`
+	Hash               pgtype.Text        `json:"hash"`
+	Attempts           pgtype.Int4        `json:"attempts"`
+	SolveTimeMs        int64              `json:"solve_time_ms"`
+	Verified           bool               `json:"verified"`
+	CreatedAt          pgtype.Timestamptz `json:"created_at"`
+	AchievedDifficulty pgtype.Int4        `json:"achieved_difficulty"`
+	ClientSolveTimeMs  pgtype.Int8        `json:"client_solve_time_ms"`
+	Difficulty         int32              `json:"difficulty"`
+	Algorithm          PowAlgorithm       `json:"algorithm"`
 }
 
 func (q *Queries) GetRecentSolutions(ctx context.Context, db DBTX, limit int32) ([]GetRecentSolutionsRow, error) {
@@ -91,6 +203,8 @@ func (q *Queries) GetRecentSolutions(ctx context.Context, db DBTX, limit int32)
 			&i.SolveTimeMs,
 			&i.Verified,
 			&i.CreatedAt,
+			&i.AchievedDifficulty,
+			&i.ClientSolveTimeMs,
 			&i.Difficulty,
 			&i.Algorithm,
 		); err != nil {
@@ -104,8 +218,58 @@ func (q *Queries) GetRecentSolutions(ctx context.Context, db DBTX, limit int32)
 	return items, nil
 }
 
+const getSLABreaches = `-- name: GetSLABreaches :many
+SELECT 
+    c.difficulty,
+    COUNT(*) as total_solves,
+    COUNT(*) FILTER (WHERE s.solve_time_ms > $1::bigint) as breaches
+FROM solutions s
+JOIN challenges c ON s.challenge_id = c.id
+WHERE s.verified = true
+    AND c.difficulty <= $2::integer
+    AND s.created_at >= NOW() - INTERVAL '24 hours'
+GROUP BY c.difficulty
+ORDER BY c.difficulty
+`
+
+type GetSLABreachesParams struct {
+	SlaMs         int64 `json:"sla_ms"`
+	MaxDifficulty int32 `json:"max_difficulty"`
+}
+
+type GetSLABreachesRow struct {
+	Difficulty  int32 `json:"difficulty"`
+	TotalSolves int64 `json:"total_solves"`
+	Breaches    int64 `json:"breaches"`
+}
+
+// Verified solves by low-difficulty clients in the last 24 hours and how many exceeded the SLA
+func (q *Queries) GetSLABreaches(ctx context.Context, db DBTX, arg GetSLABreachesParams) ([]GetSLABreachesRow, error) {
+	rows, err := db.Query(ctx, getSLABreaches, arg.SlaMs, arg.MaxDifficulty)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetSLABreachesRow{}
+	for rows.Next() {
+		var i GetSLABreachesRow
+		if err := rows.Scan(
+			&i.Difficulty,
+			&i.TotalSolves,
+			&i.Breaches,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getSolution = `-- name: GetSolution :one
-SELECT id, challenge_id, nonce, hash, attempts, solve_time_ms, verified, created_at FROM solutions WHERE id = $1
+SELECT id, challenge_id, nonce, hash, attempts, solve_time_ms, verified, created_at, achieved_difficulty, client_solve_time_ms FROM solutions WHERE id = $1
 `
 
 func (q *Queries) GetSolution(ctx context.Context, db DBTX, id pgtype.UUID) (Solution, error) {
@@ -120,6 +284,8 @@ func (q *Queries) GetSolution(ctx context.Context, db DBTX, id pgtype.UUID) (Sol
 		&i.SolveTimeMs,
 		&i.Verified,
 		&i.CreatedAt,
+		&i.AchievedDifficulty,
+		&i.ClientSolveTimeMs,
 	)
 	return i, err
 }
@@ -157,7 +323,7 @@ func (q *Queries) GetSolutionStats(ctx context.Context, db DBTX) (GetSolutionSta
 }
 
 const getSolutionsByChallenge = `-- name: GetSolutionsByChallenge :many
-SELECT id, challenge_id, nonce, hash, attempts, solve_time_ms, verified, created_at FROM solutions 
+SELECT id, challenge_id, nonce, hash, attempts, solve_time_ms, verified, created_at, achieved_difficulty, client_solve_time_ms FROM solutions 
 WHERE challenge_id = $1
 ORDER BY created_at ASC
 `
@@ -180,6 +346,8 @@ func (q *Queries) GetSolutionsByChallenge(ctx context.Context, db DBTX, challeng
 			&i.SolveTimeMs,
 			&i.Verified,
 			&i.CreatedAt,
+			&i.AchievedDifficulty,
+			&i.ClientSolveTimeMs,
 		); err != nil {
 			return nil, err
 		}
@@ -195,7 +363,7 @@ const verifySolution = `-- name: VerifySolution :one
 UPDATE solutions 
 SET verified = $2
 WHERE id = $1 
-RETURNING id, challenge_id, nonce, hash, attempts, solve_time_ms, verified, created_at
+RETURNING id, challenge_id, nonce, hash, attempts, solve_time_ms, verified, created_at, achieved_difficulty, client_solve_time_ms
 `
 
 type VerifySolutionParams struct {
@@ -215,6 +383,8 @@ func (q *Queries) VerifySolution(ctx context.Context, db DBTX, arg VerifySolutio
 		&i.SolveTimeMs,
 		&i.Verified,
 		&i.CreatedAt,
+		&i.AchievedDifficulty,
+		&i.ClientSolveTimeMs,
 	)
 	return i, err
 }
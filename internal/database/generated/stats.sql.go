@@ -7,7 +7,115 @@ package db
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const getActivityTimeline = `-- name: GetActivityTimeline :many
+WITH buckets AS (
+    SELECT generate_series(
+        time_bucket('1 minute', $1::timestamptz),
+        $2::timestamptz,
+        INTERVAL '1 minute'
+    ) AS bucket
+),
+conn AS (
+    SELECT 
+        time_bucket('1 minute', connected_at) AS bucket,
+        COUNT(*) AS connections,
+        COUNT(DISTINCT remote_addr) AS unique_clients
+    FROM connections
+    WHERE connected_at >= $1 AND connected_at <= $2
+    GROUP BY 1
+),
+chal AS (
+    SELECT 
+        time_bucket('1 minute', created_at) AS bucket,
+        COUNT(*) AS challenges,
+        COUNT(*) FILTER (WHERE status = 'completed') AS solved,
+        COUNT(*) FILTER (WHERE status IN ('failed', 'expired')) AS failed,
+        AVG(difficulty) AS avg_difficulty,
+        MAX(difficulty) AS max_difficulty
+    FROM challenges
+    WHERE created_at >= $1 AND created_at <= $2
+    GROUP BY 1
+),
+events AS (
+    SELECT 
+        time_bucket('1 minute', timestamp) AS bucket,
+        COUNT(*) FILTER (WHERE metadata->>'event' = 'aggressive_client_alert') AS aggressive_alerts,
+        COUNT(*) FILTER (WHERE metadata->>'event' IN ('difficulty_increased', 'high_difficulty_assigned')) AS escalations
+    FROM logs
+    WHERE timestamp >= $1 AND timestamp <= $2
+    GROUP BY 1
 )
+SELECT 
+    b.bucket::timestamptz AS bucket,
+    COALESCE(conn.connections, 0)::bigint AS connections,
+    COALESCE(conn.unique_clients, 0)::bigint AS unique_clients,
+    COALESCE(chal.challenges, 0)::bigint AS challenges,
+    COALESCE(chal.solved, 0)::bigint AS solved,
+    COALESCE(chal.failed, 0)::bigint AS failed,
+    COALESCE(chal.avg_difficulty, 0)::FLOAT AS avg_difficulty,
+    COALESCE(chal.max_difficulty, 0)::integer AS max_difficulty,
+    COALESCE(events.aggressive_alerts, 0)::bigint AS aggressive_alerts,
+    COALESCE(events.escalations, 0)::bigint AS escalations
+FROM buckets b
+LEFT JOIN conn ON conn.bucket = b.bucket
+LEFT JOIN chal ON chal.bucket = b.bucket
+LEFT JOIN events ON events.bucket = b.bucket
+ORDER BY b.bucket
+`
+
+type GetActivityTimelineParams struct {
+	StartTime pgtype.Timestamptz `json:"start_time"`
+	EndTime   pgtype.Timestamptz `json:"end_time"`
+}
+
+type GetActivityTimelineRow struct {
+	Bucket           pgtype.Timestamptz `json:"bucket"`
+	Connections      int64              `json:"connections"`
+	UniqueClients    int64              `json:"unique_clients"`
+	Challenges       int64              `json:"challenges"`
+	Solved           int64              `json:"solved"`
+	Failed           int64              `json:"failed"`
+	AvgDifficulty    float64            `json:"avg_difficulty"`
+	MaxDifficulty    int32              `json:"max_difficulty"`
+	AggressiveAlerts int64              `json:"aggressive_alerts"`
+	Escalations      int64              `json:"escalations"`
+}
+
+// Per-minute activity between two timestamps, used to reconstruct experiment timelines
+func (q *Queries) GetActivityTimeline(ctx context.Context, db DBTX, arg GetActivityTimelineParams) ([]GetActivityTimelineRow, error) {
+	rows, err := db.Query(ctx, getActivityTimeline, arg.StartTime, arg.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetActivityTimelineRow{}
+	for rows.Next() {
+		var i GetActivityTimelineRow
+		if err := rows.Scan(
+			&i.Bucket,
+			&i.Connections,
+			&i.UniqueClients,
+			&i.Challenges,
+			&i.Solved,
+			&i.Failed,
+			&i.AvgDifficulty,
+			&i.MaxDifficulty,
+			&i.AggressiveAlerts,
+			&i.Escalations,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
 
 const getChallengeDistribution = `-- name: GetChallengeDistribution :many
 SELECT 
@@ -0,0 +1,2 @@
+-- Leading zeros the submitted nonce actually produced, recorded at verify time
+ALTER TABLE solutions ADD COLUMN IF NOT EXISTS achieved_difficulty INTEGER;
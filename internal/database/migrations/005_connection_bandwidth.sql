@@ -0,0 +1,3 @@
+-- Bytes exchanged with the client over the lifetime of a connection
+ALTER TABLE connections ADD COLUMN IF NOT EXISTS bytes_sent BIGINT DEFAULT 0;
+ALTER TABLE connections ADD COLUMN IF NOT EXISTS bytes_received BIGINT DEFAULT 0;
@@ -0,0 +1,6 @@
+-- Attempts and solve time as reported by the client alongside its nonce. Both are
+-- untrusted and only used for analytics, verification never looks at them.
+ALTER TABLE solutions ADD COLUMN IF NOT EXISTS client_solve_time_ms BIGINT;
+
+COMMENT ON COLUMN solutions.attempts IS 'Client-reported attempts, untrusted, NULL when not reported';
+COMMENT ON COLUMN solutions.client_solve_time_ms IS 'Client-reported solve time, untrusted, NULL when not reported';
@@ -0,0 +1,5 @@
+-- Why a challenge got its difficulty: the stored difficulty the server started from and
+-- every behavioral and server-side factor that moved it, see behavior.DifficultyDecision
+ALTER TABLE challenges ADD COLUMN IF NOT EXISTS difficulty_decision JSONB;
+
+COMMENT ON COLUMN challenges.difficulty_decision IS 'Factors behind the assigned difficulty, NULL for challenges issued before it was recorded';
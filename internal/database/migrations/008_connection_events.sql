@@ -0,0 +1,32 @@
+-- Publish connection lifecycle changes on the connection_events channel for the API
+-- server's live stream. Only inserts and status changes notify, the bandwidth and
+-- challenge counters are updated too often to be worth a notification each.
+CREATE OR REPLACE FUNCTION notify_connection_event()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('connection_events', json_build_object(
+        'id', NEW.id,
+        'clientId', NEW.client_id,
+        'remoteAddr', host(NEW.remote_addr),
+        'status', NEW.status,
+        'algorithm', NEW.algorithm,
+        'connectedAt', NEW.connected_at,
+        'disconnectedAt', NEW.disconnected_at,
+        'challengesAttempted', NEW.challenges_attempted,
+        'challengesCompleted', NEW.challenges_completed,
+        'bytesSent', NEW.bytes_sent,
+        'bytesReceived', NEW.bytes_received
+    )::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS connections_notify_insert ON connections;
+CREATE TRIGGER connections_notify_insert AFTER INSERT
+    ON connections FOR EACH ROW EXECUTE FUNCTION notify_connection_event();
+
+DROP TRIGGER IF EXISTS connections_notify_status ON connections;
+CREATE TRIGGER connections_notify_status AFTER UPDATE OF status
+    ON connections FOR EACH ROW
+    WHEN (OLD.status IS DISTINCT FROM NEW.status)
+    EXECUTE FUNCTION notify_connection_event();
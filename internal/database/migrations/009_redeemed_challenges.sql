@@ -0,0 +1,10 @@
+-- Challenge nonces whose solution was accepted, shared by the TCP server and the HTTP
+-- solve endpoints so a solution is only redeemed once whichever way it arrives. A row
+-- is only needed until its challenge expires, after which the pipeline rejects it anyway.
+CREATE TABLE IF NOT EXISTS redeemed_challenges (
+    nonce TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL,
+    redeemed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_redeemed_challenges_expires_at ON redeemed_challenges(expires_at);
@@ -0,0 +1,38 @@
+-- Connection count and reconnect rate over a rolling window of connection_timestamps,
+-- so a client connecting once an hour for weeks doesn't look like a rapid reconnecter.
+-- Used instead of the lifetime figures when the server runs with a connection window.
+CREATE OR REPLACE FUNCTION count_recent_connections(p_client_behavior_id UUID, p_window INTERVAL)
+RETURNS INTEGER AS $$
+    SELECT COUNT(*)::INTEGER
+    FROM connection_timestamps
+    WHERE client_behavior_id = p_client_behavior_id
+    AND connected_at >= NOW() - p_window;
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION calculate_windowed_reconnect_rate(p_client_behavior_id UUID, p_window INTERVAL)
+RETURNS FLOAT AS $$
+DECLARE
+    v_reconnect_count INTEGER;
+    v_total_connections INTEGER;
+BEGIN
+    -- Rapid reconnects (within 5 seconds of disconnect) inside the window
+    SELECT COUNT(*) INTO v_reconnect_count
+    FROM connection_timestamps t1
+    JOIN connection_timestamps t2 ON t1.client_behavior_id = t2.client_behavior_id
+    WHERE t1.client_behavior_id = p_client_behavior_id
+    AND t1.connected_at >= NOW() - p_window
+    AND t2.connected_at > t1.disconnected_at
+    AND t2.connected_at - t1.disconnected_at < INTERVAL '5 seconds';
+
+    v_total_connections := count_recent_connections(p_client_behavior_id, p_window);
+
+    IF v_total_connections <= 1 THEN
+        RETURN 0.0;
+    END IF;
+
+    RETURN v_reconnect_count::FLOAT / v_total_connections::FLOAT;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE INDEX IF NOT EXISTS idx_connection_timestamps_client_connected
+    ON connection_timestamps(client_behavior_id, connected_at);
@@ -0,0 +1,4 @@
+-- Every rotation writes the next version. Two processes rotating from the same stale
+-- version would otherwise both insert it, and the second would drop the first's live key.
+DROP INDEX IF EXISTS idx_hmac_keys_version;
+CREATE UNIQUE INDEX idx_hmac_keys_version ON hmac_keys (key_version);
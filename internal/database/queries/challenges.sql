@@ -1,9 +1,10 @@
 -- name: CreateChallenge :one
 INSERT INTO challenges (
     seed, difficulty, algorithm, client_id, status,
-    argon2_time, argon2_memory, argon2_threads, argon2_keylen
+    argon2_time, argon2_memory, argon2_threads, argon2_keylen,
+    difficulty_decision
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7, $8, $9
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
 ) RETURNING *;
 
 -- name: GetChallenge :one
@@ -60,4 +61,13 @@ WHERE
     AND (@algorithm::pow_algorithm IS NULL OR c.algorithm = @algorithm)
     AND c.created_at >= NOW() - INTERVAL '24 hours'
 ORDER BY c.created_at DESC
-LIMIT @limit_count;
\ No newline at end of file
+LIMIT @limit_count;
+
+-- name: GetLatestDifficultyDecision :one
+-- Decision behind the most recent challenge issued to a client IP
+SELECT ch.difficulty_decision, ch.created_at
+FROM challenges ch
+JOIN connections c ON c.client_id = ch.client_id
+WHERE c.remote_addr = $1 AND ch.difficulty_decision IS NOT NULL
+ORDER BY ch.created_at DESC
+LIMIT 1;
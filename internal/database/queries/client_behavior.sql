@@ -9,7 +9,7 @@ INSERT INTO client_behaviors (
     difficulty,
     last_connection
 ) VALUES (
-    $1, 1, 2, CURRENT_TIMESTAMP
+    $1, 1, $2, CURRENT_TIMESTAMP
 ) RETURNING *;
 
 -- name: UpdateClientBehavior :one
@@ -47,7 +47,18 @@ SET
     updated_at = CURRENT_TIMESTAMP
 WHERE ip_address = $1;
 
+-- name: UpdateClientWindowedActivity :one
+-- Replaces the lifetime connection count and reconnect rate with their values over the window
+UPDATE client_behaviors
+SET 
+    connection_count = count_recent_connections(id, @connection_window::interval),
+    reconnect_rate = calculate_windowed_reconnect_rate(id, @connection_window::interval),
+    updated_at = CURRENT_TIMESTAMP
+WHERE ip_address = @ip_address
+RETURNING connection_count, reconnect_rate;
+
 -- name: CalculateAndUpdateClientDifficulty :one
+-- Returns the new difficulty with the inputs it was calculated from
 UPDATE client_behaviors
 SET 
     difficulty = calculate_adaptive_difficulty(
@@ -60,7 +71,7 @@ SET
     ),
     updated_at = CURRENT_TIMESTAMP
 WHERE ip_address = $1
-RETURNING difficulty;
+RETURNING difficulty, failure_rate, avg_solve_time_ms, reconnect_rate, connection_count, reputation_score;
 
 -- name: UpdateClientReputation :exec
 SELECT update_reputation_score(
@@ -68,6 +79,13 @@ SELECT update_reputation_score(
     @challenge_success::boolean
 );
 
+-- name: AddClientReputation :exec
+-- Reputation earned outside a challenge result, capped at 100
+UPDATE client_behaviors
+SET reputation_score = LEAST(100, reputation_score + @bonus::float),
+    updated_at = CURRENT_TIMESTAMP
+WHERE ip_address = @ip_address;
+
 -- name: CreateConnectionTimestamp :one
 INSERT INTO connection_timestamps (
     client_behavior_id,
@@ -95,6 +113,35 @@ GROUP BY cb.id
 ORDER BY cb.difficulty DESC, cb.connection_count DESC
 LIMIT $1;
 
+-- name: GetActiveClientSummary :one
+-- Class counts and averages over every client seen in the last hour
+SELECT
+    COUNT(*) as total_clients,
+    COUNT(*) FILTER (WHERE difficulty <= 2) as normal_clients,
+    COUNT(*) FILTER (WHERE difficulty = 3) as power_users,
+    COUNT(*) FILTER (WHERE difficulty = 4) as suspicious_clients,
+    COUNT(*) FILTER (WHERE difficulty >= 5) as attackers,
+    COUNT(*) FILTER (WHERE difficulty >= 4 AND failure_rate < 0.3) as false_positives,
+    COUNT(*) FILTER (WHERE created_at > NOW() - INTERVAL '1 minute') as new_clients_last_minute,
+    COALESCE(AVG(difficulty), 0)::float8 as avg_difficulty,
+    COALESCE(AVG(avg_solve_time_ms) FILTER (WHERE difficulty <= 2), 0)::float8 as avg_normal_solve_time_ms,
+    COALESCE(AVG(reputation_score), 0)::float8 as avg_reputation,
+    COALESCE(AVG(suspicious_activity_score), 0)::float8 as avg_suspicious_score
+FROM client_behaviors
+WHERE last_connection > NOW() - INTERVAL '1 hour';
+
+-- name: GetActiveClientsByDifficulty :many
+-- Client count, solve time and failure rate per difficulty over every client seen in the last hour
+SELECT
+    difficulty,
+    COUNT(*) as clients,
+    COALESCE(AVG(avg_solve_time_ms), 0)::float8 as avg_solve_time_ms,
+    COALESCE(AVG(failure_rate), 0)::float8 as avg_failure_rate
+FROM client_behaviors
+WHERE last_connection > NOW() - INTERVAL '1 hour'
+GROUP BY difficulty
+ORDER BY difficulty;
+
 -- name: GetClientBehaviorStats :many
 SELECT 
     cb.*,
@@ -142,4 +189,45 @@ WHERE suspicious_activity_score > 50
    OR reputation_score < 20
    OR difficulty >= 5
 ORDER BY suspicious_activity_score DESC, reputation_score ASC
-LIMIT $1;
\ No newline at end of file
+LIMIT $1;
+
+-- name: GetAttackers :many
+-- Clients at or above either attacker threshold, sorted by suspicious_score, failure_rate, connections or difficulty
+SELECT 
+    ip_address,
+    difficulty,
+    connection_count,
+    failure_rate,
+    avg_solve_time_ms,
+    reconnect_rate,
+    reputation_score,
+    suspicious_activity_score,
+    last_connection,
+    successful_challenges,
+    failed_challenges,
+    total_challenges
+FROM client_behaviors
+WHERE difficulty >= @min_difficulty::integer
+   OR suspicious_activity_score >= @min_suspicious::float8
+ORDER BY
+    CASE WHEN @sort_by::text = 'failure_rate' THEN failure_rate END DESC NULLS LAST,
+    CASE WHEN @sort_by::text = 'connections' THEN connection_count END DESC NULLS LAST,
+    CASE WHEN @sort_by::text = 'difficulty' THEN difficulty END DESC NULLS LAST,
+    suspicious_activity_score DESC NULLS LAST,
+    ip_address
+LIMIT @max_results::integer;
+
+-- name: ResetClientBehavior :one
+-- Clears the accumulated penalties of a client, keeping its successful challenge history
+UPDATE client_behaviors
+SET
+    reputation_score = 50.0,
+    suspicious_activity_score = 0.0,
+    failure_rate = 0.0,
+    failed_challenges = 0,
+    total_challenges = successful_challenges,
+    difficulty = $2,
+    last_reputation_update = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+WHERE ip_address = $1
+RETURNING *;
@@ -29,6 +29,12 @@ SET challenges_attempted = challenges_attempted + $2,
 WHERE id = $1 
 RETURNING *;
 
+-- name: UpdateConnectionBandwidth :exec
+UPDATE connections
+SET bytes_sent = @bytes_sent,
+    bytes_received = @bytes_received
+WHERE id = @id;
+
 -- name: GetActiveConnections :many
 SELECT * FROM connections 
 WHERE status IN ('connected', 'solving')
@@ -61,10 +67,37 @@ SELECT
     disconnected_at,
     challenges_attempted,
     challenges_completed,
-    total_solve_time_ms
+    total_solve_time_ms,
+    bytes_sent,
+    bytes_received
 FROM connections
 WHERE 
     (@status::connection_status IS NULL OR status = @status)
     AND connected_at >= NOW() - INTERVAL '24 hours'
 ORDER BY connected_at DESC
-LIMIT 100;
\ No newline at end of file
+LIMIT 100;
+
+-- name: GetBandwidthStats :one
+-- Bytes exchanged across all connections in the last 24 hours
+SELECT
+    COUNT(*) as total_connections,
+    COALESCE(SUM(bytes_sent), 0)::bigint as total_bytes_sent,
+    COALESCE(SUM(bytes_received), 0)::bigint as total_bytes_received,
+    COALESCE(AVG(bytes_received), 0)::float8 as avg_bytes_received,
+    COALESCE(MAX(bytes_received), 0)::bigint as max_bytes_received
+FROM connections
+WHERE connected_at >= NOW() - INTERVAL '24 hours';
+
+-- name: GetBandwidthByIP :many
+-- Per-IP bytes exchanged in the last 24 hours, chattiest first
+SELECT
+    remote_addr,
+    COUNT(*) as connections,
+    COALESCE(SUM(bytes_sent), 0)::bigint as bytes_sent,
+    COALESCE(SUM(bytes_received), 0)::bigint as bytes_received,
+    COALESCE(MAX(bytes_received), 0)::bigint as max_bytes_received
+FROM connections
+WHERE connected_at >= NOW() - INTERVAL '24 hours'
+GROUP BY remote_addr
+ORDER BY bytes_received DESC, bytes_sent DESC
+LIMIT $1;
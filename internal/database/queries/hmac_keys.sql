@@ -3,6 +3,13 @@ SELECT * FROM hmac_keys
 WHERE is_active = true
 LIMIT 1;
 
+-- name: GetActiveHMACKeyForUpdate :one
+-- Locks the active key so concurrent rotations derive from the same row one at a time
+SELECT * FROM hmac_keys
+WHERE is_active = true
+LIMIT 1
+FOR UPDATE;
+
 -- name: CreateHMACKey :one
 INSERT INTO hmac_keys (
     key_version,
@@ -0,0 +1,10 @@
+-- name: RedeemChallenge :execrows
+-- Claims a challenge nonce, no row is affected when it was already redeemed
+INSERT INTO redeemed_challenges (nonce, expires_at)
+VALUES ($1, $2)
+ON CONFLICT (nonce) DO NOTHING;
+
+-- name: DeleteExpiredRedemptions :exec
+-- Deletes redemptions of challenges that expired before the cutoff
+DELETE FROM redeemed_challenges
+WHERE expires_at < $1;
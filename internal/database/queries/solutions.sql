@@ -1,8 +1,8 @@
 -- name: CreateSolution :one
 INSERT INTO solutions (
-    challenge_id, nonce, hash, attempts, solve_time_ms, verified
+    challenge_id, nonce, hash, attempts, solve_time_ms, verified, achieved_difficulty, client_solve_time_ms
 ) VALUES (
-    $1, $2, $3, $4, $5, $6
+    $1, $2, $3, $4, $5, $6, $7, $8
 ) RETURNING *;
 
 -- name: GetSolution :one
@@ -35,4 +35,50 @@ SELECT
     MAX(solve_time_ms) as max_solve_time_ms,
     COUNT(CASE WHEN verified = true THEN 1 END) as verified_count
 FROM solutions 
-WHERE created_at >= NOW() - INTERVAL '24 hours';
\ No newline at end of file
+WHERE created_at >= NOW() - INTERVAL '24 hours';
+
+-- name: GetSLABreaches :many
+-- Verified solves by low-difficulty clients in the last 24 hours and how many exceeded the SLA
+SELECT 
+    c.difficulty,
+    COUNT(*) as total_solves,
+    COUNT(*) FILTER (WHERE s.solve_time_ms > @sla_ms::bigint) as breaches
+FROM solutions s
+JOIN challenges c ON s.challenge_id = c.id
+WHERE s.verified = true
+    AND c.difficulty <= @max_difficulty::integer
+    AND s.created_at >= NOW() - INTERVAL '24 hours'
+GROUP BY c.difficulty
+ORDER BY c.difficulty;
+
+-- name: GetAchievedDifficultyDistribution :many
+-- Required vs achieved difficulty of solutions in the last 24 hours
+SELECT 
+    c.difficulty as required_difficulty,
+    s.achieved_difficulty::integer as achieved_difficulty,
+    s.verified,
+    COUNT(*) as solutions
+FROM solutions s
+JOIN challenges c ON s.challenge_id = c.id
+WHERE s.achieved_difficulty IS NOT NULL
+    AND s.created_at >= NOW() - INTERVAL '24 hours'
+GROUP BY c.difficulty, s.achieved_difficulty, s.verified
+ORDER BY c.difficulty, s.achieved_difficulty, s.verified;
+
+-- name: GetAchievedDifficultyViolations :many
+-- Accepted solutions whose hash does not meet the required difficulty, which should never happen
+SELECT 
+    s.id,
+    s.challenge_id,
+    c.client_id,
+    c.algorithm,
+    c.difficulty as required_difficulty,
+    s.achieved_difficulty::integer as achieved_difficulty,
+    s.created_at
+FROM solutions s
+JOIN challenges c ON s.challenge_id = c.id
+WHERE s.verified = true
+    AND s.achieved_difficulty < c.difficulty
+    AND s.created_at >= NOW() - INTERVAL '24 hours'
+ORDER BY s.created_at DESC
+LIMIT $1;
\ No newline at end of file
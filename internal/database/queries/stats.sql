@@ -64,4 +64,60 @@ FROM solutions s
 JOIN challenges c ON s.challenge_id = c.id
 WHERE s.created_at >= NOW() - INTERVAL '24 hours'
 GROUP BY time_bucket
-ORDER BY time_bucket DESC;
\ No newline at end of file
+ORDER BY time_bucket DESC;
+
+-- name: GetActivityTimeline :many
+-- Per-minute activity between two timestamps, used to reconstruct experiment timelines
+WITH buckets AS (
+    SELECT generate_series(
+        time_bucket('1 minute', @start_time::timestamptz),
+        @end_time::timestamptz,
+        INTERVAL '1 minute'
+    ) AS bucket
+),
+conn AS (
+    SELECT 
+        time_bucket('1 minute', connected_at) AS bucket,
+        COUNT(*) AS connections,
+        COUNT(DISTINCT remote_addr) AS unique_clients
+    FROM connections
+    WHERE connected_at >= @start_time AND connected_at <= @end_time
+    GROUP BY 1
+),
+chal AS (
+    SELECT 
+        time_bucket('1 minute', created_at) AS bucket,
+        COUNT(*) AS challenges,
+        COUNT(*) FILTER (WHERE status = 'completed') AS solved,
+        COUNT(*) FILTER (WHERE status IN ('failed', 'expired')) AS failed,
+        AVG(difficulty) AS avg_difficulty,
+        MAX(difficulty) AS max_difficulty
+    FROM challenges
+    WHERE created_at >= @start_time AND created_at <= @end_time
+    GROUP BY 1
+),
+events AS (
+    SELECT 
+        time_bucket('1 minute', timestamp) AS bucket,
+        COUNT(*) FILTER (WHERE metadata->>'event' = 'aggressive_client_alert') AS aggressive_alerts,
+        COUNT(*) FILTER (WHERE metadata->>'event' IN ('difficulty_increased', 'high_difficulty_assigned')) AS escalations
+    FROM logs
+    WHERE timestamp >= @start_time AND timestamp <= @end_time
+    GROUP BY 1
+)
+SELECT 
+    b.bucket::timestamptz AS bucket,
+    COALESCE(conn.connections, 0)::bigint AS connections,
+    COALESCE(conn.unique_clients, 0)::bigint AS unique_clients,
+    COALESCE(chal.challenges, 0)::bigint AS challenges,
+    COALESCE(chal.solved, 0)::bigint AS solved,
+    COALESCE(chal.failed, 0)::bigint AS failed,
+    COALESCE(chal.avg_difficulty, 0)::FLOAT AS avg_difficulty,
+    COALESCE(chal.max_difficulty, 0)::integer AS max_difficulty,
+    COALESCE(events.aggressive_alerts, 0)::bigint AS aggressive_alerts,
+    COALESCE(events.escalations, 0)::bigint AS escalations
+FROM buckets b
+LEFT JOIN conn ON conn.bucket = b.bucket
+LEFT JOIN chal ON chal.bucket = b.bucket
+LEFT JOIN events ON events.bucket = b.bucket
+ORDER BY b.bucket;
\ No newline at end of file
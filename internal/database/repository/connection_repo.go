@@ -42,4 +42,12 @@ func (r *connectionRepo) GetFiltered(ctx context.Context, status ConnectionStatu
 
 func (r *connectionRepo) GetStats(ctx context.Context) (GetConnectionStatsRow, error) {
 	return r.queries.GetConnectionStats(ctx, r.db)
+}
+
+func (r *connectionRepo) GetBandwidthStats(ctx context.Context) (GetBandwidthStatsRow, error) {
+	return r.queries.GetBandwidthStats(ctx, r.db)
+}
+
+func (r *connectionRepo) GetBandwidthByIP(ctx context.Context, limit int32) ([]GetBandwidthByIPRow, error) {
+	return r.queries.GetBandwidthByIP(ctx, r.db, limit)
 }
\ No newline at end of file
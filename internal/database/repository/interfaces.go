@@ -20,12 +20,18 @@ type (
 	Solution                       = db.Solution
 	CreateSolutionParams           = db.CreateSolutionParams
 	GetRecentSolutionsRow          = db.GetRecentSolutionsRow
+	GetSLABreachesParams           = db.GetSLABreachesParams
+	GetSLABreachesRow              = db.GetSLABreachesRow
+	GetAchievedDifficultyDistributionRow = db.GetAchievedDifficultyDistributionRow
+	GetAchievedDifficultyViolationsRow   = db.GetAchievedDifficultyViolationsRow
 	
 	Connection                     = db.Connection
 	CreateConnectionParams         = db.CreateConnectionParams
 	UpdateConnectionStatusParams   = db.UpdateConnectionStatusParams
 	GetConnectionStatsRow          = db.GetConnectionStatsRow
 	ConnectionStatus               = db.ConnectionStatus
+	GetBandwidthStatsRow           = db.GetBandwidthStatsRow
+	GetBandwidthByIPRow            = db.GetBandwidthByIPRow
 	
 	RecordMetricParams             = db.RecordMetricParams
 	GetSystemMetricsRow            = db.GetSystemMetricsRow
@@ -33,6 +39,8 @@ type (
 	GetMetricsByTimeRangeRow       = db.GetMetricsByTimeRangeRow
 	GetAggregatedMetricsParams     = db.GetAggregatedMetricsParams
 	GetAggregatedMetricsRow        = db.GetAggregatedMetricsRow
+	GetActivityTimelineParams      = db.GetActivityTimelineParams
+	GetActivityTimelineRow         = db.GetActivityTimelineRow
 	
 	Log                            = db.Log
 	CreateLogParams                = db.CreateLogParams
@@ -59,6 +67,9 @@ type SolutionRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (Solution, error)
 	GetByChallenge(ctx context.Context, challengeID uuid.UUID) ([]Solution, error)
 	GetRecent(ctx context.Context, limit int32) ([]GetRecentSolutionsRow, error)
+	GetSLABreaches(ctx context.Context, params GetSLABreachesParams) ([]GetSLABreachesRow, error)
+	GetAchievedDifficultyDistribution(ctx context.Context) ([]GetAchievedDifficultyDistributionRow, error)
+	GetAchievedDifficultyViolations(ctx context.Context, limit int32) ([]GetAchievedDifficultyViolationsRow, error)
 }
 
 // ConnectionRepository defines connection-related database operations
@@ -69,6 +80,8 @@ type ConnectionRepository interface {
 	GetActive(ctx context.Context) ([]Connection, error)
 	GetFiltered(ctx context.Context, status ConnectionStatus) ([]Connection, error)
 	GetStats(ctx context.Context) (GetConnectionStatsRow, error)
+	GetBandwidthStats(ctx context.Context) (GetBandwidthStatsRow, error)
+	GetBandwidthByIP(ctx context.Context, limit int32) ([]GetBandwidthByIPRow, error)
 }
 
 // MetricsRepository defines metrics-related database operations
@@ -77,6 +90,7 @@ type MetricsRepository interface {
 	GetSystem(ctx context.Context) ([]GetSystemMetricsRow, error)
 	GetByTimeRange(ctx context.Context, params GetMetricsByTimeRangeParams) ([]GetMetricsByTimeRangeRow, error)
 	GetAggregated(ctx context.Context, params GetAggregatedMetricsParams) ([]GetAggregatedMetricsRow, error)
+	GetActivityTimeline(ctx context.Context, params GetActivityTimelineParams) ([]GetActivityTimelineRow, error)
 }
 
 // LogRepository defines log-related database operations
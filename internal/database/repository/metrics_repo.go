@@ -25,4 +25,8 @@ func (r *metricsRepo) GetByTimeRange(ctx context.Context, params GetMetricsByTim
 
 func (r *metricsRepo) GetAggregated(ctx context.Context, params GetAggregatedMetricsParams) ([]GetAggregatedMetricsRow, error) {
 	return r.queries.GetAggregatedMetrics(ctx, r.db, params)
+}
+
+func (r *metricsRepo) GetActivityTimeline(ctx context.Context, params GetActivityTimelineParams) ([]GetActivityTimelineRow, error) {
+	return r.queries.GetActivityTimeline(ctx, r.db, params)
 }
\ No newline at end of file
@@ -29,4 +29,15 @@ func (r *solutionRepo) GetByChallenge(ctx context.Context, challengeID uuid.UUID
 
 func (r *solutionRepo) GetRecent(ctx context.Context, limit int32) ([]GetRecentSolutionsRow, error) {
 	return r.queries.GetRecentSolutions(ctx, r.db, limit)
-}
\ No newline at end of file
+}
+
+func (r *solutionRepo) GetSLABreaches(ctx context.Context, params GetSLABreachesParams) ([]GetSLABreachesRow, error) {
+	return r.queries.GetSLABreaches(ctx, r.db, params)
+}
+func (r *solutionRepo) GetAchievedDifficultyDistribution(ctx context.Context) ([]GetAchievedDifficultyDistributionRow, error) {
+	return r.queries.GetAchievedDifficultyDistribution(ctx, r.db)
+}
+
+func (r *solutionRepo) GetAchievedDifficultyViolations(ctx context.Context, limit int32) ([]GetAchievedDifficultyViolationsRow, error) {
+	return r.queries.GetAchievedDifficultyViolations(ctx, r.db, limit)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// difficultyUpdate is the body PUT /difficulty accepts
+type difficultyUpdate struct {
+	Difficulty int `json:"difficulty"`
+}
+
+// registerAdminRoutes adds the difficulty and stats routes to the metrics port's mux.
+// Changing the difficulty requires the admin token when one is configured.
+func (s *Server) registerAdminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /difficulty", s.handleGetDifficulty)
+	mux.HandleFunc("PUT /difficulty", s.requireAdminToken(s.handleSetDifficulty))
+	mux.HandleFunc("GET /stats", s.handleGetStats)
+}
+
+// requireAdminToken rejects requests without the admin token as a bearer token, and lets
+// everything through when no token is configured
+func (s *Server) requireAdminToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+				http.Error(w, "missing or invalid admin token", http.StatusUnauthorized)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) handleGetDifficulty(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, difficultyUpdate{Difficulty: s.getDifficulty()})
+}
+
+// handleSetDifficulty applies a new global difficulty. In adaptive mode the controller
+// keeps adjusting from the new value.
+func (s *Server) handleSetDifficulty(w http.ResponseWriter, r *http.Request) {
+	var update difficultyUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := s.SetDifficulty(update.Difficulty); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.recorder.UpdateCurrentDifficulty(update.Difficulty)
+	log.Printf("🎚️ Difficulty set to %d by admin from %s", update.Difficulty, r.RemoteAddr)
+
+	writeJSON(w, http.StatusOK, update)
+}
+
+func (s *Server) handleGetStats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.GetStats())
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
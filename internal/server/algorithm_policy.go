@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"world-of-wisdom/pkg/pow"
+)
+
+// algorithmPolicy is the algorithm challenges of each difficulty use, indexed by
+// difficulty. Difficulties left empty use the server's configured algorithm.
+type algorithmPolicy [maxDifficulty + 1]string
+
+// parseAlgorithmPolicy reads comma-separated difficulty ranges and their algorithm, e.g.
+// "1-3:sha256,4-6:argon2". A range may be a single difficulty, and ranges must not overlap.
+func parseAlgorithmPolicy(policy string) (algorithmPolicy, error) {
+	var p algorithmPolicy
+	for _, entry := range strings.Split(policy, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		levels, algorithm, ok := strings.Cut(entry, ":")
+		if !ok {
+			return p, fmt.Errorf("invalid algorithm policy entry %q (want <difficulties>:<algorithm>)", entry)
+		}
+		if algorithm != "sha256" && algorithm != "argon2" {
+			return p, fmt.Errorf("invalid algorithm %q in policy entry %q (must be sha256 or argon2)", algorithm, entry)
+		}
+
+		low, high, err := pow.ParseDifficultyRange(levels)
+		if err != nil {
+			return p, fmt.Errorf("invalid algorithm policy entry %q: %w", entry, err)
+		}
+		for d := low; d <= high; d++ {
+			if p[d] != "" {
+				return p, fmt.Errorf("difficulty %d appears twice in the algorithm policy", d)
+			}
+			p[d] = algorithm
+		}
+	}
+	return p, nil
+}
+
+// algorithmFor returns the algorithm a challenge of difficulty is issued with
+func (s *Server) algorithmFor(difficulty int) string {
+	if algorithm := s.algorithmPolicy[clampDifficulty(difficulty)]; algorithm != "" {
+		return algorithm
+	}
+	return s.algorithm
+}
+
+// issuesArgon2 reports whether any difficulty is issued Argon2 challenges
+func (s *Server) issuesArgon2() bool {
+	for d := 1; d <= maxDifficulty; d++ {
+		if s.algorithmFor(d) == "argon2" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// busyPrefix starts the line sent instead of a challenge when the server is overloaded.
+// It is newline-delimited for every client, framed clients tell it from a frame by its
+// first byte.
+const busyPrefix = "BUSY retry-after="
+
+// defaultBusyRetryAfter is the retry hint when BusyRetryAfter is not configured
+const defaultBusyRetryAfter = 5 * time.Second
+
+// Reasons a connection is shed, the label of wow_connections_shed_total
+const (
+	shedWorkerQueueFull = "worker_queue_full"
+	shedArgon2Memory    = "argon2_memory"
+	shedIssueRate       = "issue_rate"
+)
+
+// busyLine is "BUSY retry-after=N\n", N in whole seconds and at least 1
+func busyLine(retryAfter time.Duration) string {
+	seconds := max(int((retryAfter+time.Second-1)/time.Second), 1)
+	return fmt.Sprintf("%s%d\n", busyPrefix, seconds)
+}
+
+// writeBusy tells a new client to come back later. Shedding happens in floods, so it is
+// counted rather than logged per connection.
+func (s *Server) writeBusy(w io.Writer, reason string) {
+	s.recorder.RecordConnectionShed(reason)
+	w.Write([]byte(busyLine(s.busyRetryAfter)))
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// connLimiter caps the number of simultaneous connections from a single IP
+type connLimiter struct {
+	mu     sync.Mutex
+	max    int // 0 disables the cap
+	active map[netip.Addr]int
+	exempt []netip.Prefix
+}
+
+func newConnLimiter(max int, exempt []netip.Prefix) *connLimiter {
+	return &connLimiter{
+		max:    max,
+		active: make(map[netip.Addr]int),
+		exempt: exempt,
+	}
+}
+
+// acquire reserves a connection slot for ip. ok is false if ip is already at the cap, held
+// reports whether a slot was counted and must be given back with release.
+func (l *connLimiter) acquire(ip netip.Addr) (ok, held bool) {
+	if l == nil {
+		return true, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.max <= 0 || l.isExempt(ip) {
+		return true, false
+	}
+	if l.active[ip] >= l.max {
+		return false, false
+	}
+	l.active[ip]++
+	return true, true
+}
+
+// release frees a slot counted by acquire. It doesn't look at the cap or exemptions, which
+// a reload may have changed since the slot was taken.
+func (l *connLimiter) release(ip netip.Addr) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active[ip] <= 1 {
+		delete(l.active, ip)
+		return
+	}
+	l.active[ip]--
+}
+
+// update changes the cap and exemptions in place, open connections are not affected
+func (l *connLimiter) update(max int, exempt []netip.Prefix) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.max = max
+	l.exempt = exempt
+}
+
+// limit returns the current cap, 0 when disabled
+func (l *connLimiter) limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.max
+}
+
+// activeFor returns the number of open connections held by ip
+func (l *connLimiter) activeFor(ip netip.Addr) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active[ip]
+}
+
+// isExempt must be called with l.mu held
+func (l *connLimiter) isExempt(ip netip.Addr) bool {
+	for _, prefix := range l.exempt {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAllowlist parses a comma-separated list of IPs and CIDR prefixes
+func parseAllowlist(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowlist prefix %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowlist address %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
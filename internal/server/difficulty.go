@@ -0,0 +1,208 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// connectionRateWindow is the EWMA time constant for the connection rate, a burst of
+// N connections moves the rate by N per window rather than N per sample
+const connectionRateWindow = 2 * time.Minute
+
+// rateEWMA is a connections-per-minute estimate that decays continuously between
+// connections instead of resetting at each difficulty adjustment
+type rateEWMA struct {
+	rate float64 // Per minute as of last
+	last time.Time
+}
+
+// observe records one connection at now
+func (r *rateEWMA) observe(now time.Time) {
+	r.rate = r.perMinute(now) + float64(time.Minute)/float64(connectionRateWindow)
+	r.last = now
+}
+
+// perMinute returns the smoothed rate as of now
+func (r *rateEWMA) perMinute(now time.Time) float64 {
+	if r.last.IsZero() {
+		return 0
+	}
+	elapsed := now.Sub(r.last)
+	return r.rate * math.Exp(-float64(elapsed)/float64(connectionRateWindow))
+}
+
+// DifficultySample is the traffic observed since the last difficulty adjustment
+type DifficultySample struct {
+	AvgSolveTime            time.Duration
+	ConnectionRatePerMinute float64
+	Solves                  int
+}
+
+// solveTimeHistory is how many recent solve times adaptive difficulty averages at most
+const solveTimeHistory = 50
+
+// AdaptiveConfig holds the thresholds adaptive difficulty acts on. Zero fields take the
+// defaults the rules were written with.
+type AdaptiveConfig struct {
+	TargetSolveTime    time.Duration // Raise difficulty while the average solve is faster (default 1s)
+	MaxSolveTime       time.Duration // Lower difficulty while the average solve is slower and the rate is low (default 5s)
+	HighConnectionRate float64       // Connections per minute above which difficulty is raised (default 20)
+	LowConnectionRate  float64       // Connections per minute below which difficulty may be lowered (default 5)
+	AdjustEvery        int           // Solves between adjustments, also made every 30s regardless (default 10)
+}
+
+// withDefaults fills in the zero fields
+func (c AdaptiveConfig) withDefaults() AdaptiveConfig {
+	if c.TargetSolveTime <= 0 {
+		c.TargetSolveTime = time.Second
+	}
+	if c.MaxSolveTime <= 0 {
+		c.MaxSolveTime = 5 * time.Second
+	}
+	if c.HighConnectionRate <= 0 {
+		c.HighConnectionRate = 20
+	}
+	if c.LowConnectionRate <= 0 {
+		c.LowConnectionRate = 5
+	}
+	if c.AdjustEvery <= 0 {
+		c.AdjustEvery = 10
+	}
+	return c
+}
+
+// validate rejects thresholds that would raise and lower difficulty on the same sample
+func (c AdaptiveConfig) validate() error {
+	c = c.withDefaults()
+	if c.MaxSolveTime <= c.TargetSolveTime {
+		return fmt.Errorf("max solve time %v must be above the target solve time %v", c.MaxSolveTime, c.TargetSolveTime)
+	}
+	if c.LowConnectionRate >= c.HighConnectionRate {
+		return fmt.Errorf("low connection rate %.1f/min must be below the high rate %.1f/min", c.LowConnectionRate, c.HighConnectionRate)
+	}
+	if c.AdjustEvery > solveTimeHistory {
+		return fmt.Errorf("adjusting every %d solves exceeds the %d solve times kept", c.AdjustEvery, solveTimeHistory)
+	}
+	return nil
+}
+
+// DifficultyController picks the next global difficulty (1-6) from a traffic sample
+type DifficultyController interface {
+	Name() string
+	Next(current int, sample DifficultySample) int
+}
+
+// NewDifficultyController returns the controller registered under name, acting on the
+// thresholds in adaptive
+func NewDifficultyController(name string, solveTimeSLA time.Duration, adaptive AdaptiveConfig) (DifficultyController, error) {
+	switch name {
+	case "", "threshold":
+		return thresholdController{limits: adaptive}, nil
+	case "sla":
+		return slaController{target: solveTimeSLA, limits: adaptive}, nil
+	default:
+		return nil, fmt.Errorf("invalid difficulty controller: %s (must be threshold or sla)", name)
+	}
+}
+
+// thresholdController is the original rule set, with AdaptiveConfig's defaults:
+// - If avg solve time < 1s: increase difficulty
+// - If avg solve time > 5s: decrease difficulty
+// - If connection rate is high (>20/min): increase difficulty
+type thresholdController struct {
+	limits AdaptiveConfig
+}
+
+func (thresholdController) Name() string { return "threshold" }
+
+func (c thresholdController) Next(current int, sample DifficultySample) int {
+	limits := c.limits.withDefaults()
+	if sample.AvgSolveTime < limits.TargetSolveTime || sample.ConnectionRatePerMinute > limits.HighConnectionRate {
+		return clampDifficulty(current + 1)
+	}
+	if sample.AvgSolveTime > limits.MaxSolveTime && sample.ConnectionRatePerMinute < limits.LowConnectionRate {
+		return clampDifficulty(current - 1)
+	}
+	return current
+}
+
+// slaController keeps solves under the solve-time SLA, raising difficulty only
+// while clients solve well within it or the connection rate is high. Of the adaptive
+// thresholds it only uses the high connection rate.
+type slaController struct {
+	target time.Duration
+	limits AdaptiveConfig
+}
+
+func (slaController) Name() string { return "sla" }
+
+func (c slaController) Next(current int, sample DifficultySample) int {
+	if sample.AvgSolveTime > c.target {
+		return clampDifficulty(current - 1)
+	}
+	if sample.AvgSolveTime < c.target/3 || sample.ConnectionRatePerMinute > c.limits.withDefaults().HighConnectionRate {
+		return clampDifficulty(current + 1)
+	}
+	return current
+}
+
+// SetAdaptiveConfig changes the adaptive difficulty thresholds at runtime, for the active
+// and the shadow controller. Invalid thresholds are rejected and the current ones kept.
+func (s *Server) SetAdaptiveConfig(adaptive AdaptiveConfig) error {
+	if err := adaptive.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	controller, err := NewDifficultyController(s.controller.Name(), s.solveTimeSLA, adaptive)
+	if err != nil {
+		return err
+	}
+	if s.shadowController != nil {
+		shadow, err := NewDifficultyController(s.shadowController.Name(), s.solveTimeSLA, adaptive)
+		if err != nil {
+			return err
+		}
+		s.shadowController = shadow
+	}
+	s.controller = controller
+	s.adaptive = adaptive.withDefaults()
+
+	log.Printf("Adaptive difficulty thresholds: solve %v-%v, rate %.1f-%.1f/min, every %d solves",
+		s.adaptive.TargetSolveTime, s.adaptive.MaxSolveTime, s.adaptive.LowConnectionRate, s.adaptive.HighConnectionRate, s.adaptive.AdjustEvery)
+	return nil
+}
+
+// maxDifficulty is the highest difficulty any controller or client can reach
+const maxDifficulty = 6
+
+func clampDifficulty(d int) int {
+	return max(1, min(d, maxDifficulty))
+}
+
+// floorDifficulty raises d to the configured minimum difficulty
+func (s *Server) floorDifficulty(d int) int {
+	return max(d, s.minDifficulty)
+}
+
+// evaluateShadow runs the shadow controller on the same sample as the active one.
+// Its difficulty evolves on its own and is only logged and exported, never applied.
+// Must be called with s.mu held.
+func (s *Server) evaluateShadow(sample DifficultySample) {
+	if s.shadowController == nil {
+		return
+	}
+
+	s.shadowDifficulty = s.floorDifficulty(s.shadowController.Next(s.shadowDifficulty, sample))
+	s.recorder.UpdateShadowDifficulty(s.shadowController.Name(), s.shadowDifficulty, s.difficulty)
+
+	if s.shadowDifficulty != s.difficulty {
+		log.Printf("Shadow difficulty (%s): %d vs active %d (avg solve: %v, rate: %.1f/min)",
+			s.shadowController.Name(), s.shadowDifficulty, s.difficulty,
+			sample.AvgSolveTime, sample.ConnectionRatePerMinute)
+	}
+}
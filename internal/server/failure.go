@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+
+	"world-of-wisdom/pkg/pow"
+)
+
+// FailureReason is why a submitted solution was rejected
+type FailureReason string
+
+const (
+	FailureExpired       FailureReason = "expired"        // Solution arrived after the challenge expired
+	FailureInvalidFormat FailureReason = "invalid_format" // Nothing that could be verified as a nonce
+	FailureInvalidPoW    FailureReason = "invalid_pow"    // Nonce does not meet the difficulty
+	FailureUnknownToken  FailureReason = "unknown_token"  // Retry named no quote earned from this IP
+	FailureReplayed      FailureReason = "replayed"       // Challenge was already redeemed, here or over HTTP
+)
+
+// terseFailure is sent for every rejected solution unless verbose failures are enabled,
+// so clients can't tell the reasons apart
+const terseFailure = "Solution rejected"
+
+var failureMessages = map[FailureReason]string{
+	FailureExpired:       "Challenge expired, reconnect",
+	FailureInvalidFormat: "Malformed solution",
+	FailureInvalidPoW:    "Invalid proof of work",
+	FailureUnknownToken:  "Unknown or expired solve token, solve the challenge",
+	FailureReplayed:      "Challenge already redeemed",
+}
+
+// parseFailureResponses validates the failure response mode, returning whether it is verbose
+func parseFailureResponses(mode string) (bool, error) {
+	switch mode {
+	case "", "terse":
+		return false, nil
+	case "verbose":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid failure responses: %s (must be terse or verbose)", mode)
+	}
+}
+
+// failureResponse is the line sent to a client whose solution was rejected
+func failureResponse(reason FailureReason, verbose bool) string {
+	if !verbose {
+		return "Error: " + terseFailure + "\n"
+	}
+	return fmt.Sprintf("Error: %s (%s)\n", failureMessages[reason], reason)
+}
+
+// writeFailure tells a JSON client its solution was rejected, binary clients are just disconnected
+func (s *Server) writeFailure(sess *session, reason FailureReason) {
+	sess.outcome = string(reason)
+	if sess.format != pow.FormatBinary {
+		sess.conn.Write([]byte(failureResponse(reason, s.verboseFailures)))
+	}
+}
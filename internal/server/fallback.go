@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"log"
+
+	"world-of-wisdom/pkg/pow"
+)
+
+// checkArgon2Memory tracks whether the host can spare the memory an Argon2 hash needs and
+// reports whether a new connection must be shed for it. The difficulty isn't known yet,
+// so the largest memory of the active Argon2 profile is checked. With Argon2 fallback
+// enabled clients get SHA-256 challenges instead and are never shed.
+func (s *Server) checkArgon2Memory(ctx context.Context) (shed bool) {
+	if !s.issuesArgon2() {
+		return false
+	}
+
+	err := pow.CheckArgon2Memory(pow.MaxArgon2Memory())
+	if err == nil {
+		if s.argon2Degraded.CompareAndSwap(true, false) {
+			log.Printf("✅ Memory pressure cleared, Argon2 challenges are back to normal")
+			s.logActivity(ctx, "info", "Argon2 memory pressure cleared", map[string]interface{}{
+				"event": "argon2_memory_recovered",
+			})
+		}
+		return false
+	}
+
+	// Only log transitions so a sustained shortage doesn't flood the logs
+	if s.argon2Degraded.CompareAndSwap(false, true) {
+		if s.argon2Fallback {
+			log.Printf("⚠️ Falling back to SHA-256 challenges: %v", err)
+			s.logActivity(ctx, "warning", "Falling back to SHA-256 challenges under memory pressure", map[string]interface{}{
+				"reason": err.Error(),
+				"event":  "argon2_fallback",
+			})
+			s.recorder.RecordAlgorithmFallback()
+		} else {
+			log.Printf("⚠️ Shedding new connections under memory pressure (%v), enable ARGON2_FALLBACK to degrade to SHA-256", err)
+			s.logActivity(ctx, "warning", "New connections shed under memory pressure", map[string]interface{}{
+				"reason": err.Error(),
+				"event":  "argon2_memory_pressure",
+			})
+		}
+	}
+	return !s.argon2Fallback
+}
+
+// selectAlgorithm picks the algorithm and challenge difficulty for a new challenge from
+// the algorithm policy, SHA-256 at an equivalent-effort difficulty in place of Argon2 while
+// checkArgon2Memory found the host short of memory and fallback is enabled
+func (s *Server) selectAlgorithm(difficulty int) (string, int) {
+	algorithm := s.algorithmFor(difficulty)
+	if algorithm != "argon2" || !s.argon2Fallback || !s.argon2Degraded.Load() {
+		return algorithm, difficulty
+	}
+	return "sha256", pow.EquivalentSHA256Difficulty(difficulty)
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"time"
+
+	"world-of-wisdom/pkg/pow"
+)
+
+// framedHello is sent by clients right after connecting to announce they read
+// length-prefixed challenge frames. Legacy clients never speak first and keep getting
+// newline-delimited JSON, binary challenges are only sent framed since their bytes
+// may contain a newline.
+const framedHello = "FRAMED\n"
+
+// framedHelloOptions starts a hello carrying options before its newline, e.g.
+// "FRAMED difficulty=5\n". It is as long as the bare hello, so one peek tells them apart.
+const framedHelloOptions = "FRAMED "
+
+// negotiateFraming waits until helloWait after the handshake started for the framed hello
+// and picks the session's framing and challenge format from it
+func (s *Server) negotiateFraming(sess *session) {
+	sess.format = pow.FormatJSON
+	if s.helloWait <= 0 {
+		return
+	}
+
+	sess.conn.SetReadDeadline(sess.stateEntered.Add(s.helloWait))
+	options, ok := readHello(sess.reader)
+
+	var deadline time.Time
+	if timeout := s.stateTimeout(sess.state); timeout > 0 {
+		deadline = sess.stateEntered.Add(timeout)
+	}
+	sess.conn.SetReadDeadline(deadline)
+
+	if !ok {
+		return
+	}
+	sess.framed = true
+	sess.format = s.challengeFormat
+	sess.difficultyHint = parseDifficultyHint(options)
+}
+
+// readHello consumes the framed hello and returns its options, if any. Anything else the
+// client sent is left unread.
+func readHello(reader *bufio.Reader) (string, bool) {
+	hello, err := reader.Peek(len(framedHello))
+	if err != nil {
+		return "", false
+	}
+
+	switch string(hello) {
+	case framedHello:
+		reader.Discard(len(framedHello))
+		return "", true
+	case framedHelloOptions:
+		line, err := reader.ReadSlice('\n')
+		if err != nil {
+			return "", false
+		}
+		return strings.TrimSpace(string(line[len(framedHelloOptions):])), true
+	}
+	return "", false
+}
+
+// parseDifficultyHint returns the difficulty asked for with "difficulty=N" among the hello
+// options, 0 without one. Unknown options are ignored for clients newer than the server.
+func parseDifficultyHint(options string) int {
+	for _, option := range strings.Fields(options) {
+		value, ok := strings.CutPrefix(option, "difficulty=")
+		if !ok {
+			continue
+		}
+		if hint, err := strconv.Atoi(value); err == nil && hint > 0 {
+			return hint
+		}
+	}
+	return 0
+}
+
+// encodeChallenge frames challenge data the way the session negotiated
+func encodeChallenge(sess *session, data []byte) []byte {
+	if sess.framed {
+		return pow.EncodeFrame(data, sess.format)
+	}
+	return append(data, '\n')
+}
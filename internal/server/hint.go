@@ -0,0 +1,40 @@
+package server
+
+import (
+	"fmt"
+
+	"world-of-wisdom/internal/behavior"
+	"world-of-wisdom/pkg/logger"
+)
+
+// hintRejectedPrefix starts the line sent ahead of the challenge when a client's
+// difficulty hint is not granted, followed by the difficulty it is issued instead.
+// Like the busy line it is newline-delimited, framed clients tell it from a frame by
+// its first byte.
+const hintRejectedPrefix = "HINT rejected difficulty="
+
+// applyDifficultyHint grants the difficulty a client asked for in its hello when it is no
+// easier than the one required and no harder than maxDifficulty. Any other hint is
+// answered with the required difficulty, which the client is issued instead.
+func (s *Server) applyDifficultyHint(sess *session, required int, decision behavior.DifficultyDecision) (int, behavior.DifficultyDecision) {
+	hint := sess.difficultyHint
+	if hint == 0 {
+		return required, decision
+	}
+
+	if hint < required || hint > maxDifficulty {
+		s.recorder.RecordDifficultyHint("rejected")
+		s.logActivity(sess.ctx, "info", fmt.Sprintf("Rejected difficulty hint %d from %s, enforcing %d", hint, logger.SanitizeIP(sess.clientAddr), required), map[string]interface{}{
+			"ip":       sess.remoteAddr.String(),
+			"hint":     hint,
+			"required": required,
+			"event":    "difficulty_hint_rejected",
+		})
+		sess.conn.Write([]byte(fmt.Sprintf("%s%d\n", hintRejectedPrefix, required)))
+		return required, decision
+	}
+
+	s.recorder.RecordDifficultyHint("granted")
+	sess.volunteered = hint - required
+	return hint, decision.Adjust("client_hint", float64(hint), hint)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// rateSweepInterval is how often buckets of IPs that stopped connecting are dropped
+const rateSweepInterval = time.Minute
+
+// ipRateLimiter caps how often a single IP may do something per minute, with a token
+// bucket per IP. The server keeps one for connections and one for issued challenges.
+type ipRateLimiter struct {
+	mu        sync.Mutex
+	rate      int // Events per IP per minute, also the burst, 0 disables the limit
+	buckets   map[netip.Addr]*rateBucket
+	exempt    []netip.Prefix
+	lastSweep time.Time
+}
+
+// rateBucket is a token bucket refilled at rate tokens per minute
+type rateBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newIPRateLimiter(rate int, exempt []netip.Prefix) *ipRateLimiter {
+	return &ipRateLimiter{
+		rate:    rate,
+		buckets: make(map[netip.Addr]*rateBucket),
+		exempt:  exempt,
+	}
+}
+
+// allow takes a token from ip's bucket, returning false if it is empty
+func (l *ipRateLimiter) allow(ip netip.Addr, now time.Time) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 || l.isExempt(ip) {
+		return true
+	}
+	l.sweep(now)
+
+	capacity := float64(l.rate)
+	bucket, ok := l.buckets[ip]
+	if !ok {
+		bucket = &rateBucket{tokens: capacity, updated: now}
+		l.buckets[ip] = bucket
+	}
+	bucket.tokens = min(capacity, bucket.tokens+now.Sub(bucket.updated).Minutes()*capacity)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// sweepIdle drops idle buckets, for when no new events arrive to trigger a sweep
+func (l *ipRateLimiter) sweepIdle(now time.Time) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+}
+
+// sweep drops buckets that have refilled completely, they behave like new ones. Must be
+// called with l.mu held.
+func (l *ipRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for ip, bucket := range l.buckets {
+		if now.Sub(bucket.updated) >= time.Minute {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+// update changes the rate and exemptions in place, existing buckets are kept
+func (l *ipRateLimiter) update(rate int, exempt []netip.Prefix) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = rate
+	l.exempt = exempt
+}
+
+// isExempt must be called with l.mu held
+func (l *ipRateLimiter) isExempt(ip netip.Addr) bool {
+	for _, prefix := range l.exempt {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// sweepRateLimiters drops idle buckets of both rate limiters until shutdown, so an IP
+// that floods once and never returns doesn't keep its bucket while no one connects
+func (s *Server) sweepRateLimiters() {
+	ticker := time.NewTicker(rateSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.shutdownChan:
+			return
+		case now := <-ticker.C:
+			s.connRateLimiter.sweepIdle(now)
+			s.issueLimiter.sweepIdle(now)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"fmt"
+	"net"
+)
+
+// listenOptions are the socket options of the TCP listeners
+type listenOptions struct {
+	backlog   int  // Accept queue length, 0 keeps the OS default (net.core.somaxconn)
+	reusePort bool // Set SO_REUSEPORT so several listeners can bind the same port
+	listeners int  // Listeners opened in this process, more than one requires reusePort
+}
+
+// listen opens the server's listeners. With SO_REUSEPORT the kernel spreads incoming
+// connections across them, and each gets its own accept loop.
+func listen(addr string, opts listenOptions) ([]net.Listener, error) {
+	count := max(opts.listeners, 1)
+	if count > 1 && !opts.reusePort {
+		return nil, fmt.Errorf("%d accept listeners require SO_REUSEPORT", count)
+	}
+
+	listeners := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		l, err := listenTCP(addr, opts.backlog, opts.reusePort)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, err
+		}
+		// Later listeners join the first one's port, which matters for ":0"
+		if i == 0 {
+			addr = l.Addr().String()
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
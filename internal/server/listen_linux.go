@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenTCP opens a TCP listener with SO_REUSEPORT and a custom backlog as requested
+func listenTCP(addr string, backlog int, reusePort bool) (net.Listener, error) {
+	var lc net.ListenConfig
+	if reusePort {
+		lc.Control = func(_, _ string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		}
+	}
+
+	l, err := lc.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if backlog > 0 {
+		if err := setBacklog(l, backlog); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// setBacklog calls listen(2) again on the bound socket, which on Linux resizes its accept
+// queue. The kernel still caps it at net.core.somaxconn.
+func setBacklog(l net.Listener, backlog int) error {
+	tcp, ok := l.(*net.TCPListener)
+	if !ok {
+		return fmt.Errorf("listen backlog needs a TCP listener, got %T", l)
+	}
+	raw, err := tcp.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("failed to access listener socket: %w", err)
+	}
+
+	var listenErr error
+	err = raw.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to access listener socket: %w", err)
+	}
+	if listenErr != nil {
+		return fmt.Errorf("failed to set listen backlog %d: %w", backlog, listenErr)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package server
+
+import (
+	"fmt"
+	"net"
+)
+
+// listenTCP opens a plain TCP listener, the socket options are only supported on Linux
+func listenTCP(addr string, backlog int, reusePort bool) (net.Listener, error) {
+	if backlog > 0 || reusePort {
+		return nil, fmt.Errorf("listen backlog and SO_REUSEPORT are only supported on Linux")
+	}
+	return net.Listen("tcp", addr)
+}
@@ -0,0 +1,762 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"world-of-wisdom/internal/behavior"
+	generated "world-of-wisdom/internal/database/generated"
+	"world-of-wisdom/internal/webhook"
+	"world-of-wisdom/pkg/config"
+	"world-of-wisdom/pkg/logger"
+	"world-of-wisdom/pkg/pow"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// protocolState is a step of the challenge-response protocol
+type protocolState string
+
+const (
+	// stateAwaitHandshake admits the client: framing negotiation, address checks,
+	// per-IP limits and behavior lookup
+	stateAwaitHandshake protocolState = "await_handshake"
+	stateSendChallenge  protocolState = "send_challenge"
+	stateAwaitSolution  protocolState = "await_solution"
+	stateRespond        protocolState = "respond"
+	stateDone           protocolState = "done"
+)
+
+// stateFunc runs one protocol state and returns the next one, stateDone ends the connection
+type stateFunc func(sess *session) protocolState
+
+// countingConn counts the bytes exchanged with the client. Only the connection's own
+// goroutine uses it, so the counters are plain integers.
+type countingConn struct {
+	net.Conn
+	sent     int64
+	received int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.received += int64(n)
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.sent += int64(n)
+	return n, err
+}
+
+// session is the per-connection state carried between protocol states
+type session struct {
+	conn       *countingConn
+	reader     *bufio.Reader
+	ctx        context.Context // Base context for database operations, each call is bounded by queryTimeout
+	startTime  time.Time
+	clientAddr string
+	clientID   string
+	remoteAddr netip.Addr
+	slotHeld   bool // Whether a per-IP connection slot must be released
+
+	clientBehavior   *behavior.ClientBehavior
+	connectionRecord generated.Connection
+	algorithm        string
+	difficulty       int                         // Per-client difficulty
+	challengeDiff    int                         // Difficulty actually issued, differs under Argon2 fallback
+	decision         behavior.DifficultyDecision // Why challengeDiff was issued, stored with the challenge
+	difficultyHint   int                         // Difficulty the client asked for in its hello, 0 without a hint
+	volunteered      int                         // Levels granted above the required difficulty at the client's request
+
+	framed bool                // Client sent the framed hello, challenges are length-prefixed
+	format pow.ChallengeFormat // Challenge format, always JSON for newline-delimited clients
+
+	challenge       *pow.SecureChallenge
+	challengeRecord generated.Challenge
+
+	response     string
+	solutionHash string
+	solveTime    time.Duration
+	solveToken   string // Client token the earned quote is remembered under
+	retry        bool   // Client asked for the quote earned with solveToken instead of solving
+	report       solveReport
+	outcome      string // How the session ended, reported in the connection summary
+
+	state        protocolState
+	stateEntered time.Time
+}
+
+// protocolSteps is the state table for the current single-shot flow
+func (s *Server) protocolSteps() map[protocolState]stateFunc {
+	return map[protocolState]stateFunc{
+		stateAwaitHandshake: s.awaitHandshake,
+		stateSendChallenge:  s.sendChallenge,
+		stateAwaitSolution:  s.awaitSolution,
+		stateRespond:        s.respond,
+	}
+}
+
+// stateTimeouts collects the configured per-state deadlines, states left out use Timeout
+func stateTimeouts(cfg Config) map[protocolState]time.Duration {
+	timeouts := make(map[protocolState]time.Duration)
+	if cfg.HandshakeTimeout > 0 {
+		timeouts[stateAwaitHandshake] = cfg.HandshakeTimeout
+	}
+	if cfg.RespondTimeout > 0 {
+		timeouts[stateRespond] = cfg.RespondTimeout
+	}
+	return timeouts
+}
+
+// stateTimeout is the deadline applied when a state is entered, zero leaves the connection
+// without one. States without their own deadline get the idle timeout. Waiting for the
+// solution uses the difficulty-scaled solve deadline instead, see awaitSolution.
+func (s *Server) stateTimeout(state protocolState) time.Duration {
+	if timeout, ok := s.stateTimeouts[state]; ok {
+		return timeout
+	}
+	return s.timeout
+}
+
+// runProtocol drives a session through steps until a state returns stateDone.
+// Connections that end before the respond state are counted as stalled in the state they ended in.
+func (s *Server) runProtocol(sess *session, steps map[protocolState]stateFunc) {
+	state := stateAwaitHandshake
+	for {
+		step, ok := steps[state]
+		if !ok {
+			log.Printf("Client %s: no handler for protocol state %s", logger.SanitizeIP(sess.clientAddr), state)
+			s.recorder.RecordProtocolStall(string(state))
+			return
+		}
+
+		sess.state = state
+		sess.stateEntered = time.Now()
+		if timeout := s.stateTimeout(state); timeout > 0 {
+			sess.conn.SetDeadline(sess.stateEntered.Add(timeout))
+		}
+
+		next := step(sess)
+		s.recorder.RecordProtocolState(string(state), time.Since(sess.stateEntered))
+
+		if next == stateDone {
+			if state != stateRespond {
+				s.recorder.RecordProtocolStall(string(state))
+			}
+			return
+		}
+
+		// The connection summary records the final state, each step is only logged for debugging
+		if s.logLevelEnabled("debug") {
+			log.Printf("Client %s: %s -> %s (%v)", logger.SanitizeIP(sess.clientAddr), state, next, time.Since(sess.stateEntered))
+		}
+		state = next
+	}
+}
+
+// closeSession records the disconnection, runs once the protocol has finished
+func (s *Server) closeSession(sess *session) {
+	if sess.slotHeld {
+		s.connLimiter.release(sess.remoteAddr)
+	}
+
+	// Record disconnection in behavior tracker
+	if sess.clientBehavior != nil && sess.clientBehavior.ConnectionTimestampID != (pgtype.UUID{}) {
+		err := s.behaviorTracker.RecordDisconnection(sess.ctx, sess.clientBehavior.ConnectionTimestampID,
+			sess.connectionRecord.ID != (pgtype.UUID{}))
+		if err != nil {
+			log.Printf("Failed to record disconnection: %v", err)
+		}
+	}
+
+	s.recorder.RecordConnectionBytes(sess.conn.sent, sess.conn.received)
+	s.updateConnectionBandwidth(sess.ctx, sess.connectionRecord.ID, sess.conn.sent, sess.conn.received)
+
+	// Always mark connection as disconnected when handler exits
+	if sess.connectionRecord.ID != (pgtype.UUID{}) {
+		s.updateConnectionStatus(sess.ctx, sess.connectionRecord.ID, generated.ConnectionStatusDisconnected)
+	}
+
+	s.logConnectionSummary(sess)
+}
+
+// writeError sends a one-line error to JSON clients, binary clients are just disconnected
+func (s *Server) writeError(sess *session, message string) {
+	if sess.format != pow.FormatBinary {
+		sess.conn.Write([]byte("Error: " + message + "\n"))
+	}
+}
+
+func (s *Server) awaitHandshake(sess *session) protocolState {
+	ctx := sess.ctx
+
+	// Behind a trusted load balancer the real client address comes from the PROXY header,
+	// any other peer sending one is turned away before it is issued anything
+	if s.proxyProtocol && !s.resolveProxyHeader(sess) {
+		return stateDone
+	}
+
+	// Newline-delimited JSON unless the client asks for framed challenges
+	s.negotiateFraming(sess)
+
+	// Parse remote address, IPv6 addresses are bracketed
+	remoteAddrPort, err := netip.ParseAddrPort(sess.clientAddr)
+	remoteAddr := remoteAddrPort.Addr().Unmap()
+	if err != nil {
+		log.Printf("Failed to parse remote address %s: %v", logger.SanitizeIP(sess.clientAddr), err)
+		s.writeError(sess, "Invalid client address")
+		return stateDone
+	}
+	sess.remoteAddr = remoteAddr
+
+	// A flooding IP is turned away before anything is written to the database
+	if !s.connRateLimiter.allow(remoteAddr, time.Now()) {
+		s.recorder.RecordConnection("rejected_conn_rate")
+		sess.outcome = outcomeRateLimited
+		s.writeError(sess, "Rate limited")
+		return stateDone
+	}
+
+	// Log new connection
+	s.logActivity(ctx, "info", fmt.Sprintf("New connection from %s", logger.SanitizeIP(sess.clientAddr)), map[string]interface{}{
+		"client_id":   logger.MaskSensitive(sess.clientID),
+		"remote_addr": logger.SanitizeIP(sess.clientAddr),
+		"event":       "connection_established",
+	})
+
+	// Refuse the connection if this IP already holds its share of slots
+	ok, held := s.connLimiter.acquire(remoteAddr)
+	if !ok {
+		log.Printf("Rejecting connection from %s: per-IP connection limit reached", logger.SanitizeIP(sess.clientAddr))
+		s.logActivity(ctx, "warning", fmt.Sprintf("Connection limit reached for %s", remoteAddr.String()), map[string]interface{}{
+			"ip":    remoteAddr.String(),
+			"limit": s.connLimiter.limit(),
+			"event": "connection_limited",
+		})
+		s.recorder.RecordConnection("rejected_ip_limit")
+		sess.outcome = outcomeLimited
+		s.writeError(sess, "Too many concurrent connections")
+		return stateDone
+	}
+	sess.slotHeld = held
+
+	// Without memory for another Argon2 verification the client is asked to come back
+	// later, before its connection counts against its behavior
+	if s.checkArgon2Memory(ctx) {
+		sess.outcome = outcomeBusy
+		s.writeBusy(sess.conn, shedArgon2Memory)
+		return stateDone
+	}
+
+	// Get previous behavior if exists, a fallback while the database is unavailable
+	prevBehavior, _ := s.behaviorTracker.GetClientBehavior(ctx, remoteAddr)
+	prevDifficulty := prevBehavior.Difficulty
+	prevConnectionCount := prevBehavior.ConnectionCount
+
+	// Track client behavior and get per-client difficulty, the global difficulty if tracking is down
+	clientBehavior, err := s.behaviorTracker.RecordConnection(ctx, remoteAddr)
+	if err != nil {
+		log.Printf("Failed to track client behavior, using the global difficulty: %v", err)
+	}
+	sess.clientBehavior = clientBehavior
+
+	// The connection counts against the client's behavior, but no challenge is generated
+	// for an IP past its issuance rate
+	if !s.issueLimiter.allow(remoteAddr, time.Now()) {
+		log.Printf("Rejecting connection from %s: per-IP challenge issuance rate reached", logger.SanitizeIP(sess.clientAddr))
+		s.recorder.RecordConnection("rejected_issue_rate")
+		sess.outcome = outcomeBusy
+		s.writeBusy(sess.conn, shedIssueRate)
+		return stateDone
+	}
+
+	// Log connection with behavior context
+	if prevConnectionCount > 0 {
+		s.logActivity(ctx, "info", fmt.Sprintf("Client %s reconnected (connection #%d)", remoteAddr.String(), clientBehavior.ConnectionCount), map[string]interface{}{
+			"ip":                remoteAddr.String(),
+			"connection_count":  clientBehavior.ConnectionCount,
+			"failure_rate":      fmt.Sprintf("%.2f%%", clientBehavior.FailureRate*100),
+			"avg_solve_time_ms": clientBehavior.AvgSolveTime.Milliseconds(),
+			"reconnect_rate":    fmt.Sprintf("%.2f%%", clientBehavior.ReconnectRate*100),
+			"reputation_score":  clientBehavior.ReputationScore,
+			"event":             "client_reconnected",
+		})
+
+		// Log difficulty change on reconnection
+		if prevDifficulty != clientBehavior.Difficulty {
+			s.logActivity(ctx, "warning", fmt.Sprintf("Client %s difficulty changed from %d to %d on reconnection", remoteAddr.String(), prevDifficulty, clientBehavior.Difficulty), map[string]interface{}{
+				"ip":             remoteAddr.String(),
+				"old_difficulty": prevDifficulty,
+				"new_difficulty": clientBehavior.Difficulty,
+				"reason":         "reconnection_pattern",
+				"event":          "difficulty_adjusted",
+			})
+		}
+	} else if !clientBehavior.Fallback {
+		// First connection
+		s.logActivity(ctx, "info", fmt.Sprintf("New client %s connected with initial difficulty %d", remoteAddr.String(), clientBehavior.Difficulty), map[string]interface{}{
+			"ip":                 remoteAddr.String(),
+			"initial_difficulty": clientBehavior.Difficulty,
+			"reputation_score":   clientBehavior.ReputationScore,
+			"event":              "new_client_connected",
+		})
+	}
+
+	// First-time clients start higher while a surge of new IPs is under way. Without
+	// tracking every client would look new, so the surge detector is left alone.
+	difficulty := s.floorDifficulty(clientBehavior.Difficulty)
+	decision := clientBehavior.Decision.Adjust("min_difficulty", float64(s.minDifficulty), difficulty)
+	if prevConnectionCount == 0 && !clientBehavior.Fallback {
+		if boost := s.surge.observe(time.Now()); boost > 0 {
+			difficulty = clampDifficulty(difficulty + boost)
+			decision = decision.Adjust("surge", float64(boost), difficulty)
+			s.logActivity(ctx, "warning", fmt.Sprintf("Connection surge: new client %s starts at difficulty %d", remoteAddr.String(), difficulty), map[string]interface{}{
+				"ip":                 remoteAddr.String(),
+				"initial_difficulty": clientBehavior.Difficulty,
+				"boost":              boost,
+				"difficulty":         difficulty,
+				"event":              "surge_difficulty_boost",
+			})
+		}
+	}
+
+	// A client may volunteer for a harder challenge than required, within the server's bounds
+	difficulty, decision = s.applyDifficultyHint(sess, difficulty, decision)
+
+	// Pick the algorithm, degrading to SHA-256 under memory pressure when enabled
+	sess.algorithm, sess.challengeDiff = s.selectAlgorithm(difficulty)
+	sess.decision = decision.Adjust("sha256_equivalent", float64(difficulty), sess.challengeDiff)
+
+	// Create connection record in database
+	sess.connectionRecord, err = s.logConnection(ctx, sess.clientID, remoteAddr, sess.algorithm)
+	if err != nil {
+		log.Printf("Failed to log connection: %v", err)
+		// Continue anyway - don't fail the connection due to DB issues
+	}
+
+	// Record connection metrics
+	s.recorder.RecordConnection("accepted")
+
+	// Track connection rate for adaptive difficulty
+	s.trackConnection()
+
+	// Use per-client difficulty
+	sess.difficulty = difficulty
+	log.Printf("Client %s assigned difficulty %d from %d (reputation: %.1f, suspicious: %.1f): %s",
+		sess.clientAddr, sess.difficulty, sess.decision.Previous, clientBehavior.ReputationScore, clientBehavior.SuspiciousScore, sess.decision)
+
+	// Log if client is flagged as aggressive
+	if sess.difficulty >= 5 {
+		s.logActivity(ctx, "warning", fmt.Sprintf("High difficulty assigned to potential DDoS client: %s", remoteAddr.String()), map[string]interface{}{
+			"ip":               remoteAddr.String(),
+			"difficulty":       sess.difficulty,
+			"reputation_score": clientBehavior.ReputationScore,
+			"suspicious_score": clientBehavior.SuspiciousScore,
+			"decision":         sess.decision,
+			"event":            "high_difficulty_assigned",
+		})
+	}
+
+	return stateSendChallenge
+}
+
+func (s *Server) sendChallenge(sess *session) protocolState {
+	ctx := sess.ctx
+
+	// Use secure challenge generation with key manager
+	challenge, err := pow.GenerateSecureChallengeWithKeyManager(sess.challengeDiff, sess.algorithm, sess.clientID, s.keyManager)
+	if err != nil {
+		log.Printf("Failed to generate secure challenge: %v", err)
+		s.writeError(sess, "Failed to generate challenge")
+		s.updateConnectionStatus(ctx, sess.connectionRecord.ID, generated.ConnectionStatusFailed)
+		return stateDone
+	}
+	sess.challenge = challenge
+
+	// Encode challenge using the negotiated format
+	challengeData, err := s.challengeEncoder.Encode(challenge, sess.format)
+	if err != nil {
+		log.Printf("Failed to encode challenge: %v", err)
+		s.writeError(sess, "Failed to generate challenge")
+		s.updateConnectionStatus(ctx, sess.connectionRecord.ID, generated.ConnectionStatusFailed)
+		return stateDone
+	}
+
+	log.Printf("Sending %s challenge to %s (size: %d bytes, framed: %v)", sess.format, logger.SanitizeIP(sess.clientAddr), len(challengeData), sess.framed)
+
+	// Log challenge to database
+	sess.challengeRecord, err = s.logChallenge(ctx, challenge, int32(sess.challengeDiff), sess.algorithm, sess.clientID, sess.decision)
+	if err != nil {
+		log.Printf("Failed to log challenge: %v", err)
+		// Continue anyway
+	}
+
+	// Update connection status to solving
+	s.updateConnectionStatus(ctx, sess.connectionRecord.ID, generated.ConnectionStatusSolving)
+
+	_, err = sess.conn.Write(encodeChallenge(sess, challengeData))
+	if err != nil {
+		log.Printf("Failed to send challenge to %s: %v", logger.SanitizeIP(sess.clientAddr), err)
+		s.updateConnectionStatus(ctx, sess.connectionRecord.ID, generated.ConnectionStatusFailed)
+		return stateDone
+	}
+	s.recorder.RecordChallengeIssued(string(sess.format), len(challengeData))
+
+	return stateAwaitSolution
+}
+
+func (s *Server) awaitSolution(sess *session) protocolState {
+	ctx := sess.ctx
+
+	// Slow solvers get a difficulty-scaled deadline for the first byte of their answer,
+	// the rest of the line must then arrive within the normal read timeout
+	solveStart := time.Now()
+	sess.conn.SetReadDeadline(s.solveDeadline(sess.challenge))
+	_, peekErr := sess.reader.Peek(1)
+	if peekErr == nil {
+		sess.conn.SetDeadline(time.Now().Add(s.timeout))
+	}
+
+	// Without a hello wait a PROXY header from an untrusted peer only shows up here. Only
+	// trusted proxies may send one, and only before the challenge.
+	if peekErr == nil && s.proxyProtocol && startsWithProxyHeader(sess.reader) {
+		log.Printf("Rejecting PROXY header from untrusted source %s", logger.SanitizeIP(sess.clientAddr))
+		s.recorder.RecordConnection("rejected_proxy_header")
+		if sess.challengeRecord.ID != (pgtype.UUID{}) {
+			s.updateChallengeStatus(ctx, sess.challengeRecord.ID, generated.ChallengeStatusFailed)
+		}
+		s.writeFailure(sess, FailureInvalidFormat)
+		return stateDone
+	}
+	scanner := bufio.NewScanner(sess.reader)
+	if peekErr != nil || !scanner.Scan() {
+		log.Printf("Client %s disconnected or timed out", logger.SanitizeIP(sess.clientAddr))
+
+		// Log disconnection
+		s.logActivity(ctx, "warning", fmt.Sprintf("Client disconnected: %s", logger.SanitizeIP(sess.clientAddr)), map[string]interface{}{
+			"client_id": logger.MaskSensitive(sess.clientID),
+			"event":     "client_disconnected",
+			"reason":    "timeout_or_disconnect",
+		})
+
+		// Record expired challenge as failed attempt for behavior tracking
+		err := s.behaviorTracker.RecordChallengeResult(ctx, sess.remoteAddr, false, time.Since(solveStart))
+		if err != nil {
+			log.Printf("Failed to record expired challenge result: %v", err)
+		}
+
+		s.updateConnectionStatus(ctx, sess.connectionRecord.ID, generated.ConnectionStatusDisconnected)
+		if sess.challengeRecord.ID != (pgtype.UUID{}) {
+			s.updateChallengeStatus(ctx, sess.challengeRecord.ID, generated.ChallengeStatusExpired)
+		}
+		return stateDone
+	}
+
+	sess.response = strings.TrimSpace(scanner.Text())
+	sess.solveTime = time.Since(solveStart)
+
+	line, report := splitSolveReport(sess.response)
+	sess.report = report
+	sess.response, sess.solveToken, sess.retry = parseSolutionLine(line)
+	return stateRespond
+}
+
+func (s *Server) respond(sess *session) protocolState {
+	switch {
+	case sess.retry:
+		s.respondRedeemed(sess)
+	case sess.challenge.IsExpired():
+		// A solution that arrives after expiry is rejected even if the PoW is valid
+		s.respondExpired(sess)
+	case sess.response == "":
+		s.respondFailed(sess, FailureInvalidFormat)
+	case !sess.verify():
+		s.respondFailed(sess, FailureInvalidPoW)
+	case !s.redeemed.Redeem(sess.ctx, sess.challenge):
+		// The same challenge can't earn a second quote, whichever connection or endpoint it was solved on
+		s.respondFailed(sess, FailureReplayed)
+	default:
+		s.respondSolved(sess)
+	}
+	return stateDone
+}
+
+// verify checks the response and keeps its hash, stored with the solution so required vs
+// achieved difficulty can be compared later. It runs after the expiry and empty-response
+// checks, so a submission costs at most one Argon2 hash.
+func (sess *session) verify() bool {
+	hash, ok := verifySolution(sess.challenge, sess.response)
+	sess.solutionHash = hash
+	return ok
+}
+
+// verifySolution hashes the response once and checks it for the challenge's algorithm,
+// against the difficulty the challenge was signed with. A hash that meets or exceeds it
+// is accepted, only too few leading zeros (or a hash at or above a target) fails.
+func verifySolution(challenge *pow.SecureChallenge, response string) (string, bool) {
+	hash, err := pow.SolutionHash(challenge, response)
+	if err != nil {
+		log.Printf("Failed to hash solution: %v", err)
+		return "", false
+	}
+	if challenge.Algorithm == "sha256" {
+		return hash, pow.VerifySHA256Solution(challenge, response)
+	}
+	if challenge.Difficulty < 1 || challenge.Difficulty > maxDifficulty {
+		return hash, false
+	}
+	return hash, pow.AchievedDifficulty(hash) >= challenge.Difficulty
+}
+
+func (s *Server) respondExpired(sess *session) {
+	ctx := sess.ctx
+	log.Printf("Client %s submitted a solution after the challenge expired", logger.SanitizeIP(sess.clientAddr))
+
+	s.logActivity(ctx, "warning", fmt.Sprintf("Challenge expired before solve by %s", logger.SanitizeIP(sess.clientAddr)), map[string]interface{}{
+		"client_id":  logger.MaskSensitive(sess.clientID),
+		"solve_time": sess.solveTime.Milliseconds(),
+		"difficulty": sess.difficulty,
+		"algorithm":  sess.algorithm,
+		"event":      "challenge_expired",
+	})
+
+	err := s.behaviorTracker.RecordChallengeResult(ctx, sess.remoteAddr, false, sess.solveTime)
+	if err != nil {
+		log.Printf("Failed to record expired challenge result: %v", err)
+	}
+
+	if sess.challengeRecord.ID != (pgtype.UUID{}) {
+		s.logSolution(ctx, sess, false)
+		s.updateChallengeStatus(ctx, sess.challengeRecord.ID, generated.ChallengeStatusExpired)
+	}
+
+	s.recorder.RecordPuzzleExpired(sess.difficulty, sess.algorithm)
+	s.recorder.RecordProcessingTime("expired", time.Since(sess.startTime))
+
+	s.writeFailure(sess, FailureExpired)
+}
+
+func (s *Server) respondSolved(sess *session) {
+	ctx := sess.ctx
+	remoteAddr := sess.remoteAddr
+	difficulty := sess.difficulty
+	log.Printf("Client %s solved the %s challenge in %v", logger.SanitizeIP(sess.clientAddr), sess.algorithm, sess.solveTime)
+	sess.outcome = outcomeSolved
+
+	achieved := pow.AchievedDifficulty(sess.solutionHash)
+	switch {
+	case sess.solutionHash == "":
+	case achieved < sess.challenge.Difficulty:
+		// An accepted hash below the required difficulty means verification is broken
+		log.Printf("❌ Accepted solution from %s only achieved difficulty %d of %d", logger.SanitizeIP(sess.clientAddr), achieved, sess.challenge.Difficulty)
+		s.logActivity(ctx, "error", "Accepted solution below required difficulty", map[string]interface{}{
+			"client_id": logger.MaskSensitive(sess.clientID),
+			"required":  sess.challenge.Difficulty,
+			"achieved":  achieved,
+			"algorithm": sess.algorithm,
+			"event":     "difficulty_violation",
+		})
+	case achieved > sess.challenge.Difficulty:
+		// More leading zeros than required is still a valid solution, whether by luck or
+		// by a client solving for a difficulty the controller has since lowered
+		s.recorder.RecordOverSolve(sess.challenge.Difficulty, sess.algorithm)
+	}
+	s.recordSolveTime(sess.solveTime)
+
+	// Get current reputation before update
+	oldBehavior, _ := s.behaviorTracker.GetClientBehavior(ctx, remoteAddr)
+	oldReputation := oldBehavior.ReputationScore
+
+	// Update client behavior with successful challenge
+	err := s.behaviorTracker.RecordChallengeResult(ctx, remoteAddr, true, sess.solveTime)
+	if err != nil {
+		log.Printf("Failed to record challenge result: %v", err)
+	}
+
+	// Solving above the required difficulty by choice earns extra reputation
+	if sess.volunteered > 0 {
+		if err := s.behaviorTracker.RecordVoluntaryDifficulty(ctx, remoteAddr, sess.volunteered); err != nil {
+			log.Printf("Failed to record voluntary difficulty: %v", err)
+		}
+	}
+
+	// Get new behavior to check changes
+	newBehavior, _ := s.behaviorTracker.GetClientBehavior(ctx, remoteAddr)
+	newReputation := newBehavior.ReputationScore
+	newDifficulty := newBehavior.Difficulty
+
+	// Fallback behaviors carry no real reputation or difficulty to compare
+	tracked := !oldBehavior.Fallback && !newBehavior.Fallback
+
+	// Log reputation change
+	if tracked && oldReputation != newReputation {
+		s.logActivity(ctx, "info", fmt.Sprintf("Client %s reputation increased from %.1f to %.1f after successful challenge", remoteAddr.String(), oldReputation, newReputation), map[string]interface{}{
+			"ip":             remoteAddr.String(),
+			"old_reputation": oldReputation,
+			"new_reputation": newReputation,
+			"change":         newReputation - oldReputation,
+			"event":          "reputation_increased",
+		})
+	}
+
+	// Log difficulty change if it occurred
+	if tracked && difficulty != newDifficulty {
+		s.logActivity(ctx, "info", fmt.Sprintf("Client %s difficulty changed from %d to %d after successful challenge", remoteAddr.String(), difficulty, newDifficulty), map[string]interface{}{
+			"ip":             remoteAddr.String(),
+			"old_difficulty": difficulty,
+			"new_difficulty": newDifficulty,
+			"event":          "difficulty_changed",
+		})
+	}
+
+	// Log successful solution
+	s.logActivity(ctx, "success", fmt.Sprintf("Challenge solved by %s", logger.SanitizeIP(sess.clientAddr)), map[string]interface{}{
+		"client_id":  logger.MaskSensitive(sess.clientID),
+		"solve_time": sess.solveTime.Milliseconds(),
+		"difficulty": difficulty,
+		"algorithm":  sess.algorithm,
+		"event":      "challenge_solved",
+	})
+
+	// Log successful solution to database
+	if sess.challengeRecord.ID != (pgtype.UUID{}) {
+		s.logSolution(ctx, sess, true)
+		s.updateChallengeStatus(ctx, sess.challengeRecord.ID, generated.ChallengeStatusCompleted)
+	}
+
+	// Record metrics
+	s.recorder.RecordPuzzleSolved(difficulty, sess.algorithm, sess.solveTime)
+	s.recorder.RecordProcessingTime("success", time.Since(sess.startTime))
+	if difficulty <= config.SLAMaxDifficulty && sess.solveTime > s.solveTimeSLA {
+		s.recorder.RecordSLABreach(difficulty)
+	}
+
+	quote := s.quoteProvider.GetRandomQuote()
+	s.solveTokens.remember(sess.solveToken, remoteAddr, quote, time.Now())
+	s.writeQuote(sess, quote)
+
+	if s.webhook != nil {
+		s.webhook.Enqueue(webhook.Event{
+			ClientID:    sess.clientID,
+			IP:          remoteAddr.String(),
+			Difficulty:  difficulty,
+			Algorithm:   sess.algorithm,
+			SolveTimeMs: sess.solveTime.Milliseconds(),
+			Quote:       quote,
+			Timestamp:   time.Now(),
+		})
+	}
+}
+
+// respondRedeemed returns the quote a client already earned with its solve token. The
+// challenge issued on this connection goes unsolved, and an unknown token is not held
+// against the client since its earlier solution may simply never have arrived.
+func (s *Server) respondRedeemed(sess *session) {
+	ctx := sess.ctx
+	if sess.challengeRecord.ID != (pgtype.UUID{}) {
+		s.updateChallengeStatus(ctx, sess.challengeRecord.ID, generated.ChallengeStatusExpired)
+	}
+
+	quote, ok := s.solveTokens.redeem(sess.solveToken, sess.remoteAddr, time.Now())
+	s.recorder.RecordSolveTokenRedemption(ok)
+	if !ok {
+		log.Printf("Client %s retried with an unknown solve token", logger.SanitizeIP(sess.clientAddr))
+		s.writeFailure(sess, FailureUnknownToken)
+		return
+	}
+
+	log.Printf("Client %s collected an earned quote with its solve token", logger.SanitizeIP(sess.clientAddr))
+	sess.outcome = outcomeRedeemed
+	s.logActivity(ctx, "info", fmt.Sprintf("Earned quote resent to %s", logger.SanitizeIP(sess.clientAddr)), map[string]interface{}{
+		"client_id": logger.MaskSensitive(sess.clientID),
+		"event":     "solve_token_redeemed",
+	})
+	s.recorder.RecordProcessingTime("redeemed", time.Since(sess.startTime))
+	s.writeQuote(sess, quote)
+}
+
+// writeQuote sends a quote, followed by a line signing it together with this connection's
+// challenge when quote signing is on. Clients unaware of signatures stop after the quote line.
+func (s *Server) writeQuote(sess *session, quote string) {
+	response := quote + "\n"
+	if s.signQuotes {
+		response += pow.SignQuote(s.keyManager, quote, sess.challenge.Seed, time.Now()) + "\n"
+	}
+	sess.conn.Write([]byte(response))
+}
+
+func (s *Server) respondFailed(sess *session, reason FailureReason) {
+	ctx := sess.ctx
+	remoteAddr := sess.remoteAddr
+	difficulty := sess.difficulty
+	log.Printf("Client %s failed the %s challenge (%s)", logger.SanitizeIP(sess.clientAddr), sess.algorithm, reason)
+
+	// Get current reputation before update
+	oldBehavior, _ := s.behaviorTracker.GetClientBehavior(ctx, remoteAddr)
+	oldReputation := oldBehavior.ReputationScore
+
+	// Update client behavior with failed challenge
+	err := s.behaviorTracker.RecordChallengeResult(ctx, remoteAddr, false, sess.solveTime)
+	if err != nil {
+		log.Printf("Failed to record challenge result: %v", err)
+	}
+
+	// Get new behavior to check changes
+	newBehavior, _ := s.behaviorTracker.GetClientBehavior(ctx, remoteAddr)
+	newReputation := newBehavior.ReputationScore
+	newDifficulty := newBehavior.Difficulty
+
+	// Fallback behaviors carry no real reputation or difficulty to compare
+	tracked := !oldBehavior.Fallback && !newBehavior.Fallback
+
+	// Log reputation decrease
+	if tracked && oldReputation != newReputation {
+		s.logActivity(ctx, "warning", fmt.Sprintf("Client %s reputation decreased from %.1f to %.1f after failed challenge", remoteAddr.String(), oldReputation, newReputation), map[string]interface{}{
+			"ip":             remoteAddr.String(),
+			"old_reputation": oldReputation,
+			"new_reputation": newReputation,
+			"change":         newReputation - oldReputation,
+			"event":          "reputation_decreased",
+		})
+	}
+
+	// Log difficulty change if it occurred
+	if tracked && difficulty != newDifficulty {
+		s.logActivity(ctx, "warning", fmt.Sprintf("Client %s difficulty increased from %d to %d after failed challenge", remoteAddr.String(), difficulty, newDifficulty), map[string]interface{}{
+			"ip":             remoteAddr.String(),
+			"old_difficulty": difficulty,
+			"new_difficulty": newDifficulty,
+			"event":          "difficulty_increased",
+		})
+	}
+
+	// Log failed challenge
+	s.logActivity(ctx, "warning", fmt.Sprintf("Challenge failed by %s", logger.SanitizeIP(sess.clientAddr)), map[string]interface{}{
+		"client_id":  logger.MaskSensitive(sess.clientID),
+		"solve_time": sess.solveTime.Milliseconds(),
+		"difficulty": difficulty,
+		"algorithm":  sess.algorithm,
+		"reason":     string(reason),
+		"event":      "challenge_failed",
+	})
+
+	// Log failed solution to database
+	if sess.challengeRecord.ID != (pgtype.UUID{}) {
+		s.logSolution(ctx, sess, false)
+		s.updateChallengeStatus(ctx, sess.challengeRecord.ID, generated.ChallengeStatusFailed)
+	}
+
+	// Record metrics
+	s.recorder.RecordPuzzleFailed(difficulty, sess.algorithm)
+	s.recorder.RecordProcessingTime("failed", time.Since(sess.startTime))
+
+	s.writeFailure(sess, reason)
+}
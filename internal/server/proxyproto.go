@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"world-of-wisdom/pkg/logger"
+)
+
+// proxyV2Signature starts every PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	proxyV1MaxLength = 107 // Longest valid v1 line, including the CRLF
+	proxyV2MaxLength = 4096
+)
+
+// readProxyHeader reads a PROXY protocol v1 or v2 header and returns the original client
+// address. ok is false for LOCAL and UNKNOWN headers, e.g. load balancer health checks,
+// which carry no client address.
+func readProxyHeader(r *bufio.Reader) (addr netip.AddrPort, ok bool, err error) {
+	// The shortest v1 header ("PROXY UNKNOWN\r\n") is longer than the v2 signature
+	prefix, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return netip.AddrPort{}, false, fmt.Errorf("failed to read PROXY header: %w", err)
+	}
+
+	switch {
+	case bytes.Equal(prefix, proxyV2Signature):
+		return readProxyV2(r)
+	case bytes.HasPrefix(prefix, []byte(proxyV1Prefix)):
+		return readProxyV1(r)
+	default:
+		return netip.AddrPort{}, false, fmt.Errorf("missing PROXY header")
+	}
+}
+
+func readProxyV1(r *bufio.Reader) (netip.AddrPort, bool, error) {
+	line := make([]byte, 0, proxyV1MaxLength)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) == proxyV1MaxLength {
+			return netip.AddrPort{}, false, fmt.Errorf("PROXY v1 header too long")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return netip.AddrPort{}, false, fmt.Errorf("failed to read PROXY v1 header: %w", err)
+		}
+		line = append(line, b)
+	}
+
+	// PROXY TCP4|TCP6 <src> <dst> <src port> <dst port>, or PROXY UNKNOWN ...
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return netip.AddrPort{}, false, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return netip.AddrPort{}, false, fmt.Errorf("malformed PROXY v1 header")
+	}
+
+	src, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return netip.AddrPort{}, false, fmt.Errorf("invalid PROXY v1 source address: %w", err)
+	}
+	if src.Is4() != (fields[1] == "TCP4") {
+		return netip.AddrPort{}, false, fmt.Errorf("PROXY v1 source address does not match %s", fields[1])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, false, fmt.Errorf("invalid PROXY v1 source port: %w", err)
+	}
+
+	return netip.AddrPortFrom(src, uint16(port)), true, nil
+}
+
+func readProxyV2(r *bufio.Reader) (netip.AddrPort, bool, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return netip.AddrPort{}, false, fmt.Errorf("failed to read PROXY v2 header: %w", err)
+	}
+
+	version, command := header[12]>>4, header[12]&0x0f
+	family := header[13] >> 4
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+	if version != 2 || command > 1 {
+		return netip.AddrPort{}, false, fmt.Errorf("unsupported PROXY v2 version/command 0x%02x", header[12])
+	}
+	if length > proxyV2MaxLength {
+		return netip.AddrPort{}, false, fmt.Errorf("PROXY v2 header too long (%d bytes)", length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return netip.AddrPort{}, false, fmt.Errorf("failed to read PROXY v2 addresses: %w", err)
+	}
+
+	// LOCAL connections originate from the proxy itself
+	if command == 0 {
+		return netip.AddrPort{}, false, nil
+	}
+
+	switch family {
+	case 1: // AF_INET: src(4) dst(4) src port(2) dst port(2)
+		if length < 12 {
+			return netip.AddrPort{}, false, fmt.Errorf("short PROXY v2 IPv4 address block")
+		}
+		src := netip.AddrFrom4([4]byte(payload[0:4]))
+		return netip.AddrPortFrom(src, binary.BigEndian.Uint16(payload[8:10])), true, nil
+	case 2: // AF_INET6: src(16) dst(16) src port(2) dst port(2)
+		if length < 36 {
+			return netip.AddrPort{}, false, fmt.Errorf("short PROXY v2 IPv6 address block")
+		}
+		src := netip.AddrFrom16([16]byte(payload[0:16])).Unmap()
+		return netip.AddrPortFrom(src, binary.BigEndian.Uint16(payload[32:34])), true, nil
+	default:
+		// UNSPEC and UNIX carry no usable client address
+		return netip.AddrPort{}, false, nil
+	}
+}
+
+// isTrustedProxy reports whether addr may send PROXY headers
+func (s *Server) isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveProxyHeader replaces the session's client address with the one a trusted load
+// balancer forwarded. Connections from other peers are treated as direct clients and
+// their address is kept, unless they start with a PROXY header themselves. Returns false
+// if a trusted peer sent no valid header or an untrusted one sent any.
+func (s *Server) resolveProxyHeader(sess *session) bool {
+	peer, err := netip.ParseAddrPort(sess.clientAddr)
+	if err != nil || !s.isTrustedProxy(peer.Addr()) {
+		if s.sentProxyHeader(sess) {
+			log.Printf("Rejecting PROXY header from untrusted source %s", logger.SanitizeIP(sess.clientAddr))
+			s.recorder.RecordConnection("rejected_proxy_header")
+			s.writeFailure(sess, FailureInvalidFormat)
+			return false
+		}
+		return true
+	}
+
+	addr, ok, err := readProxyHeader(sess.reader)
+	if err != nil {
+		log.Printf("Rejecting connection from proxy %s: %v", logger.SanitizeIP(sess.clientAddr), err)
+		s.recorder.RecordConnection("rejected_proxy_header")
+		return false
+	}
+	if !ok {
+		return true
+	}
+
+	log.Printf("Proxy %s forwarded client %s", logger.SanitizeIP(sess.clientAddr), logger.SanitizeIP(addr.String()))
+	sess.clientAddr = addr.String()
+	sess.clientID = s.generateClientID(sess.clientAddr)
+	return true
+}
+
+// sentProxyHeader reports whether the peer starts with a PROXY header. A proxy sends it as
+// soon as it connects, so it is only waited for within the hello wait, which the framed
+// hello shares. Without a hello wait only input that has already arrived is checked.
+func (s *Server) sentProxyHeader(sess *session) bool {
+	if s.helloWait > 0 {
+		sess.conn.SetReadDeadline(sess.stateEntered.Add(s.helloWait))
+		sess.reader.Peek(len(proxyV1Prefix))
+	}
+	return startsWithProxyHeader(sess.reader)
+}
+
+// proxyV1Prefix starts every PROXY protocol v1 header
+const proxyV1Prefix = "PROXY "
+
+// startsWithProxyHeader reports whether the input already read starts with a PROXY v1 or
+// v2 header, which only trusted proxies may send. It never waits for more input.
+func startsWithProxyHeader(r *bufio.Reader) bool {
+	buffered, _ := r.Peek(r.Buffered())
+	return bytes.HasPrefix(buffered, []byte(proxyV1Prefix)) || bytes.HasPrefix(buffered, proxyV2Signature)
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ReloadConfig holds the settings that can change without restarting the listener
+type ReloadConfig struct {
+	MaxConnsPerIP           int
+	MaxConnectionsPerMinute int
+	ChallengeIssueRate      int
+	Allowlist               []string
+	LogLevel                string
+}
+
+// Reload applies new hot-reloadable settings and re-reads the quotes file.
+// Invalid settings are rejected as a whole so a bad edit leaves the running config intact.
+func (s *Server) Reload(cfg ReloadConfig) error {
+	allowlist, err := parseAllowlist(cfg.Allowlist)
+	if err != nil {
+		return err
+	}
+	level, err := parseLogLevel(cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+
+	s.connLimiter.update(cfg.MaxConnsPerIP, allowlist)
+	s.connRateLimiter.update(cfg.MaxConnectionsPerMinute, allowlist)
+	s.issueLimiter.update(cfg.ChallengeIssueRate, allowlist)
+	s.logLevel.Store(level)
+
+	if err := s.quoteProvider.Reload(); err != nil {
+		log.Printf("⚠️ Keeping current quotes: %v", err)
+	}
+
+	log.Printf("🔄 Reloaded config: max conns per IP %d, connections per IP %d/min, challenges per IP %d/min, %d allowlisted prefixes, log level %s, %d quotes",
+		cfg.MaxConnsPerIP, cfg.MaxConnectionsPerMinute, cfg.ChallengeIssueRate, len(allowlist), strings.ToLower(cfg.LogLevel), s.quoteProvider.GetQuoteCount())
+	return nil
+}
+
+// Activity log levels in increasing severity, "success" ranks with "info"
+const (
+	logLevelDebug int32 = iota
+	logLevelInfo
+	logLevelWarning
+	logLevelError
+)
+
+func parseLogLevel(level string) (int32, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return logLevelDebug, nil
+	case "", "info", "success":
+		return logLevelInfo, nil
+	case "warn", "warning":
+		return logLevelWarning, nil
+	case "error":
+		return logLevelError, nil
+	default:
+		return 0, fmt.Errorf("invalid log level: %s (must be debug, info, warning or error)", level)
+	}
+}
+
+// logLevelEnabled reports whether an activity log entry at level should be written
+func (s *Server) logLevelEnabled(level string) bool {
+	rank, err := parseLogLevel(level)
+	if err != nil {
+		return true
+	}
+	return rank >= s.logLevel.Load()
+}
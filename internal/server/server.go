@@ -9,12 +9,15 @@ import (
 	"net"
 	"net/netip"
 	"os"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"world-of-wisdom/internal/behavior"
+	"world-of-wisdom/internal/database"
 	generated "world-of-wisdom/internal/database/generated"
+	"world-of-wisdom/internal/webhook"
+	"world-of-wisdom/pkg/config"
 	"world-of-wisdom/pkg/logger"
 	"world-of-wisdom/pkg/metrics"
 	"world-of-wisdom/pkg/pow"
@@ -29,52 +32,179 @@ type Server struct {
 	listener      net.Listener
 	quoteProvider *wisdom.QuoteProvider
 	difficulty    int
-	timeout       time.Duration
+	timeout       time.Duration // Idle/read timeout, also the floor for the solve deadline
+	maxSolveWait  time.Duration // Cap on the difficulty-scaled solve deadline
 	mu            sync.RWMutex
 	activeConns   sync.WaitGroup
 	shutdownChan  chan struct{}
 
 	// Database components
-	dbpool  *pgxpool.Pool
-	queries *generated.Queries
+	dbpool       *pgxpool.Pool
+	db           generated.DBTX // Used by the write helpers, normally dbpool
+	queries      *generated.Queries
+	queryTimeout time.Duration
+
+	// Metrics, normally the Prometheus package functions
+	recorder metrics.MetricsRecorder
 
 	// Adaptive difficulty tracking
 	solveTimes     []time.Duration
-	connectionRate int64
+	connectionRate rateEWMA
 	lastAdjustment time.Time
 	adaptiveMode   bool
+	controller     DifficultyController
+	adaptive       AdaptiveConfig // Thresholds the controllers act on, defaults filled in
+	minDifficulty  int // Floor for the global and per-client difficulty
+
+	// Optional second controller evaluated on the same samples but never applied
+	shadowController DifficultyController
+	shadowDifficulty int
 
 	// PoW algorithm selection
-	algorithm string // "sha256" or "argon2"
+	algorithm       string          // "sha256" or "argon2", for difficulties the policy doesn't name
+	algorithmPolicy algorithmPolicy // Algorithm per difficulty, see algorithmFor
 
 	// Client behavior tracking
 	behaviorTracker *behavior.Tracker
 	
 	// HMAC key management for secure challenges
 	keyManager pow.KeyManager
+	keyRotationInterval time.Duration  // Age at which the keys are rotated, 0 never rotates
+	stopKeyRotation     chan struct{}  // Stops the rotation scheduler, nil when it isn't running
+	signQuotes bool           // Follow every quote with a signature line clients sharing the keys can verify
+	redeemed   pow.NonceStore // Challenges already redeemed, shared with the HTTP solve endpoints
 	
 	// Challenge protocol format
-	challengeFormat pow.ChallengeFormat // "json" or "binary"
+	challengeFormat pow.ChallengeFormat // "json" or "binary", for clients reading framed challenges
 	challengeEncoder *pow.ChallengeEncoder
+	helloWait        time.Duration // How long to wait for the framed hello, zero treats every client as legacy
+	stateTimeouts    map[protocolState]time.Duration // Deadlines of states that don't use timeout, see stateTimeout
+
+	// Optional outbound notifications for solved challenges
+	webhook *webhook.Notifier
+
+	// Target solve time for clients at or below config.SLAMaxDifficulty
+	solveTimeSLA time.Duration
+
+	// Per-IP concurrent connection cap
+	connLimiter *connLimiter
+
+	// Per-IP connection rate, checked before the connection is tracked
+	connRateLimiter *ipRateLimiter
+
+	// Per-IP challenge issuance rate, checked before a challenge is generated
+	issueLimiter *ipRateLimiter
+
+	// Argon2 to SHA-256 degradation under memory pressure
+	argon2Fallback bool
+	argon2Degraded atomic.Bool
+
+	// Behavior aggregates export, disabled without a metrics port
+	behaviorMetricsInterval time.Duration
+
+	// Minimum activity log level, changed by Reload
+	logLevel atomic.Int32
+
+	// PROXY protocol support for clients behind a load balancer
+	proxyProtocol  bool
+	trustedProxies []netip.Prefix
+
+	// Name the failure reason in rejections, for development only
+	verboseFailures bool
+
+	// Difficulty boost for first-time clients during a surge of new IPs
+	surge surgeDetector
+
+	// Quotes earned per client solve token, resent when the response was lost
+	solveTokens solveTokens
+
+	// Further SO_REUSEPORT listeners on the same port, each with its own accept loop
+	extraListeners []net.Listener
+
+	// Optional bounded worker pool, nil runs every connection on its own goroutine
+	workerPool *connPool
+
+	// Retry hint sent to connections shed under overload
+	busyRetryAfter time.Duration
+
+	// Challenges generated before the first connection is accepted, 0 skips warm-up
+	warmupChallenges int
+	ready            atomic.Bool
+
+	adminToken string // Bearer token PUT /difficulty requires on the metrics port, empty leaves it open
 }
 
 type Config struct {
 	Port            string
 	Difficulty      int
-	Timeout         time.Duration
+	Timeout         time.Duration // Idle/read timeout outside the solve wait
+	MaxSolveWait    time.Duration // Longest solve wait for high-difficulty challenges (default 5m)
 	AdaptiveMode    bool
 	MetricsPort     string
+	Metrics         metrics.MetricsRecorder // Where the server records its metrics (default Prometheus)
 	Algorithm       string // "sha256" or "argon2"
 	DatabaseURL     string
 	ChallengeFormat string // "json" or "binary"
 	MasterSecret    string // Master secret for key encryption (required)
+	WebhookURL      string // Optional endpoint notified on every solved challenge
+	WebhookSecret   string // Secret used to HMAC-sign webhook payloads
+	QueryTimeout    time.Duration // Per-query database timeout (default 5s)
+	SolveTimeSLA    time.Duration // Solve-time target for low-difficulty clients (default 3s)
+	MaxConnsPerIP   int           // Concurrent connections allowed per IP (0 = unlimited)
+	MaxConnectionsPerMinute int   // New connections accepted per IP per minute, allowlisted IPs exempt (0 = unlimited)
+	ChallengeIssueRate int        // Challenges issued per IP per minute, allowlisted IPs exempt (0 = unlimited)
+	Allowlist       []string      // IPs or CIDR prefixes exempt from the per-IP cap
+	Argon2Fallback  bool          // Issue SHA-256 challenges while Argon2 memory can't be allocated
+	BehaviorMetricsInterval time.Duration // How often behavior aggregates are exported (default 30s)
+	DifficultyController    string        // Adaptive difficulty controller: "threshold" (default) or "sla"
+	ShadowController        string        // Controller evaluated alongside the active one without being applied
+	Adaptive                AdaptiveConfig // Adaptive difficulty thresholds, zero fields keep the defaults
+	LogLevel                string        // Minimum activity log level: debug, info, warning or error
+	QuotesFile              string        // Optional quotes file, one per line, re-read on Reload
+	ProxyProtocol           bool          // Read PROXY protocol v1/v2 headers from trusted proxies
+	TrustedProxies          []string      // IPs or CIDR prefixes of load balancers allowed to send PROXY headers
+	FailureResponses        string        // "terse" (default) or "verbose", verbose tells clients why a solution failed
+	SurgeThreshold          int           // New clients per minute that raise first-time client difficulty, with the surge_detector feature
+	SolveTokenTTL           time.Duration // How long an earned quote can be collected again with its solve token (0 = disabled)
+	InitialUnknownClientDifficulty int    // Difficulty clients without history start at, independent of the global difficulty (0 = default 2)
+	MinDifficulty                  int    // Floor adaptation and per-client difficulty never go below (0 = 1)
+	HelloWait                      time.Duration // How long to wait for a framed hello before assuming a newline-delimited client (default 100ms)
+	HandshakeTimeout               time.Duration // Deadline of the handshake state: PROXY header, hello and connection setup (0 = Timeout)
+	RespondTimeout                 time.Duration // Deadline of the respond state: verification, database writes and the quote (0 = Timeout)
+	ListenBacklog                  int           // TCP accept queue length (0 = OS default), Linux only
+	ReusePort                      bool          // Set SO_REUSEPORT so several processes can share the port, Linux only
+	AcceptListeners                int           // SO_REUSEPORT listeners opened in this process, each with its own accept loop (default 1)
+	SignQuotes                     bool          // Send an HMAC signature line after each quote (default off)
+	Workers                        int           // Worker pool size with the worker_pool feature (0 = 32 per CPU)
+	WorkerQueue                    int           // Accepted connections waiting for a worker before new ones are shed (0 = pool size)
+	BusyRetryAfter                 time.Duration // Retry hint sent with BUSY to connections shed under overload (default 5s)
+	WarmupChallenges               int           // Challenges generated at startup before connections are accepted (0 = skip warm-up)
+	AlgorithmPolicy                string        // Algorithm per difficulty range, e.g. "1-3:sha256,4-6:argon2" (empty = Algorithm everywhere)
+	ConnectionWindow               time.Duration // Recent history the connection count and reconnect rate cover (0 = lifetime)
+	KeyRotationInterval            time.Duration   // Rotate the HMAC keys once they are this old (0 = never)
+	AdminToken                     string          // Bearer token required to change the difficulty on the metrics port (empty = no check)
+	Features                       config.Features // Experimental features switched on, see config.KnownFeatures
 }
 
 func NewServer(cfg Config) (*Server, error) {
-	listener, err := net.Listen("tcp", cfg.Port)
+	minDifficulty := max(cfg.MinDifficulty, 1)
+	if minDifficulty > maxDifficulty {
+		return nil, fmt.Errorf("min difficulty %d exceeds max difficulty %d", cfg.MinDifficulty, maxDifficulty)
+	}
+	if cfg.Difficulty < minDifficulty {
+		log.Printf("Raising difficulty %d to the minimum of %d", cfg.Difficulty, minDifficulty)
+		cfg.Difficulty = minDifficulty
+	}
+
+	listeners, err := listen(cfg.Port, listenOptions{
+		backlog:   cfg.ListenBacklog,
+		reusePort: cfg.ReusePort,
+		listeners: cfg.AcceptListeners,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to listen on %s: %w", cfg.Port, err)
 	}
+	listener := listeners[0]
 
 	// Connect to database
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -93,14 +223,28 @@ func NewServer(cfg Config) (*Server, error) {
 
 	log.Printf("✅ TCP Server connected to database")
 
-	// Start metrics server if port specified
-	if cfg.MetricsPort != "" {
-		metrics.StartMetricsServer(cfg.MetricsPort)
-		log.Printf("Metrics server started on %s", cfg.MetricsPort)
+	queryTimeout := cfg.QueryTimeout
+	if queryTimeout <= 0 {
+		queryTimeout = database.DefaultQueryTimeout
+	}
+	behaviorTracker := behavior.NewTracker(dbpool)
+	behaviorTracker.SetQueryTimeout(queryTimeout)
+	if cfg.InitialUnknownClientDifficulty > 0 {
+		unknownDifficulty := clampDifficulty(cfg.InitialUnknownClientDifficulty)
+		behaviorTracker.SetInitialUnknownDifficulty(unknownDifficulty)
+		log.Printf("Clients without history start at difficulty %d", unknownDifficulty)
+	}
+	if cfg.ConnectionWindow > 0 {
+		behaviorTracker.SetConnectionWindow(cfg.ConnectionWindow)
+		log.Printf("Connection count and reconnect rate cover the last %v", cfg.ConnectionWindow)
 	}
 
 	// Initialize metrics
-	metrics.UpdateCurrentDifficulty(cfg.Difficulty)
+	recorder := cfg.Metrics
+	if recorder == nil {
+		recorder = metrics.Prometheus
+	}
+	recorder.UpdateCurrentDifficulty(cfg.Difficulty)
 
 	// Default to argon2 if not specified
 	algorithm := cfg.Algorithm
@@ -110,6 +254,13 @@ func NewServer(cfg Config) (*Server, error) {
 	if algorithm != "sha256" && algorithm != "argon2" {
 		return nil, fmt.Errorf("invalid algorithm: %s (must be sha256 or argon2)", algorithm)
 	}
+	algorithms, err := parseAlgorithmPolicy(cfg.AlgorithmPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AlgorithmPolicy != "" {
+		log.Printf("Algorithm policy: %s (%s elsewhere)", cfg.AlgorithmPolicy, algorithm)
+	}
 
 	// Initialize database-backed key manager for HMAC signing
 	masterSecret := cfg.MasterSecret
@@ -120,7 +271,7 @@ func NewServer(cfg Config) (*Server, error) {
 		}
 	}
 	
-	keyManager, err := pow.NewDBKeyManager(dbpool, masterSecret)
+	keyManager, err := pow.NewDBKeyManager(dbpool, masterSecret, queryTimeout)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize database key manager: %w", err)
 	}
@@ -135,41 +286,229 @@ func NewServer(cfg Config) (*Server, error) {
 		return nil, fmt.Errorf("invalid challenge format: %s (must be json or binary)", challengeFormat)
 	}
 
-	return &Server{
+	allowlist, err := parseAllowlist(cfg.Allowlist)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxConnsPerIP > 0 {
+		log.Printf("Per-IP connection cap: %d (%d allowlisted prefixes)", cfg.MaxConnsPerIP, len(allowlist))
+	}
+	if cfg.MaxConnectionsPerMinute > 0 {
+		log.Printf("Per-IP connection rate limit: %d/min (%d allowlisted prefixes)", cfg.MaxConnectionsPerMinute, len(allowlist))
+	}
+	if cfg.ChallengeIssueRate > 0 {
+		log.Printf("Per-IP challenge issuance limit: %d/min (%d allowlisted prefixes)", cfg.ChallengeIssueRate, len(allowlist))
+	}
+
+	trustedProxies, err := parseAllowlist(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	if cfg.ProxyProtocol {
+		if len(trustedProxies) == 0 {
+			return nil, fmt.Errorf("PROXY protocol requires at least one trusted proxy")
+		}
+		log.Printf("PROXY protocol enabled for %d trusted proxy prefixes", len(trustedProxies))
+	}
+
+	verboseFailures, err := parseFailureResponses(cfg.FailureResponses)
+	if err != nil {
+		return nil, err
+	}
+
+	quoteProvider := wisdom.NewQuoteProvider()
+	if cfg.QuotesFile != "" {
+		if err := quoteProvider.LoadFile(cfg.QuotesFile); err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded %d quotes from %s", quoteProvider.GetQuoteCount(), cfg.QuotesFile)
+	}
+
+	logLevel, err := parseLogLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	// Behavior gauges are only useful when metrics are served
+	var behaviorMetricsInterval time.Duration
+	if cfg.MetricsPort != "" {
+		behaviorMetricsInterval = cfg.BehaviorMetricsInterval
+		if behaviorMetricsInterval <= 0 {
+			behaviorMetricsInterval = 30 * time.Second
+		}
+	}
+
+	helloWait := cfg.HelloWait
+	if helloWait <= 0 {
+		helloWait = 100 * time.Millisecond
+	}
+
+	maxSolveWait := cfg.MaxSolveWait
+	if maxSolveWait <= 0 {
+		maxSolveWait = 5 * time.Minute
+	}
+
+	busyRetryAfter := cfg.BusyRetryAfter
+	if busyRetryAfter <= 0 {
+		busyRetryAfter = defaultBusyRetryAfter
+	}
+
+	solveTimeSLA := cfg.SolveTimeSLA
+	if solveTimeSLA <= 0 {
+		solveTimeSLA = 3 * time.Second
+	}
+
+	if err := cfg.Adaptive.validate(); err != nil {
+		return nil, fmt.Errorf("invalid adaptive difficulty config: %w", err)
+	}
+	controller, err := NewDifficultyController(cfg.DifficultyController, solveTimeSLA, cfg.Adaptive)
+	if err != nil {
+		return nil, err
+	}
+
+	var shadowController DifficultyController
+	if cfg.ShadowController != "" {
+		shadowController, err = NewDifficultyController(cfg.ShadowController, solveTimeSLA, cfg.Adaptive)
+		if err != nil {
+			return nil, fmt.Errorf("invalid shadow controller: %w", err)
+		}
+		log.Printf("Shadow difficulty controller %q running alongside %q", shadowController.Name(), controller.Name())
+	}
+
+	var notifier *webhook.Notifier
+	if cfg.WebhookURL != "" {
+		notifier = webhook.NewNotifier(webhook.Config{
+			URL:        cfg.WebhookURL,
+			Secret:     cfg.WebhookSecret,
+			QueueSize:  256,
+			MaxRetries: 3,
+			RetryDelay: 500 * time.Millisecond,
+			Timeout:    5 * time.Second,
+		})
+		log.Printf("Solved-challenge webhook enabled (signed: %v)", cfg.WebhookSecret != "")
+	}
+
+	s := &Server{
 		listener:         listener,
-		quoteProvider:    wisdom.NewQuoteProvider(),
+		extraListeners:   listeners[1:],
+		quoteProvider:    quoteProvider,
 		difficulty:       cfg.Difficulty,
 		timeout:          cfg.Timeout,
+		maxSolveWait:     maxSolveWait,
 		shutdownChan:     make(chan struct{}),
 		dbpool:           dbpool,
+		db:               dbpool,
 		queries:          generated.New(),
+		queryTimeout:     queryTimeout,
+		recorder:         recorder,
 		solveTimes:       make([]time.Duration, 0, 100),
 		lastAdjustment:   time.Now(),
 		adaptiveMode:     cfg.AdaptiveMode,
+		controller:       controller,
+		adaptive:         cfg.Adaptive.withDefaults(),
+		minDifficulty:    minDifficulty,
+		shadowController: shadowController,
+		shadowDifficulty: cfg.Difficulty,
 		algorithm:        algorithm,
-		behaviorTracker:  behavior.NewTracker(dbpool),
+		algorithmPolicy:  algorithms,
+		behaviorTracker:  behaviorTracker,
 		keyManager:       keyManager,
+		keyRotationInterval:     cfg.KeyRotationInterval,
+		signQuotes:       cfg.SignQuotes,
+		redeemed:         pow.NewDBNonceStore(dbpool, queryTimeout),
 		challengeFormat:  challengeFormat,
 		challengeEncoder: pow.NewChallengeEncoder(challengeFormat),
-	}, nil
+		helloWait:        helloWait,
+		stateTimeouts:    stateTimeouts(cfg),
+		webhook:          notifier,
+		solveTimeSLA:     solveTimeSLA,
+		connLimiter:      newConnLimiter(cfg.MaxConnsPerIP, allowlist),
+		connRateLimiter:  newIPRateLimiter(cfg.MaxConnectionsPerMinute, allowlist),
+		issueLimiter:     newIPRateLimiter(cfg.ChallengeIssueRate, allowlist),
+		argon2Fallback:   cfg.Argon2Fallback,
+		behaviorMetricsInterval: behaviorMetricsInterval,
+		proxyProtocol:           cfg.ProxyProtocol,
+		trustedProxies:          trustedProxies,
+		verboseFailures:         verboseFailures,
+		busyRetryAfter:          busyRetryAfter,
+		warmupChallenges:        cfg.WarmupChallenges,
+		adminToken:              cfg.AdminToken,
+	}
+	s.logLevel.Store(logLevel)
+	behaviorTracker.SetFallbackDifficulty(s.getDifficulty)
+	s.surge.recorder = recorder
+	if cfg.Features.Enabled(config.FeatureSurgeDetector) {
+		if cfg.SurgeThreshold > 0 {
+			s.surge.threshold = float64(cfg.SurgeThreshold)
+			log.Printf("Surge detection enabled above %d new clients/min", cfg.SurgeThreshold)
+		} else {
+			log.Printf("⚠️ surge_detector feature enabled without SURGE_THRESHOLD, surge detection stays off")
+		}
+	}
+	s.solveTokens.ttl = cfg.SolveTokenTTL
+	if cfg.Features.Enabled(config.FeatureWorkerPool) {
+		s.workerPool = newConnPool(cfg.Workers, cfg.WorkerQueue)
+		log.Printf("Worker pool enabled: %d workers, queue of %d", s.workerPool.workers, cap(s.workerPool.queue))
+	}
+
+	// Start metrics server if port specified, with the admin routes next to /metrics
+	if cfg.MetricsPort != "" {
+		metrics.StartMetricsServer(cfg.MetricsPort, s.registerAdminRoutes)
+		log.Printf("Metrics server started on %s (difficulty updates protected: %v)", cfg.MetricsPort, s.adminToken != "")
+	}
+
+	return s, nil
 }
 
 func (s *Server) Start() error {
 	log.Printf("Server listening on %s with difficulty %d (format: %s)", s.listener.Addr(), s.difficulty, s.challengeFormat)
 
+	// Connections arriving meanwhile wait in the accept queue rather than hit cold paths
+	if err := s.warmUp(); err != nil {
+		return fmt.Errorf("warm-up failed: %w", err)
+	}
+	s.markReady(true)
+	log.Printf("✅ Server ready")
+
+	if km, ok := s.keyManager.(*pow.DBKeyManager); ok && s.keyRotationInterval > 0 {
+		s.stopKeyRotation = km.StartRotationScheduler(s.keyRotationInterval)
+		log.Printf("HMAC keys rotate every %v (key age %v)", s.keyRotationInterval, km.GetRotationAge().Round(time.Second))
+	}
+
 	// Start periodic behavior stats logging
 	go s.logBehaviorStats()
+	go s.sweepRateLimiters()
+	if s.solveTokens.ttl > 0 {
+		go s.sweepSolveTokens()
+	}
+	if s.behaviorMetricsInterval > 0 {
+		go s.exportBehaviorMetrics()
+	}
+	if s.workerPool != nil {
+		for i := 0; i < s.workerPool.workers; i++ {
+			go s.connWorker()
+		}
+	}
+
+	for _, l := range s.extraListeners {
+		go s.acceptLoop(l)
+	}
+	s.acceptLoop(s.listener)
+	return nil
+}
 
+// acceptLoop serves connections from l until shutdown
+func (s *Server) acceptLoop(l net.Listener) {
 	for {
 		select {
 		case <-s.shutdownChan:
-			return nil
+			return
 		default:
-			conn, err := s.listener.Accept()
+			conn, err := l.Accept()
 			if err != nil {
 				select {
 				case <-s.shutdownChan:
-					return nil
+					return
 				default:
 					log.Printf("Failed to accept connection: %v", err)
 					continue
@@ -177,7 +516,7 @@ func (s *Server) Start() error {
 			}
 
 			s.activeConns.Add(1)
-			go s.handleConnection(conn)
+			s.dispatch(conn)
 		}
 	}
 }
@@ -186,372 +525,20 @@ func (s *Server) handleConnection(conn net.Conn) {
 	defer s.activeConns.Done()
 	defer conn.Close()
 
-	startTime := time.Now()
 	clientAddr := conn.RemoteAddr().String()
-	clientID := s.generateClientID(clientAddr)
-	log.Printf("New connection from %s (Client ID: %s)", logger.SanitizeIP(clientAddr), logger.MaskSensitive(clientID))
-	
-	// Context for database operations
-	ctx := context.Background()
-	
-	// Track connection record for cleanup
-	var connectionRecord generated.Connection
-	// Track client behavior for this connection
-	var clientBehavior *behavior.ClientBehavior
-	defer func() {
-		// Record disconnection in behavior tracker
-		if clientBehavior != nil && clientBehavior.ConnectionTimestampID != (pgtype.UUID{}) {
-			err := s.behaviorTracker.RecordDisconnection(ctx, clientBehavior.ConnectionTimestampID, 
-				connectionRecord.ID != (pgtype.UUID{}))
-			if err != nil {
-				log.Printf("Failed to record disconnection: %v", err)
-			}
-		}
-		
-		// Always mark connection as disconnected when handler exits
-		if connectionRecord.ID != (pgtype.UUID{}) {
-			s.updateConnectionStatus(ctx, connectionRecord.ID, generated.ConnectionStatusDisconnected)
-			s.logActivity(ctx, "info", fmt.Sprintf("Client disconnected: %s", logger.SanitizeIP(clientAddr)), map[string]interface{}{
-				"client_id": logger.MaskSensitive(clientID),
-				"event":     "connection_closed",
-			})
-			log.Printf("Client %s disconnected (cleanup)", logger.SanitizeIP(clientAddr))
-		}
-	}()
-
-	// Log new connection
-	s.logActivity(context.Background(), "info", fmt.Sprintf("New connection from %s", logger.SanitizeIP(clientAddr)), map[string]interface{}{
-		"client_id":   logger.MaskSensitive(clientID),
-		"remote_addr": logger.SanitizeIP(clientAddr),
-		"event":       "connection_established",
-	})
-
-	// Parse remote address
-	remoteAddr, err := netip.ParseAddr(strings.Split(clientAddr, ":")[0])
-	if err != nil {
-		log.Printf("Failed to parse remote address %s: %v", logger.SanitizeIP(clientAddr), err)
-		// Send proper error response based on format
-		if s.challengeFormat == pow.FormatBinary {
-			// For binary format, just close the connection
-			return
-		} else {
-			conn.Write([]byte("Error: Invalid client address\n"))
-			return
-		}
-	}
-
-	// Get previous behavior if exists
-	prevBehavior, _ := s.behaviorTracker.GetClientBehavior(ctx, remoteAddr)
-	prevDifficulty := prevBehavior.Difficulty
-	prevConnectionCount := prevBehavior.ConnectionCount
-	
-	// Track client behavior and get per-client difficulty
-	clientBehavior, err = s.behaviorTracker.RecordConnection(ctx, remoteAddr)
-	if err != nil {
-		log.Printf("Failed to track client behavior: %v", err)
-		// Fall back to global difficulty
-		clientBehavior = &behavior.ClientBehavior{
-			IP:         remoteAddr,
-			Difficulty: s.getDifficulty(),
-		}
-	}
-	
-	// Log connection with behavior context
-	if prevConnectionCount > 0 {
-		s.logActivity(ctx, "info", fmt.Sprintf("Client %s reconnected (connection #%d)", remoteAddr.String(), clientBehavior.ConnectionCount), map[string]interface{}{
-			"ip":                remoteAddr.String(),
-			"connection_count":  clientBehavior.ConnectionCount,
-			"failure_rate":      fmt.Sprintf("%.2f%%", clientBehavior.FailureRate*100),
-			"avg_solve_time_ms": clientBehavior.AvgSolveTime.Milliseconds(),
-			"reconnect_rate":    fmt.Sprintf("%.2f%%", clientBehavior.ReconnectRate*100),
-			"reputation_score":  clientBehavior.ReputationScore,
-			"event":             "client_reconnected",
-		})
-		
-		// Log difficulty change on reconnection
-		if prevDifficulty != clientBehavior.Difficulty {
-			s.logActivity(ctx, "warning", fmt.Sprintf("Client %s difficulty changed from %d to %d on reconnection", remoteAddr.String(), prevDifficulty, clientBehavior.Difficulty), map[string]interface{}{
-				"ip":             remoteAddr.String(),
-				"old_difficulty": prevDifficulty,
-				"new_difficulty": clientBehavior.Difficulty,
-				"reason":         "reconnection_pattern",
-				"event":          "difficulty_adjusted",
-			})
-		}
-	} else {
-		// First connection
-		s.logActivity(ctx, "info", fmt.Sprintf("New client %s connected with initial difficulty %d", remoteAddr.String(), clientBehavior.Difficulty), map[string]interface{}{
-			"ip":                 remoteAddr.String(),
-			"initial_difficulty": clientBehavior.Difficulty,
-			"reputation_score":   clientBehavior.ReputationScore,
-			"event":              "new_client_connected",
-		})
-	}
-
-	// Create connection record in database
-	connectionRecord, err = s.logConnection(ctx, clientID, remoteAddr, s.algorithm)
-	if err != nil {
-		log.Printf("Failed to log connection: %v", err)
-		// Continue anyway - don't fail the connection due to DB issues
-	}
-
-	// Record connection metrics
-	metrics.RecordConnection("accepted")
-	conn.SetDeadline(time.Now().Add(s.timeout))
-
-	// Track connection rate for adaptive difficulty
-	s.trackConnection()
-
-	// Use per-client difficulty
-	difficulty := clientBehavior.Difficulty
-	log.Printf("Client %s assigned difficulty %d (reputation: %.1f, suspicious: %.1f)", 
-		clientAddr, difficulty, clientBehavior.ReputationScore, clientBehavior.SuspiciousScore)
-	
-	// Log if client is flagged as aggressive
-	if difficulty >= 5 {
-		s.logActivity(ctx, "warning", fmt.Sprintf("High difficulty assigned to potential DDoS client: %s", remoteAddr.String()), map[string]interface{}{
-			"ip":                remoteAddr.String(),
-			"difficulty":        difficulty,
-			"reputation_score":  clientBehavior.ReputationScore,
-			"suspicious_score":  clientBehavior.SuspiciousScore,
-			"event":             "high_difficulty_assigned",
-		})
-	}
-
-	// Generate secure JSON challenge
-	var secureChallenge *pow.SecureChallenge
-	var challengeSeed string
-	var verifySolution func(string) bool
-
-	// Use secure challenge generation with key manager
-	secureChallenge, err = pow.GenerateSecureChallengeWithKeyManager(difficulty, s.algorithm, clientID, s.keyManager)
-	if err != nil {
-		log.Printf("Failed to generate secure challenge: %v", err)
-		if s.challengeFormat == pow.FormatBinary {
-			// For binary format, just close the connection
-			return
-		} else {
-			conn.Write([]byte("Error: Failed to generate challenge\n"))
-		}
-		s.updateConnectionStatus(ctx, connectionRecord.ID, generated.ConnectionStatusFailed)
-		return
-	}
-	
-	challengeSeed = secureChallenge.Seed
-	
-	// Set up verification function based on algorithm
-	if s.algorithm == "sha256" {
-		verifySolution = func(response string) bool {
-			return pow.VerifyPoW(secureChallenge.Seed, response, secureChallenge.Difficulty)
-		}
-	} else {
-		// For Argon2, we need to verify with the secure challenge
-		verifySolution = func(response string) bool {
-			// Create an Argon2Challenge from the SecureChallenge for verification
-			argon2Challenge := &pow.Argon2Challenge{
-				Seed:       secureChallenge.Seed,
-				Difficulty: secureChallenge.Difficulty,
-			}
-			if secureChallenge.Argon2Params != nil {
-				argon2Challenge.Time = secureChallenge.Argon2Params.Time
-				argon2Challenge.Memory = secureChallenge.Argon2Params.Memory
-				argon2Challenge.Threads = secureChallenge.Argon2Params.Threads
-				argon2Challenge.KeyLen = secureChallenge.Argon2Params.KeyLength
-			}
-			return pow.VerifyArgon2PoW(argon2Challenge, response)
-		}
-	}
-	
-	// Encode challenge using configured format
-	challengeData, err := s.challengeEncoder.Encode(secureChallenge, s.challengeFormat)
-	if err != nil {
-		log.Printf("Failed to encode challenge: %v", err)
-		if s.challengeFormat == pow.FormatBinary {
-			// For binary format, just close the connection
-			return
-		} else {
-			conn.Write([]byte("Error: Failed to generate challenge\n"))
-		}
-		s.updateConnectionStatus(ctx, connectionRecord.ID, generated.ConnectionStatusFailed)
-		return
-	}
-	
-	log.Printf("Sending %s challenge to %s (size: %d bytes)", s.challengeFormat, logger.SanitizeIP(clientAddr), len(challengeData))
-
-	// Log challenge to database
-	challengeRecord, err := s.logChallenge(ctx, challengeSeed, int32(difficulty), s.algorithm, clientID)
-	if err != nil {
-		log.Printf("Failed to log challenge: %v", err)
-		// Continue anyway
-	}
-
-	// Update connection status to solving
-	s.updateConnectionStatus(ctx, connectionRecord.ID, generated.ConnectionStatusSolving)
-
-	_, err = conn.Write(append(challengeData, '\n'))
-	if err != nil {
-		log.Printf("Failed to send challenge to %s: %v", logger.SanitizeIP(clientAddr), err)
-		s.updateConnectionStatus(ctx, connectionRecord.ID, generated.ConnectionStatusFailed)
-		return
-	}
-
-	solveStart := time.Now()
-	scanner := bufio.NewScanner(conn)
-	if !scanner.Scan() {
-		log.Printf("Client %s disconnected or timed out", logger.SanitizeIP(clientAddr))
-		
-		// Log disconnection
-		s.logActivity(ctx, "warning", fmt.Sprintf("Client disconnected: %s", logger.SanitizeIP(clientAddr)), map[string]interface{}{
-			"client_id": logger.MaskSensitive(clientID),
-			"event":     "client_disconnected",
-			"reason":    "timeout_or_disconnect",
-		})
-		
-		// Record expired challenge as failed attempt for behavior tracking
-		solveTime := time.Since(solveStart)
-		err = s.behaviorTracker.RecordChallengeResult(ctx, remoteAddr, false, solveTime)
-		if err != nil {
-			log.Printf("Failed to record expired challenge result: %v", err)
-		}
-		
-		s.updateConnectionStatus(ctx, connectionRecord.ID, generated.ConnectionStatusDisconnected)
-		if challengeRecord.ID != (pgtype.UUID{}) {
-			s.updateChallengeStatus(ctx, challengeRecord.ID, generated.ChallengeStatusExpired)
-		}
-		return
-	}
-
-	response := strings.TrimSpace(scanner.Text())
-	solveTime := time.Since(solveStart)
-
-	if verifySolution(response) {
-		log.Printf("Client %s solved the %s challenge in %v", logger.SanitizeIP(clientAddr), s.algorithm, solveTime)
-		s.recordSolveTime(solveTime)
-
-		// Get current reputation before update
-		oldBehavior, _ := s.behaviorTracker.GetClientBehavior(ctx, remoteAddr)
-		oldReputation := oldBehavior.ReputationScore
-		
-		// Update client behavior with successful challenge
-		err = s.behaviorTracker.RecordChallengeResult(ctx, remoteAddr, true, solveTime)
-		if err != nil {
-			log.Printf("Failed to record challenge result: %v", err)
-		}
-		
-		// Get new behavior to check changes
-		newBehavior, _ := s.behaviorTracker.GetClientBehavior(ctx, remoteAddr)
-		newReputation := newBehavior.ReputationScore
-		newDifficulty := newBehavior.Difficulty
-		
-		// Log reputation change
-		if oldReputation != newReputation {
-			s.logActivity(ctx, "info", fmt.Sprintf("Client %s reputation increased from %.1f to %.1f after successful challenge", remoteAddr.String(), oldReputation, newReputation), map[string]interface{}{
-				"ip":                remoteAddr.String(),
-				"old_reputation":    oldReputation,
-				"new_reputation":    newReputation,
-				"change":            newReputation - oldReputation,
-				"event":             "reputation_increased",
-			})
-		}
-		
-		// Log difficulty change if it occurred
-		if difficulty != newDifficulty {
-			s.logActivity(ctx, "info", fmt.Sprintf("Client %s difficulty changed from %d to %d after successful challenge", remoteAddr.String(), difficulty, newDifficulty), map[string]interface{}{
-				"ip":                remoteAddr.String(),
-				"old_difficulty":    difficulty,
-				"new_difficulty":    newDifficulty,
-				"event":             "difficulty_changed",
-			})
-		}
-
-		// Log successful solution
-		s.logActivity(ctx, "success", fmt.Sprintf("Challenge solved by %s", logger.SanitizeIP(clientAddr)), map[string]interface{}{
-			"client_id":   logger.MaskSensitive(clientID),
-			"solve_time":  solveTime.Milliseconds(),
-			"difficulty":  difficulty,
-			"algorithm":   s.algorithm,
-			"event":       "challenge_solved",
-		})
-
-		// Log successful solution to database
-		if challengeRecord.ID != (pgtype.UUID{}) {
-			s.logSolution(ctx, challengeRecord.ID, response, true, solveTime)
-			s.updateChallengeStatus(ctx, challengeRecord.ID, generated.ChallengeStatusCompleted)
-		}
-
-		// Record metrics
-		metrics.RecordPuzzleSolved(difficulty, solveTime)
-		metrics.RecordProcessingTime("success", time.Since(startTime))
-
-		quote := s.quoteProvider.GetRandomQuote()
-		conn.Write([]byte(quote + "\n"))
-	} else {
-		log.Printf("Client %s failed the %s challenge", logger.SanitizeIP(clientAddr), s.algorithm)
-
-		// Get current reputation before update
-		oldBehavior, _ := s.behaviorTracker.GetClientBehavior(ctx, remoteAddr)
-		oldReputation := oldBehavior.ReputationScore
-		
-		// Update client behavior with failed challenge
-		err = s.behaviorTracker.RecordChallengeResult(ctx, remoteAddr, false, solveTime)
-		if err != nil {
-			log.Printf("Failed to record challenge result: %v", err)
-		}
-		
-		// Get new behavior to check changes
-		newBehavior, _ := s.behaviorTracker.GetClientBehavior(ctx, remoteAddr)
-		newReputation := newBehavior.ReputationScore
-		newDifficulty := newBehavior.Difficulty
-		
-		// Log reputation decrease
-		if oldReputation != newReputation {
-			s.logActivity(ctx, "warning", fmt.Sprintf("Client %s reputation decreased from %.1f to %.1f after failed challenge", remoteAddr.String(), oldReputation, newReputation), map[string]interface{}{
-				"ip":                remoteAddr.String(),
-				"old_reputation":    oldReputation,
-				"new_reputation":    newReputation,
-				"change":            newReputation - oldReputation,
-				"event":             "reputation_decreased",
-			})
-		}
-		
-		// Log difficulty change if it occurred
-		if difficulty != newDifficulty {
-			s.logActivity(ctx, "warning", fmt.Sprintf("Client %s difficulty increased from %d to %d after failed challenge", remoteAddr.String(), difficulty, newDifficulty), map[string]interface{}{
-				"ip":                remoteAddr.String(),
-				"old_difficulty":    difficulty,
-				"new_difficulty":    newDifficulty,
-				"event":             "difficulty_increased",
-			})
-		}
-
-		// Log failed challenge
-		s.logActivity(ctx, "warning", fmt.Sprintf("Challenge failed by %s", logger.SanitizeIP(clientAddr)), map[string]interface{}{
-			"client_id":   logger.MaskSensitive(clientID),
-			"solve_time":  solveTime.Milliseconds(),
-			"difficulty":  difficulty,
-			"algorithm":   s.algorithm,
-			"event":       "challenge_failed",
-		})
-
-		// Log failed solution to database
-		if challengeRecord.ID != (pgtype.UUID{}) {
-			s.logSolution(ctx, challengeRecord.ID, response, false, solveTime)
-			s.updateChallengeStatus(ctx, challengeRecord.ID, generated.ChallengeStatusFailed)
-		}
-
-		// Record metrics
-		metrics.RecordPuzzleFailed(difficulty)
-		metrics.RecordProcessingTime("failed", time.Since(startTime))
-
-		if s.challengeFormat == pow.FormatBinary {
-			// For binary format, just close the connection without message
-			// The client will handle disconnection appropriately
-		} else {
-			conn.Write([]byte("Error: Invalid proof of work\n"))
-		}
-	}
-	
-	// Connection status will be updated by defer
+	counted := &countingConn{Conn: conn}
+	sess := &session{
+		conn:       counted,
+		reader:     bufio.NewReader(counted),
+		ctx:        context.Background(),
+		startTime:  time.Now(),
+		clientAddr: clientAddr,
+		clientID:   s.generateClientID(clientAddr),
+	}
+	log.Printf("New connection from %s (Client ID: %s)", logger.SanitizeIP(clientAddr), logger.MaskSensitive(sess.clientID))
+	defer s.closeSession(sess)
+
+	s.runProtocol(sess, s.protocolSteps())
 }
 
 func (s *Server) getDifficulty() int {
@@ -561,8 +548,8 @@ func (s *Server) getDifficulty() int {
 }
 
 func (s *Server) SetDifficulty(difficulty int) error {
-	if difficulty < 1 || difficulty > 6 {
-		return fmt.Errorf("difficulty must be between 1 and 6")
+	if difficulty < s.minDifficulty || difficulty > maxDifficulty {
+		return fmt.Errorf("difficulty must be between %d and %d", s.minDifficulty, maxDifficulty)
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -573,8 +560,15 @@ func (s *Server) SetDifficulty(difficulty int) error {
 
 func (s *Server) Shutdown() error {
 	log.Println("Shutting down server...")
+	s.markReady(false)
 	close(s.shutdownChan)
+	if s.stopKeyRotation != nil {
+		close(s.stopKeyRotation)
+	}
 
+	for _, l := range s.extraListeners {
+		l.Close()
+	}
 	err := s.listener.Close()
 	if err != nil {
 		return fmt.Errorf("failed to close listener: %w", err)
@@ -593,6 +587,15 @@ func (s *Server) Shutdown() error {
 		log.Println("Timeout waiting for connections to close")
 	}
 
+	// Flush pending webhook deliveries
+	if s.webhook != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := s.webhook.Stop(ctx); err != nil {
+			log.Printf("Webhook shutdown: %v", err)
+		}
+		cancel()
+	}
+
 	// Close database connection pool
 	if s.dbpool != nil {
 		s.dbpool.Close()
@@ -609,7 +612,7 @@ func (s *Server) trackConnection() {
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.connectionRate++
+	s.connectionRate.observe(time.Now())
 }
 
 func (s *Server) recordSolveTime(solveTime time.Duration) {
@@ -622,13 +625,13 @@ func (s *Server) recordSolveTime(solveTime time.Duration) {
 
 	s.solveTimes = append(s.solveTimes, solveTime)
 
-	// Keep only last 50 solve times
-	if len(s.solveTimes) > 50 {
-		s.solveTimes = s.solveTimes[len(s.solveTimes)-50:]
+	// Keep only the latest solve times
+	if len(s.solveTimes) > solveTimeHistory {
+		s.solveTimes = s.solveTimes[len(s.solveTimes)-solveTimeHistory:]
 	}
 
-	// Adjust difficulty every 10 solutions or every 30 seconds
-	if len(s.solveTimes) >= 10 || time.Since(s.lastAdjustment) > 30*time.Second {
+	// Adjust difficulty every AdjustEvery solutions or every 30 seconds
+	if len(s.solveTimes) >= s.adaptive.withDefaults().AdjustEvery || time.Since(s.lastAdjustment) > 30*time.Second {
 		s.adjustDifficulty()
 	}
 }
@@ -647,22 +650,14 @@ func (s *Server) adjustDifficulty() {
 
 	oldDifficulty := s.difficulty
 
-	// Adaptive difficulty rules:
-	// - If avg solve time < 1s: increase difficulty
-	// - If avg solve time > 5s: decrease difficulty
-	// - If connection rate is high (>20/min): increase difficulty
+	connectionRatePerMinute := s.connectionRate.perMinute(time.Now())
 
-	connectionRatePerMinute := float64(s.connectionRate) / time.Since(s.lastAdjustment).Minutes()
-
-	if avgSolveTime < time.Second || connectionRatePerMinute > 20 {
-		if s.difficulty < 6 {
-			s.difficulty++
-		}
-	} else if avgSolveTime > 5*time.Second && connectionRatePerMinute < 5 {
-		if s.difficulty > 1 {
-			s.difficulty--
-		}
+	sample := DifficultySample{
+		AvgSolveTime:            avgSolveTime,
+		ConnectionRatePerMinute: connectionRatePerMinute,
+		Solves:                  len(s.solveTimes),
 	}
+	s.difficulty = s.floorDifficulty(s.controller.Next(s.difficulty, sample))
 
 	if s.difficulty != oldDifficulty {
 		direction := "increase"
@@ -674,17 +669,27 @@ func (s *Server) adjustDifficulty() {
 			oldDifficulty, s.difficulty, avgSolveTime, connectionRatePerMinute)
 
 		// Record metrics
-		metrics.RecordDifficultyAdjustment(direction)
-		metrics.UpdateCurrentDifficulty(s.difficulty)
+		s.recorder.RecordDifficultyAdjustment(direction)
+		s.recorder.UpdateCurrentDifficulty(s.difficulty)
 	}
 
+	s.evaluateShadow(sample)
+
 	// Reset tracking
 	s.solveTimes = s.solveTimes[:0]
-	s.connectionRate = 0
 	s.lastAdjustment = time.Now()
 }
 
 func (s *Server) GetStats() map[string]interface{} {
+	// Queried before taking the lock so a slow database never blocks connection handling
+	var distribution map[int]int
+	if s.behaviorTracker != nil {
+		var err error
+		if distribution, err = s.behaviorTracker.DifficultyDistribution(context.Background()); err != nil {
+			log.Printf("Failed to get difficulty distribution: %v", err)
+		}
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -697,9 +702,9 @@ func (s *Server) GetStats() map[string]interface{} {
 		avgSolveTime = total / time.Duration(len(s.solveTimes))
 	}
 
-	connectionRatePerMinute := float64(s.connectionRate) / time.Since(s.lastAdjustment).Minutes()
+	connectionRatePerMinute := s.connectionRate.perMinute(time.Now())
 
-	return map[string]interface{}{
+	stats := map[string]interface{}{
 		"difficulty":         s.difficulty,
 		"adaptive_mode":      s.adaptiveMode,
 		"avg_solve_time_ms":  avgSolveTime.Milliseconds(),
@@ -707,6 +712,23 @@ func (s *Server) GetStats() map[string]interface{} {
 		"recent_solve_count": len(s.solveTimes),
 		"last_adjustment":    s.lastAdjustment.Unix(),
 	}
+	if s.controller != nil {
+		stats["controller"] = s.controller.Name()
+	}
+	if s.shadowController != nil {
+		stats["shadow_controller"] = s.shadowController.Name()
+		stats["shadow_difficulty"] = s.shadowDifficulty
+	}
+	if s.surge.threshold > 0 {
+		boost, rate := s.surge.boost(time.Now())
+		stats["surge_new_client_rate"] = rate
+		stats["surge_boost"] = boost
+	}
+	if distribution != nil {
+		stats["difficulty_distribution"] = distribution
+	}
+
+	return stats
 }
 
 func (s *Server) Addr() string {
@@ -752,6 +774,31 @@ func (s *Server) logBehaviorStats() {
 	}
 }
 
+// exportBehaviorMetrics refreshes the behavior gauges on a ticker so scrapes never hit the database
+func (s *Server) exportBehaviorMetrics() {
+	ticker := time.NewTicker(s.behaviorMetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.shutdownChan:
+			return
+		case <-ticker.C:
+			// Lets the surge gauges decay while no new clients arrive
+			s.surge.export(time.Now())
+
+			agg, err := s.behaviorTracker.ComputeAggregates(context.Background())
+			if err != nil {
+				log.Printf("Failed to compute behavior aggregates: %v", err)
+				continue
+			}
+
+			s.recorder.UpdateBehaviorAggregates(agg.ClientsByDifficulty, agg.FlaggedAttackers,
+				agg.AvgReputation, agg.AvgSuspiciousScore, agg.NewClientsPerMinute)
+		}
+	}
+}
+
 // Database helper functions for write-only operations
 
 func (s *Server) generateClientID(clientAddr string) string {
@@ -759,6 +806,10 @@ func (s *Server) generateClientID(clientAddr string) string {
 }
 
 func (s *Server) logActivity(ctx context.Context, level, message string, metadata map[string]interface{}) {
+	if !s.logLevelEnabled(level) {
+		return
+	}
+
 	// Convert metadata to JSONB
 	var metadataJSON []byte
 	if metadata != nil {
@@ -772,7 +823,10 @@ func (s *Server) logActivity(ctx context.Context, level, message string, metadat
 		Metadata: metadataJSON,
 	}
 	
-	_, err := s.queries.CreateLog(ctx, s.dbpool, params)
+	ctx, cancel := database.WithQueryTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	_, err := s.queries.CreateLog(ctx, s.db, params)
 	if err != nil {
 		log.Printf("Failed to create log entry: %v", err)
 	}
@@ -796,7 +850,10 @@ func (s *Server) logConnection(ctx context.Context, clientID string, remoteAddr
 		Algorithm:  algo,
 	}
 
-	return s.queries.CreateConnection(ctx, s.dbpool, params)
+	ctx, cancel := database.WithQueryTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	return s.queries.CreateConnection(ctx, s.db, params)
 }
 
 func (s *Server) updateConnectionStatus(ctx context.Context, connectionID pgtype.UUID, status generated.ConnectionStatus) {
@@ -809,13 +866,38 @@ func (s *Server) updateConnectionStatus(ctx context.Context, connectionID pgtype
 		Status: status,
 	}
 
-	_, err := s.queries.UpdateConnectionStatus(ctx, s.dbpool, params)
+	ctx, cancel := database.WithQueryTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	_, err := s.queries.UpdateConnectionStatus(ctx, s.db, params)
 	if err != nil {
 		log.Printf("Failed to update connection status: %v", err)
 	}
 }
 
-func (s *Server) logChallenge(ctx context.Context, seed string, difficulty int32, algorithm, clientID string) (generated.Challenge, error) {
+// updateConnectionBandwidth stores the bytes exchanged over a connection
+func (s *Server) updateConnectionBandwidth(ctx context.Context, connectionID pgtype.UUID, sent, received int64) {
+	if connectionID == (pgtype.UUID{}) {
+		return // Skip if no valid connection ID
+	}
+
+	params := generated.UpdateConnectionBandwidthParams{
+		ID:            connectionID,
+		BytesSent:     pgtype.Int8{Int64: sent, Valid: true},
+		BytesReceived: pgtype.Int8{Int64: received, Valid: true},
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	err := s.queries.UpdateConnectionBandwidth(ctx, s.db, params)
+	if err != nil {
+		log.Printf("Failed to update connection bandwidth: %v", err)
+	}
+}
+
+// logChallenge records an issued challenge, with the Argon2 parameters it was signed with
+func (s *Server) logChallenge(ctx context.Context, challenge *pow.SecureChallenge, difficulty int32, algorithm, clientID string, decision behavior.DifficultyDecision) (generated.Challenge, error) {
 	var algo generated.PowAlgorithm
 	switch algorithm {
 	case "sha256":
@@ -827,19 +909,32 @@ func (s *Server) logChallenge(ctx context.Context, seed string, difficulty int32
 	}
 
 	params := generated.CreateChallengeParams{
-		Seed:       seed,
+		Seed:       challenge.Seed,
 		Difficulty: difficulty,
 		Algorithm:  algo,
 		ClientID:   clientID,
 		Status:     generated.ChallengeStatusPending,
-		// Argon2 parameters (only used for argon2 challenges)
-		Argon2Time:    pgtype.Int4{Int32: 1, Valid: algorithm == "argon2"},
-		Argon2Memory:  pgtype.Int4{Int32: 64 * 1024, Valid: algorithm == "argon2"},
-		Argon2Threads: pgtype.Int2{Int16: 4, Valid: algorithm == "argon2"},
-		Argon2Keylen:  pgtype.Int4{Int32: 32, Valid: algorithm == "argon2"},
 	}
+	// Argon2 parameters (only used for argon2 challenges), as issued rather than looked up
+	// again, the profile may have been reloaded since
+	if argon2Params := challenge.Argon2Params; algorithm == "argon2" && argon2Params != nil {
+		params.Argon2Time = pgtype.Int4{Int32: int32(argon2Params.Time), Valid: true}
+		params.Argon2Memory = pgtype.Int4{Int32: int32(argon2Params.Memory), Valid: true}
+		params.Argon2Threads = pgtype.Int2{Int16: int16(argon2Params.Threads), Valid: true}
+		params.Argon2Keylen = pgtype.Int4{Int32: int32(argon2Params.KeyLength), Valid: true}
+	}
+
+	// A decision that can't be encoded is left NULL rather than losing the challenge
+	if data, err := json.Marshal(decision); err != nil {
+		log.Printf("Failed to encode difficulty decision: %v", err)
+	} else {
+		params.DifficultyDecision = data
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx, s.queryTimeout)
+	defer cancel()
 
-	return s.queries.CreateChallenge(ctx, s.dbpool, params)
+	return s.queries.CreateChallenge(ctx, s.db, params)
 }
 
 func (s *Server) updateChallengeStatus(ctx context.Context, challengeID pgtype.UUID, status generated.ChallengeStatus) {
@@ -852,27 +947,39 @@ func (s *Server) updateChallengeStatus(ctx context.Context, challengeID pgtype.U
 		Status: status,
 	}
 
-	_, err := s.queries.UpdateChallengeStatus(ctx, s.dbpool, params)
+	ctx, cancel := database.WithQueryTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	_, err := s.queries.UpdateChallengeStatus(ctx, s.db, params)
 	if err != nil {
 		log.Printf("Failed to update challenge status: %v", err)
 	}
 }
 
-func (s *Server) logSolution(ctx context.Context, challengeID pgtype.UUID, solution string, valid bool, solveTime time.Duration) {
-	if challengeID == (pgtype.UUID{}) {
+// logSolution stores the submitted solution with the client's untrusted solve report
+func (s *Server) logSolution(ctx context.Context, sess *session, valid bool) {
+	if sess.challengeRecord.ID == (pgtype.UUID{}) {
 		return // Skip if no valid challenge ID
 	}
 
 	params := generated.CreateSolutionParams{
-		ChallengeID: challengeID,
-		Nonce:       solution,
-		Hash:        pgtype.Text{String: "", Valid: false}, // Can be empty for now
-		Attempts:    pgtype.Int4{Int32: 1, Valid: true},
-		SolveTimeMs: solveTime.Milliseconds(),
+		ChallengeID: sess.challengeRecord.ID,
+		Nonce:       sess.response,
+		Hash:        pgtype.Text{String: sess.solutionHash, Valid: sess.solutionHash != ""},
+		Attempts:    sess.report.attempts,
+		SolveTimeMs: sess.solveTime.Milliseconds(),
 		Verified:    valid,
+		AchievedDifficulty: pgtype.Int4{
+			Int32: int32(pow.AchievedDifficulty(sess.solutionHash)),
+			Valid: sess.solutionHash != "",
+		},
+		ClientSolveTimeMs: sess.report.solveTimeMs,
 	}
 
-	_, err := s.queries.CreateSolution(ctx, s.dbpool, params)
+	ctx, cancel := database.WithQueryTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	_, err := s.queries.CreateSolution(ctx, s.db, params)
 	if err != nil {
 		log.Printf("Failed to log solution: %v", err)
 	}
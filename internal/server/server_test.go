@@ -0,0 +1,2105 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"world-of-wisdom/internal/behavior"
+	"world-of-wisdom/internal/client"
+	generated "world-of-wisdom/internal/database/generated"
+	"world-of-wisdom/pkg/metrics"
+	"world-of-wisdom/pkg/metrics/metricstest"
+	"world-of-wisdom/pkg/pow"
+	"world-of-wisdom/pkg/wisdom"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// hangingDB blocks every query until its context is done and records why it was released
+type hangingDB struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (d *hangingDB) wait(ctx context.Context) error {
+	<-ctx.Done()
+	d.mu.Lock()
+	d.err = ctx.Err()
+	d.mu.Unlock()
+	return ctx.Err()
+}
+
+func (d *hangingDB) Exec(ctx context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, d.wait(ctx)
+}
+
+func (d *hangingDB) Query(ctx context.Context, _ string, _ ...interface{}) (pgx.Rows, error) {
+	return nil, d.wait(ctx)
+}
+
+func (d *hangingDB) QueryRow(ctx context.Context, _ string, _ ...interface{}) pgx.Row {
+	return errRow{err: d.wait(ctx)}
+}
+
+type errRow struct{ err error }
+
+func (r errRow) Scan(...interface{}) error { return r.err }
+
+func TestSlowQueryIsCancelled(t *testing.T) {
+	db := &hangingDB{}
+	s := &Server{
+		db:           db,
+		queries:      generated.New(),
+		queryTimeout: 50 * time.Millisecond,
+	}
+
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		s.logActivity(context.Background(), "info", "slow query", nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("logActivity did not return, query was never cancelled")
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Query took %v, expected it to be cancelled after ~50ms", elapsed)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if !errors.Is(db.err, context.DeadlineExceeded) {
+		t.Errorf("Expected query context to hit its deadline, got %v", db.err)
+	}
+}
+
+// failingDB rejects every query immediately, as if the database were unreachable
+type failingDB struct{}
+
+var errDatabaseDown = errors.New("database unavailable")
+
+func (failingDB) Exec(context.Context, string, ...interface{}) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errDatabaseDown
+}
+
+func (failingDB) Query(context.Context, string, ...interface{}) (pgx.Rows, error) {
+	return nil, errDatabaseDown
+}
+
+func (failingDB) QueryRow(context.Context, string, ...interface{}) pgx.Row {
+	return errRow{err: errDatabaseDown}
+}
+
+// remoteConn overrides the remote address of an in-memory connection
+type remoteConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c remoteConn) RemoteAddr() net.Addr { return c.remote }
+
+func TestPerIPConnectionCapRejectsExcessConnections(t *testing.T) {
+	const limit = 2
+	s := &Server{
+		recorder:        &metricstest.Recorder{},
+		db:              failingDB{},
+		queries:         generated.New(),
+		queryTimeout:    time.Second,
+		challengeFormat: pow.FormatJSON,
+		connLimiter:     newConnLimiter(limit, nil),
+	}
+
+	ip := netip.MustParseAddr("203.0.113.7")
+
+	// The IP already holds every slot it is allowed
+	for i := 0; i < limit; i++ {
+		if ok, _ := s.connLimiter.acquire(ip); !ok {
+			t.Fatalf("Connection %d should have been admitted", i+1)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		serverSide, clientSide := net.Pipe()
+		s.activeConns.Add(1)
+		go s.handleConnection(remoteConn{Conn: serverSide, remote: &net.TCPAddr{IP: ip.AsSlice(), Port: 40000 + i}})
+
+		clientSide.SetReadDeadline(time.Now().Add(2 * time.Second))
+		reply, err := bufio.NewReader(clientSide).ReadString('\n')
+		clientSide.Close()
+		if err != nil {
+			t.Fatalf("Over-limit connection %d: failed to read reply: %v", i+1, err)
+		}
+		if !strings.Contains(reply, "Too many concurrent connections") {
+			t.Errorf("Over-limit connection %d: expected rejection, got %q", i+1, reply)
+		}
+	}
+
+	s.activeConns.Wait()
+
+	if got := s.connLimiter.activeFor(ip); got != limit {
+		t.Errorf("Rejected connections must not hold slots: expected %d active, got %d", limit, got)
+	}
+}
+
+func TestConnectionRateLimitRejectsAFlood(t *testing.T) {
+	const perMinute = 10
+	s := &Server{
+		recorder:        &metricstest.Recorder{},
+		db:              failingDB{},
+		queries:         generated.New(),
+		queryTimeout:    time.Second,
+		challengeFormat: pow.FormatJSON,
+		connLimiter:     newConnLimiter(1, nil),
+		connRateLimiter: newIPRateLimiter(perMinute, nil),
+	}
+
+	// Connections within the rate go on to the concurrent cap, whose only slot is taken,
+	// so no connection gets as far as the database
+	ip := netip.MustParseAddr("203.0.113.7")
+	if ok, _ := s.connLimiter.acquire(ip); !ok {
+		t.Fatal("Failed to take the only slot")
+	}
+
+	rateLimited := 0
+	for i := 0; i < 100; i++ {
+		serverSide, clientSide := net.Pipe()
+		s.activeConns.Add(1)
+		go s.handleConnection(remoteConn{Conn: serverSide, remote: &net.TCPAddr{IP: ip.AsSlice(), Port: 40000 + i}})
+
+		clientSide.SetReadDeadline(time.Now().Add(2 * time.Second))
+		reply, err := bufio.NewReader(clientSide).ReadString('\n')
+		clientSide.Close()
+		if err != nil {
+			t.Fatalf("Connection %d: failed to read reply: %v", i+1, err)
+		}
+		if strings.Contains(reply, "Rate limited") {
+			rateLimited++
+		}
+	}
+	s.activeConns.Wait()
+
+	if rateLimited != 100-perMinute {
+		t.Errorf("Expected %d of 100 rapid connections to be rate limited, got %d", 100-perMinute, rateLimited)
+	}
+
+	// Another IP has its own bucket
+	if !s.connRateLimiter.allow(netip.MustParseAddr("198.51.100.1"), time.Now()) {
+		t.Error("Expected a different IP to be unaffected")
+	}
+}
+
+func TestConnLimiterReleaseAndAllowlist(t *testing.T) {
+	allowlist, err := parseAllowlist([]string{"10.0.0.0/8", " 192.0.2.1 ", ""})
+	if err != nil {
+		t.Fatalf("parseAllowlist failed: %v", err)
+	}
+	l := newConnLimiter(1, allowlist)
+
+	admitted := func(ip netip.Addr) bool {
+		ok, _ := l.acquire(ip)
+		return ok
+	}
+
+	ip := netip.MustParseAddr("198.51.100.1")
+	if !admitted(ip) {
+		t.Fatal("First connection should be admitted")
+	}
+	if admitted(ip) {
+		t.Fatal("Second concurrent connection should be rejected")
+	}
+	l.release(ip)
+	if !admitted(ip) {
+		t.Error("Connection should be admitted again after release")
+	}
+
+	for _, addr := range []string{"10.1.2.3", "192.0.2.1"} {
+		allowed := netip.MustParseAddr(addr)
+		for i := 0; i < 5; i++ {
+			if ok, held := l.acquire(allowed); !ok || held {
+				t.Errorf("Allowlisted %s was rejected or counted on connection %d", addr, i+1)
+			}
+		}
+	}
+
+	if _, err := parseAllowlist([]string{"not-an-ip"}); err == nil {
+		t.Error("Expected an error for an invalid allowlist entry")
+	}
+}
+
+func TestSlotsHeldAcrossAReloadAreReleased(t *testing.T) {
+	ip := netip.MustParseAddr("198.51.100.1")
+	allowlist, _ := parseAllowlist([]string{"198.51.100.0/24"})
+
+	for name, reload := range map[string]func(l *connLimiter){
+		"cap disabled":   func(l *connLimiter) { l.update(0, nil) },
+		"IP allowlisted": func(l *connLimiter) { l.update(1, allowlist) },
+	} {
+		l := newConnLimiter(1, nil)
+		ok, held := l.acquire(ip)
+		if !ok || !held {
+			t.Fatalf("%s: expected the slot to be taken and counted", name)
+		}
+
+		// The connection ends while the reloaded settings no longer count it
+		reload(l)
+		l.release(ip)
+		l.update(1, nil)
+
+		if ok, _ := l.acquire(ip); !ok {
+			t.Errorf("%s: expected the slot to have been released, %d still held", name, l.activeFor(ip))
+		}
+	}
+}
+
+func TestIssueLimiterRefillsAndExemptsAllowlist(t *testing.T) {
+	allowlist, _ := parseAllowlist([]string{"10.0.0.0/8"})
+	l := newIPRateLimiter(3, allowlist)
+	ip := netip.MustParseAddr("198.51.100.2")
+	now := time.Now()
+
+	for i := 1; i <= 3; i++ {
+		if !l.allow(ip, now) {
+			t.Fatalf("Challenge %d of the burst should be issued", i)
+		}
+	}
+	if l.allow(ip, now) {
+		t.Fatal("A fourth challenge within the minute should be refused")
+	}
+	if !l.allow(netip.MustParseAddr("198.51.100.3"), now) {
+		t.Error("Another IP should have its own bucket")
+	}
+
+	// Three per minute refill one every 20 seconds
+	if l.allow(ip, now.Add(10*time.Second)) {
+		t.Error("Expected no challenge before a token refilled")
+	}
+	if !l.allow(ip, now.Add(21*time.Second)) {
+		t.Error("Expected a challenge once a token refilled")
+	}
+
+	allowed := netip.MustParseAddr("10.1.2.3")
+	for i := 1; i <= 10; i++ {
+		if !l.allow(allowed, now) {
+			t.Fatalf("Allowlisted IP was refused on challenge %d", i)
+		}
+	}
+
+	l.update(0, nil)
+	if !l.allow(ip, now) {
+		t.Error("Expected a rate of 0 to disable the limit")
+	}
+}
+
+// fixedController always chooses the same difficulty
+type fixedController struct{ difficulty int }
+
+func (c fixedController) Name() string                   { return "fixed" }
+func (c fixedController) Next(int, DifficultySample) int { return c.difficulty }
+
+func TestShadowControllerIsNeverApplied(t *testing.T) {
+	s := &Server{
+		recorder:         &metricstest.Recorder{},
+		difficulty:       2,
+		controller:       thresholdController{},
+		shadowController: fixedController{difficulty: 6},
+		shadowDifficulty: 2,
+		solveTimes:       []time.Duration{8 * time.Second, 9 * time.Second},
+		lastAdjustment:   time.Now().Add(-time.Minute),
+	}
+
+	s.adjustDifficulty()
+
+	// Slow solves at a low connection rate make the threshold controller back off
+	if s.difficulty != 1 {
+		t.Errorf("Expected active difficulty 1, got %d", s.difficulty)
+	}
+	if s.shadowDifficulty != 6 {
+		t.Errorf("Expected shadow difficulty 6, got %d", s.shadowDifficulty)
+	}
+
+	stats := s.GetStats()
+	if stats["shadow_controller"] != "fixed" || stats["shadow_difficulty"] != 6 {
+		t.Errorf("Expected shadow state in stats, got %v", stats)
+	}
+}
+
+func TestDifficultyNeverDropsBelowFloor(t *testing.T) {
+	for _, controller := range []DifficultyController{thresholdController{}, slaController{target: time.Second}} {
+		s := &Server{
+			recorder:         &metricstest.Recorder{},
+			difficulty:       5,
+			controller:       controller,
+			minDifficulty:    3,
+			shadowController: thresholdController{},
+			shadowDifficulty: 5,
+		}
+
+		// Slow solves at a low connection rate push both controllers down every round
+		for round := 0; round < 10; round++ {
+			s.solveTimes = append(s.solveTimes[:0], 8*time.Second, 9*time.Second)
+			s.adjustDifficulty()
+			if s.difficulty < 3 || s.shadowDifficulty < 3 {
+				t.Fatalf("%s: round %d dropped to difficulty %d (shadow %d), below the floor of 3",
+					controller.Name(), round, s.difficulty, s.shadowDifficulty)
+			}
+		}
+		if s.difficulty != 3 {
+			t.Errorf("%s: expected difficulty to settle at the floor, got %d", controller.Name(), s.difficulty)
+		}
+
+		if got := s.floorDifficulty(1); got != 3 {
+			t.Errorf("Expected per-client difficulty 1 raised to 3, got %d", got)
+		}
+		if err := s.SetDifficulty(2); err == nil {
+			t.Error("Expected SetDifficulty below the floor to fail")
+		}
+	}
+}
+
+func TestAdaptiveConfigMovesDifficulty(t *testing.T) {
+	s := &Server{
+		recorder:       &metricstest.Recorder{},
+		difficulty:     3,
+		adaptiveMode:   true,
+		controller:     thresholdController{},
+		lastAdjustment: time.Now(),
+	}
+	custom := AdaptiveConfig{TargetSolveTime: 3 * time.Second, MaxSolveTime: 10 * time.Second, AdjustEvery: 4}
+	if err := s.SetAdaptiveConfig(custom); err != nil {
+		t.Fatalf("SetAdaptiveConfig failed: %v", err)
+	}
+
+	// 2s solves are slow enough for the default 1s target, not for a 3s one. Nothing
+	// moves until the fourth solve.
+	for i := 0; i < 3; i++ {
+		s.recordSolveTime(2 * time.Second)
+	}
+	if s.difficulty != 3 {
+		t.Fatalf("Expected no adjustment before %d solves, got difficulty %d", custom.AdjustEvery, s.difficulty)
+	}
+	s.recordSolveTime(2 * time.Second)
+	if s.difficulty != 4 {
+		t.Errorf("Expected solves under the 3s target to raise difficulty to 4, got %d", s.difficulty)
+	}
+
+	// 8s solves are past the default 5s maximum but within the custom 10s
+	for i := 0; i < 4; i++ {
+		s.recordSolveTime(8 * time.Second)
+	}
+	if s.difficulty != 4 {
+		t.Errorf("Expected 8s solves to keep difficulty 4 with a 10s maximum, got %d", s.difficulty)
+	}
+	for i := 0; i < 4; i++ {
+		s.recordSolveTime(12 * time.Second)
+	}
+	if s.difficulty != 3 {
+		t.Errorf("Expected solves over the 10s maximum to lower difficulty to 3, got %d", s.difficulty)
+	}
+
+	// Thresholds that overlap are rejected and the current ones kept
+	if err := s.SetAdaptiveConfig(AdaptiveConfig{TargetSolveTime: 5 * time.Second, MaxSolveTime: 2 * time.Second}); err == nil {
+		t.Error("Expected a maximum below the target to be rejected")
+	}
+	if s.adaptive.MaxSolveTime != 10*time.Second {
+		t.Errorf("Expected the 10s maximum to be kept, got %v", s.adaptive.MaxSolveTime)
+	}
+}
+
+func TestSolveDeadlineScalesWithDifficulty(t *testing.T) {
+	s := &Server{timeout: 30 * time.Second, maxSolveWait: 5 * time.Minute}
+	expiresAt := time.Now().Add(10 * time.Minute).UnixMicro()
+
+	easy := &pow.SecureChallenge{Algorithm: "sha256", Difficulty: 2, ExpiresAt: expiresAt}
+	if window := time.Until(s.solveDeadline(easy)); window > 31*time.Second {
+		t.Errorf("Expected an easy challenge to keep the 30s read timeout, got %v", window)
+	}
+
+	hard := &pow.SecureChallenge{Algorithm: "argon2", Difficulty: 3, ExpiresAt: expiresAt}
+	if window := time.Until(s.solveDeadline(hard)); window < 4*time.Minute || window > 5*time.Minute {
+		t.Errorf("Expected a hard Argon2 challenge to get up to the 5m cap, got %v", window)
+	}
+
+	hard.ExpiresAt = time.Now().Add(time.Minute).UnixMicro()
+	if window := time.Until(s.solveDeadline(hard)); window > time.Minute {
+		t.Errorf("Expected the deadline to stop at challenge expiry, got %v", window)
+	}
+}
+
+func TestReloadAppliesHotSettings(t *testing.T) {
+	s := &Server{
+		recorder:        &metricstest.Recorder{},
+		connLimiter:     newConnLimiter(1, nil),
+		connRateLimiter: newIPRateLimiter(0, nil),
+		issueLimiter:    newIPRateLimiter(0, nil),
+		quoteProvider:   wisdom.NewQuoteProvider(),
+	}
+	ip := netip.MustParseAddr("203.0.113.7")
+
+	err := s.Reload(ReloadConfig{MaxConnsPerIP: 2, MaxConnectionsPerMinute: 1, ChallengeIssueRate: 1, Allowlist: []string{"10.0.0.0/8"}, LogLevel: "warning"})
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	acquire := func(ip netip.Addr) bool {
+		ok, _ := s.connLimiter.acquire(ip)
+		return ok
+	}
+	if !acquire(ip) || !acquire(ip) {
+		t.Error("Expected the raised cap to allow two connections")
+	}
+	if acquire(ip) {
+		t.Error("Expected a third connection to be rejected")
+	}
+	if !acquire(netip.MustParseAddr("10.1.2.3")) {
+		t.Error("Expected the reloaded allowlist to exempt 10.0.0.0/8")
+	}
+	if now := time.Now(); !s.issueLimiter.allow(ip, now) || s.issueLimiter.allow(ip, now) {
+		t.Error("Expected the reloaded issuance rate to allow one challenge a minute")
+	}
+	if now := time.Now(); !s.connRateLimiter.allow(ip, now) || s.connRateLimiter.allow(ip, now) {
+		t.Error("Expected the reloaded connection rate to allow one connection a minute")
+	}
+	if s.logLevelEnabled("info") || !s.logLevelEnabled("error") {
+		t.Error("Expected only warning and above to be logged")
+	}
+
+	// A bad allowlist rejects the whole reload
+	err = s.Reload(ReloadConfig{MaxConnsPerIP: 5, Allowlist: []string{"not-an-ip"}, LogLevel: "debug"})
+	if err == nil {
+		t.Fatal("Expected an invalid allowlist to fail the reload")
+	}
+	if s.logLevelEnabled("info") {
+		t.Error("Expected the log level to be unchanged after a failed reload")
+	}
+}
+
+func TestConnectionRateEWMADampensSingleSpike(t *testing.T) {
+	controller := thresholdController{}
+	sample := func(rate float64) DifficultySample {
+		// Solve times inside the 1s-5s band so only the rate can move difficulty
+		return DifficultySample{AvgSolveTime: 2 * time.Second, ConnectionRatePerMinute: rate}
+	}
+
+	// 30 connections in one burst, sampled 30s later: the raw count/elapsed signal
+	// would read 60/min and raise difficulty
+	start := time.Now()
+	var spike rateEWMA
+	for i := 0; i < 30; i++ {
+		spike.observe(start)
+	}
+	if rate := spike.perMinute(start.Add(30 * time.Second)); controller.Next(2, sample(rate)) != 2 {
+		t.Errorf("Expected a single burst not to raise difficulty, smoothed rate was %.1f/min", rate)
+	}
+
+	// 25 connections a minute sustained for 10 minutes should
+	var sustained rateEWMA
+	now := start
+	for i := 0; i < 250; i++ {
+		now = now.Add(2400 * time.Millisecond)
+		sustained.observe(now)
+	}
+	if rate := sustained.perMinute(now); controller.Next(2, sample(rate)) != 3 {
+		t.Errorf("Expected a sustained 25/min to raise difficulty, smoothed rate was %.1f/min", rate)
+	}
+}
+
+func TestProtocolStateDeadlineBoundsEachState(t *testing.T) {
+	s := &Server{timeout: 50 * time.Millisecond, recorder: &metricstest.Recorder{}}
+
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	counted := &countingConn{Conn: serverSide}
+	sess := &session{conn: counted, reader: bufio.NewReader(counted), clientAddr: "203.0.113.7:40000"}
+
+	// The handshake outlives its deadline, the next state still gets a full one
+	var visited []protocolState
+	steps := map[protocolState]stateFunc{
+		stateAwaitHandshake: func(sess *session) protocolState {
+			visited = append(visited, sess.state)
+			if _, err := sess.reader.ReadByte(); err == nil {
+				t.Error("Expected the handshake read to time out")
+			}
+			return stateSendChallenge
+		},
+		stateSendChallenge: func(sess *session) protocolState {
+			visited = append(visited, sess.state)
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				clientSide.Write([]byte("x"))
+			}()
+			if _, err := sess.reader.ReadByte(); err != nil {
+				t.Errorf("Expected a fresh deadline for %s, read failed: %v", sess.state, err)
+			}
+			return stateDone
+		},
+	}
+
+	s.runProtocol(sess, steps)
+
+	if len(visited) != 2 || visited[0] != stateAwaitHandshake || visited[1] != stateSendChallenge {
+		t.Errorf("Expected handshake then send, visited %v", visited)
+	}
+	if counted.received != 1 || counted.sent != 0 {
+		t.Errorf("Expected 1 byte received and none sent, got %d received, %d sent", counted.received, counted.sent)
+	}
+}
+
+func TestStalledHandshakeTimesOutOnItsOwnLimit(t *testing.T) {
+	s := &Server{
+		timeout:       10 * time.Second,
+		stateTimeouts: stateTimeouts(Config{HandshakeTimeout: 50 * time.Millisecond, RespondTimeout: 3 * time.Second}),
+		recorder:      &metricstest.Recorder{},
+	}
+
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	counted := &countingConn{Conn: serverSide}
+	sess := &session{conn: counted, reader: bufio.NewReader(counted), clientAddr: "203.0.113.7:40000"}
+
+	var handshakeWait time.Duration
+	steps := map[protocolState]stateFunc{
+		stateAwaitHandshake: func(sess *session) protocolState {
+			start := time.Now()
+			if _, err := sess.reader.ReadByte(); err == nil {
+				t.Error("Expected the stalled handshake to time out")
+			}
+			handshakeWait = time.Since(start)
+			return stateRespond
+		},
+		stateRespond: func(sess *session) protocolState {
+			go clientSide.Write([]byte("x"))
+			if _, err := sess.reader.ReadByte(); err != nil {
+				t.Errorf("Expected respond to get a fresh deadline, read failed: %v", err)
+			}
+			return stateDone
+		},
+	}
+	s.runProtocol(sess, steps)
+
+	if handshakeWait > time.Second {
+		t.Errorf("Expected the handshake to give up after its 50ms limit, not the 10s idle timeout, waited %v", handshakeWait)
+	}
+	if got := s.stateTimeout(stateRespond); got != 3*time.Second {
+		t.Errorf("Expected respond to get its own 3s limit, got %v", got)
+	}
+	if got := s.stateTimeout(stateSendChallenge); got != 10*time.Second {
+		t.Errorf("Expected states without a limit to use the idle timeout, got %v", got)
+	}
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	v2 := func(command, family byte, addresses []byte) string {
+		header := append([]byte{}, proxyV2Signature...)
+		header = append(header, 0x20|command, family, byte(len(addresses)>>8), byte(len(addresses)))
+		return string(append(header, addresses...))
+	}
+
+	tests := []struct {
+		name   string
+		input  string
+		want   string
+		ok     bool
+		hasErr bool
+	}{
+		{"v1 tcp4", "PROXY TCP4 198.51.100.9 10.0.0.1 51234 8080\r\nsolution", "198.51.100.9:51234", true, false},
+		{"v1 tcp6", "PROXY TCP6 2001:db8::9 2001:db8::1 51234 8080\r\n", "[2001:db8::9]:51234", true, false},
+		{"v1 unknown", "PROXY UNKNOWN\r\n", "", false, false},
+		{"v1 family mismatch", "PROXY TCP4 2001:db8::9 10.0.0.1 51234 8080\r\n", "", false, true},
+		{"v1 unterminated", "PROXY TCP4 " + strings.Repeat("1", 120), "", false, true},
+		{"v2 tcp4", v2(1, 0x11, []byte{198, 51, 100, 9, 10, 0, 0, 1, 0xc8, 0x22, 0x1f, 0x90}), "198.51.100.9:51234", true, false},
+		{"v2 local", v2(0, 0x00, nil), "", false, false},
+		{"v2 short", v2(1, 0x11, []byte{198, 51, 100, 9}), "", false, true},
+		{"no header", "0123456789abcdef\n", "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.input))
+			addr, ok, err := readProxyHeader(r)
+			if (err != nil) != tt.hasErr {
+				t.Fatalf("Expected error %v, got %v", tt.hasErr, err)
+			}
+			if ok != tt.ok {
+				t.Fatalf("Expected ok %v, got %v", tt.ok, ok)
+			}
+			if ok && addr.String() != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, addr)
+			}
+		})
+	}
+
+	// The header is consumed, the rest of the stream is left for the protocol
+	r := bufio.NewReader(strings.NewReader(tests[0].input))
+	readProxyHeader(r)
+	if rest, _ := r.ReadString('\n'); rest != "solution" {
+		t.Errorf("Expected the payload after the header to be left unread, got %q", rest)
+	}
+}
+
+func TestProxyHeaderOnlyTrustedFromProxies(t *testing.T) {
+	trusted, _ := parseAllowlist([]string{"10.0.0.0/8"})
+	s := &Server{proxyProtocol: true, trustedProxies: trusted, recorder: &metricstest.Recorder{}}
+
+	// A direct client keeps its own address, nothing is read from it
+	sess := &session{clientAddr: "198.51.100.9:1000", reader: bufio.NewReader(strings.NewReader("FRAMED\n"))}
+	if !s.resolveProxyHeader(sess) || sess.clientAddr != "198.51.100.9:1000" {
+		t.Errorf("Untrusted peer must keep its address, got %s", sess.clientAddr)
+	}
+
+	sess = &session{clientAddr: "10.0.0.5:1000", reader: bufio.NewReader(strings.NewReader("PROXY TCP4 192.0.2.1 10.0.0.1 4321 8080\r\n"))}
+	if !s.resolveProxyHeader(sess) || sess.clientAddr != "192.0.2.1:4321" {
+		t.Errorf("Expected the forwarded address from a trusted proxy, got %s", sess.clientAddr)
+	}
+
+	sess = &session{clientAddr: "10.0.0.5:1000", reader: bufio.NewReader(strings.NewReader("no header here\n"))}
+	if s.resolveProxyHeader(sess) {
+		t.Error("Expected a trusted proxy without a header to be rejected")
+	}
+}
+
+func TestUntrustedProxyHeaderIsRejectedBeforeAChallenge(t *testing.T) {
+	trusted, _ := parseAllowlist([]string{"10.0.0.0/8"})
+	v2 := append(append([]byte{}, proxyV2Signature...), 0x21, 0x11, 0, 12)
+	v2 = append(v2, 192, 0, 2, 1, 10, 0, 0, 1, 0x10, 0xe1, 0x1f, 0x90)
+
+	for name, header := range map[string][]byte{
+		"v1": []byte("PROXY TCP4 192.0.2.1 10.0.0.1 4321 8080\r\n"),
+		"v2": v2,
+	} {
+		recorder := &metricstest.Recorder{}
+		s := &Server{
+			recorder:        recorder,
+			db:              failingDB{},
+			queries:         generated.New(),
+			queryTimeout:    time.Second,
+			timeout:         5 * time.Second,
+			difficulty:      1,
+			algorithm:       "sha256",
+			helloWait:       time.Second,
+			proxyProtocol:   true,
+			trustedProxies:  trusted,
+			keyManager:      pow.NewStaticKeyManager(testSigningKey),
+			connLimiter:     newConnLimiter(0, nil),
+			behaviorTracker: behavior.NewTracker(failingDB{}),
+			quoteProvider:   wisdom.NewQuoteProvider(),
+		}
+
+		serverSide, clientSide := net.Pipe()
+		s.activeConns.Add(1)
+		go s.handleConnection(remoteConn{Conn: serverSide, remote: &net.TCPAddr{IP: net.IPv4(198, 51, 100, 9), Port: 40000}})
+
+		clientSide.SetDeadline(time.Now().Add(2 * time.Second))
+		clientSide.Write(header)
+		reply, err := bufio.NewReader(clientSide).ReadString('\n')
+		clientSide.Close()
+		s.activeConns.Wait()
+
+		if err != nil || reply != "Error: Solution rejected\n" {
+			t.Errorf("%s: expected the header to be rejected, got %q (%v)", name, reply, err)
+		}
+		if !recorder.Called("RecordConnection", "rejected_proxy_header") {
+			t.Errorf("%s: expected the rejection to be counted", name)
+		}
+		if calls := recorder.Calls("RecordChallengeIssued"); len(calls) != 0 {
+			t.Errorf("%s: expected no challenge to be issued, got %v", name, calls)
+		}
+	}
+}
+
+func TestFailureResponsesHideReasonUnlessVerbose(t *testing.T) {
+	reasons := []FailureReason{FailureExpired, FailureInvalidFormat, FailureInvalidPoW}
+
+	for _, reason := range reasons {
+		if got := failureResponse(reason, false); got != "Error: Solution rejected\n" {
+			t.Errorf("Terse response for %s leaks detail: %q", reason, got)
+		}
+		verbose := failureResponse(reason, true)
+		if !strings.HasPrefix(verbose, "Error: ") || !strings.Contains(verbose, "("+string(reason)+")") {
+			t.Errorf("Verbose response for %s should name the reason code, got %q", reason, verbose)
+		}
+	}
+
+	if _, err := parseFailureResponses("chatty"); err == nil {
+		t.Error("Expected an error for an unknown failure response mode")
+	}
+}
+
+func TestSurgeBoostRisesAndDecays(t *testing.T) {
+	recorder := &metricstest.Recorder{}
+	d := &surgeDetector{threshold: 10, recorder: recorder}
+	start := time.Now()
+
+	// A trickle of new clients stays below the threshold
+	for i := 0; i < 5; i++ {
+		if boost := d.observe(start.Add(time.Duration(i) * 12 * time.Second)); boost != 0 {
+			t.Fatalf("Expected no boost for 5 new clients/min, got %d", boost)
+		}
+	}
+
+	// A flood of fresh IPs, 200 in a minute
+	now := start.Add(time.Minute)
+	var boost int
+	for i := 0; i < 200; i++ {
+		now = now.Add(300 * time.Millisecond)
+		boost = d.observe(now)
+	}
+	if boost < 2 {
+		t.Errorf("Expected a boost of at least 2 during the surge, got %d", boost)
+	}
+	if !recorder.Called("UpdateSurge", d.rate.perMinute(now), boost) {
+		t.Errorf("Expected the surge gauges to be set to the final boost %d", boost)
+	}
+
+	// Decays back once the surge is over
+	if decayed, _ := d.boost(now.Add(10 * time.Minute)); decayed != 0 {
+		t.Errorf("Expected the boost to decay to 0, got %d", decayed)
+	}
+
+	disabled := &surgeDetector{}
+	if boost := disabled.observe(now); boost != 0 {
+		t.Errorf("A zero threshold must disable the detector, got boost %d", boost)
+	}
+}
+
+func TestSplitSolveReport(t *testing.T) {
+	const token = "0123456789abcdef0123456789abcdef"
+
+	line, report := splitSolveReport("12345 " + token + " attempts=12346 ms=420")
+	if line != "12345 "+token {
+		t.Errorf("Expected the report stripped from the line, got %q", line)
+	}
+	if report.attempts.Int32 != 12346 || !report.attempts.Valid || report.solveTimeMs.Int64 != 420 || !report.solveTimeMs.Valid {
+		t.Errorf("Expected attempts=12346 ms=420, got %+v", report)
+	}
+
+	// Reports are optional and untrusted, bad values are dropped rather than rejected
+	for _, raw := range []string{"12345", "12345 attempts=-3 ms=abc", "12345 attempts=99999999999 color=blue"} {
+		line, report := splitSolveReport(raw)
+		if line != "12345" || report.attempts.Valid || report.solveTimeMs.Valid {
+			t.Errorf("%q: expected nonce alone and no report, got %q %+v", raw, line, report)
+		}
+	}
+}
+
+func TestSolveTokenResendsEarnedQuoteOnce(t *testing.T) {
+	const token = "0123456789abcdef0123456789abcdef"
+
+	nonce, parsed, retry := parseSolutionLine("12345 " + token)
+	if nonce != "12345" || parsed != token || retry {
+		t.Fatalf("Expected nonce and token from a solution line, got %q %q retry=%v", nonce, parsed, retry)
+	}
+	if _, parsed, retry = parseSolutionLine("RETRY " + token); parsed != token || !retry {
+		t.Fatalf("Expected a retry for token %q, got %q retry=%v", token, parsed, retry)
+	}
+	if nonce, parsed, _ = parseSolutionLine("12345 not-a-token"); nonce != "12345 not-a-token" || parsed != "" {
+		t.Errorf("A malformed token must not be accepted, got nonce %q token %q", nonce, parsed)
+	}
+
+	tokens := &solveTokens{ttl: time.Minute}
+	client := netip.MustParseAddr("203.0.113.7")
+	now := time.Now()
+	tokens.remember(token, client, "quote", now)
+
+	if _, ok := tokens.redeem(token, netip.MustParseAddr("198.51.100.1"), now); ok {
+		t.Error("Token must only be redeemable from the IP that solved")
+	}
+	if quote, ok := tokens.redeem(token, client, now.Add(time.Second)); !ok || quote != "quote" {
+		t.Fatalf("Expected the earned quote, got %q ok=%v", quote, ok)
+	}
+	if _, ok := tokens.redeem(token, client, now.Add(time.Second)); ok {
+		t.Error("Token must only be redeemable once")
+	}
+
+	tokens.remember(token, client, "quote", now)
+	if _, ok := tokens.redeem(token, client, now.Add(2*time.Minute)); ok {
+		t.Error("Token must expire after its TTL")
+	}
+
+	disabled := &solveTokens{}
+	disabled.remember(token, client, "quote", now)
+	if _, ok := disabled.redeem(token, client, now); ok {
+		t.Error("A zero TTL must disable solve tokens")
+	}
+}
+
+func TestSolveTokensAreSweptAndCapped(t *testing.T) {
+	tokens := &solveTokens{ttl: time.Minute}
+	client := netip.MustParseAddr("203.0.113.7")
+	now := time.Now()
+
+	tokenFor := func(i int) string { return fmt.Sprintf("%032x", i) }
+	for i := 0; i < maxSolveTokens+10; i++ {
+		tokens.remember(tokenFor(i), client, "quote", now)
+	}
+	if n := len(tokens.completed); n != maxSolveTokens {
+		t.Fatalf("Expected %d remembered quotes at most, got %d", maxSolveTokens, n)
+	}
+	if _, ok := tokens.redeem(tokenFor(maxSolveTokens+9), client, now); !ok {
+		t.Error("Expected the latest quote to be kept when the cap is reached")
+	}
+
+	tokens.remember(tokenFor(0), client, "quote", now.Add(30*time.Second))
+	tokens.sweepExpired(now.Add(time.Minute))
+	if n := len(tokens.completed); n != 1 {
+		t.Fatalf("Expected only the unexpired quote to survive the sweep, got %d", n)
+	}
+	if _, ok := tokens.redeem(tokenFor(0), client, now.Add(time.Minute)); !ok {
+		t.Error("Expected the unexpired quote to stay redeemable after the sweep")
+	}
+}
+
+// newClientDB knows no client history and creates client rows with the requested difficulty
+type newClientDB struct{ failingDB }
+
+func (newClientDB) QueryRow(_ context.Context, sql string, args ...interface{}) pgx.Row {
+	if strings.Contains(sql, "INSERT INTO client_behaviors") {
+		return clientBehaviorRow{ip: args[0].(netip.Addr), difficulty: args[1].(pgtype.Int4)}
+	}
+	return errRow{err: pgx.ErrNoRows}
+}
+
+// clientBehaviorRow scans into the client_behaviors column order
+type clientBehaviorRow struct {
+	ip         netip.Addr
+	difficulty pgtype.Int4
+}
+
+func (r clientBehaviorRow) Scan(dest ...interface{}) error {
+	*dest[1].(*netip.Addr) = r.ip
+	*dest[2].(*pgtype.Int4) = pgtype.Int4{Int32: 1, Valid: true}
+	*dest[7].(*pgtype.Int4) = r.difficulty
+	return nil
+}
+
+func TestUnknownClientStartsAtInitialDifficulty(t *testing.T) {
+	tracker := behavior.NewTracker(newClientDB{})
+	tracker.SetInitialUnknownDifficulty(4)
+
+	cb, err := tracker.RecordConnection(context.Background(), netip.MustParseAddr("203.0.113.7"))
+	if err != nil {
+		t.Fatalf("Failed to record connection: %v", err)
+	}
+	if cb.Difficulty != 4 {
+		t.Errorf("Expected a brand-new IP to start at difficulty 4, got %d", cb.Difficulty)
+	}
+
+	tracker = behavior.NewTracker(newClientDB{})
+	cb, err = tracker.GetClientBehavior(context.Background(), netip.MustParseAddr("198.51.100.1"))
+	if err != nil {
+		t.Fatalf("Failed to get client behavior: %v", err)
+	}
+	if cb.Difficulty != behavior.DefaultInitialDifficulty {
+		t.Errorf("Expected the default initial difficulty %d, got %d", behavior.DefaultInitialDifficulty, cb.Difficulty)
+	}
+}
+
+// adaptiveDB holds one client at difficulty 1 whose failure and reconnect rates move it to 5
+type adaptiveDB struct{ failingDB }
+
+func (adaptiveDB) QueryRow(_ context.Context, sql string, args ...interface{}) pgx.Row {
+	switch {
+	case strings.Contains(sql, "calculate_adaptive_difficulty"):
+		return adaptiveRow{}
+	case strings.Contains(sql, "UPDATE client_behaviors"):
+		return clientBehaviorRow{ip: args[0].(netip.Addr), difficulty: pgtype.Int4{Int32: 1, Valid: true}}
+	}
+	return errRow{err: pgx.ErrNoRows}
+}
+
+// adaptiveRow is the new difficulty with the inputs calculate_adaptive_difficulty read
+type adaptiveRow struct{}
+
+func (adaptiveRow) Scan(dest ...interface{}) error {
+	*dest[0].(*pgtype.Int4) = pgtype.Int4{Int32: 5, Valid: true}
+	*dest[1].(*pgtype.Float8) = pgtype.Float8{Float64: 0.6, Valid: true}
+	*dest[2].(*pgtype.Int8) = pgtype.Int8{Int64: 5000, Valid: true}
+	*dest[3].(*pgtype.Float8) = pgtype.Float8{Float64: 0.9, Valid: true}
+	*dest[4].(*pgtype.Int4) = pgtype.Int4{Int32: 4, Valid: true}
+	*dest[5].(*pgtype.Float8) = pgtype.Float8{Float64: 50, Valid: true}
+	return nil
+}
+
+func TestDifficultyDecisionExplainsEveryLevel(t *testing.T) {
+	tracker := behavior.NewTracker(adaptiveDB{})
+	cb, err := tracker.RecordConnection(context.Background(), netip.MustParseAddr("203.0.113.7"))
+	if err != nil {
+		t.Fatalf("Failed to record connection: %v", err)
+	}
+
+	decision := cb.Decision
+	if decision.Previous != 1 || decision.Difficulty != 5 || cb.Difficulty != 5 {
+		t.Fatalf("Expected a decision from 1 to 5, got %+v", decision)
+	}
+	if got, want := decision.String(), "failure_rate=0.6 (+2), reconnect_rate=0.9 (+2)"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	// Server-side adjustments extend a copy, the tracker's decision is left alone
+	floored := decision.Adjust("min_difficulty", 6, 6)
+	total := floored.Previous
+	for _, f := range floored.Factors {
+		total += f.Effect
+	}
+	if total != 6 || floored.Difficulty != 6 || len(floored.Factors) != 3 {
+		t.Errorf("Expected the floor to add the missing level, got %+v", floored)
+	}
+	if len(cb.Decision.Factors) != 2 {
+		t.Errorf("Adjust modified the original decision: %+v", cb.Decision)
+	}
+}
+
+func TestBehaviorFallbackWhenDatabaseIsDown(t *testing.T) {
+	tracker := behavior.NewTracker(failingDB{})
+	tracker.SetFallbackDifficulty(func() int { return 3 })
+	ip := netip.MustParseAddr("203.0.113.7")
+
+	for name, lookup := range map[string]func() (*behavior.ClientBehavior, error){
+		"GetClientBehavior": func() (*behavior.ClientBehavior, error) { return tracker.GetClientBehavior(context.Background(), ip) },
+		"RecordConnection":  func() (*behavior.ClientBehavior, error) { return tracker.RecordConnection(context.Background(), ip) },
+	} {
+		cb, err := lookup()
+		if err == nil {
+			t.Errorf("%s: expected the database error to be reported", name)
+		}
+		if cb == nil || !cb.Fallback {
+			t.Fatalf("%s: expected a fallback behavior, got %+v", name, cb)
+		}
+		if cb.Difficulty != 3 || cb.ReputationScore != behavior.NeutralReputation {
+			t.Errorf("%s: expected global difficulty 3 and neutral reputation, got %d and %.1f", name, cb.Difficulty, cb.ReputationScore)
+		}
+	}
+}
+
+// testSigningKey signs the challenges of servers built by newTestServer
+var testSigningKey = []byte("test-signing-key-0123456789abcdef")
+
+// testServerOptions are the settings tests vary between servers built by newTestServer
+type testServerOptions struct {
+	listener  net.Listener        // nil for servers handed connections directly
+	format    pow.ChallengeFormat // Framed challenge format, JSON when empty
+	helloWait time.Duration
+	pool      *connPool // nil serves every connection in its own goroutine
+}
+
+// newTestServer serves SHA-256 difficulty 1 challenges signed with testSigningKey while
+// the database is down
+func newTestServer(t testing.TB, opts testServerOptions) *Server {
+	t.Helper()
+	format := opts.format
+	if format == "" {
+		format = pow.FormatJSON
+	}
+	tracker := behavior.NewTracker(failingDB{})
+	s := &Server{
+		recorder:         &metricstest.Recorder{},
+		listener:         opts.listener,
+		db:               failingDB{},
+		queries:          generated.New(),
+		queryTimeout:     time.Second,
+		timeout:          5 * time.Second,
+		difficulty:       1,
+		algorithm:        "sha256",
+		challengeFormat:  format,
+		challengeEncoder: pow.NewChallengeEncoder(format),
+		helloWait:        opts.helloWait,
+		keyManager:       pow.NewStaticKeyManager(testSigningKey),
+		redeemed:         pow.NewMemoryNonceStore(),
+		connLimiter:      newConnLimiter(0, nil),
+		behaviorTracker:  tracker,
+		quoteProvider:    wisdom.NewQuoteProvider(),
+		shutdownChan:     make(chan struct{}),
+		workerPool:       opts.pool,
+	}
+	tracker.SetFallbackDifficulty(s.getDifficulty)
+	return s
+}
+
+func TestConnectionIsServedWhileDatabaseIsDown(t *testing.T) {
+	s := newTestServer(t, testServerOptions{})
+	s.redeemed = pow.NewDBNonceStore(failingDB{}, time.Second)
+
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	s.activeConns.Add(1)
+	go s.handleConnection(remoteConn{Conn: serverSide, remote: &net.TCPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 40000}})
+
+	clientSide.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(clientSide)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+	challenge, err := s.challengeEncoder.Decode(line[:len(line)-1], pow.FormatJSON, "")
+	if err != nil {
+		t.Fatalf("Failed to decode challenge: %v", err)
+	}
+	if challenge.Difficulty != 1 {
+		t.Errorf("Expected the global difficulty 1 while tracking is down, got %d", challenge.Difficulty)
+	}
+
+	nonce, err := pow.SolveChallenge(&pow.Challenge{Seed: challenge.Seed, Difficulty: challenge.Difficulty})
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+	clientSide.Write([]byte(nonce + "\n"))
+
+	quote, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read quote: %v", err)
+	}
+	if strings.HasPrefix(quote, "Error:") {
+		t.Errorf("Expected a quote, got %q", quote)
+	}
+	s.activeConns.Wait()
+}
+
+func TestLegacyAndFramedClientsShareOneServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := newTestServer(t, testServerOptions{listener: listener, format: pow.FormatBinary, helloWait: 50 * time.Millisecond})
+	go s.Start()
+	defer s.Shutdown()
+
+	// A legacy client never speaks first and reads a newline-delimited JSON challenge
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("Legacy client failed to read challenge: %v", err)
+	}
+	challenge, err := s.challengeEncoder.Decode(line[:len(line)-1], pow.FormatJSON, "")
+	if err != nil {
+		t.Fatalf("Legacy client got a challenge that isn't JSON: %v", err)
+	}
+	nonce, err := pow.SolveChallenge(&pow.Challenge{Seed: challenge.Seed, Difficulty: challenge.Difficulty})
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+	conn.Write([]byte(nonce + "\n"))
+	if quote, err := reader.ReadString('\n'); err != nil || strings.HasPrefix(quote, "Error:") {
+		t.Errorf("Legacy client expected a quote, got %q (%v)", quote, err)
+	}
+
+	// The bundled client sends the framed hello and reads a length-prefixed binary challenge
+	framed := client.NewClient(listener.Addr().String(), 5*time.Second)
+	framed.SetRetryConfig(0, 0)
+	if _, err := framed.RequestQuote(); err != nil {
+		t.Errorf("Framed client failed to get a quote: %v", err)
+	}
+}
+
+// quoteRelay forwards connections to addr and passes the quote and signature lines the
+// server answers with through edit, the way a party on the path could alter them
+func quoteRelay(t *testing.T, addr string, edit func(quote, sig string) string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				upstream, err := net.Dial("tcp", addr)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go io.Copy(upstream, conn)
+
+				reader := bufio.NewReader(upstream)
+				data, format, err := pow.ReadFrame(reader)
+				if err != nil {
+					return
+				}
+				conn.Write(pow.EncodeFrame(data, format))
+				quote, _ := reader.ReadString('\n')
+				sig, _ := reader.ReadString('\n')
+				conn.Write([]byte(edit(quote, sig)))
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestClientVerifiesSignedQuotes(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := newTestServer(t, testServerOptions{listener: listener, format: pow.FormatBinary, helloWait: 50 * time.Millisecond})
+	s.signQuotes = true
+	go s.Start()
+	defer s.Shutdown()
+
+	request := func(addr string) (string, error) {
+		c := client.NewClient(addr, 5*time.Second)
+		c.SetRetryConfig(0, 0)
+		c.SetQuoteVerification(pow.NewStaticKeyManager(testSigningKey))
+		return c.RequestQuote()
+	}
+
+	quote, err := request(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Expected the signed quote to verify, got %v", err)
+	}
+	if quote == "" || strings.HasPrefix(quote, pow.QuoteSignaturePrefix) {
+		t.Errorf("Expected the quote without its signature, got %q", quote)
+	}
+
+	tampered := quoteRelay(t, listener.Addr().String(), func(quote, sig string) string {
+		return "Tampered: " + quote + sig
+	})
+	if _, err := request(tampered); err == nil || !strings.Contains(err.Error(), "rejected quote") {
+		t.Errorf("Expected the altered quote to be rejected, got %v", err)
+	}
+
+	unsigned := quoteRelay(t, listener.Addr().String(), func(quote, sig string) string {
+		return quote
+	})
+	if _, err := request(unsigned); err == nil || !strings.Contains(err.Error(), "without a signature") {
+		t.Errorf("Expected the unsigned quote to be rejected, got %v", err)
+	}
+}
+
+// BenchmarkAcceptThroughput dials short-lived connections at one listener and at four
+// SO_REUSEPORT listeners on the same port, each drained by its own accept loop
+func BenchmarkAcceptThroughput(b *testing.B) {
+	cases := []struct {
+		name string
+		opts listenOptions
+	}{
+		{"single", listenOptions{backlog: 4096}},
+		{"reuseport-4", listenOptions{backlog: 4096, reusePort: true, listeners: 4}},
+	}
+
+	for _, tc := range cases {
+		b.Run(tc.name, func(b *testing.B) {
+			listeners, err := listen("127.0.0.1:0", tc.opts)
+			if err != nil {
+				b.Skipf("listen: %v", err)
+			}
+			for _, l := range listeners {
+				go func(l net.Listener) {
+					for {
+						conn, err := l.Accept()
+						if err != nil {
+							return
+						}
+						conn.Close()
+					}
+				}(l)
+			}
+			defer func() {
+				for _, l := range listeners {
+					l.Close()
+				}
+			}()
+
+			addr := listeners[0].Addr().String()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					conn, err := net.Dial("tcp", addr)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					conn.Close()
+				}
+			})
+		})
+	}
+}
+
+// solveOnce reads the first line from conn and, unless it was turned away as busy, solves
+// the challenge and reads the quote
+func solveOnce(conn net.Conn, encoder *pow.ChallengeEncoder) (shed bool, err error) {
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return false, err
+	}
+	if strings.HasPrefix(string(line), busyPrefix) {
+		return true, nil
+	}
+	challenge, err := encoder.Decode(line[:len(line)-1], pow.FormatJSON, "")
+	if err != nil {
+		return false, err
+	}
+	nonce, err := pow.SolveChallenge(&pow.Challenge{Seed: challenge.Seed, Difficulty: challenge.Difficulty})
+	if err != nil {
+		return false, err
+	}
+	conn.Write([]byte(nonce + "\n"))
+	_, err = reader.ReadString('\n')
+	return false, err
+}
+
+func TestWorkerPoolShedsWhenQueueIsFull(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := newTestServer(t, testServerOptions{listener: listener, pool: newConnPool(1, 1)})
+	go s.Start()
+	defer s.Shutdown()
+
+	dial := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		return conn, bufio.NewReader(conn)
+	}
+
+	// The only worker waits for the first client's solution, the second client is queued
+	first, firstReader := dial()
+	defer first.Close()
+	challengeLine, err := firstReader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("First client failed to read its challenge: %v", err)
+	}
+	queued, queuedReader := dial()
+	defer queued.Close()
+
+	// With the queue full the third client is turned away at once
+	shed, shedReader := dial()
+	defer shed.Close()
+	if line, err := shedReader.ReadString('\n'); err != nil || line != busyLine(s.busyRetryAfter) {
+		t.Fatalf("Expected the busy line, got %q (%v)", line, err)
+	}
+
+	// Once the worker is free the queued client is served
+	challenge, err := s.challengeEncoder.Decode(challengeLine[:len(challengeLine)-1], pow.FormatJSON, "")
+	if err != nil {
+		t.Fatalf("Failed to decode challenge: %v", err)
+	}
+	nonce, err := pow.SolveChallenge(&pow.Challenge{Seed: challenge.Seed, Difficulty: challenge.Difficulty})
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+	first.Write([]byte(nonce + "\n"))
+	if _, err := firstReader.ReadString('\n'); err != nil {
+		t.Fatalf("First client failed to read its quote: %v", err)
+	}
+	if line, err := queuedReader.ReadString('\n'); err != nil || strings.HasPrefix(line, busyPrefix) {
+		t.Errorf("Expected the queued client to get a challenge, got %q (%v)", line, err)
+	}
+}
+
+func TestBusyLineRoundsRetryAfterUp(t *testing.T) {
+	for _, tc := range []struct {
+		retryAfter time.Duration
+		want       string
+	}{
+		{0, "BUSY retry-after=1\n"},
+		{1500 * time.Millisecond, "BUSY retry-after=2\n"},
+		{5 * time.Second, "BUSY retry-after=5\n"},
+	} {
+		if got := busyLine(tc.retryAfter); got != tc.want {
+			t.Errorf("busyLine(%v) = %q, want %q", tc.retryAfter, got, tc.want)
+		}
+	}
+}
+
+func TestClientWaitsOutBusyRetryAfter(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	// Every connection is shed with a one second retry hint
+	var attempts []time.Time
+	var mu sync.Mutex
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			attempts = append(attempts, time.Now())
+			mu.Unlock()
+			conn.Write([]byte(busyLine(time.Second)))
+			conn.Close()
+		}
+	}()
+
+	c := client.NewClient(listener.Addr().String(), 5*time.Second)
+	c.SetRetryConfig(1, 10*time.Millisecond)
+	if _, err := c.RequestQuote(); err == nil || !strings.Contains(err.Error(), "server busy") {
+		t.Fatalf("Expected a busy error, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) != 2 {
+		t.Fatalf("Expected 2 attempts, got %d", len(attempts))
+	}
+	if gap := attempts[1].Sub(attempts[0]); gap < time.Second {
+		t.Errorf("Expected the retry to wait the 1s retry-after, it came after %v", gap)
+	}
+}
+
+// gatedKeyManager blocks GetKeys until release is closed
+type gatedKeyManager struct {
+	*pow.StaticKeyManager
+	release chan struct{}
+}
+
+func (km gatedKeyManager) GetKeys() (current, previous []byte) {
+	<-km.release
+	return km.StaticKeyManager.GetKeys()
+}
+
+func TestNotReadyUntilWarmupFinishes(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	keys := gatedKeyManager{
+		StaticKeyManager: pow.NewStaticKeyManager(testSigningKey),
+		release:          make(chan struct{}),
+	}
+	s := newTestServer(t, testServerOptions{listener: listener})
+	s.keyManager = keys
+	s.warmupChallenges = 2
+	go s.Start()
+	defer s.Shutdown()
+
+	readyz := func() int {
+		rec := httptest.NewRecorder()
+		metrics.ReadyHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+
+	// Warm-up is stuck loading keys
+	time.Sleep(50 * time.Millisecond)
+	if s.Ready() || readyz() != http.StatusServiceUnavailable {
+		t.Fatal("Expected the server not to be ready during warm-up")
+	}
+
+	close(keys.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("Server never became ready after warm-up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("Expected /readyz to answer 200 after warm-up, got %d", code)
+	}
+}
+
+func TestDifficultyHintWithinBounds(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := newTestServer(t, testServerOptions{listener: listener})
+	s.difficulty = 2
+	s.helloWait = time.Second
+	go s.Start()
+	defer s.Shutdown()
+
+	// hinted sends the hello with options and returns any line ahead of the challenge
+	// frame, along with the difficulty of the challenge
+	hinted := func(options string) (string, int) {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		conn.Write([]byte("FRAMED " + options + "\n"))
+
+		reader := bufio.NewReader(conn)
+		var notice string
+		if first, err := reader.Peek(1); err == nil && !pow.IsFrameStart(first[0]) {
+			notice, _ = reader.ReadString('\n')
+		}
+		data, _, err := pow.ReadFrame(reader)
+		if err != nil {
+			t.Fatalf("Failed to read challenge frame after %q: %v", options, err)
+		}
+		challenge, err := s.challengeEncoder.Decode(data, pow.FormatJSON, "")
+		if err != nil {
+			t.Fatalf("Failed to decode challenge: %v", err)
+		}
+		return notice, challenge.Difficulty
+	}
+
+	for _, tc := range []struct {
+		options    string
+		notice     string
+		difficulty int
+	}{
+		{"difficulty=4", "", 4},
+		{"difficulty=2", "", 2},
+		{"compress=zstd difficulty=3", "", 3},
+		{"difficulty=1", "HINT rejected difficulty=2\n", 2},
+		{"difficulty=7", "HINT rejected difficulty=2\n", 2},
+		{"difficulty=hard", "", 2},
+	} {
+		notice, difficulty := hinted(tc.options)
+		if notice != tc.notice || difficulty != tc.difficulty {
+			t.Errorf("Hello %q: got notice %q and difficulty %d, want %q and %d", tc.options, notice, difficulty, tc.notice, tc.difficulty)
+		}
+	}
+
+	// The bundled client skips the rejection and solves at the enforced difficulty
+	c := client.NewClient(listener.Addr().String(), 5*time.Second)
+	c.SetRetryConfig(0, 0)
+	c.SetDifficultyHint(1)
+	if _, err := c.RequestQuote(); err != nil {
+		t.Errorf("Client with a rejected hint failed to get a quote: %v", err)
+	}
+}
+
+// lockedBuffer collects log output written from connection goroutines
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestConnectionSummaryLoggedOnDisconnect(t *testing.T) {
+	var logs lockedBuffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := newTestServer(t, testServerOptions{listener: listener})
+	go s.Start()
+	defer s.Shutdown()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := solveOnce(conn, s.challengeEncoder); err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	conn.Close()
+
+	// The summary is the last thing the handler writes
+	var line string
+	deadline := time.Now().Add(5 * time.Second)
+	for line == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("No connection summary was logged")
+		}
+		time.Sleep(10 * time.Millisecond)
+		if _, after, ok := strings.Cut(logs.String(), "Connection summary: "); ok {
+			line, _, _ = strings.Cut(after, "\n")
+		}
+	}
+
+	var summary map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &summary); err != nil {
+		t.Fatalf("Summary is not JSON: %v (%s)", err, line)
+	}
+	if summary["outcome"] != outcomeSolved || summary["final_state"] != string(stateRespond) {
+		t.Errorf("Expected a solved session ending in respond, got %v", summary)
+	}
+	if summary["challenges_attempted"] != 1.0 || summary["challenges_solved"] != 1.0 || summary["difficulty"] != 1.0 {
+		t.Errorf("Expected one solved challenge at difficulty 1, got %v", summary)
+	}
+	if sent, _ := summary["bytes_sent"].(float64); sent == 0 {
+		t.Errorf("Expected the bytes sent to be counted, got %v", summary["bytes_sent"])
+	}
+}
+
+func TestAlgorithmPolicyPicksAlgorithmByDifficulty(t *testing.T) {
+	policy, err := parseAlgorithmPolicy("1-3:sha256, 4-6:argon2")
+	if err != nil {
+		t.Fatalf("parseAlgorithmPolicy failed: %v", err)
+	}
+	s := &Server{algorithm: "argon2", algorithmPolicy: policy}
+	for difficulty, want := range map[int]string{1: "sha256", 3: "sha256", 4: "argon2", 6: "argon2"} {
+		if algorithm, _ := s.selectAlgorithm(difficulty); algorithm != want {
+			t.Errorf("Difficulty %d got %s, want %s", difficulty, algorithm, want)
+		}
+	}
+
+	// Difficulties the policy leaves out, and every difficulty without one, use the default
+	partial, _ := parseAlgorithmPolicy("5-6:argon2")
+	s = &Server{algorithm: "sha256", algorithmPolicy: partial}
+	if algorithm, _ := s.selectAlgorithm(2); algorithm != "sha256" {
+		t.Errorf("Expected the default algorithm below the policy, got %s", algorithm)
+	}
+	if !s.issuesArgon2() {
+		t.Error("Expected a policy naming argon2 to need Argon2 memory")
+	}
+	if (&Server{algorithm: "sha256"}).issuesArgon2() {
+		t.Error("Expected a SHA-256 server without a policy not to need Argon2 memory")
+	}
+
+	for _, bad := range []string{"1-3", "1-3:scrypt", "0-2:sha256", "4-7:argon2", "3-1:sha256", "1-3:sha256,3-4:argon2"} {
+		if _, err := parseAlgorithmPolicy(bad); err == nil {
+			t.Errorf("Expected policy %q to be rejected", bad)
+		}
+	}
+}
+
+func TestClientDeclinesChallengeAboveItsMaximum(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := newTestServer(t, testServerOptions{listener: listener})
+	s.helloWait = time.Second
+	go s.Start()
+	defer s.Shutdown()
+
+	c := client.NewClient(listener.Addr().String(), 5*time.Second)
+	c.SetRetryConfig(3, 0)
+	if _, err := c.RequestQuote(); err != nil {
+		t.Fatalf("Client failed to get a quote: %v", err)
+	}
+
+	// Escalated past what the client is willing to spend, it backs off without retrying
+	s.SetDifficulty(3)
+	c.SetMaxAcceptableDifficulty(2)
+	if _, err := c.RequestQuote(); !errors.Is(err, client.ErrChallengeDeclined) {
+		t.Fatalf("Expected the challenge to be declined, got %v", err)
+	}
+
+	var previewed client.ChallengePreview
+	c.SetMaxAcceptableDifficulty(0)
+	c.SetPreviewHandler(func(p client.ChallengePreview) bool {
+		previewed = p
+		return false
+	})
+	if _, err := c.RequestQuote(); !errors.Is(err, client.ErrChallengeDeclined) {
+		t.Fatalf("Expected the preview handler to decline, got %v", err)
+	}
+	if previewed.Algorithm != "sha256" || previewed.Difficulty != 3 || previewed.EstimatedSolveTime <= 0 {
+		t.Errorf("Unexpected preview %+v", previewed)
+	}
+
+	stats := c.GetStats()
+	if stats.TotalRequests != 3 || stats.SuccessfulRequests != 1 || stats.DeclinedRequests != 2 || stats.FailedRequests != 0 {
+		t.Errorf("Expected declines counted apart from failures, got %+v", stats)
+	}
+}
+
+// BenchmarkConnectionFlood runs full exchanges from many concurrent clients against a
+// goroutine per connection and against a small worker pool, reporting the share of
+// connections the pool turned away
+func BenchmarkConnectionFlood(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	cases := []struct {
+		name string
+		pool func() *connPool
+	}{
+		{"goroutine-per-conn", func() *connPool { return nil }},
+		{"pool-4-queue-4", func() *connPool { return newConnPool(4, 4) }},
+	}
+
+	for _, tc := range cases {
+		b.Run(tc.name, func(b *testing.B) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				b.Fatalf("Failed to listen: %v", err)
+			}
+			s := newTestServer(b, testServerOptions{listener: listener, pool: tc.pool()})
+			go s.Start()
+			defer s.Shutdown()
+
+			var shed atomic.Int64
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					conn, err := net.Dial("tcp", listener.Addr().String())
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					conn.SetDeadline(time.Now().Add(10 * time.Second))
+					wasShed, err := solveOnce(conn, s.challengeEncoder)
+					conn.Close()
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					if wasShed {
+						shed.Add(1)
+					}
+				}
+			})
+			b.ReportMetric(float64(shed.Load())/float64(b.N), "shed/op")
+		})
+	}
+}
+
+func TestSolutionsAtOrAboveRequiredDifficultyAreAccepted(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	challenge, err := pow.GenerateSecureChallengeWithKeyManager(2, "sha256", "test-client", pow.NewStaticKeyManager(key))
+	if err != nil {
+		t.Fatalf("Failed to generate challenge: %v", err)
+	}
+
+	// Find one nonce for each number of leading zeros around the required two
+	nonces := make(map[int]string)
+	for n := 0; len(nonces) < 3 && n < 10000000; n++ {
+		nonce := strconv.Itoa(n)
+		hash, _ := pow.SolutionHash(challenge, nonce)
+		achieved := min(pow.AchievedDifficulty(hash), 3)
+		if _, found := nonces[achieved]; !found && achieved >= 1 {
+			nonces[achieved] = nonce
+		}
+	}
+
+	for achieved, want := range map[int]bool{1: false, 2: true, 3: true} {
+		nonce, found := nonces[achieved]
+		if !found {
+			t.Fatalf("No nonce found achieving difficulty %d", achieved)
+		}
+		if _, got := verifySolution(challenge, nonce); got != want {
+			t.Errorf("verifySolution with %d leading zeros for difficulty 2 = %v, want %v", achieved, got, want)
+		}
+	}
+}
+
+func TestArgon2SolutionIsHashedOnceAndKept(t *testing.T) {
+	challenge := &pow.SecureChallenge{
+		Seed:         "argon2-seed",
+		Difficulty:   1,
+		Algorithm:    "argon2",
+		Argon2Params: &pow.Argon2Params{Time: 1, Memory: 8, Threads: 1, KeyLength: 32},
+	}
+	argon2Challenge := &pow.Argon2Challenge{Seed: challenge.Seed, Difficulty: 1, Time: 1, Memory: 8, Threads: 1, KeyLen: 32}
+
+	for n := 0; n < 64; n++ {
+		nonce := strconv.Itoa(n)
+		hash, ok := verifySolution(challenge, nonce)
+		if want := pow.VerifyArgon2PoW(argon2Challenge, nonce); ok != want {
+			t.Fatalf("verifySolution(%s) = %v, VerifyArgon2PoW says %v", nonce, ok, want)
+		}
+		if expected, _ := pow.SolutionHash(challenge, nonce); hash != expected {
+			t.Fatalf("Expected the verified hash to be kept for the solutions table, got %q", hash)
+		}
+	}
+}
+
+func TestChallengeRedeemedElsewhereIsRejected(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := newTestServer(t, testServerOptions{listener: listener})
+	s.verboseFailures = true
+	go s.Start()
+	defer s.Shutdown()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+	challenge, err := s.challengeEncoder.Decode(line[:len(line)-1], pow.FormatJSON, "")
+	if err != nil {
+		t.Fatalf("Failed to decode challenge: %v", err)
+	}
+
+	// The same solution already earned a quote over HTTP, which shares the store
+	if !s.redeemed.Redeem(context.Background(), challenge) {
+		t.Fatal("Expected the first redemption to succeed")
+	}
+
+	nonce, err := pow.SolveChallenge(&pow.Challenge{Seed: challenge.Seed, Difficulty: challenge.Difficulty})
+	if err != nil {
+		t.Fatalf("Failed to solve: %v", err)
+	}
+	conn.Write([]byte(nonce + "\n"))
+	response, _ := reader.ReadString('\n')
+	if want := failureResponse(FailureReplayed, true); response != want {
+		t.Errorf("Expected %q for a replayed solution, got %q", want, response)
+	}
+}
+
+func TestFailedSolveRecordsPuzzleFailedMetric(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := newTestServer(t, testServerOptions{listener: listener})
+	recorder := s.recorder.(*metricstest.Recorder)
+	go s.Start()
+	defer s.Shutdown()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+	challenge, err := s.challengeEncoder.Decode(line[:len(line)-1], pow.FormatJSON, "")
+	if err != nil {
+		t.Fatalf("Failed to decode challenge: %v", err)
+	}
+
+	// Any nonce whose hash misses the leading zero
+	nonce := 0
+	for pow.VerifySHA256Solution(challenge, strconv.Itoa(nonce)) {
+		nonce++
+	}
+	conn.Write([]byte(strconv.Itoa(nonce) + "\n"))
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+
+	if !recorder.Called("RecordPuzzleFailed", 1, "sha256") {
+		t.Errorf("Expected a failed difficulty 1 sha256 puzzle, got %v", recorder.Calls(""))
+	}
+	if len(recorder.Calls("RecordPuzzleSolved")) != 0 {
+		t.Error("Expected no solved puzzle to be recorded")
+	}
+	if !recorder.Called("RecordConnection", "accepted") {
+		t.Error("Expected the accepted connection to be recorded")
+	}
+}
+
+func TestAdminDifficultyRoutes(t *testing.T) {
+	recorder := &metricstest.Recorder{}
+	s := &Server{
+		difficulty:    2,
+		minDifficulty: 1,
+		recorder:      recorder,
+		adminToken:    "admin-secret",
+	}
+	mux := http.NewServeMux()
+	s.registerAdminRoutes(mux)
+
+	put := func(body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/difficulty", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := put(`{"difficulty":4}`, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without the admin token, got %d", rec.Code)
+	}
+	if rec := put(`{"difficulty":4}`, "admin-secret"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 setting difficulty 4, got %d: %s", rec.Code, rec.Body)
+	}
+	if s.getDifficulty() != 4 || !recorder.Called("UpdateCurrentDifficulty", 4) {
+		t.Errorf("Expected difficulty 4 applied and recorded, got %d", s.getDifficulty())
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/difficulty", nil))
+	var got difficultyUpdate
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Difficulty != 4 {
+		t.Errorf("Expected GET /difficulty to report 4, got %q (%v)", rec.Body, err)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var stats map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil || stats["difficulty"] != float64(4) {
+		t.Errorf("Expected GET /stats to include difficulty 4, got %q (%v)", rec.Body, err)
+	}
+}
+
+func TestAdminDifficultyRejectsOutOfRange(t *testing.T) {
+	s := &Server{difficulty: 2, minDifficulty: 1, recorder: &metricstest.Recorder{}}
+	mux := http.NewServeMux()
+	s.registerAdminRoutes(mux)
+
+	for _, body := range []string{`{"difficulty":0}`, `{"difficulty":7}`, `{"difficulty":"high"}`} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/difficulty", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, rec.Code)
+		}
+	}
+	if s.getDifficulty() != 2 {
+		t.Errorf("Expected rejected updates to keep difficulty 2, got %d", s.getDifficulty())
+	}
+}
+
+// challengeStatusDB records the statuses challenges are updated to, every other query fails
+type challengeStatusDB struct {
+	failingDB
+	mu       sync.Mutex
+	statuses []generated.ChallengeStatus
+}
+
+func (d *challengeStatusDB) QueryRow(_ context.Context, sql string, args ...interface{}) pgx.Row {
+	if strings.Contains(sql, "UPDATE challenges") {
+		d.mu.Lock()
+		d.statuses = append(d.statuses, args[0].(generated.ChallengeStatus))
+		d.mu.Unlock()
+	}
+	return errRow{err: pgx.ErrNoRows}
+}
+
+func TestValidSolutionAfterExpiryIsRejectedAsExpired(t *testing.T) {
+	skew := pow.ClockSkew()
+	pow.SetClockSkew(0)
+	t.Cleanup(func() { pow.SetClockSkew(skew) })
+
+	for _, verbose := range []bool{false, true} {
+		db := &challengeStatusDB{}
+		recorder := &metricstest.Recorder{}
+		tracker := behavior.NewTracker(failingDB{})
+		s := &Server{
+			recorder:        recorder,
+			db:              db,
+			queries:         generated.New(),
+			queryTimeout:    time.Second,
+			timeout:         5 * time.Second,
+			behaviorTracker: tracker,
+			verboseFailures: verbose,
+		}
+
+		// Valid for 30ms, solved right away but only submitted once it has expired
+		challenge := &pow.SecureChallenge{
+			Version:    1,
+			Seed:       "late-seed-" + strconv.FormatBool(verbose),
+			Difficulty: 1,
+			Algorithm:  "sha256",
+			ExpiresAt:  time.Now().Add(30 * time.Millisecond).UnixMicro(),
+		}
+		nonce, err := pow.SolveChallenge(&pow.Challenge{Seed: challenge.Seed, Difficulty: 1})
+		if err != nil {
+			t.Fatalf("Failed to solve challenge: %v", err)
+		}
+
+		serverSide, clientSide := net.Pipe()
+		counted := &countingConn{Conn: serverSide}
+		sess := &session{
+			conn:            counted,
+			reader:          bufio.NewReader(counted),
+			ctx:             context.Background(),
+			startTime:       time.Now(),
+			clientAddr:      "203.0.113.7:40000",
+			remoteAddr:      netip.MustParseAddr("203.0.113.7"),
+			format:          pow.FormatJSON,
+			challenge:       challenge,
+			difficulty:      1,
+			algorithm:       "sha256",
+			challengeRecord: generated.Challenge{ID: pgtype.UUID{Bytes: [16]byte{1}, Valid: true}},
+		}
+
+		responses := make(chan string, 1)
+		go func() {
+			line, _ := bufio.NewReader(clientSide).ReadString('\n')
+			responses <- line
+		}()
+
+		// awaitSolution caps its read deadline at the expiry, a line that still arrives
+		// late is checked here, after the deadline has passed but before it is verified
+		time.Sleep(60 * time.Millisecond)
+		sess.response = nonce
+		if next := s.respond(sess); next != stateDone {
+			t.Errorf("verbose=%v: expected the protocol to end, got state %v", verbose, next)
+		}
+		serverSide.Close()
+		clientSide.Close()
+
+		want := "Error: Solution rejected\n"
+		if verbose {
+			want = "Error: Challenge expired, reconnect (expired)\n"
+		}
+		if got := <-responses; got != want {
+			t.Errorf("verbose=%v: expected %q, got %q", verbose, want, got)
+		}
+		if sess.outcome != string(FailureExpired) {
+			t.Errorf("verbose=%v: expected the expired outcome, got %q", verbose, sess.outcome)
+		}
+		if len(db.statuses) != 1 || db.statuses[0] != generated.ChallengeStatusExpired {
+			t.Errorf("verbose=%v: expected the challenge marked expired, got %v", verbose, db.statuses)
+		}
+		if !recorder.Called("RecordPuzzleExpired", 1, "sha256") {
+			t.Errorf("verbose=%v: expected RecordPuzzleExpired(1, sha256)", verbose)
+		}
+		if recorder.Called("RecordPuzzleSolved", 1, "sha256") {
+			t.Errorf("verbose=%v: expected no solve recorded", verbose)
+		}
+		if sess.solutionHash != "" {
+			t.Errorf("verbose=%v: expected an expired solution not to be hashed", verbose)
+		}
+	}
+}
+
+// aggregateDB answers the behavior summary and per-difficulty aggregates with fixed rows
+type aggregateDB struct {
+	failingDB
+	summary      generated.GetActiveClientSummaryRow
+	byDifficulty []generated.GetActiveClientsByDifficultyRow
+}
+
+func (d aggregateDB) QueryRow(_ context.Context, sql string, _ ...interface{}) pgx.Row {
+	if strings.Contains(sql, "GetActiveClientSummary") {
+		return summaryRow{d.summary}
+	}
+	return errRow{err: errDatabaseDown}
+}
+
+func (d aggregateDB) Query(_ context.Context, sql string, _ ...interface{}) (pgx.Rows, error) {
+	if strings.Contains(sql, "GetActiveClientsByDifficulty") {
+		return &difficultyRows{rows: d.byDifficulty}, nil
+	}
+	return nil, errDatabaseDown
+}
+
+type summaryRow struct {
+	row generated.GetActiveClientSummaryRow
+}
+
+func (r summaryRow) Scan(dest ...interface{}) error {
+	*dest[0].(*int64) = r.row.TotalClients
+	*dest[1].(*int64) = r.row.NormalClients
+	*dest[2].(*int64) = r.row.PowerUsers
+	*dest[3].(*int64) = r.row.SuspiciousClients
+	*dest[4].(*int64) = r.row.Attackers
+	*dest[5].(*int64) = r.row.FalsePositives
+	*dest[6].(*int64) = r.row.NewClientsLastMinute
+	*dest[7].(*float64) = r.row.AvgDifficulty
+	*dest[8].(*float64) = r.row.AvgNormalSolveTimeMs
+	*dest[9].(*float64) = r.row.AvgReputation
+	*dest[10].(*float64) = r.row.AvgSuspiciousScore
+	return nil
+}
+
+type difficultyRows struct {
+	pgx.Rows
+	rows []generated.GetActiveClientsByDifficultyRow
+	next int
+}
+
+func (r *difficultyRows) Next() bool {
+	r.next++
+	return r.next <= len(r.rows)
+}
+
+func (r *difficultyRows) Scan(dest ...interface{}) error {
+	row := r.rows[r.next-1]
+	*dest[0].(*pgtype.Int4) = row.Difficulty
+	*dest[1].(*int64) = row.Clients
+	*dest[2].(*float64) = row.AvgSolveTimeMs
+	*dest[3].(*float64) = row.AvgFailureRate
+	return nil
+}
+
+func (r *difficultyRows) Err() error { return nil }
+func (r *difficultyRows) Close()     {}
+
+func TestBehaviorAggregatesAreExported(t *testing.T) {
+	db := aggregateDB{
+		summary: generated.GetActiveClientSummaryRow{
+			TotalClients:         10,
+			NewClientsLastMinute: 7,
+			AvgReputation:        62.5,
+			AvgSuspiciousScore:   0.25,
+		},
+		byDifficulty: []generated.GetActiveClientsByDifficultyRow{
+			{Difficulty: pgtype.Int4{Int32: 1, Valid: true}, Clients: 4},
+			{Difficulty: pgtype.Int4{Int32: 3, Valid: true}, Clients: 3},
+			{Difficulty: pgtype.Int4{Int32: behavior.AttackerDifficulty, Valid: true}, Clients: 2},
+			{Difficulty: pgtype.Int4{Int32: behavior.AttackerDifficulty + 1, Valid: true}, Clients: 1},
+		},
+	}
+	recorder := &metricstest.Recorder{}
+	s := &Server{
+		recorder:                recorder,
+		behaviorTracker:         behavior.NewTracker(db),
+		behaviorMetricsInterval: 5 * time.Millisecond,
+		shutdownChan:            make(chan struct{}),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.exportBehaviorMetrics()
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(recorder.Calls("UpdateBehaviorAggregates")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(s.shutdownChan)
+	<-done
+
+	wantByDifficulty := map[int]int{1: 4, 3: 3, behavior.AttackerDifficulty: 2, behavior.AttackerDifficulty + 1: 1}
+	// Only the clients at or above the attacker difficulty are flagged
+	if !recorder.Called("UpdateBehaviorAggregates", wantByDifficulty, 3, 62.5, 0.25, 7) {
+		t.Errorf("Expected the aggregates to be exported, got %v", recorder.Calls("UpdateBehaviorAggregates"))
+	}
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"time"
+
+	"world-of-wisdom/pkg/pow"
+)
+
+// solveDeadlineFactor is the headroom over the expected solve time given to slow clients
+const solveDeadlineFactor = 4
+
+// solveDeadline scales the time allowed to solve with the challenge's expected work.
+// It is never shorter than the read timeout, never longer than maxSolveWait and never
+// past the challenge's own expiry.
+func (s *Server) solveDeadline(challenge *pow.SecureChallenge) time.Time {
+	window := solveDeadlineFactor * pow.ExpectedSolveTime(challenge.Algorithm, challenge.Difficulty)
+	window = max(window, s.timeout)
+	if s.maxSolveWait > 0 {
+		window = min(window, s.maxSolveWait)
+	}
+
+	deadline := time.Now().Add(window)
+	if expiry := time.UnixMicro(challenge.ExpiresAt); expiry.Before(deadline) {
+		return expiry
+	}
+	return deadline
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// retryPrefix starts the line a client sends instead of a solution to collect a quote it
+// already earned: "RETRY <token>"
+const retryPrefix = "RETRY "
+
+const (
+	minSolveTokenLength = 16
+	maxSolveTokenLength = 64
+)
+
+// maxSolveTokens caps the quotes remembered at once, and solveTokenSweepInterval is how
+// often expired ones are dropped
+const (
+	maxSolveTokens          = 10000
+	solveTokenSweepInterval = time.Minute
+)
+
+// completedSolve is a quote already earned with a solve token
+type completedSolve struct {
+	ip      netip.Addr
+	quote   string
+	expires time.Time
+}
+
+// solveTokens remembers recently completed solves by client token, so a client whose
+// response was lost can collect its quote on reconnect without solving again. Each
+// token is redeemable once, only from the IP that solved, until ttl passes.
+type solveTokens struct {
+	mu        sync.Mutex
+	ttl       time.Duration // 0 disables solve tokens
+	completed map[string]completedSolve
+}
+
+// remember records the quote earned with token. Once maxSolveTokens are remembered an
+// arbitrary one is forgotten to make room, expired ones are left to sweepExpired.
+func (t *solveTokens) remember(token string, ip netip.Addr, quote string, now time.Time) {
+	if t.ttl <= 0 || token == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.completed == nil {
+		t.completed = make(map[string]completedSolve)
+	}
+	if _, ok := t.completed[token]; !ok && len(t.completed) >= maxSolveTokens {
+		for key := range t.completed {
+			delete(t.completed, key)
+			break
+		}
+	}
+	t.completed[token] = completedSolve{ip: ip, quote: quote, expires: now.Add(t.ttl)}
+}
+
+// sweepExpired drops the quotes whose token expired without being redeemed
+func (t *solveTokens) sweepExpired(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, solve := range t.completed {
+		if !now.Before(solve.expires) {
+			delete(t.completed, key)
+		}
+	}
+}
+
+// sweepSolveTokens drops expired solve tokens until shutdown
+func (s *Server) sweepSolveTokens() {
+	ticker := time.NewTicker(solveTokenSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.shutdownChan:
+			return
+		case now := <-ticker.C:
+			s.solveTokens.sweepExpired(now)
+		}
+	}
+}
+
+// redeem returns the quote earned with token and forgets it
+func (t *solveTokens) redeem(token string, ip netip.Addr, now time.Time) (string, bool) {
+	if t.ttl <= 0 {
+		return "", false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	solve, ok := t.completed[token]
+	if !ok || solve.ip != ip || !now.Before(solve.expires) {
+		return "", false
+	}
+	delete(t.completed, token)
+	return solve.quote, true
+}
+
+// validSolveToken accepts hex tokens of a sensible length
+func validSolveToken(token string) bool {
+	if len(token) < minSolveTokenLength || len(token) > maxSolveTokenLength {
+		return false
+	}
+	for _, c := range token {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSolutionLine splits a client line into the nonce and an optional solve token.
+// "<nonce> <token>" submits a solution, "RETRY <token>" asks for an earned quote.
+// Lines with a malformed token are returned whole as the nonce and fail verification.
+func parseSolutionLine(line string) (nonce, token string, retry bool) {
+	if rest, ok := strings.CutPrefix(line, retryPrefix); ok {
+		if token = strings.TrimSpace(rest); validSolveToken(token) {
+			return "", token, true
+		}
+		return line, "", false
+	}
+
+	nonce, token, found := strings.Cut(line, " ")
+	if !found {
+		return line, "", false
+	}
+	if token = strings.TrimSpace(token); !validSolveToken(token) {
+		return line, "", false
+	}
+	return nonce, token, false
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"world-of-wisdom/pkg/logger"
+)
+
+// Session outcomes reported in the connection summary. Rejected solutions report their
+// FailureReason instead.
+const (
+	outcomeSolved      = "solved"       // Quote sent for a verified solution
+	outcomeRedeemed    = "redeemed"     // Quote resent for a solve token
+	outcomeBusy        = "busy"         // Turned away with the busy line
+	outcomeLimited     = "limited"      // Refused by the per-IP connection limit
+	outcomeRateLimited = "rate_limited" // Refused by the per-IP connection rate, counted but never logged
+	outcomeStalled     = "stalled"      // Ended before a response, see the final state
+)
+
+// logConnectionSummary writes one record of the whole session when it ends, to the log
+// as a JSON line and to the activity log as the connection_summary event
+func (s *Server) logConnectionSummary(sess *session) {
+	outcome := sess.outcome
+	if outcome == outcomeRateLimited {
+		return
+	}
+	if outcome == "" {
+		outcome = outcomeStalled
+	}
+	attempted, solved := 0, 0
+	if sess.challenge != nil {
+		attempted = 1
+	}
+	if outcome == outcomeSolved {
+		solved = 1
+	}
+
+	summary := map[string]interface{}{
+		"client_id":            logger.MaskSensitive(sess.clientID),
+		"remote_addr":          logger.SanitizeIP(sess.clientAddr),
+		"duration_ms":          time.Since(sess.startTime).Milliseconds(),
+		"final_state":          string(sess.state),
+		"outcome":              outcome,
+		"algorithm":            sess.algorithm,
+		"difficulty":           sess.challengeDiff,
+		"challenges_attempted": attempted,
+		"challenges_solved":    solved,
+		"bytes_sent":           sess.conn.sent,
+		"bytes_received":       sess.conn.received,
+		"framed":               sess.framed,
+		"event":                "connection_summary",
+	}
+
+	data, _ := json.Marshal(summary)
+	log.Printf("Connection summary: %s", data)
+	s.logActivity(sess.ctx, "info", fmt.Sprintf("Connection from %s ended: %s", logger.SanitizeIP(sess.clientAddr), outcome), summary)
+}
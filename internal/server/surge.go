@@ -0,0 +1,58 @@
+package server
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"world-of-wisdom/pkg/metrics"
+)
+
+// surgeDetector raises the baseline difficulty of first-time clients while new clients
+// arrive faster than threshold. A flood of fresh IPs never builds per-client history, so
+// behavior tracking alone starts every one of them at the lowest difficulty.
+type surgeDetector struct {
+	mu        sync.Mutex
+	threshold float64 // New clients per minute, 0 disables the detector
+	rate      rateEWMA
+	recorder  metrics.MetricsRecorder
+}
+
+// observe records a first-time client and returns the difficulty boost to apply to it
+func (d *surgeDetector) observe(now time.Time) int {
+	if d.threshold <= 0 {
+		return 0
+	}
+
+	d.mu.Lock()
+	d.rate.observe(now)
+	d.mu.Unlock()
+
+	return d.export(now)
+}
+
+// boost is 1 once the smoothed rate reaches the threshold and grows by 1 with every
+// doubling above it, so it decays step by step as the surge subsides
+func (d *surgeDetector) boost(now time.Time) (int, float64) {
+	if d.threshold <= 0 {
+		return 0, 0
+	}
+
+	d.mu.Lock()
+	rate := d.rate.perMinute(now)
+	d.mu.Unlock()
+
+	if rate < d.threshold {
+		return 0, rate
+	}
+	return 1 + int(math.Log2(rate/d.threshold)), rate
+}
+
+// export refreshes the surge gauges and returns the current boost
+func (d *surgeDetector) export(now time.Time) int {
+	boost, rate := d.boost(now)
+	if d.threshold > 0 {
+		d.recorder.UpdateSurge(rate, boost)
+	}
+	return boost
+}
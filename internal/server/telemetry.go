@@ -0,0 +1,49 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// solveReport is what a client says about its own solve, appended to the solution line
+// as "attempts=N ms=N". It is untrusted: stored with the solution for analytics and
+// never used for verification.
+type solveReport struct {
+	attempts    pgtype.Int4
+	solveTimeMs pgtype.Int8
+}
+
+// splitSolveReport strips trailing key=value fields from a solution line and returns the
+// rest of the line with the report. Unknown keys and malformed values are dropped.
+func splitSolveReport(line string) (string, solveReport) {
+	var report solveReport
+	fields := strings.Fields(line)
+	end := len(fields)
+	for end > 0 {
+		key, value, ok := strings.Cut(fields[end-1], "=")
+		if !ok {
+			break
+		}
+		end--
+
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			continue
+		}
+		switch key {
+		case "attempts":
+			if n > 0 && n <= math.MaxInt32 {
+				report.attempts = pgtype.Int4{Int32: int32(n), Valid: true}
+			}
+		case "ms":
+			report.solveTimeMs = pgtype.Int8{Int64: n, Valid: true}
+		}
+	}
+	if end == len(fields) {
+		return line, report
+	}
+	return strings.Join(fields[:end], " "), report
+}
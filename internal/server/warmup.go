@@ -0,0 +1,55 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"world-of-wisdom/pkg/metrics"
+	"world-of-wisdom/pkg/pow"
+)
+
+// warmUp runs the first-connection work once before any client is accepted: the signing
+// keys are loaded, the quote provider is touched and warmupChallenges challenges are
+// generated, encoded and hashed once, which allocates Argon2's memory the first time.
+// With no warm-up challenges configured it is skipped entirely.
+func (s *Server) warmUp() error {
+	if s.warmupChallenges <= 0 {
+		return nil
+	}
+	start := time.Now()
+
+	if current, _ := s.keyManager.GetKeys(); len(current) == 0 {
+		return fmt.Errorf("no signing key loaded")
+	}
+	s.quoteProvider.GetRandomQuote()
+
+	for i := 0; i < s.warmupChallenges; i++ {
+		difficulty := s.getDifficulty()
+		algorithm, challengeDiff := s.selectAlgorithm(difficulty)
+		challenge, err := pow.GenerateSecureChallengeWithKeyManager(challengeDiff, algorithm, "warmup", s.keyManager)
+		if err != nil {
+			return fmt.Errorf("failed to generate warm-up challenge: %w", err)
+		}
+		if _, err := s.challengeEncoder.Encode(challenge, s.challengeFormat); err != nil {
+			return fmt.Errorf("failed to encode warm-up challenge: %w", err)
+		}
+		if _, err := pow.SolutionHash(challenge, "0"); err != nil {
+			return fmt.Errorf("failed to hash warm-up challenge: %w", err)
+		}
+	}
+
+	log.Printf("Warm-up done in %v (%d challenges)", time.Since(start), s.warmupChallenges)
+	return nil
+}
+
+// markReady reports the server ready, on Ready and on the metrics port's /readyz
+func (s *Server) markReady(ready bool) {
+	s.ready.Store(ready)
+	metrics.SetReady(ready)
+}
+
+// Ready reports whether warm-up has finished and connections are being accepted
+func (s *Server) Ready() bool {
+	return s.ready.Load()
+}
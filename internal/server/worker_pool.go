@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net"
+	"runtime"
+	"time"
+)
+
+// workersPerCPU is the default pool size per CPU. A worker holds its connection for the
+// whole exchange, including the client's solve time, so most workers are waiting on I/O.
+const workersPerCPU = 32
+
+// connPool is a fixed set of workers fed by a bounded queue of accepted connections
+type connPool struct {
+	workers int
+	queue   chan net.Conn
+}
+
+// newConnPool sizes the pool, 0 workers is workersPerCPU per CPU and a 0 queue matches the workers
+func newConnPool(workers, queueSize int) *connPool {
+	if workers <= 0 {
+		workers = workersPerCPU * runtime.NumCPU()
+	}
+	if queueSize <= 0 {
+		queueSize = workers
+	}
+	return &connPool{workers: workers, queue: make(chan net.Conn, queueSize)}
+}
+
+// dispatch hands an accepted connection to its own goroutine or, with a worker pool, to
+// the queue. Connections arriving while the queue is full are shed.
+func (s *Server) dispatch(conn net.Conn) {
+	if s.workerPool == nil {
+		go s.handleConnection(conn)
+		return
+	}
+
+	select {
+	case s.workerPool.queue <- conn:
+	default:
+		s.shedConnection(conn)
+	}
+}
+
+// connWorker handles queued connections until shutdown, then sheds whatever is still queued
+func (s *Server) connWorker() {
+	for {
+		select {
+		case conn := <-s.workerPool.queue:
+			s.handleConnection(conn)
+		case <-s.shutdownChan:
+			for {
+				select {
+				case conn := <-s.workerPool.queue:
+					s.shedConnection(conn)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// shedConnection answers a connection no worker will take with the busy line and closes it
+func (s *Server) shedConnection(conn net.Conn) {
+	defer s.activeConns.Done()
+	defer conn.Close()
+
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	s.writeBusy(conn, shedWorkerQueueFull)
+}
@@ -0,0 +1,204 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body
+const SignatureHeader = "X-WoW-Signature"
+
+// Event is the payload delivered for every successfully solved challenge
+type Event struct {
+	Event       string    `json:"event"`
+	ClientID    string    `json:"client_id"`
+	IP          string    `json:"ip"`
+	Difficulty  int       `json:"difficulty"`
+	Algorithm   string    `json:"algorithm"`
+	SolveTimeMs int64     `json:"solve_time_ms"`
+	Quote       string    `json:"quote"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Config holds webhook delivery settings
+type Config struct {
+	URL        string
+	Secret     string        // HMAC signing secret, payloads are unsigned when empty
+	QueueSize  int           // Maximum number of pending events
+	MaxRetries int           // Delivery attempts after the first failure
+	RetryDelay time.Duration // Base delay, doubled after every failed attempt
+	Timeout    time.Duration // Per-request HTTP timeout
+}
+
+// Notifier delivers events asynchronously so webhook latency never blocks connection handling
+type Notifier struct {
+	cfg    Config
+	client *http.Client
+	queue  chan Event
+	wg     sync.WaitGroup
+
+	// Cancelled once Stop gives up waiting, ending backoffs and requests in flight
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex // Guards stopped and closing queue against concurrent sends
+	stopped bool
+}
+
+// NewNotifier creates a notifier and starts its delivery worker
+func NewNotifier(cfg Config) *Notifier {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 100
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = 500 * time.Millisecond
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+
+	n := &Notifier{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan Event, cfg.QueueSize),
+	}
+	n.ctx, n.cancel = context.WithCancel(context.Background())
+
+	n.wg.Add(1)
+	go n.run()
+
+	return n
+}
+
+// Enqueue schedules an event for delivery, dropping it when the queue is full or the
+// notifier has been stopped
+func (n *Notifier) Enqueue(event Event) bool {
+	if event.Event == "" {
+		event.Event = "challenge_solved"
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped {
+		log.Printf("Webhook notifier stopped, dropping %s event", event.Event)
+		return false
+	}
+
+	select {
+	case n.queue <- event:
+		return true
+	default:
+		log.Printf("Webhook queue full, dropping %s event", event.Event)
+		return false
+	}
+}
+
+// Stop stops accepting events and waits for queued deliveries until ctx is done. Once it
+// is, pending retries and queued events are abandoned.
+func (n *Notifier) Stop(ctx context.Context) error {
+	n.mu.Lock()
+	if !n.stopped {
+		n.stopped = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		n.cancel()
+		return nil
+	case <-ctx.Done():
+		n.cancel()
+		return fmt.Errorf("webhook queue not drained: %w", ctx.Err())
+	}
+}
+
+func (n *Notifier) run() {
+	defer n.wg.Done()
+
+	for event := range n.queue {
+		if n.ctx.Err() != nil {
+			log.Printf("Webhook notifier stopped, dropping %s event", event.Event)
+			continue
+		}
+		if err := n.deliver(event); err != nil {
+			log.Printf("Webhook delivery failed: %v", err)
+		}
+	}
+}
+
+// deliver posts a single event, retrying with exponential backoff
+func (n *Notifier) deliver(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook event: %w", err)
+	}
+
+	delay := n.cfg.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err = n.post(body)
+		if err == nil {
+			return nil
+		}
+		if attempt >= n.cfg.MaxRetries {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt+1, err)
+		}
+		select {
+		case <-time.After(delay):
+		case <-n.ctx.Done():
+			return fmt.Errorf("stopped before retrying after %d attempts: %w", attempt+1, err)
+		}
+		delay *= 2
+	}
+}
+
+func (n *Notifier) post(body []byte) error {
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, n.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign([]byte(n.cfg.Secret), body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body using secret
+func Sign(secret, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,154 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeliveryIsSigned(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer ts.Close()
+
+	n := NewNotifier(Config{URL: ts.URL, Secret: "webhook-secret"})
+	defer n.Stop(context.Background())
+
+	if !n.Enqueue(Event{ClientID: "client-1", Difficulty: 3}) {
+		t.Fatal("Expected the event to be queued")
+	}
+
+	select {
+	case r := <-received:
+		body := <-bodies
+		want := "sha256=" + Sign([]byte("webhook-secret"), body)
+		if got := r.Header.Get(SignatureHeader); got != want {
+			t.Errorf("Expected signature %q, got %q", want, got)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Expected a JSON content type, got %q", ct)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Webhook was never delivered")
+	}
+}
+
+func TestFailedDeliveryIsRetriedWithBackoff(t *testing.T) {
+	var attempts atomic.Int32
+	times := make(chan time.Time, 3)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		times <- time.Now()
+		if attempts.Add(1) < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	n := NewNotifier(Config{URL: ts.URL, MaxRetries: 2, RetryDelay: 20 * time.Millisecond})
+	n.Enqueue(Event{ClientID: "client-1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := n.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	if got := attempts.Load(); got != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", got)
+	}
+	first, second, third := <-times, <-times, <-times
+	if gap := second.Sub(first); gap < 20*time.Millisecond {
+		t.Errorf("Expected the first retry after at least 20ms, got %v", gap)
+	}
+	if gap := third.Sub(second); gap < 40*time.Millisecond {
+		t.Errorf("Expected the delay to double to at least 40ms, got %v", gap)
+	}
+}
+
+func TestStopAbandonsPendingBackoff(t *testing.T) {
+	var attempts atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	n := NewNotifier(Config{URL: ts.URL, MaxRetries: 3, RetryDelay: time.Hour})
+	n.Enqueue(Event{ClientID: "client-1"})
+	n.Enqueue(Event{ClientID: "client-2"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := n.Stop(ctx); err == nil {
+		t.Fatal("Expected Stop to report the undelivered events")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Stop to return when its context is done, took %v", elapsed)
+	}
+
+	// The worker leaves the hour-long backoff and drops the queued event
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Delivery worker kept waiting out its backoff after Stop gave up")
+	}
+	if got := attempts.Load(); got > 1 {
+		t.Errorf("Expected no retries after Stop gave up, got %d attempts", got)
+	}
+}
+
+func TestEventsAreDroppedWhenQueueIsFull(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+	defer ts.Close()
+
+	n := NewNotifier(Config{URL: ts.URL, QueueSize: 1})
+	defer n.Stop(context.Background())
+	defer close(release)
+
+	// The first event occupies the worker, the second fills the queue
+	n.Enqueue(Event{ClientID: "client-1"})
+	<-started
+	if !n.Enqueue(Event{ClientID: "client-2"}) {
+		t.Fatal("Expected the second event to be queued")
+	}
+	if n.Enqueue(Event{ClientID: "client-3"}) {
+		t.Error("Expected the third event to be dropped while the queue is full")
+	}
+}
+
+func TestEnqueueAfterStopIsDropped(t *testing.T) {
+	n := NewNotifier(Config{URL: "http://127.0.0.1:0"})
+	if err := n.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	if n.Enqueue(Event{ClientID: "late"}) {
+		t.Error("Expected an event enqueued after Stop to be dropped")
+	}
+	if err := n.Stop(context.Background()); err != nil {
+		t.Errorf("Expected a second Stop to succeed, got %v", err)
+	}
+}
@@ -1,11 +1,17 @@
 package config
 
 import (
+	"bufio"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// SLAMaxDifficulty is the highest difficulty still treated as a legitimate client for the solve-time SLA
+const SLAMaxDifficulty = 2
+
 type Config struct {
 	// Database
 	PostgresHost     string
@@ -14,6 +20,7 @@ type Config struct {
 	PostgresPassword string
 	PostgresDB       string
 	PostgresSSLMode  string
+	QueryTimeout     time.Duration
 
 	RedisHost     string
 	RedisPort     int
@@ -21,13 +28,40 @@ type Config struct {
 	RedisDB       int
 
 	// Server
-	ServerPort    string
-	APIServerPort string
-	MetricsPort   string
-	Algorithm     string
-	Difficulty    int
-	AdaptiveMode  bool
-	Timeout       time.Duration
+	ServerPort          string
+	APIServerPort       string
+	MetricsPort         string
+	Algorithm           string
+	Difficulty          int
+	AdaptiveMode        bool
+	Timeout             time.Duration
+	SolveTimeSLA        time.Duration // Target solve time for low-difficulty (legitimate) clients
+	MaxSolveWait        time.Duration // Longest solve wait for high-difficulty challenges
+	SolveTokenTTL       time.Duration // How long a client can collect an earned quote again after a lost response
+	HelloWait           time.Duration // How long to wait for a framed hello before serving newline-delimited JSON
+	HandshakeTimeout    time.Duration // Deadline of the handshake state, 0 uses Timeout
+	RespondTimeout      time.Duration // Deadline of the respond state, 0 uses Timeout
+	BusyRetryAfter      time.Duration // Retry hint sent to connections shed under overload
+	ClockSkew           time.Duration // Clock difference tolerated between challenge issuers and verifiers
+	KeyRotationInterval time.Duration // Age at which the TCP server rotates the HMAC keys, 0 never rotates
+	Argon2Preset        string        // Argon2 parameters of new challenges: "default", or "test" outside production
+	Argon2Profile       string        // Argon2 parameters per difficulty, e.g. "1-2:16384/1/2,5-6:524288/3/4"
+
+	// Adaptive difficulty thresholds, zero keeps a threshold's default
+	AdaptiveTargetSolveTime    time.Duration // Raise difficulty while solves average faster (default 1s)
+	AdaptiveMaxSolveTime       time.Duration // Lower it while solves average slower at a low rate (default 5s)
+	AdaptiveHighConnectionRate float64       // Connections per minute that raise difficulty (default 20)
+	AdaptiveLowConnectionRate  float64       // Connections per minute below which it may drop (default 5)
+	AdaptiveAdjustEvery        int           // Solves between adjustments (default 10)
+
+	// Recent history per-client connection counts and reconnect rates cover, 0 for the lifetime
+	ConnectionWindow time.Duration
+
+	// How often behavior tracker aggregates are refreshed for Prometheus
+	BehaviorMetricsInterval time.Duration
+
+	// Experimental features switched on, see KnownFeatures
+	Features Features
 
 	// Environment
 	Environment string
@@ -43,6 +77,7 @@ func LoadConfig() *Config {
 		PostgresPassword: getEnvString("POSTGRES_PASSWORD", "wisdom123"),
 		PostgresDB:       getEnvString("POSTGRES_DB", "wisdom"),
 		PostgresSSLMode:  getEnvString("POSTGRES_SSL_MODE", "disable"),
+		QueryTimeout:     getEnvDuration("DB_QUERY_TIMEOUT", 5*time.Second),
 
 		RedisHost:     getEnvString("REDIS_HOST", "redis"),
 		RedisPort:     getEnvInt("REDIS_PORT", 6379),
@@ -50,13 +85,36 @@ func LoadConfig() *Config {
 		RedisDB:       getEnvInt("REDIS_DB", 0),
 
 		// Server defaults
-		ServerPort:    getEnvString("SERVER_PORT", ":8080"),
-		APIServerPort: getEnvString("API_SERVER_PORT", ":8081"),
-		MetricsPort:   getEnvString("METRICS_PORT", ":2112"),
-		Algorithm:     getEnvString("ALGORITHM", "argon2"),
-		Difficulty:    getEnvInt("DIFFICULTY", 2),
-		AdaptiveMode:  getEnvBool("ADAPTIVE_MODE", true),
-		Timeout:       getEnvDuration("TIMEOUT", 30*time.Second),
+		ServerPort:          getEnvString("SERVER_PORT", ":8080"),
+		APIServerPort:       getEnvString("API_SERVER_PORT", ":8081"),
+		MetricsPort:         getEnvString("METRICS_PORT", ":2112"),
+		Algorithm:           getEnvString("ALGORITHM", "argon2"),
+		Difficulty:          getEnvInt("DIFFICULTY", 2),
+		AdaptiveMode:        getEnvBool("ADAPTIVE_MODE", true),
+		Timeout:             getEnvDuration("TIMEOUT", 30*time.Second),
+		SolveTimeSLA:        getEnvDuration("SOLVE_TIME_SLA", 3*time.Second),
+		MaxSolveWait:        getEnvDuration("MAX_SOLVE_WAIT", 5*time.Minute),
+		SolveTokenTTL:       getEnvDuration("SOLVE_TOKEN_TTL", 2*time.Minute),
+		HelloWait:           getEnvDuration("HELLO_WAIT", 100*time.Millisecond),
+		HandshakeTimeout:    getEnvDuration("HANDSHAKE_TIMEOUT", 0),
+		RespondTimeout:      getEnvDuration("RESPOND_TIMEOUT", 0),
+		BusyRetryAfter:      getEnvDuration("BUSY_RETRY_AFTER", 5*time.Second),
+		ClockSkew:           getEnvDuration("CLOCK_SKEW", time.Minute),
+		KeyRotationInterval: getEnvDuration("KEY_ROTATION_INTERVAL", 24*time.Hour),
+		Argon2Preset:        getEnvString("ARGON2_PRESET", "default"),
+		Argon2Profile:       getEnvString("ARGON2_PROFILE", ""),
+
+		AdaptiveTargetSolveTime:    getEnvDuration("ADAPTIVE_TARGET_SOLVE_TIME", time.Second),
+		AdaptiveMaxSolveTime:       getEnvDuration("ADAPTIVE_MAX_SOLVE_TIME", 5*time.Second),
+		AdaptiveHighConnectionRate: getEnvFloat("ADAPTIVE_HIGH_CONNECTION_RATE", 20),
+		AdaptiveLowConnectionRate:  getEnvFloat("ADAPTIVE_LOW_CONNECTION_RATE", 5),
+		AdaptiveAdjustEvery:        getEnvInt("ADAPTIVE_ADJUST_EVERY", 10),
+
+		ConnectionWindow: getEnvDuration("CONNECTION_WINDOW", 0),
+
+		BehaviorMetricsInterval: getEnvDuration("BEHAVIOR_METRICS_INTERVAL", 30*time.Second),
+
+		Features: loadFeatures(),
 
 		// Environment
 		Environment: getEnvString("ENV", "development"),
@@ -64,6 +122,38 @@ func LoadConfig() *Config {
 	}
 }
 
+// LoadEnvFile sets the KEY=VALUE pairs in path as environment variables, overriding
+// existing ones. Call it again (e.g. on SIGHUP) to pick up edits before re-reading config.
+func LoadEnvFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("invalid line %d in %s: expected KEY=VALUE", lineNo, path)
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		if err := os.Setenv(strings.TrimSpace(key), value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", key, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	return nil
+}
+
 func getEnvString(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -80,6 +170,15 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if parsed, err := strconv.ParseBool(value); err == nil {
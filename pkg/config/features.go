@@ -0,0 +1,73 @@
+package config
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Experimental features, off unless switched on with FEATURES or FEATURE_<NAME>
+const (
+	FeatureSurgeDetector = "surge_detector"
+	FeatureWorkerPool    = "worker_pool"
+)
+
+// KnownFeatures lists every experimental feature with what it changes. A new experimental
+// behavior is added here and checked with Features.Enabled, not given its own switch.
+var KnownFeatures = map[string]string{
+	FeatureSurgeDetector: "Raise first-time client difficulty while new clients arrive faster than SURGE_THRESHOLD",
+	FeatureWorkerPool:    "Handle connections on a bounded worker pool instead of a goroutine each",
+}
+
+// Features holds which experimental features are enabled, by name
+type Features map[string]bool
+
+// Enabled reports whether the named feature is switched on
+func (f Features) Enabled(name string) bool {
+	return f[name]
+}
+
+// FeatureState describes one feature for the config endpoint
+type FeatureState struct {
+	Name        string `json:"name"`
+	Enabled     bool   `json:"enabled"`
+	Description string `json:"description"`
+}
+
+// List returns every known feature sorted by name
+func (f Features) List() []FeatureState {
+	states := make([]FeatureState, 0, len(KnownFeatures))
+	for name, description := range KnownFeatures {
+		states = append(states, FeatureState{Name: name, Enabled: f.Enabled(name), Description: description})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+// loadFeatures reads FEATURES, a comma-separated list of features to enable, then lets
+// FEATURE_<NAME>=true/false override single features. WORKER_POOL=true and a positive
+// SURGE_THRESHOLD still enable their features, as they did before the flags existed.
+func loadFeatures() Features {
+	features := Features{
+		FeatureSurgeDetector: getEnvInt("SURGE_THRESHOLD", 0) > 0,
+		FeatureWorkerPool:    getEnvBool("WORKER_POOL", false),
+	}
+
+	for _, name := range strings.Split(os.Getenv("FEATURES"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, ok := KnownFeatures[name]; !ok {
+			log.Printf("⚠️ FEATURES names unknown feature %q", name)
+			continue
+		}
+		features[name] = true
+	}
+
+	for name := range KnownFeatures {
+		features[name] = getEnvBool("FEATURE_"+strings.ToUpper(name), features[name])
+	}
+	return features
+}
@@ -1,40 +1,358 @@
 package metrics
 
 import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	currentDifficulty = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "wow_current_difficulty",
+		Help: "Current global PoW difficulty",
+	})
+
+	connectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wow_connections_total",
+		Help: "Connection events by type",
+	}, []string{"event"})
+
+	puzzlesSolved = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wow_puzzles_solved_total",
+		Help: "Successfully solved challenges by difficulty and algorithm",
+	}, []string{"difficulty", "algorithm"})
+
+	puzzlesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wow_puzzles_failed_total",
+		Help: "Invalid or timed out solutions by difficulty and algorithm",
+	}, []string{"difficulty", "algorithm"})
+
+	puzzlesExpired = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wow_puzzles_expired_total",
+		Help: "Solutions submitted after their challenge expired by difficulty and algorithm",
+	}, []string{"difficulty", "algorithm"})
+
+	solveDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wow_solve_duration_seconds",
+		Help:    "Client solve time by difficulty and algorithm",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 10, 20, 30},
+	}, []string{"difficulty", "algorithm"})
+
+	processingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wow_processing_duration_seconds",
+		Help:    "Total connection handling time by outcome",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"event"})
+
+	difficultyAdjustments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wow_difficulty_adjustments_total",
+		Help: "Global difficulty adjustments by direction",
+	}, []string{"direction"})
+
+	algorithmFallbacks = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "wow_algorithm_fallbacks_total",
+		Help: "Times the server degraded from Argon2 to SHA-256 under memory pressure",
+	})
+
+	behaviorClients = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wow_behavior_clients",
+		Help: "Clients seen in the last hour by assigned difficulty",
+	}, []string{"difficulty"})
+
+	behaviorFlaggedAttackers = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "wow_behavior_flagged_attackers",
+		Help: "Clients seen in the last hour at attacker-level difficulty",
+	})
+
+	behaviorAvgReputation = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "wow_behavior_avg_reputation",
+		Help: "Average reputation score of clients seen in the last hour",
+	})
+
+	behaviorAvgSuspicious = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "wow_behavior_avg_suspicious_score",
+		Help: "Average suspicious activity score of clients seen in the last hour",
+	})
+
+	behaviorNewClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "wow_behavior_new_clients_per_minute",
+		Help: "Clients first seen within the last minute",
+	})
+
+	behaviorFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wow_behavior_fallbacks_total",
+		Help: "Behavior lookups served from the fallback because the database was unavailable",
+	}, []string{"operation"})
+
+	shadowDifficulty = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wow_shadow_difficulty",
+		Help: "Difficulty the shadow controller would have chosen",
+	}, []string{"controller"})
+
+	shadowDivergence = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wow_shadow_difficulty_divergence",
+		Help: "Shadow controller difficulty minus the active difficulty",
+	}, []string{"controller"})
+
+	connectionBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wow_connection_bytes",
+		Help:    "Bytes exchanged per connection by direction",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+	}, []string{"direction"})
+
+	challengesIssued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wow_challenges_issued_total",
+		Help: "Challenges sent to clients by wire format",
+	}, []string{"format"})
+
+	challengeSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wow_challenge_size_bytes",
+		Help:    "Encoded challenge size by wire format",
+		Buckets: prometheus.ExponentialBuckets(32, 2, 6),
+	}, []string{"format"})
+
+	surgeNewClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "wow_surge_new_clients_per_minute",
+		Help: "Smoothed rate of first-time clients seen by the surge detector",
+	})
+
+	surgeBoost = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "wow_surge_difficulty_boost",
+		Help: "Difficulty added for first-time clients, 0 when no surge is detected",
+	})
+
+	protocolStateDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wow_protocol_state_duration_seconds",
+		Help:    "Time spent in each protocol state",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300},
+	}, []string{"state"})
+
+	protocolStalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wow_protocol_stalls_total",
+		Help: "Connections that ended before a response, by the protocol state they ended in",
+	}, []string{"state"})
+
+	solveTokenRedemptions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wow_solve_token_redemptions_total",
+		Help: "Retries asking for an already earned quote, by whether the token was known",
+	}, []string{"result"})
+
+	slaBreaches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wow_solve_sla_breaches_total",
+		Help: "Solves by low-difficulty clients that exceeded the solve-time SLA",
+	}, []string{"difficulty"})
+
+	connectionsShed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wow_connections_shed_total",
+		Help: "New connections answered BUSY under overload, by the resource that ran out",
+	}, []string{"reason"})
+
+	difficultyHints = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wow_difficulty_hints_total",
+		Help: "Difficulty hints sent in the framed hello, by whether they were granted or rejected",
+	}, []string{"result"})
+
+	overSolves = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wow_oversolves_total",
+		Help: "Accepted solutions whose hash has more leading zeros than required, by required difficulty and algorithm",
+	}, []string{"difficulty", "algorithm"})
+
+	hmacKeyVersion = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "wow_hmac_key_version",
+		Help: "Version of the HMAC key challenges are currently signed with",
+	})
+
+	hmacKeyAge = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "wow_hmac_key_age_seconds",
+		Help: "Seconds since the current HMAC key was created or rotated in, 0 until a key is loaded",
+	}, func() float64 {
+		rotatedAt := hmacKeyRotatedAt.Load()
+		if rotatedAt == 0 {
+			return 0
+		}
+		return time.Since(time.Unix(0, rotatedAt)).Seconds()
+	})
+
+	hmacKeyRotations = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "wow_hmac_key_rotations_total",
+		Help: "HMAC key rotations done by this process",
+	})
 )
 
-// StartMetricsServer starts the metrics server on the given port
-func StartMetricsServer(port string) {
-	// No-op implementation for now
+// hmacKeyRotatedAt is when the current HMAC key was rotated in, in Unix nanoseconds. The key
+// age is computed from it on every scrape, so it keeps growing when rotations stop.
+var hmacKeyRotatedAt atomic.Int64
+
+// ready is what /readyz reports, set by the server once it has warmed up
+var ready atomic.Bool
+
+// SetReady changes whether /readyz reports the server ready for traffic
+func SetReady(isReady bool) {
+	ready.Store(isReady)
+}
+
+// ReadyHandler answers 200 once the server is ready and 503 until then
+func ReadyHandler(w http.ResponseWriter, _ *http.Request) {
+	if !ready.Load() {
+		http.Error(w, "warming up", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ready\n"))
+}
+
+// StartMetricsServer starts the metrics server on the given port, along with /readyz and
+// any routes the callers in routes add to its mux
+func StartMetricsServer(port string, routes ...func(mux *http.ServeMux)) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/readyz", ReadyHandler)
+	for _, register := range routes {
+		register(mux)
+	}
+
+	go func() {
+		if err := http.ListenAndServe(port, mux); err != nil {
+			log.Printf("Metrics server error: %v", err)
+		}
+	}()
 }
 
 // UpdateCurrentDifficulty updates the current difficulty metric
 func UpdateCurrentDifficulty(difficulty int) {
-	// No-op implementation for now
+	currentDifficulty.Set(float64(difficulty))
 }
 
 // RecordConnection records a connection event
 func RecordConnection(event string) {
-	// No-op implementation for now
+	connectionsTotal.WithLabelValues(event).Inc()
 }
 
-// RecordPuzzleSolved records a successfully solved puzzle
-func RecordPuzzleSolved(difficulty int, solveTime time.Duration) {
-	// No-op implementation for now
+// RecordPuzzleSolved records a successfully solved puzzle of the algorithm it was issued with
+func RecordPuzzleSolved(difficulty int, algorithm string, solveTime time.Duration) {
+	label := strconv.Itoa(difficulty)
+	puzzlesSolved.WithLabelValues(label, algorithm).Inc()
+	solveDuration.WithLabelValues(label, algorithm).Observe(solveTime.Seconds())
 }
 
 // RecordProcessingTime records the processing time for an event
 func RecordProcessingTime(event string, duration time.Duration) {
-	// No-op implementation for now
+	processingDuration.WithLabelValues(event).Observe(duration.Seconds())
 }
 
 // RecordPuzzleFailed records a failed puzzle attempt
-func RecordPuzzleFailed(difficulty int) {
-	// No-op implementation for now
+func RecordPuzzleFailed(difficulty int, algorithm string) {
+	puzzlesFailed.WithLabelValues(strconv.Itoa(difficulty), algorithm).Inc()
+}
+
+// RecordPuzzleExpired records a solution that arrived after its challenge expired
+func RecordPuzzleExpired(difficulty int, algorithm string) {
+	puzzlesExpired.WithLabelValues(strconv.Itoa(difficulty), algorithm).Inc()
 }
 
 // RecordDifficultyAdjustment records a difficulty adjustment
 func RecordDifficultyAdjustment(direction string) {
-	// No-op implementation for now
-}
\ No newline at end of file
+	difficultyAdjustments.WithLabelValues(direction).Inc()
+}
+
+// RecordSLABreach records a low-difficulty solve that took longer than the SLA
+func RecordSLABreach(difficulty int) {
+	slaBreaches.WithLabelValues(strconv.Itoa(difficulty)).Inc()
+}
+
+// RecordAlgorithmFallback records a switch from Argon2 to SHA-256 challenges
+func RecordAlgorithmFallback() {
+	algorithmFallbacks.Inc()
+}
+
+// UpdateBehaviorAggregates sets the behavior tracker gauges, difficulties 1-6 are always exported
+func UpdateBehaviorAggregates(clientsByDifficulty map[int]int, flaggedAttackers int, avgReputation, avgSuspicious float64, newClientsPerMinute int) {
+	behaviorClients.Reset()
+	for difficulty := 1; difficulty <= 6; difficulty++ {
+		behaviorClients.WithLabelValues(strconv.Itoa(difficulty)).Set(float64(clientsByDifficulty[difficulty]))
+	}
+	behaviorFlaggedAttackers.Set(float64(flaggedAttackers))
+	behaviorAvgReputation.Set(avgReputation)
+	behaviorAvgSuspicious.Set(avgSuspicious)
+	behaviorNewClients.Set(float64(newClientsPerMinute))
+}
+
+// RecordBehaviorFallback records a behavior lookup answered without the database
+func RecordBehaviorFallback(operation string) {
+	behaviorFallbacks.WithLabelValues(operation).Inc()
+}
+
+// UpdateShadowDifficulty records the shadow controller's choice next to the active difficulty
+func UpdateShadowDifficulty(controller string, shadow, active int) {
+	shadowDifficulty.WithLabelValues(controller).Set(float64(shadow))
+	shadowDivergence.WithLabelValues(controller).Set(float64(shadow - active))
+}
+
+// RecordProtocolState records how long a connection spent in a protocol state
+func RecordProtocolState(state string, duration time.Duration) {
+	protocolStateDuration.WithLabelValues(state).Observe(duration.Seconds())
+}
+
+// RecordProtocolStall records a connection that ended in state without getting a response
+func RecordProtocolStall(state string) {
+	protocolStalls.WithLabelValues(state).Inc()
+}
+
+// RecordConnectionBytes records the bytes a connection sent to and received from the client
+func RecordConnectionBytes(sent, received int64) {
+	connectionBytes.WithLabelValues("sent").Observe(float64(sent))
+	connectionBytes.WithLabelValues("received").Observe(float64(received))
+}
+
+// RecordChallengeIssued records a challenge sent in format and its encoded size
+func RecordChallengeIssued(format string, size int) {
+	challengesIssued.WithLabelValues(format).Inc()
+	challengeSize.WithLabelValues(format).Observe(float64(size))
+}
+
+// UpdateSurge records the new-client rate and the difficulty boost it currently causes
+func UpdateSurge(newClientsPerMinute float64, boost int) {
+	surgeNewClients.Set(newClientsPerMinute)
+	surgeBoost.Set(float64(boost))
+}
+
+// RecordSolveTokenRedemption records a retry for an earned quote and whether it was found
+func RecordSolveTokenRedemption(found bool) {
+	result := "miss"
+	if found {
+		result = "hit"
+	}
+	solveTokenRedemptions.WithLabelValues(result).Inc()
+}
+
+// RecordConnectionShed records a new connection turned away as busy
+func RecordConnectionShed(reason string) {
+	connectionsShed.WithLabelValues(reason).Inc()
+}
+
+// RecordDifficultyHint records a client's difficulty hint as "granted" or "rejected"
+func RecordDifficultyHint(result string) {
+	difficultyHints.WithLabelValues(result).Inc()
+}
+
+// RecordOverSolve records an accepted solution that exceeded the required difficulty
+func RecordOverSolve(difficulty int, algorithm string) {
+	overSolves.WithLabelValues(strconv.Itoa(difficulty), algorithm).Inc()
+}
+
+// UpdateHMACKey records the version and rotation time of the HMAC key now in use
+func UpdateHMACKey(version int, rotatedAt time.Time) {
+	hmacKeyVersion.Set(float64(version))
+	hmacKeyRotatedAt.Store(rotatedAt.UnixNano())
+}
+
+// RecordHMACKeyRotation records a key rotation and the key it put in use
+func RecordHMACKeyRotation(version int, rotatedAt time.Time) {
+	hmacKeyRotations.Inc()
+	UpdateHMACKey(version, rotatedAt)
+}
@@ -0,0 +1,133 @@
+// Package metricstest provides a metrics.MetricsRecorder that keeps every call for tests
+package metricstest
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"world-of-wisdom/pkg/metrics"
+)
+
+// Call is one recorded metric, the method name and its arguments in order
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Recorder captures metric calls instead of exporting them. The zero value is ready to use.
+type Recorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ metrics.MetricsRecorder = (*Recorder)(nil)
+
+func (r *Recorder) record(method string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{Method: method, Args: args})
+}
+
+// Calls returns the recorded calls of method, or every call when method is empty
+func (r *Recorder) Calls(method string) []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var calls []Call
+	for _, call := range r.calls {
+		if method == "" || call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Called reports whether method was recorded with exactly args
+func (r *Recorder) Called(method string, args ...interface{}) bool {
+	for _, call := range r.Calls(method) {
+		if reflect.DeepEqual(call.Args, args) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Recorder) UpdateCurrentDifficulty(difficulty int) {
+	r.record("UpdateCurrentDifficulty", difficulty)
+}
+
+func (r *Recorder) RecordConnection(event string) {
+	r.record("RecordConnection", event)
+}
+
+func (r *Recorder) RecordPuzzleSolved(difficulty int, algorithm string, solveTime time.Duration) {
+	r.record("RecordPuzzleSolved", difficulty, algorithm, solveTime)
+}
+
+func (r *Recorder) RecordProcessingTime(event string, duration time.Duration) {
+	r.record("RecordProcessingTime", event, duration)
+}
+
+func (r *Recorder) RecordPuzzleFailed(difficulty int, algorithm string) {
+	r.record("RecordPuzzleFailed", difficulty, algorithm)
+}
+
+func (r *Recorder) RecordPuzzleExpired(difficulty int, algorithm string) {
+	r.record("RecordPuzzleExpired", difficulty, algorithm)
+}
+
+func (r *Recorder) RecordDifficultyAdjustment(direction string) {
+	r.record("RecordDifficultyAdjustment", direction)
+}
+
+func (r *Recorder) RecordSLABreach(difficulty int) {
+	r.record("RecordSLABreach", difficulty)
+}
+
+func (r *Recorder) RecordAlgorithmFallback() {
+	r.record("RecordAlgorithmFallback")
+}
+
+func (r *Recorder) UpdateBehaviorAggregates(clientsByDifficulty map[int]int, flaggedAttackers int, avgReputation, avgSuspicious float64, newClientsPerMinute int) {
+	r.record("UpdateBehaviorAggregates", clientsByDifficulty, flaggedAttackers, avgReputation, avgSuspicious, newClientsPerMinute)
+}
+
+func (r *Recorder) UpdateShadowDifficulty(controller string, shadow, active int) {
+	r.record("UpdateShadowDifficulty", controller, shadow, active)
+}
+
+func (r *Recorder) RecordProtocolState(state string, duration time.Duration) {
+	r.record("RecordProtocolState", state, duration)
+}
+
+func (r *Recorder) RecordProtocolStall(state string) {
+	r.record("RecordProtocolStall", state)
+}
+
+func (r *Recorder) RecordConnectionBytes(sent, received int64) {
+	r.record("RecordConnectionBytes", sent, received)
+}
+
+func (r *Recorder) RecordChallengeIssued(format string, size int) {
+	r.record("RecordChallengeIssued", format, size)
+}
+
+func (r *Recorder) UpdateSurge(newClientsPerMinute float64, boost int) {
+	r.record("UpdateSurge", newClientsPerMinute, boost)
+}
+
+func (r *Recorder) RecordSolveTokenRedemption(found bool) {
+	r.record("RecordSolveTokenRedemption", found)
+}
+
+func (r *Recorder) RecordConnectionShed(reason string) {
+	r.record("RecordConnectionShed", reason)
+}
+
+func (r *Recorder) RecordDifficultyHint(result string) {
+	r.record("RecordDifficultyHint", result)
+}
+
+func (r *Recorder) RecordOverSolve(difficulty int, algorithm string) {
+	r.record("RecordOverSolve", difficulty, algorithm)
+}
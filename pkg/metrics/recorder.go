@@ -0,0 +1,113 @@
+package metrics
+
+import "time"
+
+// MetricsRecorder is what the TCP server records its metrics through, so tests can swap
+// in metricstest.Recorder and assert on the calls instead of scraping Prometheus
+type MetricsRecorder interface {
+	UpdateCurrentDifficulty(difficulty int)
+	RecordConnection(event string)
+	RecordPuzzleSolved(difficulty int, algorithm string, solveTime time.Duration)
+	RecordProcessingTime(event string, duration time.Duration)
+	RecordPuzzleFailed(difficulty int, algorithm string)
+	RecordPuzzleExpired(difficulty int, algorithm string)
+	RecordDifficultyAdjustment(direction string)
+	RecordSLABreach(difficulty int)
+	RecordAlgorithmFallback()
+	UpdateBehaviorAggregates(clientsByDifficulty map[int]int, flaggedAttackers int, avgReputation, avgSuspicious float64, newClientsPerMinute int)
+	UpdateShadowDifficulty(controller string, shadow, active int)
+	RecordProtocolState(state string, duration time.Duration)
+	RecordProtocolStall(state string)
+	RecordConnectionBytes(sent, received int64)
+	RecordChallengeIssued(format string, size int)
+	UpdateSurge(newClientsPerMinute float64, boost int)
+	RecordSolveTokenRedemption(found bool)
+	RecordConnectionShed(reason string)
+	RecordDifficultyHint(result string)
+	RecordOverSolve(difficulty int, algorithm string)
+}
+
+// Prometheus records through the package functions, the default MetricsRecorder
+var Prometheus MetricsRecorder = prometheusRecorder{}
+
+type prometheusRecorder struct{}
+
+func (prometheusRecorder) UpdateCurrentDifficulty(difficulty int) {
+	UpdateCurrentDifficulty(difficulty)
+}
+
+func (prometheusRecorder) RecordConnection(event string) {
+	RecordConnection(event)
+}
+
+func (prometheusRecorder) RecordPuzzleSolved(difficulty int, algorithm string, solveTime time.Duration) {
+	RecordPuzzleSolved(difficulty, algorithm, solveTime)
+}
+
+func (prometheusRecorder) RecordProcessingTime(event string, duration time.Duration) {
+	RecordProcessingTime(event, duration)
+}
+
+func (prometheusRecorder) RecordPuzzleFailed(difficulty int, algorithm string) {
+	RecordPuzzleFailed(difficulty, algorithm)
+}
+
+func (prometheusRecorder) RecordPuzzleExpired(difficulty int, algorithm string) {
+	RecordPuzzleExpired(difficulty, algorithm)
+}
+
+func (prometheusRecorder) RecordDifficultyAdjustment(direction string) {
+	RecordDifficultyAdjustment(direction)
+}
+
+func (prometheusRecorder) RecordSLABreach(difficulty int) {
+	RecordSLABreach(difficulty)
+}
+
+func (prometheusRecorder) RecordAlgorithmFallback() {
+	RecordAlgorithmFallback()
+}
+
+func (prometheusRecorder) UpdateBehaviorAggregates(clientsByDifficulty map[int]int, flaggedAttackers int, avgReputation, avgSuspicious float64, newClientsPerMinute int) {
+	UpdateBehaviorAggregates(clientsByDifficulty, flaggedAttackers, avgReputation, avgSuspicious, newClientsPerMinute)
+}
+
+func (prometheusRecorder) UpdateShadowDifficulty(controller string, shadow, active int) {
+	UpdateShadowDifficulty(controller, shadow, active)
+}
+
+func (prometheusRecorder) RecordProtocolState(state string, duration time.Duration) {
+	RecordProtocolState(state, duration)
+}
+
+func (prometheusRecorder) RecordProtocolStall(state string) {
+	RecordProtocolStall(state)
+}
+
+func (prometheusRecorder) RecordConnectionBytes(sent, received int64) {
+	RecordConnectionBytes(sent, received)
+}
+
+func (prometheusRecorder) RecordChallengeIssued(format string, size int) {
+	RecordChallengeIssued(format, size)
+}
+
+func (prometheusRecorder) UpdateSurge(newClientsPerMinute float64, boost int) {
+	UpdateSurge(newClientsPerMinute, boost)
+}
+
+func (prometheusRecorder) RecordSolveTokenRedemption(found bool) {
+	RecordSolveTokenRedemption(found)
+}
+
+func (prometheusRecorder) RecordConnectionShed(reason string) {
+	RecordConnectionShed(reason)
+}
+
+func (prometheusRecorder) RecordDifficultyHint(result string) {
+	RecordDifficultyHint(result)
+}
+
+func (prometheusRecorder) RecordOverSolve(difficulty int, algorithm string) {
+	RecordOverSolve(difficulty, algorithm)
+}
@@ -0,0 +1,39 @@
+package pow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// SolutionHash returns the hex hash a nonce produces for a challenge, the same hash
+// VerifyPoW and VerifyArgon2PoW check for leading zeros
+func SolutionHash(challenge *SecureChallenge, nonce string) (string, error) {
+	data := []byte(challenge.Seed + nonce)
+
+	switch challenge.Algorithm {
+	case "sha256":
+		hash := sha256.Sum256(data)
+		return hex.EncodeToString(hash[:]), nil
+	case "argon2":
+		if challenge.Argon2Params == nil {
+			return "", fmt.Errorf("missing Argon2 parameters")
+		}
+		p := challenge.Argon2Params
+		return hex.EncodeToString(argon2.IDKey(data, []byte{}, p.Time, p.Memory, p.Threads, p.KeyLength)), nil
+	default:
+		return "", fmt.Errorf("unsupported algorithm: %s", challenge.Algorithm)
+	}
+}
+
+// AchievedDifficulty counts the leading hex zeros of a solution hash
+func AchievedDifficulty(hashHex string) int {
+	for i, c := range hashHex {
+		if c != '0' {
+			return i
+		}
+	}
+	return len(hashHex)
+}
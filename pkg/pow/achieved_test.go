@@ -0,0 +1,39 @@
+package pow
+
+import "testing"
+
+func TestAchievedDifficultyMatchesVerification(t *testing.T) {
+	challenge, err := GenerateSecureChallenge(3, "sha256", "test-client", testSigningKey)
+	if err != nil {
+		t.Fatalf("Failed to generate challenge: %v", err)
+	}
+
+	nonce, err := SolveSecureChallenge(challenge, testSigningKey)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+
+	hash, err := SolutionHash(challenge, nonce)
+	if err != nil {
+		t.Fatalf("Failed to hash solution: %v", err)
+	}
+
+	if achieved := AchievedDifficulty(hash); achieved < challenge.Difficulty {
+		t.Errorf("Accepted solution achieved difficulty %d, required %d", achieved, challenge.Difficulty)
+	}
+}
+
+func TestAchievedDifficulty(t *testing.T) {
+	tests := map[string]int{
+		"abc":  0,
+		"0abc": 1,
+		"000f": 3,
+		"0000": 4,
+		"":     0,
+	}
+	for hash, want := range tests {
+		if got := AchievedDifficulty(hash); got != want {
+			t.Errorf("AchievedDifficulty(%q) = %d, want %d", hash, got, want)
+		}
+	}
+}
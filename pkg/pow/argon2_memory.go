@@ -0,0 +1,83 @@
+package pow
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrArgon2Memory is returned when the host cannot spare the memory an Argon2 hash needs
+var ErrArgon2Memory = errors.New("insufficient memory for argon2")
+
+// argon2EffortOffset is how many extra SHA-256 leading zeros roughly match the cost of
+// one 64MB Argon2 hash (~20ms vs ~300ns, about 16^4 times more work)
+const argon2EffortOffset = 4
+
+// availableMemoryKiB reports the memory available to this process, ok is false when unknown.
+// It is a variable so tests can simulate memory pressure.
+var availableMemoryKiB = readAvailableMemoryKiB
+
+// CheckArgon2Memory returns ErrArgon2Memory if memoryKiB cannot currently be allocated
+func CheckArgon2Memory(memoryKiB uint32) error {
+	available, ok := availableMemoryKiB()
+	if !ok {
+		return nil
+	}
+	if uint64(memoryKiB) > available {
+		return fmt.Errorf("%w: need %d KiB, %d KiB available", ErrArgon2Memory, memoryKiB, available)
+	}
+	return nil
+}
+
+// EquivalentSHA256Difficulty maps an Argon2 difficulty to a SHA-256 difficulty of similar solve effort
+func EquivalentSHA256Difficulty(argon2Difficulty int) int {
+	return min(argon2Difficulty+argon2EffortOffset, 6)
+}
+
+// readAvailableMemoryKiB uses MemAvailable, further limited by the cgroup v2 memory limit
+func readAvailableMemoryKiB() (uint64, bool) {
+	available, ok := readMemInfoKiB("/proc/meminfo", "MemAvailable")
+	if !ok {
+		return 0, false
+	}
+
+	if limit, ok := readCgroupBytes("/sys/fs/cgroup/memory.max"); ok {
+		if usage, ok := readCgroupBytes("/sys/fs/cgroup/memory.current"); ok && usage < limit {
+			available = min(available, (limit-usage)/1024)
+		}
+	}
+
+	return available, true
+}
+
+func readMemInfoKiB(path, field string) (uint64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Format: "MemAvailable:   12345678 kB"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == field+":" {
+			value, err := strconv.ParseUint(fields[1], 10, 64)
+			return value, err == nil
+		}
+	}
+	return 0, false
+}
+
+func readCgroupBytes(path string) (uint64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	// "max" means no limit
+	return value, err == nil
+}
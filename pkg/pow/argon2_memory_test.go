@@ -0,0 +1,38 @@
+package pow
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckArgon2MemoryUnderPressure(t *testing.T) {
+	original := availableMemoryKiB
+	defer func() { availableMemoryKiB = original }()
+
+	need := DefaultArgon2Params().Memory
+
+	availableMemoryKiB = func() (uint64, bool) { return uint64(need) / 2, true }
+	if err := CheckArgon2Memory(need); !errors.Is(err, ErrArgon2Memory) {
+		t.Errorf("Expected ErrArgon2Memory under memory pressure, got %v", err)
+	}
+
+	availableMemoryKiB = func() (uint64, bool) { return uint64(need) * 4, true }
+	if err := CheckArgon2Memory(need); err != nil {
+		t.Errorf("Expected enough memory, got %v", err)
+	}
+
+	// Unknown memory must not block Argon2
+	availableMemoryKiB = func() (uint64, bool) { return 0, false }
+	if err := CheckArgon2Memory(need); err != nil {
+		t.Errorf("Expected no error when memory is unknown, got %v", err)
+	}
+}
+
+func TestEquivalentSHA256Difficulty(t *testing.T) {
+	tests := map[int]int{1: 5, 2: 6, 6: 6}
+	for argon2Difficulty, want := range tests {
+		if got := EquivalentSHA256Difficulty(argon2Difficulty); got != want {
+			t.Errorf("EquivalentSHA256Difficulty(%d) = %d, want %d", argon2Difficulty, got, want)
+		}
+	}
+}
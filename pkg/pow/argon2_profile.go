@@ -0,0 +1,186 @@
+package pow
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Argon2 parameter presets selectable with SetArgon2Preset
+const (
+	Argon2PresetDefault = "default"
+
+	// Argon2PresetTest hashes with the smallest parameters Argon2 allows, so tests and local
+	// demos can run the Argon2 path in microseconds. It gives no memory hardness at all.
+	Argon2PresetTest = "test"
+)
+
+// MinArgon2Memory is the least memory in KiB a configured profile may ask for. Below it
+// Argon2 stops being meaningfully memory-hard and GPUs solve it like SHA-256.
+const MinArgon2Memory = 8 * 1024
+
+// Argon2Profile is the Argon2 parameters challenges of each difficulty are issued with.
+// Difficulties it leaves out use DefaultArgon2Params.
+type Argon2Profile map[int]Argon2Params
+
+// argon2TestPreset is whether new challenges use the test preset's parameters
+var argon2TestPreset atomic.Bool
+
+// argon2Profile is the profile set with SetArgon2Profile, nil for the defaults
+var argon2Profile atomic.Pointer[Argon2Profile]
+
+// SetArgon2Preset switches new challenges to the test preset's parameters, or back to the
+// configured profile. Challenges carry their parameters, so verification is unaffected.
+func SetArgon2Preset(preset string) error {
+	switch preset {
+	case "", Argon2PresetDefault:
+		argon2TestPreset.Store(false)
+	case Argon2PresetTest:
+		argon2TestPreset.Store(true)
+		log.Printf("⚠️ ARGON2 TEST PRESET ENABLED: Argon2 challenges use %d KiB and are NOT memory-hard, for tests and local development only, never production",
+			testArgon2Params().Memory)
+	default:
+		return fmt.Errorf("unknown Argon2 preset %q (must be %s or %s)", preset, Argon2PresetDefault, Argon2PresetTest)
+	}
+	return nil
+}
+
+// Argon2Preset returns the preset set with SetArgon2Preset
+func Argon2Preset() string {
+	if argon2TestPreset.Load() {
+		return Argon2PresetTest
+	}
+	return Argon2PresetDefault
+}
+
+// SetArgon2Profile sets the parameters new Argon2 challenges get per difficulty, nil
+// restores the defaults. A profile with an out-of-range difficulty or parameters below
+// MinArgon2Memory, one pass or one thread is rejected as a whole. A zero key length
+// means 32 bytes.
+func SetArgon2Profile(profile Argon2Profile) error {
+	if len(profile) == 0 {
+		argon2Profile.Store(nil)
+		return nil
+	}
+
+	validated := make(Argon2Profile, len(profile))
+	for difficulty, params := range profile {
+		if difficulty < 1 || difficulty > 6 {
+			return fmt.Errorf("argon2 profile difficulty must be between 1 and 6, got %d", difficulty)
+		}
+		if params.Memory < MinArgon2Memory {
+			return fmt.Errorf("argon2 memory for difficulty %d is %d KiB, below the %d KiB floor", difficulty, params.Memory, MinArgon2Memory)
+		}
+		if params.Time < 1 || params.Threads < 1 {
+			return fmt.Errorf("argon2 time and threads for difficulty %d must be at least 1", difficulty)
+		}
+		if params.KeyLength == 0 {
+			params.KeyLength = 32
+		}
+		validated[difficulty] = params
+	}
+	argon2Profile.Store(&validated)
+	return nil
+}
+
+// Argon2ParamsFor returns the parameters a new Argon2 challenge of difficulty is issued with
+func Argon2ParamsFor(difficulty int) *Argon2Params {
+	if argon2TestPreset.Load() {
+		return testArgon2Params()
+	}
+	if profile := argon2Profile.Load(); profile != nil {
+		if params, ok := (*profile)[difficulty]; ok {
+			return &params
+		}
+	}
+	return DefaultArgon2Params()
+}
+
+// MaxArgon2Memory returns the most memory in KiB a new Argon2 challenge of any difficulty
+// is issued with under the current preset and profile
+func MaxArgon2Memory() uint32 {
+	var memory uint32
+	for difficulty := 1; difficulty <= 6; difficulty++ {
+		memory = max(memory, Argon2ParamsFor(difficulty).Memory)
+	}
+	return memory
+}
+
+// ParseArgon2Profile reads comma-separated difficulty ranges and their parameters as
+// <memory KiB>/<time>/<threads>, e.g. "1-2:16384/1/2,5-6:524288/3/4". A range may be a
+// single difficulty, and ranges must not overlap. The result is checked by SetArgon2Profile.
+func ParseArgon2Profile(spec string) (Argon2Profile, error) {
+	profile := make(Argon2Profile)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		levels, values, ok := strings.Cut(entry, ":")
+		fields := strings.Split(values, "/")
+		if !ok || len(fields) != 3 {
+			return nil, fmt.Errorf("invalid argon2 profile entry %q (want <difficulties>:<memory KiB>/<time>/<threads>)", entry)
+		}
+
+		var numbers [3]uint64
+		for i, field := range fields {
+			n, err := strconv.ParseUint(strings.TrimSpace(field), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q in argon2 profile entry %q", field, entry)
+			}
+			numbers[i] = n
+		}
+		if numbers[2] > 255 {
+			return nil, fmt.Errorf("too many threads in argon2 profile entry %q (at most 255)", entry)
+		}
+
+		low, high, err := ParseDifficultyRange(levels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid argon2 profile entry %q: %w", entry, err)
+		}
+		for d := low; d <= high; d++ {
+			if _, ok := profile[d]; ok {
+				return nil, fmt.Errorf("difficulty %d appears twice in the argon2 profile", d)
+			}
+			profile[d] = Argon2Params{
+				Memory:    uint32(numbers[0]),
+				Time:      uint32(numbers[1]),
+				Threads:   uint8(numbers[2]),
+				KeyLength: 32,
+			}
+		}
+	}
+	return profile, nil
+}
+
+// ParseDifficultyRange reads "N" or "N-M" within 1 and 6
+func ParseDifficultyRange(levels string) (int, int, error) {
+	lowStr, highStr, isRange := strings.Cut(levels, "-")
+	if !isRange {
+		highStr = lowStr
+	}
+	low, err := strconv.Atoi(strings.TrimSpace(lowStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad difficulty %q", lowStr)
+	}
+	high, err := strconv.Atoi(strings.TrimSpace(highStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad difficulty %q", highStr)
+	}
+	if low < 1 || high > 6 || low > high {
+		return 0, 0, fmt.Errorf("difficulties must be an ascending range within 1-6")
+	}
+	return low, high, nil
+}
+
+// testArgon2Params are Argon2's minimums: one pass over 8 KiB with a single lane
+func testArgon2Params() *Argon2Params {
+	return &Argon2Params{
+		Time:      1,
+		Memory:    8,
+		Threads:   1,
+		KeyLength: 32,
+	}
+}
@@ -0,0 +1,167 @@
+package pow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArgon2TestPresetSolvesThroughThePipeline(t *testing.T) {
+	if err := SetArgon2Preset(Argon2PresetTest); err != nil {
+		t.Fatalf("SetArgon2Preset failed: %v", err)
+	}
+	t.Cleanup(func() { SetArgon2Preset(Argon2PresetDefault) })
+
+	challenge, err := GenerateSecureChallenge(1, "argon2", "test-client", testSigningKey)
+	if err != nil {
+		t.Fatalf("GenerateSecureChallenge failed: %v", err)
+	}
+	if challenge.Argon2Params.Memory != 8 || challenge.Argon2Params.Threads != 1 {
+		t.Fatalf("Expected the test preset's 8 KiB and 1 thread, got %+v", challenge.Argon2Params)
+	}
+
+	// The parameters travel with the challenge, so a binary client solves with them too
+	data, err := challenge.ToBinary()
+	if err != nil {
+		t.Fatalf("ToBinary failed: %v", err)
+	}
+	decoded, err := SecureChallengeFromBinary(data, "test-client")
+	if err != nil {
+		t.Fatalf("SecureChallengeFromBinary failed: %v", err)
+	}
+	if *decoded.Argon2Params != *challenge.Argon2Params {
+		t.Errorf("Expected %+v after the binary round trip, got %+v", challenge.Argon2Params, decoded.Argon2Params)
+	}
+
+	nonce, err := SolveSecureChallenge(challenge, testSigningKey)
+	if err != nil {
+		t.Fatalf("SolveSecureChallenge failed: %v", err)
+	}
+	result := NewValidationPipeline(testSigningKey).Validate(&Solution{
+		ChallengeID: challenge.Nonce,
+		Challenge:   challenge,
+		Nonce:       nonce,
+		ClientID:    "test-client",
+		Timestamp:   time.Now().UnixMicro(),
+	})
+	if !result.Valid {
+		t.Errorf("Expected the solution to validate, failed at %s: %v", result.Stage, result.Error)
+	}
+
+	// Switching back only affects new challenges
+	SetArgon2Preset(Argon2PresetDefault)
+	if params := Argon2ParamsFor(1); params.Memory != 64*1024 {
+		t.Errorf("Expected the default 64 MB, got %d KiB", params.Memory)
+	}
+	if err := SetArgon2Preset("fast"); err == nil {
+		t.Error("Expected an unknown preset to be rejected")
+	}
+}
+
+func TestDifficultySixChallengeUsesTheHeavyProfile(t *testing.T) {
+	profile, err := ParseArgon2Profile("1-2:16384/1/2, 5-6:524288/3/4")
+	if err != nil {
+		t.Fatalf("ParseArgon2Profile failed: %v", err)
+	}
+	if err := SetArgon2Profile(profile); err != nil {
+		t.Fatalf("SetArgon2Profile failed: %v", err)
+	}
+	t.Cleanup(func() { SetArgon2Profile(nil) })
+
+	heavy := Argon2Params{Memory: 524288, Time: 3, Threads: 4, KeyLength: 32}
+	light := Argon2Params{Memory: 16384, Time: 1, Threads: 2, KeyLength: 32}
+	keyManager := NewStaticKeyManager(testSigningKey)
+
+	challenge, err := GenerateSecureChallengeWithKeyManager(6, "argon2", "test-client", keyManager)
+	if err != nil {
+		t.Fatalf("GenerateSecureChallengeWithKeyManager failed: %v", err)
+	}
+	if *challenge.Argon2Params != heavy {
+		t.Fatalf("Expected the heavy profile %+v at difficulty 6, got %+v", heavy, *challenge.Argon2Params)
+	}
+	if params := Argon2ParamsFor(2); *params != light {
+		t.Errorf("Expected the light profile %+v at difficulty 2, got %+v", light, *params)
+	}
+	if params := Argon2ParamsFor(3); *params != *DefaultArgon2Params() {
+		t.Errorf("Expected the defaults at difficulty 3, left out of the profile, got %+v", *params)
+	}
+
+	// A client sees the heavy parameters in both formats
+	data, err := challenge.ToBinary()
+	if err != nil {
+		t.Fatalf("ToBinary failed: %v", err)
+	}
+	decoded, err := SecureChallengeFromBinary(data, "test-client")
+	if err != nil {
+		t.Fatalf("SecureChallengeFromBinary failed: %v", err)
+	}
+	if *decoded.Argon2Params != heavy {
+		t.Errorf("Expected the heavy profile after the binary round trip, got %+v", *decoded.Argon2Params)
+	}
+
+	// The parameters are signed, swapping in the light ones is caught before any hashing
+	tampered := *challenge
+	tampered.Argon2Params = &light
+	result := NewValidationPipeline(testSigningKey).Validate(&Solution{
+		ChallengeID: tampered.Nonce,
+		Challenge:   &tampered,
+		Nonce:       "0",
+		ClientID:    "test-client",
+		Timestamp:   time.Now().UnixMicro(),
+	})
+	if result.Valid || result.Stage != "signature" {
+		t.Errorf("Expected lighter parameters to fail the signature check, got valid=%v at %s", result.Valid, result.Stage)
+	}
+}
+
+func TestArgon2ProfileRejectsUnsafeParameters(t *testing.T) {
+	t.Cleanup(func() { SetArgon2Profile(nil) })
+
+	for _, profile := range []Argon2Profile{
+		{1: {Memory: MinArgon2Memory - 1, Time: 1, Threads: 1}},
+		{1: {Memory: MinArgon2Memory, Time: 0, Threads: 1}},
+		{1: {Memory: MinArgon2Memory, Time: 1, Threads: 0}},
+		{7: {Memory: MinArgon2Memory, Time: 1, Threads: 1}},
+	} {
+		if err := SetArgon2Profile(profile); err == nil {
+			t.Errorf("Expected profile %+v to be rejected", profile)
+		}
+	}
+	if params := Argon2ParamsFor(1); *params != *DefaultArgon2Params() {
+		t.Errorf("Expected a rejected profile to leave the defaults, got %+v", *params)
+	}
+
+	for _, spec := range []string{"1-2:16384/1", "1-2:16384/1/x", "0-2:16384/1/2", "1-3:16384/1/2,3:16384/1/2", "1:16384/1/256"} {
+		if _, err := ParseArgon2Profile(spec); err == nil {
+			t.Errorf("Expected %q to fail to parse", spec)
+		}
+	}
+}
+
+func TestMaxArgon2MemoryFollowsPresetAndProfile(t *testing.T) {
+	t.Cleanup(func() {
+		SetArgon2Profile(nil)
+		SetArgon2Preset(Argon2PresetDefault)
+	})
+
+	if got := MaxArgon2Memory(); got != DefaultArgon2Params().Memory {
+		t.Errorf("Expected the default %d KiB without a profile, got %d", DefaultArgon2Params().Memory, got)
+	}
+
+	profile, err := ParseArgon2Profile("1-2:16384/1/2,5-6:524288/3/4")
+	if err != nil {
+		t.Fatalf("ParseArgon2Profile failed: %v", err)
+	}
+	if err := SetArgon2Profile(profile); err != nil {
+		t.Fatalf("SetArgon2Profile failed: %v", err)
+	}
+	if got := MaxArgon2Memory(); got != 524288 {
+		t.Errorf("Expected the profile's largest 524288 KiB, got %d", got)
+	}
+
+	if err := SetArgon2Preset(Argon2PresetTest); err != nil {
+		t.Fatalf("SetArgon2Preset failed: %v", err)
+	}
+	if got := MaxArgon2Memory(); got != 8 {
+		t.Errorf("Expected the test preset's 8 KiB, got %d", got)
+	}
+}
@@ -0,0 +1,102 @@
+package pow
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// solvedSolution signs and solves a fresh difficulty 1 challenge for clientID
+func solvedSolution(t *testing.T, clientID string) *Solution {
+	t.Helper()
+	challenge, err := newSecureChallenge(1, "sha256", clientID, ChallengeSources{})
+	if err != nil {
+		t.Fatalf("newSecureChallenge failed: %v", err)
+	}
+	if err := challenge.Sign(testSigningKey); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	nonce, err := SolveSecureChallenge(challenge, testSigningKey)
+	if err != nil {
+		t.Fatalf("SolveSecureChallenge failed: %v", err)
+	}
+	return &Solution{
+		ChallengeID: challenge.Nonce,
+		Challenge:   challenge,
+		Nonce:       nonce,
+		ClientID:    clientID,
+		Timestamp:   time.Now().UnixMicro(),
+	}
+}
+
+func TestBatchCountsEverySolutionAgainstTheRateLimit(t *testing.T) {
+	pipeline := NewValidationPipeline(testSigningKey)
+	pipeline.SetRateLimitConfig(time.Minute, 4)
+	pipeline.SetBatchWorkers(2)
+
+	batch := []*Solution{
+		solvedSolution(t, "batch-client"),
+		solvedSolution(t, "batch-client"),
+		solvedSolution(t, "batch-client"),
+	}
+	for i, result := range pipeline.BatchValidate(batch) {
+		if !result.Valid {
+			t.Errorf("Expected solution %d to be valid, failed at %s: %v", i, result.Stage, result.Error)
+		}
+	}
+
+	// Three of the four requests are used, a batch of two no longer fits as a whole
+	second := []*Solution{solvedSolution(t, "batch-client"), solvedSolution(t, "batch-client")}
+	for i, result := range pipeline.BatchValidate(second) {
+		if result.Valid || result.Stage != "rate_limit" {
+			t.Errorf("Expected solution %d to be rate limited, got valid=%v at %s", i, result.Valid, result.Stage)
+		}
+	}
+
+	// The rejected batch reserved nothing, so one more request still fits
+	if err := pipeline.checkRateLimit("batch-client"); err != nil {
+		t.Errorf("Expected the last request of the window to be allowed: %v", err)
+	}
+}
+
+func TestRememberedChallengeIsFoundUntilItExpires(t *testing.T) {
+	pipeline := NewValidationPipeline(testSigningKey)
+	solution := solvedSolution(t, "id-client")
+	pipeline.RememberChallenge(solution.Challenge)
+
+	if found, ok := pipeline.LookupChallenge(solution.ChallengeID); !ok || found != solution.Challenge {
+		t.Fatal("Expected the remembered challenge to be found by its nonce")
+	}
+	if _, ok := pipeline.LookupChallenge("unknown"); ok {
+		t.Error("Expected an unknown challenge id to be missing")
+	}
+
+	solution.Challenge.ExpiresAt = time.Now().Add(-time.Hour).UnixMicro()
+	if _, ok := pipeline.LookupChallenge(solution.ChallengeID); ok {
+		t.Error("Expected an expired challenge to be missing")
+	}
+
+	pipeline.cleanupExpiredChallenges()
+	if size := pipeline.GetCacheStats()["challenge_cache_size"]; size != 0 {
+		t.Errorf("Expected the cleanup to drop the expired challenge, %d left", size)
+	}
+}
+
+func TestRememberedChallengesStayWithinTheCap(t *testing.T) {
+	pipeline := NewValidationPipeline(testSigningKey)
+	expiresAt := time.Now().Add(time.Minute).UnixMicro()
+	for i := 0; i < maxChallengeCacheSize+100; i++ {
+		pipeline.RememberChallenge(&SecureChallenge{Nonce: fmt.Sprintf("nonce-%d", i), ExpiresAt: expiresAt})
+	}
+
+	stats := pipeline.GetCacheStats()
+	if stats["challenge_cache_size"] != maxChallengeCacheSize || stats["challenge_cache_evictions"] != 100 {
+		t.Errorf("Expected %d challenges and 100 evictions, got %v", maxChallengeCacheSize, stats)
+	}
+	if _, ok := pipeline.LookupChallenge("nonce-0"); ok {
+		t.Error("Expected the oldest challenge to be evicted")
+	}
+	if _, ok := pipeline.LookupChallenge(fmt.Sprintf("nonce-%d", maxChallengeCacheSize+99)); !ok {
+		t.Error("Expected the newest challenge to be kept")
+	}
+}
@@ -0,0 +1,104 @@
+package pow
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// BenchmarkResult summarises repeated solves of one algorithm at a fixed difficulty
+type BenchmarkResult struct {
+	Algorithm    string  `json:"algorithm"`
+	Difficulty   int     `json:"difficulty"`
+	Iterations   int     `json:"iterations"`
+	Completed    int     `json:"completed"`
+	MeanMs       float64 `json:"mean_ms"`
+	P95Ms        float64 `json:"p95_ms"`
+	SolvesPerSec float64 `json:"solves_per_sec"`
+}
+
+// RunBenchmark solves fresh challenges of the given algorithm and difficulty.
+// Iterations stop early once budget is spent so callers can bound CPU usage, a solve
+// still running then is abandoned and not counted. Cancelling ctx, e.g. when the
+// requesting client goes away, abandons the benchmark and returns the context's error.
+func RunBenchmark(ctx context.Context, algorithm string, difficulty, iterations int, budget time.Duration) (*BenchmarkResult, error) {
+	if difficulty < 1 || difficulty > 6 {
+		return nil, fmt.Errorf("difficulty must be between 1 and 6, got %d", difficulty)
+	}
+	if iterations < 1 {
+		return nil, fmt.Errorf("iterations must be positive, got %d", iterations)
+	}
+	if algorithm != "sha256" && algorithm != "argon2" {
+		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+
+	solveCtx := ctx
+	if budget > 0 {
+		var cancel context.CancelFunc
+		solveCtx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+
+	durations := make([]time.Duration, 0, iterations)
+	for i := 0; i < iterations && solveCtx.Err() == nil; i++ {
+		seedBytes := make([]byte, 16)
+		if _, err := rand.Read(seedBytes); err != nil {
+			return nil, fmt.Errorf("failed to generate random seed: %w", err)
+		}
+		seed := hex.EncodeToString(seedBytes)
+
+		solveStart := time.Now()
+		var err error
+		if algorithm == "sha256" {
+			_, err = SolveChallengeCtx(solveCtx, &Challenge{Seed: seed, Difficulty: difficulty})
+		} else {
+			params := Argon2ParamsFor(difficulty)
+			_, err = SolveArgon2ChallengeCtx(solveCtx, &Argon2Challenge{
+				Seed:       seed,
+				Difficulty: difficulty,
+				Time:       params.Time,
+				Memory:     params.Memory,
+				Threads:    params.Threads,
+				KeyLen:     params.KeyLength,
+			})
+		}
+		if solveCtx.Err() != nil {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("benchmark solve failed: %w", err)
+		}
+		durations = append(durations, time.Since(solveStart))
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &BenchmarkResult{
+		Algorithm:  algorithm,
+		Difficulty: difficulty,
+		Iterations: iterations,
+		Completed:  len(durations),
+	}
+	if len(durations) == 0 {
+		return result, nil
+	}
+
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	p95Index := (len(durations)*95+99)/100 - 1
+
+	result.MeanMs = float64(total.Microseconds()) / 1000 / float64(len(durations))
+	result.P95Ms = float64(durations[p95Index].Microseconds()) / 1000
+	if total > 0 {
+		result.SolvesPerSec = float64(len(durations)) / total.Seconds()
+	}
+
+	return result, nil
+}
@@ -0,0 +1,48 @@
+package pow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBenchmarkBudgetCutsASolveShort(t *testing.T) {
+	// A difficulty 6 SHA-256 solve takes millions of hashes, far longer than the budget
+	start := time.Now()
+	result, err := RunBenchmark(context.Background(), "sha256", 6, 3, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("RunBenchmark failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the 50ms budget to stop the solve, took %v", elapsed)
+	}
+	if result.Completed >= result.Iterations {
+		t.Errorf("Expected the budget to leave iterations undone, completed %d of %d", result.Completed, result.Iterations)
+	}
+}
+
+func TestBenchmarkWithoutBudgetCompletesEveryIteration(t *testing.T) {
+	result, err := RunBenchmark(context.Background(), "sha256", 1, 5, 0)
+	if err != nil {
+		t.Fatalf("RunBenchmark failed: %v", err)
+	}
+	if result.Completed != 5 {
+		t.Errorf("Expected 5 completed solves, got %+v", result)
+	}
+}
+
+func TestBenchmarkStopsWhenItsContextIsCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// The budget alone would let the difficulty 6 solves run for a minute
+	start := time.Now()
+	_, err := RunBenchmark(ctx, "sha256", 6, 3, time.Minute)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the context's error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the cancelled context to stop the solve, took %v", elapsed)
+	}
+}
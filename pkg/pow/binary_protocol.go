@@ -6,14 +6,17 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"strings"
 )
 
 // BinaryChallenge represents a compact binary format for challenges
 // Format: [Version:1][Algorithm:1][Difficulty:1][Timestamp:8][ExpiresAt:8]
 //         [Seed:16][Nonce:8][Signature:32][Argon2Params:10] (optional)
+//         [Target:4] (optional, compact SHA-256 target)
 type BinaryChallenge struct {
 	header     [3]byte   // version, algorithm, difficulty
 	timestamps [16]byte  // timestamp + expiresAt (8 bytes each)
@@ -39,6 +42,33 @@ const (
 	AlgorithmArgon2 AlgorithmType = 0x02
 )
 
+// supportedAlgorithms lists the algorithm bytes this decoder understands, in byte order
+var supportedAlgorithms = []struct {
+	algorithm AlgorithmType
+	name      string
+}{
+	{AlgorithmSHA256, "sha256"},
+	{AlgorithmArgon2, "argon2"},
+}
+
+// UnknownAlgorithmError is returned for a binary challenge whose algorithm byte this
+// decoder doesn't know, most likely one added to a newer server. 0x00 means the
+// challenge carries no algorithm at all.
+type UnknownAlgorithmError struct {
+	Algorithm AlgorithmType
+}
+
+func (e *UnknownAlgorithmError) Error() string {
+	supported := make([]string, len(supportedAlgorithms))
+	for i, s := range supportedAlgorithms {
+		supported[i] = fmt.Sprintf("0x%02x (%s)", byte(s.algorithm), s.name)
+	}
+	if e.Algorithm == 0 {
+		return fmt.Sprintf("challenge has no algorithm type (0x00), supported: %s", strings.Join(supported, ", "))
+	}
+	return fmt.Sprintf("unknown algorithm type 0x%02x, supported: %s", byte(e.Algorithm), strings.Join(supported, ", "))
+}
+
 // ToBinary converts a SecureChallenge to binary format
 func (c *SecureChallenge) ToBinary() ([]byte, error) {
 	var bc BinaryChallenge
@@ -114,6 +144,15 @@ func (c *SecureChallenge) ToBinary() ([]byte, error) {
 		// Extend result to include Argon2 params
 		result = append(result, bc.argon2[:]...)
 	}
+
+	// Target challenges carry the compact target last
+	if c.Target != "" {
+		target, err := c.TargetValue()
+		if err != nil {
+			return nil, err
+		}
+		result = binary.BigEndian.AppendUint32(result, CompactTarget(target))
+	}
 	
 	return result, nil
 }
@@ -133,13 +172,13 @@ func SecureChallengeFromBinary(data []byte, clientID string) (*SecureChallenge,
 	algorithmByte := AlgorithmType(data[1])
 	challenge.Difficulty = int(data[2])
 	
-	switch algorithmByte {
-	case AlgorithmSHA256:
-		challenge.Algorithm = "sha256"
-	case AlgorithmArgon2:
-		challenge.Algorithm = "argon2"
-	default:
-		return nil, fmt.Errorf("unknown algorithm type: %d", algorithmByte)
+	for _, supported := range supportedAlgorithms {
+		if supported.algorithm == algorithmByte {
+			challenge.Algorithm = supported.name
+		}
+	}
+	if challenge.Algorithm == "" {
+		return nil, &UnknownAlgorithmError{Algorithm: algorithmByte}
 	}
 	
 	// Parse timestamps
@@ -168,6 +207,15 @@ func SecureChallengeFromBinary(data []byte, clientID string) (*SecureChallenge,
 			KeyLength: uint32(data[84]),
 		}
 	}
+
+	// Four bytes past the fixed fields are a compact target
+	fixed := 75
+	if challenge.Algorithm == "argon2" {
+		fixed = 85
+	}
+	if len(data) == fixed+4 {
+		challenge.Target = fmt.Sprintf("%08x", binary.BigEndian.Uint32(data[fixed:]))
+	}
 	
 	return challenge, nil
 }
@@ -245,6 +293,36 @@ func (t *ChallengeTransport) SendChallenge(conn net.Conn, challenge *SecureChall
 		return fmt.Errorf("failed to encode challenge: %w", err)
 	}
 	
+	_, err = conn.Write(EncodeFrame(data, format))
+	if err != nil {
+		return fmt.Errorf("failed to send challenge: %w", err)
+	}
+	
+	return nil
+}
+
+// ReceiveChallenge receives a challenge from a network connection
+func (t *ChallengeTransport) ReceiveChallenge(conn net.Conn, clientID string) (*SecureChallenge, ChallengeFormat, error) {
+	data, format, err := ReadFrame(conn)
+	if err != nil {
+		return nil, "", err
+	}
+	
+	// Decode challenge
+	challenge, err := t.encoder.Decode(data, format, clientID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode challenge: %w", err)
+	}
+	
+	return challenge, format, nil
+}
+
+// maxChallengeSize bounds the data length a frame header may announce
+const maxChallengeSize = 10 * 1024 // 10KB max
+
+// EncodeFrame wraps encoded challenge data in a length-prefixed frame,
+// [format:1][length:4][data:n], so binary data may contain any byte
+func EncodeFrame(data []byte, format ChallengeFormat) []byte {
 	// Send format indicator (1 byte) + length (4 bytes) + data
 	formatByte := byte(0)
 	switch format {
@@ -254,37 +332,38 @@ func (t *ChallengeTransport) SendChallenge(conn net.Conn, challenge *SecureChall
 		formatByte = 2
 	}
 	
-	// Create packet: [format:1][length:4][data:n]
 	packet := make([]byte, 5+len(data))
 	packet[0] = formatByte
 	binary.BigEndian.PutUint32(packet[1:5], uint32(len(data)))
 	copy(packet[5:], data)
-	
-	_, err = conn.Write(packet)
-	if err != nil {
-		return fmt.Errorf("failed to send challenge: %w", err)
-	}
-	
-	return nil
+	return packet
 }
 
-// ReceiveChallenge receives a challenge from a network connection
-func (t *ChallengeTransport) ReceiveChallenge(conn net.Conn, clientID string) (*SecureChallenge, ChallengeFormat, error) {
+// IsFrameStart reports whether b can start a frame written by EncodeFrame, rather than
+// a newline-delimited JSON challenge or error line
+func IsFrameStart(b byte) bool {
+	return b == 1 || b == 2
+}
+
+// ErrTruncatedFrame is returned by ReadFrame when the connection closes partway through a frame
+var ErrTruncatedFrame = errors.New("connection closed mid-frame")
+
+// ReadFrame reads one frame written by EncodeFrame and returns its data and format. The
+// header and data are reassembled however TCP fragments them.
+func ReadFrame(r io.Reader) ([]byte, ChallengeFormat, error) {
 	// Read header (format + length)
 	header := make([]byte, 5)
-	n, err := readFull(conn, header)
-	if err != nil {
+	if n, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, "", fmt.Errorf("%w: got %d of 5 header bytes", ErrTruncatedFrame, n)
+		}
 		return nil, "", fmt.Errorf("failed to read challenge header: %w", err)
 	}
-	if n != 5 {
-		return nil, "", fmt.Errorf("incomplete header read: got %d bytes, expected 5", n)
-	}
 	
 	formatByte := header[0]
 	dataLength := binary.BigEndian.Uint32(header[1:5])
 	
 	// Validate data length to prevent integer overflow and excessive allocation
-	const maxChallengeSize = 10 * 1024 // 10KB max
 	if dataLength == 0 {
 		return nil, "", fmt.Errorf("invalid challenge data length: 0")
 	}
@@ -292,16 +371,6 @@ func (t *ChallengeTransport) ReceiveChallenge(conn net.Conn, clientID string) (*
 		return nil, "", fmt.Errorf("challenge data too large: %d bytes (max %d)", dataLength, maxChallengeSize)
 	}
 	
-	// Read challenge data with proper bounds checking
-	data := make([]byte, dataLength)
-	n, err = readFull(conn, data)
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to read challenge data: %w", err)
-	}
-	if n != int(dataLength) {
-		return nil, "", fmt.Errorf("incomplete data read: got %d bytes, expected %d", n, dataLength)
-	}
-	
 	// Determine format
 	var format ChallengeFormat
 	switch formatByte {
@@ -313,13 +382,16 @@ func (t *ChallengeTransport) ReceiveChallenge(conn net.Conn, clientID string) (*
 		return nil, "", fmt.Errorf("unknown format byte: %d", formatByte)
 	}
 	
-	// Decode challenge
-	challenge, err := t.encoder.Decode(data, format, clientID)
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to decode challenge: %w", err)
+	// Allocated only once the length is known to be within maxChallengeSize
+	data := make([]byte, dataLength)
+	if n, err := io.ReadFull(r, data); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return nil, "", fmt.Errorf("%w: got %d of %d data bytes", ErrTruncatedFrame, n, dataLength)
+		}
+		return nil, "", fmt.Errorf("failed to read challenge data: %w", err)
 	}
 	
-	return challenge, format, nil
+	return data, format, nil
 }
 
 // CompressedChallengeTransport handles compressed challenge transmission
@@ -398,9 +470,3 @@ func (m *MigrationHelper) ConvertFormat(data []byte, fromFormat, toFormat Challe
 	
 	return result, nil
 }
-
-// readFull reads exactly len(buf) bytes from r into buf.
-// It returns the number of bytes copied and an error if fewer bytes were read.
-func readFull(r io.Reader, buf []byte) (n int, err error) {
-	return io.ReadFull(r, buf)
-}
\ No newline at end of file
@@ -0,0 +1,94 @@
+package pow
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBinaryArgon2ChallengeCrossesAPipeIntact(t *testing.T) {
+	// Newline seed and nonce bytes would cut a line-based read short
+	newlines := bytes.NewReader(bytes.Repeat([]byte{'\n'}, 24))
+	challenge, err := newSecureChallenge(4, "argon2", "pipe-client", ChallengeSources{Rand: newlines})
+	if err != nil {
+		t.Fatalf("newSecureChallenge failed: %v", err)
+	}
+	if err := challenge.Sign(testSigningKey); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	serverSide, clientSide := net.Pipe()
+	defer serverSide.Close()
+	defer clientSide.Close()
+	clientSide.SetDeadline(time.Now().Add(5 * time.Second))
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- NewChallengeTransport().SendChallenge(serverSide, challenge, FormatBinary)
+	}()
+
+	received, format, err := NewChallengeTransport().ReceiveChallenge(clientSide, "pipe-client")
+	if err != nil {
+		t.Fatalf("ReceiveChallenge failed: %v", err)
+	}
+	if err := <-sent; err != nil {
+		t.Fatalf("SendChallenge failed: %v", err)
+	}
+
+	if format != FormatBinary {
+		t.Errorf("Expected a binary frame, got %s", format)
+	}
+	if received.Seed != challenge.Seed || received.Nonce != challenge.Nonce || received.Difficulty != 4 {
+		t.Errorf("Expected seed %s, nonce %s at difficulty 4, got %s, %s at %d",
+			challenge.Seed, challenge.Nonce, received.Seed, received.Nonce, received.Difficulty)
+	}
+	if received.Argon2Params == nil || *received.Argon2Params != *challenge.Argon2Params {
+		t.Errorf("Expected Argon2 parameters %+v, got %+v", challenge.Argon2Params, received.Argon2Params)
+	}
+	if err := received.Verify(testSigningKey); err != nil {
+		t.Errorf("Expected the received challenge to keep a valid signature: %v", err)
+	}
+}
+
+func TestFrameWrittenInTwoChunksIsReassembled(t *testing.T) {
+	challenge, err := newSecureChallenge(2, "sha256", "chunked-client", ChallengeSources{})
+	if err != nil {
+		t.Fatalf("newSecureChallenge failed: %v", err)
+	}
+	if err := challenge.Sign(testSigningKey); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	data, err := NewChallengeEncoder(FormatBinary).Encode(challenge, FormatBinary)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	frame := EncodeFrame(data, FormatBinary)
+
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	clientSide.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Split inside the header, so neither read gets a whole header or body at once
+	go func() {
+		defer serverSide.Close()
+		serverSide.Write(frame[:3])
+		time.Sleep(20 * time.Millisecond)
+		serverSide.Write(frame[3:])
+	}()
+
+	received, _, err := NewChallengeTransport().ReceiveChallenge(clientSide, "chunked-client")
+	if err != nil {
+		t.Fatalf("Expected the fragmented frame to decode: %v", err)
+	}
+	if received.Seed != challenge.Seed || received.Signature != challenge.Signature {
+		t.Errorf("Expected seed %s and the original signature, got %s", challenge.Seed, received.Seed)
+	}
+
+	// A frame cut off by the connection closing names the problem
+	_, _, err = ReadFrame(bytes.NewReader(frame[:len(frame)-4]))
+	if !errors.Is(err, ErrTruncatedFrame) {
+		t.Errorf("Expected ErrTruncatedFrame for a frame missing its last bytes, got %v", err)
+	}
+}
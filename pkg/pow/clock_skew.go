@@ -0,0 +1,29 @@
+package pow
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DefaultClockSkew is how far the clocks of a challenge's issuer and of whoever checks
+// it may disagree, the future allowance the validation pipeline has always had
+const DefaultClockSkew = time.Minute
+
+// clockSkew is the tolerance in nanoseconds applied by every expiry and timestamp check
+var clockSkew atomic.Int64
+
+func init() {
+	clockSkew.Store(int64(DefaultClockSkew))
+}
+
+// SetClockSkew sets the clock skew tolerated by IsExpired and the validation pipeline's
+// timestamp checks. A challenge stays valid for the tolerance past its expiry, and may be
+// stamped up to the tolerance in the future. Negative values are treated as zero.
+func SetClockSkew(skew time.Duration) {
+	clockSkew.Store(int64(max(skew, 0)))
+}
+
+// ClockSkew returns the clock skew tolerance set with SetClockSkew
+func ClockSkew() time.Duration {
+	return time.Duration(clockSkew.Load())
+}
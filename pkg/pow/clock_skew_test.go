@@ -0,0 +1,56 @@
+package pow
+
+import (
+	"testing"
+	"time"
+)
+
+// skewedChallenge is issued by a host whose clock is offset from this one
+func skewedChallenge(t *testing.T, offset time.Duration) *Solution {
+	t.Helper()
+	issuedAt := time.Now().Add(offset)
+	challenge, err := GenerateSecureChallengeWithSources(1, "sha256", "test-client", testSigningKey, ChallengeSources{
+		Now: func() time.Time { return issuedAt },
+	})
+	if err != nil {
+		t.Fatalf("GenerateSecureChallengeWithSources failed: %v", err)
+	}
+	return &Solution{ChallengeID: challenge.Nonce, Challenge: challenge, ClientID: "test-client"}
+}
+
+func TestClockSkewToleratedInBothDirections(t *testing.T) {
+	pipeline := NewValidationPipeline(testSigningKey)
+	SetClockSkew(time.Minute)
+	t.Cleanup(func() { SetClockSkew(DefaultClockSkew) })
+
+	for _, tc := range []struct {
+		name    string
+		offset  time.Duration
+		expired bool
+		valid   bool
+	}{
+		// Issued 5m-lived challenges look 30s into the future or already 30s expired
+		{"issuer ahead within skew", 30 * time.Second, false, true},
+		{"issuer behind within skew", -5*time.Minute - 30*time.Second, false, true},
+		{"issuer ahead beyond skew", 2 * time.Minute, false, false},
+		{"issuer behind beyond skew", -7 * time.Minute, true, false},
+	} {
+		solution := skewedChallenge(t, tc.offset)
+		if got := solution.Challenge.IsExpired(); got != tc.expired {
+			t.Errorf("%s: IsExpired() = %v, want %v", tc.name, got, tc.expired)
+		}
+		if err := pipeline.validateTimestamp(solution); (err == nil) != tc.valid {
+			t.Errorf("%s: validateTimestamp() = %v, want valid %v", tc.name, err, tc.valid)
+		}
+	}
+
+	// Without a tolerance the same skew makes both checks fail
+	SetClockSkew(0)
+	ahead, behind := skewedChallenge(t, 30*time.Second), skewedChallenge(t, -5*time.Minute-30*time.Second)
+	if err := pipeline.validateTimestamp(ahead); err == nil {
+		t.Error("Expected a challenge from the future to be rejected without a tolerance")
+	}
+	if !behind.Challenge.IsExpired() || pipeline.validateTimestamp(behind) == nil {
+		t.Error("Expected a challenge past its expiry to be rejected without a tolerance")
+	}
+}
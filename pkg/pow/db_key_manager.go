@@ -8,15 +8,20 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/pbkdf2"
+	"world-of-wisdom/internal/database"
 	generated "world-of-wisdom/internal/database/generated"
+	"world-of-wisdom/pkg/metrics"
 )
 
 // DBKeyManager handles HMAC key generation, storage, and rotation using database
@@ -28,13 +33,14 @@ type DBKeyManager struct {
 	previousKey []byte
 	rotatedAt   time.Time
 	version     int
+	timeout     time.Duration // Bound of each key query
 	
 	// Encryption key derived from master secret
 	encryptionKey []byte
 }
 
-// NewDBKeyManager creates a new database-backed key manager
-func NewDBKeyManager(db *pgxpool.Pool, masterSecret string) (*DBKeyManager, error) {
+// NewDBKeyManager creates a new database-backed key manager, each query bounded by timeout (0 = default)
+func NewDBKeyManager(db *pgxpool.Pool, masterSecret string, timeout time.Duration) (*DBKeyManager, error) {
 	// Derive encryption key from master secret
 	salt := []byte("wow-hmac-key-encryption")
 	encryptionKey := pbkdf2.Key([]byte(masterSecret), salt, 10000, 32, sha256.New)
@@ -42,6 +48,7 @@ func NewDBKeyManager(db *pgxpool.Pool, masterSecret string) (*DBKeyManager, erro
 	km := &DBKeyManager{
 		db:            db,
 		queries:       generated.New(),
+		timeout:       timeout,
 		encryptionKey: encryptionKey,
 	}
 
@@ -56,6 +63,7 @@ func NewDBKeyManager(db *pgxpool.Pool, masterSecret string) (*DBKeyManager, erro
 			return nil, fmt.Errorf("failed to load keys: %w", err)
 		}
 	}
+	metrics.UpdateHMACKey(km.version, km.rotatedAt)
 
 	return km, nil
 }
@@ -86,7 +94,9 @@ func (km *DBKeyManager) GetKeys() (current, previous []byte) {
 	return current, previous
 }
 
-// RotateKeys generates a new key and moves current to previous
+// RotateKeys generates a new key and moves the active one to previous. The active key is
+// read and locked in the rotation's transaction rather than taken from memory, so a process
+// that hasn't reloaded since another one rotated still keeps that rotation's key valid.
 func (km *DBKeyManager) RotateKeys() error {
 	km.mu.Lock()
 	defer km.mu.Unlock()
@@ -97,29 +107,34 @@ func (km *DBKeyManager) RotateKeys() error {
 		return fmt.Errorf("failed to generate new key: %w", err)
 	}
 
-	// Encrypt keys
+	// Encrypt key
 	encryptedCurrent, err := km.encrypt(newKey)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt current key: %w", err)
 	}
-	
-	var encryptedPrevious pgtype.Text
-	if km.currentKey != nil {
-		prev, err := km.encrypt(km.currentKey)
-		if err != nil {
-			return fmt.Errorf("failed to encrypt previous key: %w", err)
-		}
-		encryptedPrevious = pgtype.Text{String: prev, Valid: true}
-	}
 
 	// Start transaction
-	ctx := context.Background()
+	ctx, cancel := database.WithQueryTimeout(context.Background(), km.timeout)
+	defer cancel()
 	tx, err := km.db.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
+	// A rotation committed while this one waited for the lock leaves no active row visible
+	active, err := km.queries.GetActiveHMACKeyForUpdate(ctx, tx)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("active key changed during rotation, retry after reloading")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock active key: %w", err)
+	}
+	previousKey, err := km.decrypt(active.EncryptedKey)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt active key: %w", err)
+	}
+
 	// Deactivate current keys
 	if err := km.queries.DeactivateHMACKeys(ctx, tx); err != nil {
 		return fmt.Errorf("failed to deactivate current keys: %w", err)
@@ -127,16 +142,16 @@ func (km *DBKeyManager) RotateKeys() error {
 
 	// Create new key record
 	metadata := map[string]interface{}{
-		"rotated_from_version": km.version,
+		"rotated_from_version": active.KeyVersion,
 		"rotation_reason":      "scheduled",
 	}
 	metadataJSON, _ := json.Marshal(metadata)
 	
-	newVersion := km.version + 1
+	newVersion := int(active.KeyVersion) + 1
 	_, err = km.queries.CreateHMACKey(ctx, tx, generated.CreateHMACKeyParams{
-		KeyVersion:            int32(newVersion),
+		KeyVersion:           int32(newVersion),
 		EncryptedKey:         encryptedCurrent,
-		PreviousEncryptedKey: encryptedPrevious,
+		PreviousEncryptedKey: pgtype.Text{String: active.EncryptedKey, Valid: true},
 		Metadata:             metadataJSON,
 	})
 	if err != nil {
@@ -149,17 +164,19 @@ func (km *DBKeyManager) RotateKeys() error {
 	}
 
 	// Update in-memory keys
-	km.previousKey = km.currentKey
+	km.previousKey = previousKey
 	km.currentKey = newKey
 	km.rotatedAt = time.Now()
 	km.version = newVersion
+	metrics.RecordHMACKeyRotation(km.version, km.rotatedAt)
 
 	return nil
 }
 
 // loadKeys loads keys from database
 func (km *DBKeyManager) loadKeys() error {
-	ctx := context.Background()
+	ctx, cancel := database.WithQueryTimeout(context.Background(), km.timeout)
+	defer cancel()
 	
 	// Get active key
 	keyRecord, err := km.queries.GetActiveHMACKey(ctx, km.db)
@@ -203,7 +220,8 @@ func (km *DBKeyManager) generateAndSaveKeys() error {
 	}
 
 	// Save to database
-	ctx := context.Background()
+	ctx, cancel := database.WithQueryTimeout(context.Background(), km.timeout)
+	defer cancel()
 	metadata := map[string]interface{}{
 		"initial_key": true,
 		"created_by":  "system",
@@ -278,4 +296,83 @@ func (km *DBKeyManager) GetRotationAge() time.Duration {
 	km.mu.RLock()
 	defer km.mu.RUnlock()
 	return time.Since(km.rotatedAt)
-}
\ No newline at end of file
+}
+
+// keyRotationCheckInterval is how often the rotation scheduler looks at the key age and
+// the database, shorter only when the rotation interval itself is
+const keyRotationCheckInterval = time.Minute
+
+// StartRotationScheduler starts a background goroutine that rotates the keys once they are
+// older than interval. Each check first reloads the active key from the database, so a
+// rotation made by another process sharing the keys is picked up here and isn't repeated.
+// An interval of zero or less never rotates and only follows other processes' rotations.
+// Close the returned channel to stop it.
+func (km *DBKeyManager) StartRotationScheduler(interval time.Duration) chan struct{} {
+	stop := make(chan struct{})
+
+	check := keyRotationCheckInterval
+	if interval > 0 && interval < check {
+		check = interval
+	}
+
+	go func() {
+		ticker := time.NewTicker(check)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := km.reload(); err != nil {
+					log.Printf("⚠️ Failed to reload HMAC keys: %v", err)
+					continue
+				}
+				if interval <= 0 || km.GetRotationAge() < interval {
+					continue
+				}
+				if err := km.RotateKeys(); err != nil {
+					log.Printf("⚠️ Scheduled HMAC key rotation failed: %v", err)
+					continue
+				}
+				log.Printf("🔑 HMAC keys rotated to version %d", km.Version())
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return stop
+}
+
+// Version returns the version of the current key
+func (km *DBKeyManager) Version() int {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return km.version
+}
+
+// reload replaces the in-memory keys with the active ones in the database when another
+// process has rotated them
+func (km *DBKeyManager) reload() error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	ctx, cancel := database.WithQueryTimeout(context.Background(), km.timeout)
+	defer cancel()
+	keyRecord, err := km.queries.GetActiveHMACKey(ctx, km.db)
+	if err != nil {
+		return fmt.Errorf("failed to get active key: %w", err)
+	}
+	if int(keyRecord.KeyVersion) == km.version {
+		return nil
+	}
+
+	previous := km.previousKey
+	km.previousKey = nil
+	if err := km.loadKeys(); err != nil {
+		km.previousKey = previous
+		return err
+	}
+	metrics.UpdateHMACKey(km.version, km.rotatedAt)
+	log.Printf("🔑 Picked up HMAC key version %d from the database", km.version)
+	return nil
+}
@@ -0,0 +1,68 @@
+//go:build integration
+
+package pow
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The rotation test runs two key managers on one database, standing in for the TCP server
+// and the API server. It replaces every stored key, so point WOW_TEST_DATABASE_URL at a
+// migrated database used only for tests, `make test-integration` starts one.
+
+func TestStaleKeyManagerRotatesFromTheActiveKey(t *testing.T) {
+	url := os.Getenv("WOW_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("WOW_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	clear := func() {
+		if _, err := pool.Exec(context.Background(), "DELETE FROM hmac_keys"); err != nil {
+			t.Fatalf("Failed to clear keys: %v", err)
+		}
+	}
+	clear()
+	t.Cleanup(clear)
+
+	const secret = "integration-test-master-secret-0123456789"
+	tcp, err := NewDBKeyManager(pool, secret, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create key manager: %v", err)
+	}
+	api, err := NewDBKeyManager(pool, secret, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create key manager: %v", err)
+	}
+
+	if err := tcp.RotateKeys(); err != nil {
+		t.Fatalf("Failed to rotate keys: %v", err)
+	}
+	live := tcp.GetCurrentKey()
+
+	// The API server still holds version 1 in memory when it rotates
+	if err := api.RotateKeys(); err != nil {
+		t.Fatalf("Failed to rotate keys from a stale manager: %v", err)
+	}
+	if api.Version() != 3 {
+		t.Errorf("Expected the stale manager to rotate to version 3, got %d", api.Version())
+	}
+	if _, previous := api.GetKeys(); !bytes.Equal(previous, live) {
+		t.Error("Expected the other manager's live key to be kept as the previous key")
+	}
+
+	if _, err := pool.Exec(ctx, "INSERT INTO hmac_keys (key_version, encrypted_key, is_active) VALUES (3, 'duplicate', false)"); err == nil {
+		t.Error("Expected a second key with the same version to be refused")
+	}
+}
@@ -0,0 +1,107 @@
+package pow
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruCache maps keys to optional values, bounded to capacity entries, dropping the least
+// recently used key when full. It is safe for concurrent use.
+type lruCache struct {
+	mu        sync.Mutex
+	capacity  int
+	order     *list.List // Most recently used at the front, values are *lruEntry
+	entries   map[string]*list.Element
+	evictions int
+}
+
+type lruEntry struct {
+	key   string
+	value any
+}
+
+func newLRUCache(capacity int) *lruCache {
+	return &lruCache{
+		capacity: max(capacity, 1),
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// contains reports whether key is cached, marking it recently used
+func (c *lruCache) contains(key string) bool {
+	_, ok := c.get(key)
+	return ok
+}
+
+// get returns the value cached under key, marking it recently used
+func (c *lruCache) get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruEntry).value, true
+}
+
+// add caches key without a value
+func (c *lruCache) add(key string) {
+	c.put(key, nil)
+}
+
+// put caches value under key, evicting the least recently used key when the cache is full
+func (c *lruCache) put(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*lruEntry).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+	for c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+		c.evictions++
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value})
+}
+
+// removeIf drops every key whose value matches, returning how many were dropped. Dropped
+// keys don't count as evictions.
+func (c *lruCache) removeIf(match func(value any) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		if entry := element.Value.(*lruEntry); match(entry.value) {
+			c.order.Remove(element)
+			delete(c.entries, entry.key)
+			removed++
+		}
+		element = next
+	}
+	return removed
+}
+
+// clear empties the cache, the eviction count is kept
+func (c *lruCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// stats returns the number of cached keys and how many were evicted so far
+func (c *lruCache) stats() (size, evictions int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len(), c.evictions
+}
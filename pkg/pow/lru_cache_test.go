@@ -0,0 +1,54 @@
+package pow
+
+import "testing"
+
+func TestSignatureCacheStaysWithinMaxCacheSize(t *testing.T) {
+	pipeline := NewValidationPipeline(testSigningKey)
+	if pipeline.maxCacheSize != 1000 {
+		t.Fatalf("Expected a cache size of 1000, got %d", pipeline.maxCacheSize)
+	}
+
+	var first *Solution
+	for i := 0; i < 2000; i++ {
+		challenge, err := newSecureChallenge(1, "sha256", "cache-client", ChallengeSources{})
+		if err != nil {
+			t.Fatalf("newSecureChallenge failed: %v", err)
+		}
+		if err := challenge.Sign(testSigningKey); err != nil {
+			t.Fatalf("Sign failed: %v", err)
+		}
+		solution := &Solution{ChallengeID: challenge.Nonce, Challenge: challenge}
+		if err := pipeline.verifySignature(solution); err != nil {
+			t.Fatalf("verifySignature failed: %v", err)
+		}
+		if first == nil {
+			first = solution
+		}
+
+		if size := pipeline.GetCacheStats()["hmac_cache_size"]; size > 1000 {
+			t.Fatalf("Cache grew to %d entries after %d signatures", size, i+1)
+		}
+	}
+
+	stats := pipeline.GetCacheStats()
+	if stats["hmac_cache_size"] != 1000 || stats["hmac_cache_evictions"] != 1000 {
+		t.Errorf("Expected 1000 cached and 1000 evicted signatures, got %v", stats)
+	}
+
+	// The oldest entry was evicted first
+	if pipeline.hmacCache.contains(first.ChallengeID) {
+		t.Error("Expected the least recently used signature to be evicted")
+	}
+}
+
+func TestLRUCacheKeepsRecentlyUsedKeys(t *testing.T) {
+	cache := newLRUCache(2)
+	cache.add("a")
+	cache.add("b")
+	cache.contains("a") // "b" is now the least recently used
+	cache.add("c")
+
+	if !cache.contains("a") || cache.contains("b") || !cache.contains("c") {
+		t.Error("Expected adding to a full cache to evict the least recently used key")
+	}
+}
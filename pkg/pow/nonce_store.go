@@ -0,0 +1,131 @@
+package pow
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"world-of-wisdom/internal/database"
+	generated "world-of-wisdom/internal/database/generated"
+)
+
+// NonceStore remembers which challenges had a solution accepted, keyed by the challenge
+// nonce rather than the connection, so a captured challenge and solution can only be
+// redeemed once for as long as the challenge is valid
+type NonceStore interface {
+	// Redeem claims the challenge, returning false if it was already redeemed
+	Redeem(ctx context.Context, challenge *SecureChallenge) bool
+}
+
+// maxRedeemedNonces is how many unexpired nonces a MemoryNonceStore holds at most
+const maxRedeemedNonces = 100000
+
+// MemoryNonceStore keeps redeemed nonces in this process until their challenge expires.
+// It is keyed by the nonce alone: the nonce is random per challenge and covered by its
+// signature, whereas a submission's challenge ID is chosen by the client and would let
+// a replay through under a new ID.
+type MemoryNonceStore struct {
+	redeemed    sync.Map     // challenge nonce -> expiry (unix micro)
+	size        atomic.Int64 // Nonces in redeemed
+	limit       int64        // Nonces held before new redemptions are refused
+	lastCleanup atomic.Int64 // Unix nanoseconds
+}
+
+// NewMemoryNonceStore creates an empty in-memory nonce store
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{limit: maxRedeemedNonces}
+}
+
+// Redeem claims the challenge's nonce. While the store is full of unexpired nonces it
+// refuses new ones rather than forgetting any, which would reopen them to replay.
+func (m *MemoryNonceStore) Redeem(_ context.Context, challenge *SecureChallenge) bool {
+	m.cleanup()
+	if m.size.Load() >= m.limit {
+		log.Printf("⚠️ Replay store holds %d unexpired challenges, refusing new redemptions until they expire", m.limit)
+		return false
+	}
+	if _, loaded := m.redeemed.LoadOrStore(challenge.Nonce, challenge.ExpiresAt); loaded {
+		return false
+	}
+	m.size.Add(1)
+	return true
+}
+
+// cleanup forgets the nonces of expired challenges at most once per nonceCleanupInterval,
+// so a redemption doesn't walk every stored nonce
+func (m *MemoryNonceStore) cleanup() {
+	now := time.Now().UnixNano()
+	last := m.lastCleanup.Load()
+	if now-last < int64(nonceCleanupInterval) || !m.lastCleanup.CompareAndSwap(last, now) {
+		return
+	}
+	// Expired challenges are rejected before redemption, so their nonces can be forgotten
+	cutoff := time.Now().Add(-ClockSkew()).UnixMicro()
+	m.redeemed.Range(func(key, value interface{}) bool {
+		if expiresAt, ok := value.(int64); ok && expiresAt < cutoff {
+			if _, deleted := m.redeemed.LoadAndDelete(key); deleted {
+				m.size.Add(-1)
+			}
+		}
+		return true
+	})
+}
+
+// nonceCleanupInterval is how often the stores forget expired redemptions
+const nonceCleanupInterval = time.Minute
+
+// DBNonceStore keeps redeemed nonces in the redeemed_challenges table, shared by every
+// process on the database. While the database is unreachable it falls back to memory,
+// which only catches replays within this process.
+type DBNonceStore struct {
+	db          generated.DBTX
+	queries     *generated.Queries
+	timeout     time.Duration
+	fallback    *MemoryNonceStore
+	lastCleanup atomic.Int64 // Unix nanoseconds
+}
+
+// NewDBNonceStore creates a nonce store on db, each query bounded by timeout (0 = default)
+func NewDBNonceStore(db generated.DBTX, timeout time.Duration) *DBNonceStore {
+	return &DBNonceStore{
+		db:       db,
+		queries:  generated.New(),
+		timeout:  timeout,
+		fallback: NewMemoryNonceStore(),
+	}
+}
+
+// Redeem claims the challenge's nonce in the database
+func (s *DBNonceStore) Redeem(ctx context.Context, challenge *SecureChallenge) bool {
+	ctx, cancel := database.WithQueryTimeout(ctx, s.timeout)
+	defer cancel()
+
+	claimed, err := s.queries.RedeemChallenge(ctx, s.db, generated.RedeemChallengeParams{
+		Nonce:     challenge.Nonce,
+		ExpiresAt: pgtype.Timestamptz{Time: time.UnixMicro(challenge.ExpiresAt), Valid: true},
+	})
+	if err != nil {
+		log.Printf("Failed to record redeemed challenge, checking replays in memory: %v", err)
+		return s.fallback.Redeem(ctx, challenge)
+	}
+
+	s.cleanup(ctx)
+	return claimed == 1
+}
+
+// cleanup deletes expired redemptions at most once per nonceCleanupInterval
+func (s *DBNonceStore) cleanup(ctx context.Context) {
+	now := time.Now().UnixNano()
+	last := s.lastCleanup.Load()
+	if now-last < int64(nonceCleanupInterval) || !s.lastCleanup.CompareAndSwap(last, now) {
+		return
+	}
+	// Challenges stay valid for the clock skew past their expiry, so do their redemptions
+	cutoff := pgtype.Timestamptz{Time: time.Now().Add(-ClockSkew()), Valid: true}
+	if err := s.queries.DeleteExpiredRedemptions(ctx, s.db, cutoff); err != nil {
+		log.Printf("Failed to delete expired redemptions: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+//go:build integration
+
+package pow
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The replay test runs two stores on one database, standing in for the TCP server and the
+// API server. Point WOW_TEST_DATABASE_URL at a migrated database, `make test-integration`
+// starts one.
+
+func TestSolutionIsRedeemedOnceAcrossStores(t *testing.T) {
+	url := os.Getenv("WOW_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("WOW_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	challenge, err := GenerateSecureChallenge(1, "sha256", "replay-client", testSigningKey)
+	if err != nil {
+		t.Fatalf("Failed to generate challenge: %v", err)
+	}
+	nonce, err := SolveSecureChallenge(challenge, testSigningKey)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), "DELETE FROM redeemed_challenges WHERE nonce = $1", challenge.Nonce)
+	})
+
+	tcp, http := NewDBNonceStore(pool, time.Second), NewDBNonceStore(pool, time.Second)
+	pipeline := NewValidationPipeline(testSigningKey)
+	submit := func(store NonceStore) bool {
+		result := pipeline.Validate(&Solution{
+			ChallengeID: challenge.Nonce,
+			Challenge:   challenge,
+			Nonce:       nonce,
+			ClientID:    "replay-client",
+			Timestamp:   time.Now().UnixMicro(),
+		})
+		return result.Valid && store.Redeem(ctx, challenge)
+	}
+
+	if !submit(tcp) {
+		t.Fatal("Expected the first submission to be accepted")
+	}
+	if submit(http) {
+		t.Error("Expected the same solution to be rejected by the other store")
+	}
+	if submit(tcp) {
+		t.Error("Expected the same solution to be rejected on a new submission to the same store")
+	}
+}
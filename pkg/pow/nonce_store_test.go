@@ -0,0 +1,64 @@
+package pow
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryNonceStoreSweepsExpiredNoncesOncePerInterval(t *testing.T) {
+	store := NewMemoryNonceStore()
+	store.lastCleanup.Store(time.Now().UnixNano())
+	ctx := context.Background()
+
+	expired := &SecureChallenge{Nonce: "expired", ExpiresAt: time.Now().Add(-ClockSkew() - time.Minute).UnixMicro()}
+	fresh := &SecureChallenge{Nonce: "fresh", ExpiresAt: time.Now().Add(time.Minute).UnixMicro()}
+
+	if !store.Redeem(ctx, expired) || store.Redeem(ctx, expired) {
+		t.Fatal("Expected the nonce to be redeemable exactly once")
+	}
+
+	// Within the interval nothing is swept, not even expired nonces
+	if !store.Redeem(ctx, fresh) {
+		t.Fatal("Expected a new nonce to be redeemed")
+	}
+	if _, ok := store.redeemed.Load("expired"); !ok {
+		t.Fatal("Expected no sweep before the cleanup interval has passed")
+	}
+
+	store.lastCleanup.Store(time.Now().Add(-nonceCleanupInterval).UnixNano())
+	store.Redeem(ctx, &SecureChallenge{Nonce: "trigger", ExpiresAt: fresh.ExpiresAt})
+	if _, ok := store.redeemed.Load("expired"); ok {
+		t.Error("Expected the expired nonce to be swept once the interval passed")
+	}
+	if store.Redeem(ctx, fresh) {
+		t.Error("Expected the unexpired nonce to survive the sweep")
+	}
+}
+
+func TestFullMemoryNonceStoreRefusesNewNonces(t *testing.T) {
+	store := NewMemoryNonceStore()
+	store.limit = 2
+	store.lastCleanup.Store(time.Now().UnixNano())
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Minute).UnixMicro()
+
+	for _, nonce := range []string{"a", "b"} {
+		if !store.Redeem(ctx, &SecureChallenge{Nonce: nonce, ExpiresAt: expiresAt}) {
+			t.Fatalf("Expected nonce %s to be redeemed", nonce)
+		}
+	}
+	if store.Redeem(ctx, &SecureChallenge{Nonce: "c", ExpiresAt: expiresAt}) {
+		t.Fatal("Expected a full store to refuse a new nonce")
+	}
+	if store.Redeem(ctx, &SecureChallenge{Nonce: "a", ExpiresAt: expiresAt}) {
+		t.Error("Expected a full store to still reject replays of stored nonces")
+	}
+
+	// Once stored nonces expire and are swept there is room again
+	store.redeemed.Store("a", time.Now().Add(-ClockSkew()-time.Minute).UnixMicro())
+	store.lastCleanup.Store(time.Now().Add(-nonceCleanupInterval).UnixNano())
+	if !store.Redeem(ctx, &SecureChallenge{Nonce: "c", ExpiresAt: expiresAt}) {
+		t.Error("Expected a new nonce to be redeemed after expired ones were swept")
+	}
+}
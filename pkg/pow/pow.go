@@ -1,12 +1,14 @@
 package pow
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Challenge struct {
@@ -48,14 +50,87 @@ func VerifyPoW(seed, nonce string, difficulty int) bool {
 }
 
 func SolveChallenge(challenge *Challenge) (string, error) {
+	return solveChallenge(context.Background(), challenge, nil)
+}
+
+// SolveChallengeCtx solves like SolveChallenge until ctx is done, then returns ctx.Err()
+// and no nonce
+func SolveChallengeCtx(ctx context.Context, challenge *Challenge) (string, error) {
+	return solveChallenge(ctx, challenge, nil)
+}
+
+// cancelCheckEvery is how many SHA-256 attempts pass between checks for cancellation
+const cancelCheckEvery = 1024
+
+// SolveProgress reports how far a solve has got
+type SolveProgress struct {
+	Attempts int64
+	Elapsed  time.Duration
+	HashRate float64 // Attempts per second
+}
+
+// progressInterval is how often a solve reports progress, progressCheckEvery how many
+// attempts pass between looking at the clock
+const (
+	progressInterval   = 250 * time.Millisecond
+	progressCheckEvery = 4096
+)
+
+// SolveChallengeWithProgress solves like SolveChallenge, sending progress about every
+// progressInterval and once more when the solve ends. Nonces are counted up from zero, so
+// the final Attempts is the returned nonce plus one. Periodic reports are dropped while
+// the receiver is behind, the final one is always delivered and then progress is closed.
+// A nil channel reports nothing.
+func SolveChallengeWithProgress(challenge *Challenge, progress chan<- SolveProgress) (string, error) {
+	return solveChallenge(context.Background(), challenge, progress)
+}
+
+func solveChallenge(ctx context.Context, challenge *Challenge, progress chan<- SolveProgress) (string, error) {
+	start := time.Now()
+	lastReport := start
+	report := func(attempts int64, final bool) {
+		elapsed := time.Since(start)
+		p := SolveProgress{Attempts: attempts, Elapsed: elapsed}
+		if elapsed > 0 {
+			p.HashRate = float64(attempts) / elapsed.Seconds()
+		}
+		if final {
+			progress <- p
+			close(progress)
+			return
+		}
+		select {
+		case progress <- p:
+		default:
+		}
+	}
+
 	for nonce := 0; ; nonce++ {
 		nonceStr := strconv.Itoa(nonce)
 		if VerifyPoW(challenge.Seed, nonceStr, challenge.Difficulty) {
+			if progress != nil {
+				report(int64(nonce)+1, true)
+			}
 			return nonceStr, nil
 		}
 
 		if nonce > 100000000 {
+			if progress != nil {
+				report(int64(nonce)+1, true)
+			}
 			return "", fmt.Errorf("solution not found after %d attempts", nonce)
 		}
+
+		if nonce%cancelCheckEvery == 0 && ctx.Err() != nil {
+			if progress != nil {
+				report(int64(nonce)+1, true)
+			}
+			return "", ctx.Err()
+		}
+
+		if progress != nil && nonce%progressCheckEvery == 0 && time.Since(lastReport) >= progressInterval {
+			lastReport = time.Now()
+			report(int64(nonce)+1, false)
+		}
 	}
 }
@@ -1,6 +1,7 @@
 package pow
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
@@ -95,7 +96,16 @@ func VerifyArgon2PoW(challenge *Argon2Challenge, nonce string) bool {
 
 // SolveArgon2Challenge attempts to solve an Argon2 challenge
 func SolveArgon2Challenge(challenge *Argon2Challenge) (string, error) {
+	return SolveArgon2ChallengeCtx(context.Background(), challenge)
+}
+
+// SolveArgon2ChallengeCtx solves like SolveArgon2Challenge until ctx is done, then returns
+// ctx.Err() and no nonce. Each hash is slow enough to check before every attempt.
+func SolveArgon2ChallengeCtx(ctx context.Context, challenge *Argon2Challenge) (string, error) {
 	for nonce := 0; ; nonce++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
 		nonceStr := strconv.Itoa(nonce)
 		if VerifyArgon2PoW(challenge, nonceStr) {
 			return nonceStr, nil
@@ -0,0 +1,74 @@
+package pow
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSolveProgressFinalAttemptsMatchNonce(t *testing.T) {
+	challenge := &Challenge{Seed: "0123456789abcdef", Difficulty: 4}
+
+	progress := make(chan SolveProgress)
+	reports := make(chan []SolveProgress)
+	go func() {
+		var received []SolveProgress
+		for p := range progress {
+			received = append(received, p)
+		}
+		reports <- received
+	}()
+
+	nonce, err := SolveChallengeWithProgress(challenge, progress)
+	if err != nil {
+		t.Fatalf("SolveChallengeWithProgress failed: %v", err)
+	}
+	received := <-reports // Only arrives once the solver closed the channel
+
+	if len(received) == 0 {
+		t.Fatal("Expected at least the final progress report")
+	}
+	final := received[len(received)-1]
+	n, _ := strconv.Atoi(nonce)
+	if final.Attempts != int64(n)+1 {
+		t.Errorf("Expected the final report to count %d attempts for nonce %s, got %d", n+1, nonce, final.Attempts)
+	}
+	for i := 1; i < len(received); i++ {
+		if received[i].Attempts < received[i-1].Attempts {
+			t.Errorf("Attempts went backwards: %d after %d", received[i].Attempts, received[i-1].Attempts)
+		}
+	}
+
+	// Without a channel the same nonce is found
+	if plain, err := SolveChallenge(challenge); err != nil || plain != nonce {
+		t.Errorf("Expected SolveChallenge to find %s, got %s (%v)", nonce, plain, err)
+	}
+}
+
+func TestCancelledSolveReturnsNoNonce(t *testing.T) {
+	// No nonce below 100M gives this seed six leading zeros, the solve can only be cancelled
+	challenge := &Challenge{Seed: "cancel-me", Difficulty: 6}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	nonce, err := SolveChallengeCtx(ctx, challenge)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got nonce %q and error %v", nonce, err)
+	}
+	if nonce != "" {
+		t.Errorf("Expected no nonce from a cancelled solve, got %q", nonce)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the solve to stop soon after cancellation, took %v", elapsed)
+	}
+
+	// Argon2 checks before every hash, a done context stops it before the first
+	argon2Challenge := &Argon2Challenge{Seed: "cancel-me", Difficulty: 6, Time: 1, Memory: 64 * 1024, Threads: 4, KeyLen: 32}
+	if nonce, err := SolveArgon2ChallengeCtx(ctx, argon2Challenge); !errors.Is(err, context.Canceled) || nonce != "" {
+		t.Errorf("Expected the Argon2 solve to return context.Canceled and no nonce, got %q (%v)", nonce, err)
+	}
+}
@@ -0,0 +1,60 @@
+package pow
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QuoteSignaturePrefix starts the line that follows a signed quote
+const QuoteSignaturePrefix = "SIG "
+
+// signedQuote is what a quote signature covers: the quote, the challenge it was earned
+// on and when it was sent, so a signature can't be moved to another quote or connection
+type signedQuote struct {
+	Quote       string `json:"quote"`
+	ChallengeID string `json:"challenge_id"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+func quoteSigningData(quote, challengeID string, timestamp int64) []byte {
+	data, _ := json.Marshal(signedQuote{Quote: quote, ChallengeID: challengeID, Timestamp: timestamp})
+	return data
+}
+
+// SignQuote returns the signature line for a quote sent in answer to the challenge with
+// seed challengeID, "SIG <unix micro> <base64 HMAC>"
+func SignQuote(keyManager KeyManager, quote, challengeID string, now time.Time) string {
+	timestamp := now.UnixMicro()
+	signature := NewHMACSignature(keyManager).Sign(quoteSigningData(quote, challengeID, timestamp))
+	return fmt.Sprintf("%s%d %s", QuoteSignaturePrefix, timestamp, base64.StdEncoding.EncodeToString(signature))
+}
+
+// VerifyQuote checks a signature line from SignQuote against the quote and the seed of the
+// challenge it was earned on. Signatures older than maxAge are rejected, 0 accepts any age.
+func VerifyQuote(keyManager KeyManager, quote, challengeID, signatureLine string, maxAge time.Duration) error {
+	fields := strings.Fields(strings.TrimPrefix(signatureLine, QuoteSignaturePrefix))
+	if !strings.HasPrefix(signatureLine, QuoteSignaturePrefix) || len(fields) != 2 {
+		return fmt.Errorf("malformed quote signature")
+	}
+
+	timestamp, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed quote signature timestamp: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return fmt.Errorf("failed to decode quote signature: %w", err)
+	}
+
+	if !NewHMACSignature(keyManager).Verify(quoteSigningData(quote, challengeID, timestamp), signature) {
+		return fmt.Errorf("invalid quote signature")
+	}
+	if maxAge > 0 && time.Since(time.UnixMicro(timestamp)) > maxAge {
+		return fmt.Errorf("quote signature older than %v", maxAge)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package pow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifyQuote(t *testing.T) {
+	km := NewStaticKeyManager(testSigningKey)
+	quote := "The only true wisdom is in knowing you know nothing."
+	line := SignQuote(km, quote, "seed-1", time.Now())
+
+	if err := VerifyQuote(km, quote, "seed-1", line, time.Minute); err != nil {
+		t.Fatalf("Expected a fresh signature to verify: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		quote, seed, line string
+		km                KeyManager
+		maxAge            time.Duration
+	}{
+		"substituted quote": {quote: "Buy now!", seed: "seed-1", line: line, km: km},
+		"other challenge":   {quote: quote, seed: "seed-2", line: line, km: km},
+		"other key":         {quote: quote, seed: "seed-1", line: line, km: NewStaticKeyManager([]byte("another-signing-key-0123456789ab"))},
+		"missing signature": {quote: quote, seed: "seed-1", line: "", km: km},
+		"malformed":         {quote: quote, seed: "seed-1", line: "SIG not-a-time sig", km: km},
+		"expired":           {quote: quote, seed: "seed-1", line: SignQuote(km, quote, "seed-1", time.Now().Add(-time.Hour)), km: km, maxAge: time.Minute},
+	} {
+		if err := VerifyQuote(tc.km, tc.quote, tc.seed, tc.line, tc.maxAge); err == nil {
+			t.Errorf("%s: expected verification to fail", name)
+		}
+	}
+}
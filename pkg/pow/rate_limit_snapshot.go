@@ -0,0 +1,86 @@
+package pow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// rateLimitWindow is one client's rate-limit window as saved to disk
+type rateLimitWindow struct {
+	ClientID    string    `json:"client_id"`
+	Requests    int       `json:"requests"`
+	WindowStart time.Time `json:"window_start"`
+}
+
+// SaveRateLimits writes the rate-limit windows still open to path, so a restarted
+// pipeline doesn't hand every client a fresh allowance. Expired windows would be reset
+// on the next request anyway and are left out. The file is replaced atomically.
+func (v *ValidationPipeline) SaveRateLimits(path string) (int, error) {
+	now := time.Now()
+
+	v.rateLimitMu.RLock()
+	windows := make([]rateLimitWindow, 0, len(v.rateLimitMap))
+	for clientID, state := range v.rateLimitMap {
+		if now.Sub(state.windowStart) <= v.rateLimitWindow {
+			windows = append(windows, rateLimitWindow{ClientID: clientID, Requests: state.requests, WindowStart: state.windowStart})
+		}
+	}
+	v.rateLimitMu.RUnlock()
+
+	data, err := json.Marshal(windows)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode rate limits: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create rate limit snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to write rate limit snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write rate limit snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("failed to replace rate limit snapshot: %w", err)
+	}
+	return len(windows), nil
+}
+
+// LoadRateLimits restores the windows saved by SaveRateLimits that are still open,
+// replacing any state for the same clients. A missing snapshot restores nothing.
+func (v *ValidationPipeline) LoadRateLimits(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read rate limit snapshot: %w", err)
+	}
+
+	var windows []rateLimitWindow
+	if err := json.Unmarshal(data, &windows); err != nil {
+		return 0, fmt.Errorf("failed to decode rate limit snapshot: %w", err)
+	}
+
+	now := time.Now()
+	restored := 0
+	v.rateLimitMu.Lock()
+	defer v.rateLimitMu.Unlock()
+	for _, w := range windows {
+		if w.ClientID == "" || now.Sub(w.WindowStart) > v.rateLimitWindow {
+			continue
+		}
+		v.rateLimitMap[w.ClientID] = &RateLimitState{requests: w.Requests, windowStart: w.WindowStart}
+		restored++
+	}
+	return restored, nil
+}
@@ -0,0 +1,62 @@
+package pow
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRateLimitsSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rate-limits.json")
+
+	before := NewValidationPipeline(testSigningKey)
+	before.SetRateLimitConfig(time.Minute, 3)
+	for i := 0; i < 3; i++ {
+		before.checkRateLimit("busy-client")
+	}
+	before.checkRateLimit("quiet-client")
+
+	// A window that has run out isn't worth keeping
+	before.rateLimitMap["gone-client"] = &RateLimitState{requests: 3, windowStart: time.Now().Add(-2 * time.Minute)}
+
+	saved, err := before.SaveRateLimits(path)
+	if err != nil {
+		t.Fatalf("SaveRateLimits failed: %v", err)
+	}
+	if saved != 2 {
+		t.Errorf("Expected 2 open windows saved, got %d", saved)
+	}
+
+	after := NewValidationPipeline(testSigningKey)
+	after.SetRateLimitConfig(time.Minute, 3)
+	restored, err := after.LoadRateLimits(path)
+	if err != nil {
+		t.Fatalf("LoadRateLimits failed: %v", err)
+	}
+	if restored != 2 {
+		t.Errorf("Expected 2 windows restored, got %d", restored)
+	}
+	if err := after.checkRateLimit("busy-client"); err == nil {
+		t.Error("Expected the restored window to keep the client rate limited")
+	}
+	if err := after.checkRateLimit("quiet-client"); err != nil {
+		t.Errorf("Expected the quiet client to keep its remaining allowance: %v", err)
+	}
+	if _, ok := after.rateLimitMap["gone-client"]; ok {
+		t.Error("Expected the expired window to be left out")
+	}
+}
+
+func TestLoadRateLimitsWithoutSnapshot(t *testing.T) {
+	v := NewValidationPipeline(testSigningKey)
+	if n, err := v.LoadRateLimits(filepath.Join(t.TempDir(), "missing.json")); err != nil || n != 0 {
+		t.Errorf("Expected nothing restored without a snapshot, got %d (%v)", n, err)
+	}
+
+	corrupt := filepath.Join(t.TempDir(), "corrupt.json")
+	os.WriteFile(corrupt, []byte("{not json"), 0o600)
+	if _, err := v.LoadRateLimits(corrupt); err == nil {
+		t.Error("Expected a corrupt snapshot to be reported")
+	}
+}
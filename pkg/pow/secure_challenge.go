@@ -1,6 +1,7 @@
 package pow
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
@@ -8,6 +9,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 )
@@ -19,6 +21,7 @@ type SecureChallenge struct {
 	Seed       string `json:"seed"`        
 	Difficulty int    `json:"difficulty"`
 	Algorithm  string `json:"algorithm"`   // "argon2" or "sha256"
+	Target     string `json:"target,omitempty"` // Compact SHA-256 target as 8 hex digits, replaces the leading-zero check when set
 	
 	// Argon2 specific parameters (when algorithm="argon2")
 	Argon2Params *Argon2Params `json:"argon2_params,omitempty"`
@@ -41,6 +44,17 @@ type Argon2Params struct {
 	KeyLength uint32 `json:"l"`
 }
 
+// DefaultArgon2Params returns the Argon2 parameters of difficulties without a configured
+// profile, see Argon2ParamsFor
+func DefaultArgon2Params() *Argon2Params {
+	return &Argon2Params{
+		Time:      1,
+		Memory:    64 * 1024, // 64MB
+		Threads:   4,
+		KeyLength: 32,
+	}
+}
+
 // HMACSignature handles HMAC signing and verification
 type HMACSignature struct {
 	keyManager KeyManager
@@ -82,26 +96,42 @@ func (s *HMACSignature) Verify(data, signature []byte) bool {
 	return false
 }
 
-// GenerateSecureChallengeWithKeyManager creates a new secure challenge with HMAC signature using key manager
-func GenerateSecureChallengeWithKeyManager(difficulty int, algorithm string, clientID string, keyManager KeyManager) (*SecureChallenge, error) {
+// ChallengeSources supplies the randomness and clock challenges are generated from.
+// Tests fix both to get the exact same challenge, signature and encoding every run.
+type ChallengeSources struct {
+	Rand io.Reader        // Seed and nonce bytes, crypto/rand when nil
+	Now  func() time.Time // Issue time, time.Now when nil
+}
+
+// newSecureChallenge builds an unsigned challenge from sources
+func newSecureChallenge(difficulty int, algorithm string, clientID string, sources ChallengeSources) (*SecureChallenge, error) {
 	if difficulty < 1 || difficulty > 6 {
 		return nil, fmt.Errorf("difficulty must be between 1 and 6, got %d", difficulty)
 	}
 
+	random := sources.Rand
+	if random == nil {
+		random = rand.Reader
+	}
+	now := time.Now
+	if sources.Now != nil {
+		now = sources.Now
+	}
+
 	// Generate random seed
 	seedBytes := make([]byte, 16)
-	if _, err := rand.Read(seedBytes); err != nil {
+	if _, err := io.ReadFull(random, seedBytes); err != nil {
 		return nil, fmt.Errorf("failed to generate random seed: %w", err)
 	}
 
 	// Generate random nonce for replay prevention
 	nonceBytes := make([]byte, 8)
-	if _, err := rand.Read(nonceBytes); err != nil {
+	if _, err := io.ReadFull(random, nonceBytes); err != nil {
 		return nil, fmt.Errorf("failed to generate random nonce: %w", err)
 	}
 
-	now := time.Now()
-	expiresAt := now.Add(5 * time.Minute)
+	issuedAt := now()
+	expiresAt := issuedAt.Add(5 * time.Minute)
 
 	challenge := &SecureChallenge{
 		Version:    1,
@@ -109,19 +139,24 @@ func GenerateSecureChallengeWithKeyManager(difficulty int, algorithm string, cli
 		Difficulty: difficulty,
 		Algorithm:  algorithm,
 		ClientID:   clientID,
-		Timestamp:  now.UnixMicro(),
+		Timestamp:  issuedAt.UnixMicro(),
 		ExpiresAt:  expiresAt.UnixMicro(),
 		Nonce:      hex.EncodeToString(nonceBytes),
 	}
 
 	// Set Argon2 parameters if needed
 	if algorithm == "argon2" {
-		challenge.Argon2Params = &Argon2Params{
-			Time:      1,
-			Memory:    64 * 1024, // 64MB
-			Threads:   4,
-			KeyLength: 32,
-		}
+		challenge.Argon2Params = Argon2ParamsFor(difficulty)
+	}
+
+	return challenge, nil
+}
+
+// GenerateSecureChallengeWithKeyManager creates a new secure challenge with HMAC signature using key manager
+func GenerateSecureChallengeWithKeyManager(difficulty int, algorithm string, clientID string, keyManager KeyManager) (*SecureChallenge, error) {
+	challenge, err := newSecureChallenge(difficulty, algorithm, clientID, ChallengeSources{})
+	if err != nil {
+		return nil, err
 	}
 
 	// Create signature
@@ -134,44 +169,15 @@ func GenerateSecureChallengeWithKeyManager(difficulty int, algorithm string, cli
 
 // GenerateSecureChallenge creates a new secure challenge with HMAC signature (deprecated - use GenerateSecureChallengeWithKeyManager)
 func GenerateSecureChallenge(difficulty int, algorithm string, clientID string, signingKey []byte) (*SecureChallenge, error) {
-	if difficulty < 1 || difficulty > 6 {
-		return nil, fmt.Errorf("difficulty must be between 1 and 6, got %d", difficulty)
-	}
-
-	// Generate random seed
-	seedBytes := make([]byte, 16)
-	if _, err := rand.Read(seedBytes); err != nil {
-		return nil, fmt.Errorf("failed to generate random seed: %w", err)
-	}
-
-	// Generate random nonce for replay prevention
-	nonceBytes := make([]byte, 8)
-	if _, err := rand.Read(nonceBytes); err != nil {
-		return nil, fmt.Errorf("failed to generate random nonce: %w", err)
-	}
-
-	now := time.Now()
-	expiresAt := now.Add(5 * time.Minute)
-
-	challenge := &SecureChallenge{
-		Version:    1,
-		Seed:       hex.EncodeToString(seedBytes),
-		Difficulty: difficulty,
-		Algorithm:  algorithm,
-		ClientID:   clientID,
-		Timestamp:  now.UnixMicro(),
-		ExpiresAt:  expiresAt.UnixMicro(),
-		Nonce:      hex.EncodeToString(nonceBytes),
-	}
+	return GenerateSecureChallengeWithSources(difficulty, algorithm, clientID, signingKey, ChallengeSources{})
+}
 
-	// Set Argon2 parameters if needed
-	if algorithm == "argon2" {
-		challenge.Argon2Params = &Argon2Params{
-			Time:      1,
-			Memory:    64 * 1024, // 64MB
-			Threads:   4,
-			KeyLength: 32,
-		}
+// GenerateSecureChallengeWithSources is GenerateSecureChallenge with the seed, nonce and
+// timestamps drawn from sources, for reproducible challenges in tests
+func GenerateSecureChallengeWithSources(difficulty int, algorithm string, clientID string, signingKey []byte, sources ChallengeSources) (*SecureChallenge, error) {
+	challenge, err := newSecureChallenge(difficulty, algorithm, clientID, sources)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create signature
@@ -287,13 +293,42 @@ func (c *SecureChallenge) VerifyWithKeyManager(keyManager KeyManager) error {
 	return nil
 }
 
-// IsExpired checks if the challenge has expired
+// IsExpired checks if the challenge has expired, allowing for the ClockSkew between
+// the issuer's clock and this one
 func (c *SecureChallenge) IsExpired() bool {
-	return time.Now().UnixMicro() > c.ExpiresAt
+	return time.Now().Add(-ClockSkew()).UnixMicro() > c.ExpiresAt
 }
 
 // IsValid performs comprehensive validation of the challenge
 func (c *SecureChallenge) IsValid(key []byte) error {
+	if err := c.checkFields(); err != nil {
+		return err
+	}
+
+	// Verify signature
+	if err := c.Verify(key); err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	return nil
+}
+
+// IsValidWithKeyManager validates the challenge like IsValid, accepting a signature by
+// either the current or the previous key so challenges issued before a rotation still pass
+func (c *SecureChallenge) IsValidWithKeyManager(keyManager KeyManager) error {
+	if err := c.checkFields(); err != nil {
+		return err
+	}
+
+	if err := c.VerifyWithKeyManager(keyManager); err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	return nil
+}
+
+// checkFields validates everything IsValid checks but the signature
+func (c *SecureChallenge) checkFields() error {
 	// Check version
 	if c.Version != 1 {
 		return fmt.Errorf("unsupported challenge version: %d", c.Version)
@@ -309,22 +344,31 @@ func (c *SecureChallenge) IsValid(key []byte) error {
 		return fmt.Errorf("invalid difficulty: %d", c.Difficulty)
 	}
 
+	// Targets only apply to SHA-256
+	if c.Target != "" {
+		if c.Algorithm != "sha256" {
+			return fmt.Errorf("target is not supported for %s challenges", c.Algorithm)
+		}
+		if _, err := c.TargetValue(); err != nil {
+			return err
+		}
+	}
+
 	// Check expiration
 	if c.IsExpired() {
 		return fmt.Errorf("challenge has expired")
 	}
 
-	// Verify signature
-	if err := c.Verify(key); err != nil {
-		return fmt.Errorf("signature verification failed: %w", err)
-	}
-
 	return nil
 }
 
 // String returns a human-readable representation of the challenge
 func (c *SecureChallenge) String() string {
 	var prefix string
+	if c.Algorithm == "sha256" && c.Target != "" {
+		return fmt.Sprintf("Solve PoW: %s below target %s (expires: %s)",
+			c.Seed, c.Target, time.UnixMicro(c.ExpiresAt).Format(time.RFC3339))
+	}
 	if c.Algorithm == "sha256" {
 		prefix = strings.Repeat("0", c.Difficulty)
 		return fmt.Sprintf("Solve PoW: %s with prefix %s (expires: %s)", 
@@ -342,10 +386,25 @@ func VerifySecurePoW(challenge *SecureChallenge, solution string, signingKey []b
 		return fmt.Errorf("invalid challenge: %w", err)
 	}
 
+	return verifySecureSolution(challenge, solution)
+}
+
+// VerifySecurePoWWithKeyManager validates a solution like VerifySecurePoW, accepting a
+// challenge signed by either of keyManager's keys
+func VerifySecurePoWWithKeyManager(challenge *SecureChallenge, solution string, keyManager KeyManager) error {
+	if err := challenge.IsValidWithKeyManager(keyManager); err != nil {
+		return fmt.Errorf("invalid challenge: %w", err)
+	}
+
+	return verifySecureSolution(challenge, solution)
+}
+
+// verifySecureSolution checks the proof-of-work of an already validated challenge
+func verifySecureSolution(challenge *SecureChallenge, solution string) error {
 	// Verify the proof-of-work based on algorithm
 	switch challenge.Algorithm {
 	case "sha256":
-		if !VerifyPoW(challenge.Seed, solution, challenge.Difficulty) {
+		if !VerifySHA256Solution(challenge, solution) {
 			return fmt.Errorf("invalid SHA-256 proof-of-work")
 		}
 	case "argon2":
@@ -374,6 +433,12 @@ func VerifySecurePoW(challenge *SecureChallenge, solution string, signingKey []b
 
 // SolveSecureChallenge attempts to solve a secure challenge
 func SolveSecureChallenge(challenge *SecureChallenge, signingKey []byte) (string, error) {
+	return SolveSecureChallengeCtx(context.Background(), challenge, signingKey)
+}
+
+// SolveSecureChallengeCtx solves like SolveSecureChallenge until ctx is done, then returns
+// ctx.Err() and no nonce
+func SolveSecureChallengeCtx(ctx context.Context, challenge *SecureChallenge, signingKey []byte) (string, error) {
 	// Validate challenge first
 	if err := challenge.IsValid(signingKey); err != nil {
 		return "", fmt.Errorf("invalid challenge: %w", err)
@@ -382,12 +447,20 @@ func SolveSecureChallenge(challenge *SecureChallenge, signingKey []byte) (string
 	// Solve based on algorithm
 	switch challenge.Algorithm {
 	case "sha256":
+		if challenge.Target != "" {
+			target, err := challenge.TargetValue()
+			if err != nil {
+				return "", err
+			}
+			return SolveTargetChallengeCtx(ctx, challenge.Seed, target)
+		}
+
 		// Use existing SHA-256 solver
 		basicChallenge := &Challenge{
 			Seed:       challenge.Seed,
 			Difficulty: challenge.Difficulty,
 		}
-		return SolveChallenge(basicChallenge)
+		return SolveChallengeCtx(ctx, basicChallenge)
 		
 	case "argon2":
 		if challenge.Argon2Params == nil {
@@ -403,7 +476,7 @@ func SolveSecureChallenge(challenge *SecureChallenge, signingKey []byte) (string
 			KeyLen:     challenge.Argon2Params.KeyLength,
 		}
 		
-		return SolveArgon2Challenge(argon2Challenge)
+		return SolveArgon2ChallengeCtx(ctx, argon2Challenge)
 		
 	default:
 		return "", fmt.Errorf("unsupported algorithm: %s", challenge.Algorithm)
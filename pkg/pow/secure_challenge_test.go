@@ -0,0 +1,135 @@
+package pow
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSigningKey = []byte("test-signing-key-0123456789abcdef")
+
+func TestSecureChallengeExpiresBeforeSolveIsSubmitted(t *testing.T) {
+	// Issuer and verifier share a clock here, no skew to allow for
+	SetClockSkew(0)
+	t.Cleanup(func() { SetClockSkew(DefaultClockSkew) })
+
+	challenge, err := GenerateSecureChallenge(1, "sha256", "test-client", testSigningKey)
+	if err != nil {
+		t.Fatalf("GenerateSecureChallenge failed: %v", err)
+	}
+
+	// Deliberately short expiry, re-signed so only the timing is wrong
+	challenge.ExpiresAt = time.Now().Add(50 * time.Millisecond).UnixMicro()
+	if err := challenge.Sign(testSigningKey); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	nonce, err := SolveSecureChallenge(challenge, testSigningKey)
+	if err != nil {
+		t.Fatalf("SolveSecureChallenge failed: %v", err)
+	}
+	if challenge.IsExpired() {
+		t.Fatal("challenge expired before the solve completed")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if !challenge.IsExpired() {
+		t.Fatal("expected challenge to be expired")
+	}
+	if !VerifyPoW(challenge.Seed, nonce, challenge.Difficulty) {
+		t.Fatal("expected the proof-of-work itself to remain valid")
+	}
+	if err := VerifySecurePoW(challenge, nonce, testSigningKey); err == nil {
+		t.Fatal("expected expired challenge to be rejected")
+	}
+}
+
+// fixedSources returns the same seed, nonce and issue time on every call
+func fixedSources() ChallengeSources {
+	random := make([]byte, 24)
+	for i := range random {
+		random[i] = byte(i)
+	}
+	issuedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	return ChallengeSources{
+		Rand: bytes.NewReader(random),
+		Now:  func() time.Time { return issuedAt },
+	}
+}
+
+func TestGenerateSecureChallengeWithSourcesIsReproducible(t *testing.T) {
+	first, err := GenerateSecureChallengeWithSources(3, "sha256", "test-client", testSigningKey, fixedSources())
+	if err != nil {
+		t.Fatalf("GenerateSecureChallengeWithSources failed: %v", err)
+	}
+	second, err := GenerateSecureChallengeWithSources(3, "sha256", "test-client", testSigningKey, fixedSources())
+	if err != nil {
+		t.Fatalf("GenerateSecureChallengeWithSources failed: %v", err)
+	}
+
+	if first.Seed != "000102030405060708090a0b0c0d0e0f" || first.Nonce != "1011121314151617" {
+		t.Errorf("Expected seed and nonce from the fixed source, got %s and %s", first.Seed, first.Nonce)
+	}
+	issuedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	if first.Timestamp != issuedAt.UnixMicro() || first.ExpiresAt != issuedAt.Add(5*time.Minute).UnixMicro() {
+		t.Errorf("Expected timestamps from the fixed clock, got %d and %d", first.Timestamp, first.ExpiresAt)
+	}
+
+	if first.Signature == "" || first.Signature != second.Signature {
+		t.Errorf("Expected identical signatures, got %q and %q", first.Signature, second.Signature)
+	}
+	if err := first.Verify(testSigningKey); err != nil {
+		t.Errorf("Fixed challenge failed signature verification: %v", err)
+	}
+
+	firstBinary, err := first.ToBinary()
+	if err != nil {
+		t.Fatalf("ToBinary failed: %v", err)
+	}
+	secondBinary, _ := second.ToBinary()
+	if !bytes.Equal(firstBinary, secondBinary) {
+		t.Errorf("Expected identical binary encodings:\n%x\n%x", firstBinary, secondBinary)
+	}
+
+	// A source that runs dry is an error rather than a short seed
+	if _, err := GenerateSecureChallengeWithSources(3, "sha256", "test-client", testSigningKey,
+		ChallengeSources{Rand: bytes.NewReader(make([]byte, 10))}); err == nil {
+		t.Error("Expected an error from an exhausted randomness source")
+	}
+}
+
+func TestUnknownAlgorithmByteNamesItAndTheSupportedSet(t *testing.T) {
+	challenge, err := GenerateSecureChallenge(1, "sha256", "test-client", testSigningKey)
+	if err != nil {
+		t.Fatalf("GenerateSecureChallenge failed: %v", err)
+	}
+	data, err := challenge.ToBinary()
+	if err != nil {
+		t.Fatalf("ToBinary failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		algorithm byte
+		want      string
+	}{
+		{0x00, "no algorithm type (0x00)"},
+		{0x03, "unknown algorithm type 0x03"},
+		{0xff, "unknown algorithm type 0xff"},
+	} {
+		data[1] = tc.algorithm
+		_, err := SecureChallengeFromBinary(data, "test-client")
+
+		var unknown *UnknownAlgorithmError
+		if !errors.As(err, &unknown) || unknown.Algorithm != AlgorithmType(tc.algorithm) {
+			t.Fatalf("Algorithm byte 0x%02x: expected an UnknownAlgorithmError, got %v", tc.algorithm, err)
+		}
+		for _, part := range []string{tc.want, "0x01 (sha256)", "0x02 (argon2)"} {
+			if !strings.Contains(err.Error(), part) {
+				t.Errorf("Algorithm byte 0x%02x: expected %q in %q", tc.algorithm, part, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package pow
+
+import (
+	"math"
+	"time"
+)
+
+// Per-hash cost on a slow but legitimate client, Argon2 at DefaultArgon2Params
+const (
+	sha256HashCost = time.Microsecond
+	argon2HashCost = 20 * time.Millisecond
+)
+
+// ExpectedSolveTime estimates how long an average client needs for a challenge.
+// A hex leading-zero target takes 16^difficulty hashes on average.
+func ExpectedSolveTime(algorithm string, difficulty int) time.Duration {
+	cost := sha256HashCost
+	if algorithm == "argon2" {
+		cost = argon2HashCost
+	}
+
+	hashes := math.Pow(16, float64(difficulty))
+	expected := hashes * float64(cost)
+	if expected > float64(math.MaxInt64) {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(expected)
+}
@@ -0,0 +1,72 @@
+package pow
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// StaticKeyManager holds a fixed signing key in memory with no persistence.
+// It is meant for tests and standalone demos, never for production signing.
+type StaticKeyManager struct {
+	mu          sync.RWMutex
+	currentKey  []byte
+	previousKey []byte
+	rotatedAt   time.Time
+}
+
+// NewStaticKeyManager creates a key manager that always signs with key
+func NewStaticKeyManager(key []byte) *StaticKeyManager {
+	current := make([]byte, len(key))
+	copy(current, key)
+
+	return &StaticKeyManager{
+		currentKey: current,
+		rotatedAt:  time.Now(),
+	}
+}
+
+// GetCurrentKey returns the current signing key
+func (km *StaticKeyManager) GetCurrentKey() []byte {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	key := make([]byte, len(km.currentKey))
+	copy(key, km.currentKey)
+	return key
+}
+
+// GetKeys returns both current and previous keys for verification
+func (km *StaticKeyManager) GetKeys() (current, previous []byte) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	current = make([]byte, len(km.currentKey))
+	copy(current, km.currentKey)
+
+	if km.previousKey != nil {
+		previous = make([]byte, len(km.previousKey))
+		copy(previous, km.previousKey)
+	}
+
+	return current, previous
+}
+
+// RotateKeys derives the next key from the current one so rotation stays deterministic
+func (km *StaticKeyManager) RotateKeys() error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	next := sha256.Sum256(km.currentKey)
+	km.previousKey = km.currentKey
+	km.currentKey = next[:]
+	km.rotatedAt = time.Now()
+	return nil
+}
+
+// GetRotationAge returns how long since the last key rotation
+func (km *StaticKeyManager) GetRotationAge() time.Duration {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return time.Since(km.rotatedAt)
+}
@@ -0,0 +1,48 @@
+package pow
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStaticKeyManagerSignsAndVerifiesAcrossRotation(t *testing.T) {
+	km := NewStaticKeyManager(testSigningKey)
+
+	challenge, err := GenerateSecureChallengeWithKeyManager(1, "sha256", "test-client", km)
+	if err != nil {
+		t.Fatalf("GenerateSecureChallengeWithKeyManager failed: %v", err)
+	}
+
+	if _, err := SolveSecureChallenge(challenge, testSigningKey); err != nil {
+		t.Fatalf("Expected the challenge to be signed with the static key: %v", err)
+	}
+
+	if err := km.RotateKeys(); err != nil {
+		t.Fatalf("RotateKeys failed: %v", err)
+	}
+	if err := challenge.VerifyWithKeyManager(km); err != nil {
+		t.Errorf("Expected the previous key to still verify after one rotation: %v", err)
+	}
+
+	if err := km.RotateKeys(); err != nil {
+		t.Fatalf("RotateKeys failed: %v", err)
+	}
+	if err := challenge.VerifyWithKeyManager(km); err == nil {
+		t.Error("Expected verification to fail once the signing key is rotated out")
+	}
+}
+
+func TestStaticKeyManagerRotationIsDeterministic(t *testing.T) {
+	a := NewStaticKeyManager(testSigningKey)
+	b := NewStaticKeyManager(testSigningKey)
+
+	a.RotateKeys()
+	b.RotateKeys()
+
+	if !bytes.Equal(a.GetCurrentKey(), b.GetCurrentKey()) {
+		t.Error("Expected managers with the same key to rotate to the same key")
+	}
+	if _, previous := a.GetKeys(); !bytes.Equal(previous, testSigningKey) {
+		t.Error("Expected the original key to become the previous key")
+	}
+}
@@ -0,0 +1,150 @@
+package pow
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Target mode replaces the count of leading zeros with a 256-bit threshold the SHA-256
+// hash, read as a big-endian integer, must be below. Difficulty d in leading hex zeros
+// is the target 2^(256-4d), so fractional difficulties fall between the usual steps.
+// Targets travel in the Bitcoin compact form: one exponent byte, the length of the
+// target in bytes, followed by its three most significant bytes.
+
+// maxTarget is 2^256, the target every hash is below
+var maxTarget = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// DifficultyToTarget returns the target as hard to meet as difficulty leading hex zeros.
+// Whole difficulties give exactly the leading-zero threshold.
+func DifficultyToTarget(difficulty float64) *big.Int {
+	if difficulty <= 0 {
+		return new(big.Int).Set(maxTarget)
+	}
+
+	// 2^(256-4d) split into a mantissa in [1, 2) and a whole power of two
+	exponent := 256 - 4*difficulty
+	whole := math.Floor(exponent)
+	mantissa := new(big.Float).SetMantExp(big.NewFloat(math.Exp2(exponent-whole)), int(whole))
+	target, _ := mantissa.Int(nil)
+	return target
+}
+
+// TargetToDifficulty returns the difficulty in leading hex zeros a target corresponds to
+func TargetToDifficulty(target *big.Int) float64 {
+	if target.Sign() <= 0 {
+		return math.Inf(1)
+	}
+	mantissa, _ := new(big.Float).SetInt(target).Float64()
+	if math.IsInf(mantissa, 0) {
+		return 0
+	}
+	return (256 - math.Log2(mantissa)) / 4
+}
+
+// CompactTarget encodes target in the compact form, keeping its three most significant
+// bytes. The rest is dropped, so the encoded target is never easier than the original.
+func CompactTarget(target *big.Int) uint32 {
+	size := (target.BitLen() + 7) / 8
+	var mantissa uint32
+	if size <= 3 {
+		mantissa = uint32(target.Uint64()) << (8 * (3 - size))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(target, uint(8*(size-3))).Uint64())
+	}
+
+	// The top mantissa bit would read as a sign, move it into the next byte
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		size++
+	}
+	return uint32(size)<<24 | mantissa
+}
+
+// ExpandCompactTarget decodes a compact target, rejecting negative and oversized ones
+func ExpandCompactTarget(compact uint32) (*big.Int, error) {
+	size := int(compact >> 24)
+	mantissa := compact & 0x007fffff
+	if compact&0x00800000 != 0 {
+		return nil, fmt.Errorf("negative compact target %08x", compact)
+	}
+
+	target := big.NewInt(int64(mantissa))
+	if size <= 3 {
+		target.Rsh(target, uint(8*(3-size)))
+	} else {
+		target.Lsh(target, uint(8*(size-3)))
+	}
+	if target.Cmp(maxTarget) > 0 {
+		return nil, fmt.Errorf("compact target %08x exceeds 256 bits", compact)
+	}
+	return target, nil
+}
+
+// VerifyTargetPoW reports whether SHA-256(seed + nonce) is below target
+func VerifyTargetPoW(seed, nonce string, target *big.Int) bool {
+	hash := sha256.Sum256([]byte(seed + nonce))
+	return new(big.Int).SetBytes(hash[:]).Cmp(target) < 0
+}
+
+// VerifySHA256Solution checks a nonce for a SHA-256 challenge in either mode, against its
+// target when it has one and its leading zeros otherwise
+func VerifySHA256Solution(challenge *SecureChallenge, nonce string) bool {
+	if challenge.Target == "" {
+		return VerifyPoW(challenge.Seed, nonce, challenge.Difficulty)
+	}
+	target, err := challenge.TargetValue()
+	return err == nil && VerifyTargetPoW(challenge.Seed, nonce, target)
+}
+
+// SolveTargetChallenge counts nonces up from zero until one hashes below target
+func SolveTargetChallenge(seed string, target *big.Int) (string, error) {
+	return SolveTargetChallengeCtx(context.Background(), seed, target)
+}
+
+// SolveTargetChallengeCtx solves like SolveTargetChallenge until ctx is done, then returns
+// ctx.Err() and no nonce
+func SolveTargetChallengeCtx(ctx context.Context, seed string, target *big.Int) (string, error) {
+	if target.Sign() <= 0 {
+		return "", fmt.Errorf("target must be positive")
+	}
+	for nonce := 0; nonce <= 100000000; nonce++ {
+		if nonce%cancelCheckEvery == 0 && ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		nonceStr := strconv.Itoa(nonce)
+		if VerifyTargetPoW(seed, nonceStr, target) {
+			return nonceStr, nil
+		}
+	}
+	return "", fmt.Errorf("solution not found after %d attempts", 100000000)
+}
+
+// SetTarget switches the challenge to target mode. Difficulty becomes the whole number of
+// leading zeros the target implies, for clients and reports that only know difficulties.
+// The challenge must be signed afterwards.
+func (c *SecureChallenge) SetTarget(target *big.Int) error {
+	compact := CompactTarget(target)
+	encoded, err := ExpandCompactTarget(compact)
+	if err != nil {
+		return err
+	}
+	c.Target = fmt.Sprintf("%08x", compact)
+	c.Difficulty = min(max(int(TargetToDifficulty(encoded)), 1), 6)
+	return nil
+}
+
+// TargetValue returns the challenge's target, nil for leading-zero challenges
+func (c *SecureChallenge) TargetValue() (*big.Int, error) {
+	if c.Target == "" {
+		return nil, nil
+	}
+	compact, err := strconv.ParseUint(c.Target, 16, 32)
+	if err != nil || len(c.Target) != 8 {
+		return nil, fmt.Errorf("malformed compact target %q", c.Target)
+	}
+	return ExpandCompactTarget(uint32(compact))
+}
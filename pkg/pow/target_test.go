@@ -0,0 +1,135 @@
+package pow
+
+import (
+	"crypto/sha256"
+	"math"
+	"math/big"
+	"strconv"
+	"testing"
+)
+
+func TestVerifyTargetPoWAtBoundary(t *testing.T) {
+	seed, nonce := "0123456789abcdef", "42"
+	hash := sha256.Sum256([]byte(seed + nonce))
+	value := new(big.Int).SetBytes(hash[:])
+
+	// The hash must be strictly below the target
+	if VerifyTargetPoW(seed, nonce, value) {
+		t.Error("Expected a target equal to the hash to be missed")
+	}
+	if !VerifyTargetPoW(seed, nonce, new(big.Int).Add(value, big.NewInt(1))) {
+		t.Error("Expected a target one above the hash to be met")
+	}
+	if VerifyTargetPoW(seed, nonce, new(big.Int).Sub(value, big.NewInt(1))) {
+		t.Error("Expected a target one below the hash to be missed")
+	}
+}
+
+func TestWholeDifficultyTargetsMatchLeadingZeros(t *testing.T) {
+	for difficulty := 1; difficulty <= 6; difficulty++ {
+		target := DifficultyToTarget(float64(difficulty))
+		if want := new(big.Int).Lsh(big.NewInt(1), uint(256-4*difficulty)); target.Cmp(want) != 0 {
+			t.Fatalf("DifficultyToTarget(%d) = %x, want %x", difficulty, target, want)
+		}
+		if got := TargetToDifficulty(target); got != float64(difficulty) {
+			t.Errorf("TargetToDifficulty(DifficultyToTarget(%d)) = %v", difficulty, got)
+		}
+	}
+
+	// Both checks agree on every nonce
+	target := DifficultyToTarget(2)
+	for nonce := 0; nonce < 5000; nonce++ {
+		n := strconv.Itoa(nonce)
+		if VerifyPoW("seed", n, 2) != VerifyTargetPoW("seed", n, target) {
+			t.Fatalf("Leading zeros and target disagree on nonce %s", n)
+		}
+	}
+}
+
+func TestFractionalDifficultyFallsBetweenSteps(t *testing.T) {
+	lower, mid, upper := DifficultyToTarget(2), DifficultyToTarget(2.5), DifficultyToTarget(3)
+	if mid.Cmp(lower) >= 0 || mid.Cmp(upper) <= 0 {
+		t.Fatalf("Expected the 2.5 target between the 2 and 3 targets, got %x", mid)
+	}
+	if got := TargetToDifficulty(mid); math.Abs(got-2.5) > 1e-9 {
+		t.Errorf("TargetToDifficulty(DifficultyToTarget(2.5)) = %v", got)
+	}
+}
+
+func TestCompactTargetRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		target  *big.Int
+		compact uint32
+	}{
+		{DifficultyToTarget(1), 0x20100000},
+		{DifficultyToTarget(6), 0x1e010000},
+		{big.NewInt(0x7f), 0x017f0000},
+		{big.NewInt(0x80), 0x02008000}, // The sign bit moves into the next byte
+		{new(big.Int).Set(maxTarget), 0x21010000},
+	} {
+		if got := CompactTarget(tc.target); got != tc.compact {
+			t.Errorf("CompactTarget(%x) = %08x, want %08x", tc.target, got, tc.compact)
+		}
+		expanded, err := ExpandCompactTarget(tc.compact)
+		if err != nil || expanded.Cmp(tc.target) != 0 {
+			t.Errorf("ExpandCompactTarget(%08x) = %x (%v), want %x", tc.compact, expanded, err, tc.target)
+		}
+	}
+
+	// Precision beyond three bytes is dropped, never rounded up
+	precise := DifficultyToTarget(2.37)
+	expanded, _ := ExpandCompactTarget(CompactTarget(precise))
+	if expanded.Cmp(precise) > 0 {
+		t.Errorf("Compact form %x is easier than the target %x", expanded, precise)
+	}
+
+	for _, compact := range []uint32{0x01800000, 0x22010000} {
+		if _, err := ExpandCompactTarget(compact); err == nil {
+			t.Errorf("Expected compact target %08x to be rejected", compact)
+		}
+	}
+}
+
+func TestTargetChallengeSolvesAndSurvivesBinary(t *testing.T) {
+	challenge, err := newSecureChallenge(1, "sha256", "test-client", ChallengeSources{})
+	if err != nil {
+		t.Fatalf("newSecureChallenge failed: %v", err)
+	}
+	if err := challenge.SetTarget(DifficultyToTarget(1.5)); err != nil {
+		t.Fatalf("SetTarget failed: %v", err)
+	}
+	if challenge.Difficulty != 1 {
+		t.Errorf("Expected difficulty 1 for a 1.5 target, got %d", challenge.Difficulty)
+	}
+	if err := challenge.Sign(testSigningKey); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	nonce, err := SolveSecureChallenge(challenge, testSigningKey)
+	if err != nil {
+		t.Fatalf("SolveSecureChallenge failed: %v", err)
+	}
+	if err := VerifySecurePoW(challenge, nonce, testSigningKey); err != nil {
+		t.Errorf("Expected the target solution to verify: %v", err)
+	}
+
+	data, err := challenge.ToBinary()
+	if err != nil {
+		t.Fatalf("ToBinary failed: %v", err)
+	}
+	decoded, err := SecureChallengeFromBinary(data, "test-client")
+	if err != nil {
+		t.Fatalf("SecureChallengeFromBinary failed: %v", err)
+	}
+	if decoded.Target != challenge.Target {
+		t.Errorf("Expected target %s after the binary round trip, got %q", challenge.Target, decoded.Target)
+	}
+
+	// Argon2 challenges can't carry a target
+	argon2Challenge, _ := newSecureChallenge(1, "argon2", "test-client", ChallengeSources{})
+	argon2Challenge.SetTarget(DifficultyToTarget(1))
+	argon2Challenge.Sign(testSigningKey)
+	if err := argon2Challenge.IsValid(testSigningKey); err == nil {
+		t.Error("Expected an Argon2 challenge with a target to be invalid")
+	}
+}
@@ -1,18 +1,26 @@
 package pow
 
 import (
+	"context"
 	"fmt"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// validationStages names every stage a validation can fail at
+var validationStages = []string{"rate_limit", "format", "timestamp", "signature", "pow", "replay"}
+
 // ValidationPipeline provides fast, multi-stage validation of proof-of-work solutions
 type ValidationPipeline struct {
 	signingKey []byte
+	keyManager KeyManager // Verifies with both current and previous keys when set, instead of signingKey
+	replay     NonceStore // Challenges already redeemed, nil skips the replay stage
 	
 	// Caching for performance with proper synchronization
-	hmacCache      sync.Map // map[string]bool
-	challengeCache sync.Map // map[string]*SecureChallenge
+	hmacCache      *lruCache // Challenge IDs whose signature verified, at most maxCacheSize
+	challengeCache *lruCache // Issued challenges by nonce, at most maxChallengeCacheSize
 	
 	// Rate limiting state with synchronization
 	rateLimitMu  sync.RWMutex
@@ -22,6 +30,39 @@ type ValidationPipeline struct {
 	maxCacheSize    int
 	rateLimitWindow time.Duration
 	maxRequestsPerWindow int
+	batchWorkers    int // Solutions of a batch verified at once
+
+	// Counters reported by GetMetrics
+	stats validationStats
+}
+
+// validationStats counts validations as they finish, safe for concurrent batch workers
+type validationStats struct {
+	total         atomic.Int64
+	successful    atomic.Int64
+	failed        atomic.Int64
+	rateLimitHits atomic.Int64
+	totalDuration atomic.Int64 // Nanoseconds, for the running average
+	cacheHits     atomic.Int64
+	cacheMisses   atomic.Int64
+	stageFailures map[string]*atomic.Int64 // Fixed to validationStages, only the counters change
+}
+
+// record counts a finished validation
+func (s *validationStats) record(result *ValidationResult) {
+	s.total.Add(1)
+	s.totalDuration.Add(int64(result.Duration))
+	if result.Valid {
+		s.successful.Add(1)
+		return
+	}
+	s.failed.Add(1)
+	if result.Stage == "rate_limit" {
+		s.rateLimitHits.Add(1)
+	}
+	if counter, ok := s.stageFailures[result.Stage]; ok {
+		counter.Add(1)
+	}
 }
 
 // RateLimitState tracks rate limiting per client
@@ -61,13 +102,30 @@ func (e *ValidationError) Error() string {
 
 // NewValidationPipeline creates a new validation pipeline
 func NewValidationPipeline(signingKey []byte) *ValidationPipeline {
-	return &ValidationPipeline{
+	v := &ValidationPipeline{
 		signingKey:           signingKey,
 		rateLimitMap:         make(map[string]*RateLimitState),
 		maxCacheSize:         1000,
 		rateLimitWindow:      time.Minute,
 		maxRequestsPerWindow: 60, // 1 request per second average
+		batchWorkers:         runtime.NumCPU(),
 	}
+	v.hmacCache = newLRUCache(v.maxCacheSize)
+	v.challengeCache = newLRUCache(maxChallengeCacheSize)
+	v.stats.stageFailures = make(map[string]*atomic.Int64, len(validationStages))
+	for _, stage := range validationStages {
+		v.stats.stageFailures[stage] = new(atomic.Int64)
+	}
+	return v
+}
+
+// NewValidationPipelineWithKeyManager creates a pipeline that accepts challenges signed by
+// either of keyManager's current and previous keys, so solutions in flight across a key
+// rotation still verify
+func NewValidationPipelineWithKeyManager(keyManager KeyManager) *ValidationPipeline {
+	v := NewValidationPipeline(nil)
+	v.keyManager = keyManager
+	return v
 }
 
 // Validate performs fast multi-stage validation of a solution
@@ -75,16 +133,25 @@ func (v *ValidationPipeline) Validate(solution *Solution) *ValidationResult {
 	start := time.Now()
 	
 	// Step 0: Rate limiting check (fail-fastest)
+	var result *ValidationResult
 	if err := v.checkRateLimit(solution.ClientID); err != nil {
-		return &ValidationResult{
+		result = &ValidationResult{
 			Valid:    false,
 			Error:    &ValidationError{Stage: "rate_limit", Message: err.Error()},
 			Stage:    "rate_limit",
 			Duration: time.Since(start),
 			ClientID: solution.ClientID,
 		}
+	} else {
+		result = v.validateStages(solution, start)
 	}
-	
+
+	v.stats.record(result)
+	return result
+}
+
+// validateStages runs every stage after rate limiting, which the caller has accounted for
+func (v *ValidationPipeline) validateStages(solution *Solution, start time.Time) *ValidationResult {
 	// Step 1: Format validation (fail-fast)
 	if err := v.validateFormat(solution); err != nil {
 		return &ValidationResult{
@@ -128,6 +195,18 @@ func (v *ValidationPipeline) Validate(solution *Solution) *ValidationResult {
 			ClientID: solution.ClientID,
 		}
 	}
+
+	// Step 5: Replay check. Only a verified solution claims its challenge, a wrong nonce
+	// must not use it up for the client still solving it.
+	if v.replay != nil && !v.replay.Redeem(context.Background(), solution.Challenge) {
+		return &ValidationResult{
+			Valid:    false,
+			Error:    &ValidationError{Stage: "replay", Message: "challenge already redeemed"},
+			Stage:    "replay",
+			Duration: time.Since(start),
+			ClientID: solution.ClientID,
+		}
+	}
 	
 	return &ValidationResult{
 		Valid:    true,
@@ -139,34 +218,37 @@ func (v *ValidationPipeline) Validate(solution *Solution) *ValidationResult {
 
 // checkRateLimit implements per-client rate limiting
 func (v *ValidationPipeline) checkRateLimit(clientID string) error {
+	return v.reserveRateLimit(clientID, 1)
+}
+
+// reserveRateLimit counts n requests against the client's window at once, all or none
+func (v *ValidationPipeline) reserveRateLimit(clientID string, n int) error {
 	now := time.Now()
 	
 	v.rateLimitMu.Lock()
 	defer v.rateLimitMu.Unlock()
 	
 	state, exists := v.rateLimitMap[clientID]
-	if !exists {
+	if !exists || now.Sub(state.windowStart) > v.rateLimitWindow {
+		// First requests of a new window
+		if n > v.maxRequestsPerWindow {
+			return fmt.Errorf("rate limit exceeded: %d requests exceed %d per %v",
+				n, v.maxRequestsPerWindow, v.rateLimitWindow)
+		}
 		v.rateLimitMap[clientID] = &RateLimitState{
-			requests:    1,
+			requests:    n,
 			windowStart: now,
 		}
 		return nil
 	}
 	
-	// Check if we need to reset the window
-	if now.Sub(state.windowStart) > v.rateLimitWindow {
-		state.requests = 1
-		state.windowStart = now
-		return nil
-	}
-	
-	// Check if we've exceeded the limit
-	if state.requests >= v.maxRequestsPerWindow {
+	// Check if we'd exceed the limit
+	if state.requests+n > v.maxRequestsPerWindow {
 		return fmt.Errorf("rate limit exceeded: %d requests in %v", 
 			state.requests, v.rateLimitWindow)
 	}
 	
-	state.requests++
+	state.requests += n
 	return nil
 }
 
@@ -211,20 +293,21 @@ func (v *ValidationPipeline) validateFormat(solution *Solution) error {
 // validateTimestamp checks if the challenge is within valid time bounds
 func (v *ValidationPipeline) validateTimestamp(solution *Solution) error {
 	now := time.Now().UnixMicro()
+	skew := ClockSkew().Microseconds()
 	
-	// Check if challenge has expired
-	if solution.Challenge.ExpiresAt < now {
+	// Check if challenge has expired, the issuer's clock may be behind
+	if solution.Challenge.IsExpired() {
 		return fmt.Errorf("challenge has expired")
 	}
 	
-	// Check if challenge is from the future (allow 1 minute clock skew)
-	maxFuture := now + (1 * time.Minute).Microseconds()
+	// Check if challenge is from the future, the issuer's clock may be ahead
+	maxFuture := now + skew
 	if solution.Challenge.Timestamp > maxFuture {
 		return fmt.Errorf("challenge timestamp is too far in the future")
 	}
 	
 	// Check if challenge is too old (beyond reasonable solve time)
-	minAge := now - (10 * time.Minute).Microseconds()
+	minAge := now - (10 * time.Minute).Microseconds() - skew
 	if solution.Challenge.Timestamp < minAge {
 		return fmt.Errorf("challenge timestamp is too old")
 	}
@@ -237,22 +320,26 @@ func (v *ValidationPipeline) verifySignature(solution *Solution) error {
 	challengeID := solution.ChallengeID
 	
 	// Check cache first
-	if cachedValue, exists := v.hmacCache.Load(challengeID); exists {
-		if cached, ok := cachedValue.(bool); ok {
-			if !cached {
-				return fmt.Errorf("signature verification failed (cached)")
-			}
-			return nil
-		}
+	if v.hmacCache.contains(challengeID) {
+		v.stats.cacheHits.Add(1)
+		return nil
 	}
+	v.stats.cacheMisses.Add(1)
 	
 	// Verify signature using constant-time comparison
-	err := solution.Challenge.Verify(v.signingKey)
+	var err error
+	if v.keyManager != nil {
+		err = solution.Challenge.VerifyWithKeyManager(v.keyManager)
+	} else {
+		err = solution.Challenge.Verify(v.signingKey)
+	}
 	
-	// Cache the result
-	// Note: sync.Map handles concurrent access, so we don't need explicit size management
-	// For production, consider using a proper LRU cache
-	v.hmacCache.Store(challengeID, err == nil)
+	// Only successes are cached: anyone can send a forged copy of a challenge under its
+	// nonce, which must not get the genuine one rejected. A cached success is safe since
+	// verifyPoW checks the signature of the submitted copy again.
+	if err == nil {
+		v.hmacCache.add(challengeID)
+	}
 	
 	if err != nil {
 		return fmt.Errorf("signature verification failed: %w", err)
@@ -263,20 +350,16 @@ func (v *ValidationPipeline) verifySignature(solution *Solution) error {
 
 // verifyPoW verifies the proof-of-work solution
 func (v *ValidationPipeline) verifyPoW(solution *Solution) error {
+	if v.keyManager != nil {
+		return VerifySecurePoWWithKeyManager(solution.Challenge, solution.Nonce, v.keyManager)
+	}
 	return VerifySecurePoW(solution.Challenge, solution.Nonce, v.signingKey)
 }
 
 // ClearCache clears the validation caches
 func (v *ValidationPipeline) ClearCache() {
-	// Clear sync.Maps by ranging over and deleting all entries
-	v.hmacCache.Range(func(key, value interface{}) bool {
-		v.hmacCache.Delete(key)
-		return true
-	})
-	v.challengeCache.Range(func(key, value interface{}) bool {
-		v.challengeCache.Delete(key)
-		return true
-	})
+	v.hmacCache.clear()
+	v.challengeCache.clear()
 	
 	// Clear rate limit map with proper locking
 	v.rateLimitMu.Lock()
@@ -286,28 +369,64 @@ func (v *ValidationPipeline) ClearCache() {
 
 // GetCacheStats returns statistics about the validation cache
 func (v *ValidationPipeline) GetCacheStats() map[string]int {
-	// Count entries in sync.Maps
-	hmacCount := 0
-	v.hmacCache.Range(func(key, value interface{}) bool {
-		hmacCount++
-		return true
-	})
-	
-	challengeCount := 0
-	v.challengeCache.Range(func(key, value interface{}) bool {
-		challengeCount++
-		return true
-	})
+	hmacCount, hmacEvictions := v.hmacCache.stats()
+	challengeCount, challengeEvictions := v.challengeCache.stats()
 	
 	v.rateLimitMu.RLock()
 	rateLimitCount := len(v.rateLimitMap)
 	v.rateLimitMu.RUnlock()
 	
 	return map[string]int{
-		"hmac_cache_size":      hmacCount,
-		"challenge_cache_size": challengeCount,
-		"rate_limit_entries":   rateLimitCount,
+		"hmac_cache_size":           hmacCount,
+		"hmac_cache_evictions":      hmacEvictions,
+		"challenge_cache_size":      challengeCount,
+		"challenge_cache_evictions": challengeEvictions,
+		"rate_limit_entries":        rateLimitCount,
+	}
+}
+
+// maxChallengeCacheSize is how many issued challenges RememberChallenge keeps at most. The
+// least recently used are dropped first, their solutions must then carry the challenge.
+const maxChallengeCacheSize = 10000
+
+// RememberChallenge keeps an issued challenge until it expires, so a solution can name it
+// by its nonce instead of sending it back. Expired challenges are dropped by the cleanup
+// routine.
+func (v *ValidationPipeline) RememberChallenge(challenge *SecureChallenge) {
+	v.challengeCache.put(challenge.Nonce, challenge)
+}
+
+// LookupChallenge returns a challenge kept by RememberChallenge that hasn't expired
+func (v *ValidationPipeline) LookupChallenge(challengeID string) (*SecureChallenge, bool) {
+	value, ok := v.challengeCache.get(challengeID)
+	if !ok {
+		return nil, false
+	}
+	challenge, ok := value.(*SecureChallenge)
+	if !ok || challenge.IsExpired() {
+		return nil, false
 	}
+	return challenge, true
+}
+
+// cleanupExpiredChallenges drops remembered challenges that have expired
+func (v *ValidationPipeline) cleanupExpiredChallenges() {
+	v.challengeCache.removeIf(func(value any) bool {
+		challenge, ok := value.(*SecureChallenge)
+		return !ok || challenge.IsExpired()
+	})
+}
+
+// SetBatchWorkers sets how many solutions of a batch are verified at once (default one per CPU)
+func (v *ValidationPipeline) SetBatchWorkers(workers int) {
+	v.batchWorkers = max(workers, 1)
+}
+
+// SetReplayStore makes every accepted solution redeem its challenge in store, so the same
+// challenge fails at the replay stage the second time, also within one batch. Share the
+// store with other verifiers of the same challenges.
+func (v *ValidationPipeline) SetReplayStore(store NonceStore) {
+	v.replay = store
 }
 
 // SetRateLimitConfig updates the rate limiting configuration
@@ -317,6 +436,7 @@ func (v *ValidationPipeline) SetRateLimitConfig(window time.Duration, maxRequest
 }
 
 // StartCleanupRoutine starts a background goroutine to clean up expired rate limit entries
+// and remembered challenges. Close the returned channel to stop it.
 func (v *ValidationPipeline) StartCleanupRoutine() chan struct{} {
 	stop := make(chan struct{})
 	
@@ -328,6 +448,7 @@ func (v *ValidationPipeline) StartCleanupRoutine() chan struct{} {
 			select {
 			case <-ticker.C:
 				v.cleanupExpiredRateLimits()
+				v.cleanupExpiredChallenges()
 			case <-stop:
 				return
 			}
@@ -352,54 +473,85 @@ func (v *ValidationPipeline) cleanupExpiredRateLimits() {
 }
 
 
-// BatchValidate validates multiple solutions concurrently
+// BatchValidate validates multiple solutions on a bounded set of workers. Each solution
+// counts as one request against its client's rate limit, reserved for the whole batch up
+// front: a client whose batch doesn't fit in its window has all of its solutions rejected.
 func (v *ValidationPipeline) BatchValidate(solutions []*Solution) []*ValidationResult {
 	results := make([]*ValidationResult, len(solutions))
-	
-	// Simple parallel validation (could be optimized with worker pools)
-	resultChan := make(chan struct {
-		index  int
-		result *ValidationResult
-	}, len(solutions))
-	
-	for i, solution := range solutions {
-		go func(idx int, sol *Solution) {
-			result := v.Validate(sol)
-			resultChan <- struct {
-				index  int
-				result *ValidationResult
-			}{index: idx, result: result}
-		}(i, solution)
+	start := time.Now()
+
+	perClient := make(map[string]int)
+	for _, solution := range solutions {
+		perClient[solution.ClientID]++
 	}
-	
-	// Collect results
-	for range len(solutions) {
-		res := <-resultChan
-		results[res.index] = res.result
+	limited := make(map[string]error)
+	for clientID, n := range perClient {
+		if err := v.reserveRateLimit(clientID, n); err != nil {
+			limited[clientID] = err
+		}
 	}
-	
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(v.batchWorkers, len(solutions)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				solution := solutions[i]
+				if err, ok := limited[solution.ClientID]; ok {
+					results[i] = &ValidationResult{
+						Valid:    false,
+						Error:    &ValidationError{Stage: "rate_limit", Message: err.Error()},
+						Stage:    "rate_limit",
+						Duration: time.Since(start),
+						ClientID: solution.ClientID,
+					}
+				} else {
+					results[i] = v.validateStages(solution, time.Now())
+				}
+				v.stats.record(results[i])
+			}
+		}()
+	}
+	for i := range solutions {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
 	return results
 }
 
 // ValidationMetrics provides metrics about validation performance
 type ValidationMetrics struct {
-	TotalValidations     int64         `json:"total_validations"`
-	SuccessfulValidations int64         `json:"successful_validations"`
-	FailedValidations    int64         `json:"failed_validations"`
-	AverageValidationTime time.Duration `json:"average_validation_time"`
-	CacheHitRate         float64       `json:"cache_hit_rate"`
-	RateLimitHits        int64         `json:"rate_limit_hits"`
+	TotalValidations      int64            `json:"total_validations"`
+	SuccessfulValidations int64            `json:"successful_validations"`
+	FailedValidations     int64            `json:"failed_validations"`
+	StageFailures         map[string]int64 `json:"stage_failures"` // Failed validations by the stage they failed at
+	AverageValidationTime time.Duration    `json:"average_validation_time"`
+	CacheHitRate          float64          `json:"cache_hit_rate"` // Signature checks answered from the cache
+	RateLimitHits         int64            `json:"rate_limit_hits"`
 }
 
-// GetMetrics returns validation metrics (basic implementation)
+// GetMetrics returns the validation counters since the pipeline was created
 func (v *ValidationPipeline) GetMetrics() *ValidationMetrics {
-	// This would be implemented with proper metrics collection
-	return &ValidationMetrics{
-		TotalValidations:     0,
-		SuccessfulValidations: 0,
-		FailedValidations:    0,
-		AverageValidationTime: 0,
-		CacheHitRate:         0.0,
-		RateLimitHits:        0,
-	}
-}
\ No newline at end of file
+	m := &ValidationMetrics{
+		TotalValidations:      v.stats.total.Load(),
+		SuccessfulValidations: v.stats.successful.Load(),
+		FailedValidations:     v.stats.failed.Load(),
+		StageFailures:         make(map[string]int64, len(v.stats.stageFailures)),
+		RateLimitHits:         v.stats.rateLimitHits.Load(),
+	}
+	for stage, counter := range v.stats.stageFailures {
+		m.StageFailures[stage] = counter.Load()
+	}
+	if m.TotalValidations > 0 {
+		m.AverageValidationTime = time.Duration(v.stats.totalDuration.Load() / m.TotalValidations)
+	}
+	hits, misses := v.stats.cacheHits.Load(), v.stats.cacheMisses.Load()
+	if hits+misses > 0 {
+		m.CacheHitRate = float64(hits) / float64(hits+misses)
+	}
+	return m
+}
@@ -0,0 +1,97 @@
+package pow
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidationMetricsCountEveryOutcome(t *testing.T) {
+	pipeline := NewValidationPipeline(testSigningKey)
+	pipeline.SetRateLimitConfig(time.Minute, 5)
+
+	valid := solvedSolution(t, "metrics-client")
+	badNonce := solvedSolution(t, "metrics-client")
+	badNonce.Nonce = unsolvedNonce(badNonce.Challenge)
+	forged := solvedSolution(t, "metrics-client")
+	forged.Challenge.Difficulty = 2
+	unformatted := solvedSolution(t, "metrics-client")
+	unformatted.Nonce = ""
+
+	results := []*ValidationResult{
+		pipeline.Validate(valid),
+		pipeline.Validate(valid), // Signature answered from the cache
+		pipeline.Validate(badNonce),
+		pipeline.Validate(forged),
+		pipeline.Validate(unformatted),
+		pipeline.Validate(valid), // Sixth request of the window
+	}
+	wantStages := []string{"complete", "complete", "pow", "signature", "format", "rate_limit"}
+	for i, result := range results {
+		if result.Stage != wantStages[i] {
+			t.Fatalf("Expected validation %d to end at %s, got %s: %v", i, wantStages[i], result.Stage, result.Error)
+		}
+	}
+
+	m := pipeline.GetMetrics()
+	if m.TotalValidations != 6 || m.SuccessfulValidations != 2 || m.FailedValidations != 4 {
+		t.Errorf("Expected 6 validations, 2 successful and 4 failed, got %d, %d and %d",
+			m.TotalValidations, m.SuccessfulValidations, m.FailedValidations)
+	}
+	wantFailures := map[string]int64{"rate_limit": 1, "format": 1, "timestamp": 0, "signature": 1, "pow": 1}
+	for stage, want := range wantFailures {
+		if m.StageFailures[stage] != want {
+			t.Errorf("Expected %d failures at %s, got %d", want, stage, m.StageFailures[stage])
+		}
+	}
+	if m.RateLimitHits != 1 {
+		t.Errorf("Expected 1 rate limit hit, got %d", m.RateLimitHits)
+	}
+	if m.AverageValidationTime <= 0 {
+		t.Errorf("Expected a positive average validation time, got %v", m.AverageValidationTime)
+	}
+
+	// Four solutions reached the signature stage, the second valid one from the cache
+	if m.CacheHitRate != 0.25 {
+		t.Errorf("Expected a cache hit rate of 0.25, got %v", m.CacheHitRate)
+	}
+}
+
+func TestSecondSubmissionOfAChallengeFailsAtReplay(t *testing.T) {
+	pipeline := NewValidationPipeline(testSigningKey)
+	pipeline.SetReplayStore(NewMemoryNonceStore())
+
+	solution := solvedSolution(t, "replay-client")
+	wrongNonce := *solution
+	wrongNonce.Nonce = unsolvedNonce(solution.Challenge)
+
+	// A wrong nonce doesn't use the challenge up
+	if result := pipeline.Validate(&wrongNonce); result.Stage != "pow" {
+		t.Fatalf("Expected the wrong nonce to fail at pow, got %s: %v", result.Stage, result.Error)
+	}
+	if result := pipeline.Validate(solution); !result.Valid {
+		t.Fatalf("Expected the first submission to be valid, failed at %s: %v", result.Stage, result.Error)
+	}
+
+	result := pipeline.Validate(solution)
+	if result.Valid || result.Stage != "replay" {
+		t.Fatalf("Expected the second submission to fail at replay, got valid=%v at %s", result.Valid, result.Stage)
+	}
+	if result.Error == nil || !strings.Contains(result.Error.Error(), "already redeemed") {
+		t.Errorf("Expected a replay error, got %v", result.Error)
+	}
+	if failures := pipeline.GetMetrics().StageFailures["replay"]; failures != 1 {
+		t.Errorf("Expected 1 replay failure counted, got %d", failures)
+	}
+}
+
+// unsolvedNonce returns a nonce that doesn't solve challenge. A fixed string would solve
+// a difficulty 1 challenge one time in sixteen.
+func unsolvedNonce(challenge *SecureChallenge) string {
+	for n := 0; ; n++ {
+		if nonce := "wrong-" + strconv.Itoa(n); VerifySecurePoW(challenge, nonce, testSigningKey) != nil {
+			return nonce
+		}
+	}
+}
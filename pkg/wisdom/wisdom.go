@@ -1,7 +1,11 @@
 package wisdom
 
 import (
+	"bufio"
+	"fmt"
 	"math/rand"
+	"os"
+	"strings"
 	"sync"
 	"time"
 )
@@ -38,6 +42,7 @@ type QuoteProvider struct {
 	quotes []string
 	mu     sync.RWMutex
 	rng    *rand.Rand
+	path   string // Quotes file, empty when using the built-in quotes
 }
 
 func NewQuoteProvider() *QuoteProvider {
@@ -72,3 +77,58 @@ func (qp *QuoteProvider) GetQuoteCount() int {
 
 	return len(qp.quotes)
 }
+
+// LoadFile replaces the quotes with those in path, one per line.
+// Blank lines and lines starting with # are skipped. Later Reload calls re-read the same file.
+func (qp *QuoteProvider) LoadFile(path string) error {
+	loaded, err := readQuotesFile(path)
+	if err != nil {
+		return err
+	}
+
+	qp.mu.Lock()
+	defer qp.mu.Unlock()
+
+	qp.quotes = loaded
+	qp.path = path
+	return nil
+}
+
+// Reload re-reads the quotes file, the current quotes are kept if it can't be read.
+// Providers using the built-in quotes have nothing to reload.
+func (qp *QuoteProvider) Reload() error {
+	qp.mu.RLock()
+	path := qp.path
+	qp.mu.RUnlock()
+
+	if path == "" {
+		return nil
+	}
+	return qp.LoadFile(path)
+}
+
+func readQuotesFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open quotes file: %w", err)
+	}
+	defer f.Close()
+
+	var loaded []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		loaded = append(loaded, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read quotes file: %w", err)
+	}
+	if len(loaded) == 0 {
+		return nil, fmt.Errorf("quotes file %s has no quotes", path)
+	}
+
+	return loaded, nil
+}
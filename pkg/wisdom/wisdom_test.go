@@ -1,6 +1,8 @@
 package wisdom
 
 import (
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 )
@@ -92,3 +94,39 @@ func TestConcurrentAccess(t *testing.T) {
 		t.Errorf("Expected %d quotes after concurrent operations, got %d", expectedCount, finalCount)
 	}
 }
+
+func TestLoadFileAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.txt")
+	if err := os.WriteFile(path, []byte("# comment\nFirst quote\n\nSecond quote\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	qp := NewQuoteProvider()
+	if err := qp.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if qp.GetQuoteCount() != 2 {
+		t.Errorf("Expected 2 quotes, got %d", qp.GetQuoteCount())
+	}
+
+	if err := os.WriteFile(path, []byte("Only quote\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := qp.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if qp.GetQuoteCount() != 1 || qp.GetRandomQuote() != "Only quote" {
+		t.Errorf("Expected reload to pick up the new file, got %d quotes", qp.GetQuoteCount())
+	}
+
+	// A broken file keeps the current quotes
+	if err := os.WriteFile(path, []byte("\n# nothing\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := qp.Reload(); err == nil {
+		t.Error("Expected reload of an empty file to fail")
+	}
+	if qp.GetQuoteCount() != 1 {
+		t.Errorf("Expected the previous quotes to be kept, got %d", qp.GetQuoteCount())
+	}
+}